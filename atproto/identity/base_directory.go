@@ -15,7 +15,9 @@ import (
 type BaseDirectory struct {
 	// if non-empty, this string should have URL method, hostname, and optional port; it should not have a path or trailing slash
 	PLCURL string
-	// If not nil, this limiter will be used to rate-limit requests to the PLCURL
+	// optional additional PLC directory URLs (eg, mirrors), in the same format as PLCURL. if a request to PLCURL fails (network error, or a non-404 error status), these are tried in order
+	PLCFallbackURLs []string
+	// If not nil, this limiter will be used to rate-limit requests to the PLCURL (and any fallbacks; each attempt counts against the same limit)
 	PLCLimiter *rate.Limiter
 	// If not nil, this function will be called inline with DID Web lookups, and can be used to limit the number of requests to a given hostname
 	DIDWebLimitFunc func(ctx context.Context, hostname string) error
@@ -29,8 +31,19 @@ type BaseDirectory struct {
 	SkipDNSDomainSuffixes []string
 	// set of fallback DNS servers (eg, domain registrars) to try as a fallback. each entry should be "ip:port", eg "8.8.8.8:53"
 	FallbackDNSServers []string
+	// order in which handle resolution methods are attempted (HandleResolutionDNS, HandleResolutionHTTP). all methods are tried before failing. if empty, DefaultHandleResolutionOrder is used
+	HandleResolutionOrder []string
 }
 
+const (
+	// DNS TXT record resolution (`_atproto.<handle>`)
+	HandleResolutionDNS = "dns"
+	// HTTPS well-known resolution (`https://<handle>/.well-known/atproto-did`)
+	HandleResolutionHTTP = "http"
+)
+
+var DefaultHandleResolutionOrder = []string{HandleResolutionDNS, HandleResolutionHTTP}
+
 var _ Directory = (*BaseDirectory)(nil)
 
 func (d *BaseDirectory) LookupHandle(ctx context.Context, h syntax.Handle) (*Identity, error) {
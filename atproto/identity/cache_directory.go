@@ -33,9 +33,24 @@ type IdentityEntry struct {
 	Err      error
 }
 
+// An in-flight lookup, which concurrent requests for the same identifier wait on. The entry is only read after done is closed.
+//
+// The result is passed directly to waiters, instead of via the cache, because the entry may already have been evicted by the time they read it (if the cache is small and busy).
+type pendingHandleLookup struct {
+	done  chan struct{}
+	entry HandleEntry
+}
+
+type pendingDIDLookup struct {
+	done  chan struct{}
+	entry IdentityEntry
+}
+
 var _ Directory = (*CacheDirectory)(nil)
 
 // Capacity of zero means unlimited size. Similarly, ttl of zero means unlimited duration.
+//
+// Handles and identities are each held in a separate LRU cache of this capacity: when full, the least-recently-used entry is evicted. All methods are safe for concurrent use.
 func NewCacheDirectory(inner Directory, capacity int, hitTTL, errTTL, invalidHandleTTL time.Duration) CacheDirectory {
 	return CacheDirectory{
 		ErrTTL:           errTTL,
@@ -98,24 +113,23 @@ func (d *CacheDirectory) ResolveHandle(ctx context.Context, h syntax.Handle) (sy
 	entry, ok := d.handleCache.Get(h)
 	if ok && !d.IsHandleStale(&entry) {
 		handleCacheHits.Inc()
+		if entry.Err != nil {
+			handleCacheNegativeHits.Inc()
+		}
 		return entry.DID, entry.Err
 	}
 	handleCacheMisses.Inc()
 
 	// Coalesce multiple requests for the same Handle
-	res := make(chan struct{})
+	res := &pendingHandleLookup{done: make(chan struct{})}
 	val, loaded := d.handleLookupChans.LoadOrStore(h.String(), res)
 	if loaded {
 		handleRequestsCoalesced.Inc()
 		// Wait for the result from the pending request
+		pending := val.(*pendingHandleLookup)
 		select {
-		case <-val.(chan struct{}):
-			// The result should now be in the cache
-			entry, ok := d.handleCache.Get(h)
-			if ok && !d.IsHandleStale(&entry) {
-				return entry.DID, entry.Err
-			}
-			return "", fmt.Errorf("identity not found in cache after coalesce returned")
+		case <-pending.done:
+			return pending.entry.DID, pending.entry.Err
 		case <-ctx.Done():
 			return "", ctx.Err()
 		}
@@ -126,8 +140,9 @@ func (d *CacheDirectory) ResolveHandle(ctx context.Context, h syntax.Handle) (sy
 
 	// Cleanup the coalesce map and close the results channel
 	d.handleLookupChans.Delete(h.String())
-	// Callers waiting will now get the result from the cache
-	close(res)
+	// Callers waiting will now get the result
+	res.entry = newEntry
+	close(res.done)
 
 	if newEntry.Err != nil {
 		return "", newEntry.Err
@@ -172,24 +187,23 @@ func (d *CacheDirectory) LookupDIDWithCacheState(ctx context.Context, did syntax
 	entry, ok := d.identityCache.Get(did)
 	if ok && !d.IsIdentityStale(&entry) {
 		identityCacheHits.Inc()
+		if entry.Err != nil {
+			identityCacheNegativeHits.Inc()
+		}
 		return entry.Identity, true, entry.Err
 	}
 	identityCacheMisses.Inc()
 
 	// Coalesce multiple requests for the same DID
-	res := make(chan struct{})
+	res := &pendingDIDLookup{done: make(chan struct{})}
 	val, loaded := d.didLookupChans.LoadOrStore(did.String(), res)
 	if loaded {
 		identityRequestsCoalesced.Inc()
 		// Wait for the result from the pending request
+		pending := val.(*pendingDIDLookup)
 		select {
-		case <-val.(chan struct{}):
-			// The result should now be in the cache
-			entry, ok := d.identityCache.Get(did)
-			if ok && !d.IsIdentityStale(&entry) {
-				return entry.Identity, false, entry.Err
-			}
-			return nil, false, fmt.Errorf("identity not found in cache after coalesce returned")
+		case <-pending.done:
+			return pending.entry.Identity, false, pending.entry.Err
 		case <-ctx.Done():
 			return nil, false, ctx.Err()
 		}
@@ -200,8 +214,9 @@ func (d *CacheDirectory) LookupDIDWithCacheState(ctx context.Context, did syntax
 
 	// Cleanup the coalesce map and close the results channel
 	d.didLookupChans.Delete(did.String())
-	// Callers waiting will now get the result from the cache
-	close(res)
+	// Callers waiting will now get the result
+	res.entry = newEntry
+	close(res.done)
 
 	if newEntry.Err != nil {
 		return nil, false, newEntry.Err
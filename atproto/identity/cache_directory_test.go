@@ -0,0 +1,141 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheDirectoryDIDWebErrors(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	errDenied := errors.New("did:web denied")
+	calls := 0
+	base := BaseDirectory{
+		DIDWebLimitFunc: func(ctx context.Context, hostname string) error {
+			calls++
+			return errDenied
+		},
+	}
+	dir := NewCacheDirectory(&base, 100, time.Hour, time.Hour, time.Hour)
+
+	did := syntax.DID("did:web:example.com")
+	for i := 0; i < 3; i++ {
+		_, err := dir.LookupDID(ctx, did)
+		assert.ErrorIs(err, errDenied)
+	}
+	// failure is cached as a negative result
+	assert.Equal(1, calls)
+}
+
+// wraps a directory, counting lookups. safe for concurrent use (as long as the inner directory isn't modified)
+type countingDirectory struct {
+	MockDirectory
+	didLookups atomic.Int64
+}
+
+func (d *countingDirectory) LookupDID(ctx context.Context, did syntax.DID) (*Identity, error) {
+	d.didLookups.Add(1)
+	// slow enough that concurrent lookups of the same DID get coalesced
+	time.Sleep(time.Millisecond)
+	return d.MockDirectory.LookupDID(ctx, did)
+}
+
+func (d *countingDirectory) LookupHandle(ctx context.Context, h syntax.Handle) (*Identity, error) {
+	time.Sleep(time.Millisecond)
+	return d.MockDirectory.LookupHandle(ctx, h)
+}
+
+func testNumberedIdentity(i int) Identity {
+	handle := fmt.Sprintf("h%d.example.com", i)
+	return Identity{
+		DID:         syntax.DID(fmt.Sprintf("did:plc:abc%d", i)),
+		Handle:      syntax.Handle(handle),
+		AlsoKnownAs: []string{"at://" + handle},
+	}
+}
+
+func TestCacheDirectoryLRU(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	inner := countingDirectory{MockDirectory: NewMockDirectory()}
+	for i := 0; i < 4; i++ {
+		inner.Insert(testNumberedIdentity(i))
+	}
+	dir := NewCacheDirectory(&inner, 3, time.Hour, time.Hour, time.Hour)
+
+	lookup := func(i int) {
+		_, err := dir.LookupDID(ctx, syntax.DID(fmt.Sprintf("did:plc:abc%d", i)))
+		assert.NoError(err)
+	}
+	lookup(0)
+	lookup(1)
+	lookup(2)
+	// touch 0, so that 1 is the least-recently-used
+	lookup(0)
+	assert.Equal(int64(3), inner.didLookups.Load())
+	// evicts 1
+	lookup(3)
+	lookup(0)
+	lookup(2)
+	assert.Equal(int64(4), inner.didLookups.Load())
+	lookup(1)
+	assert.Equal(int64(5), inner.didLookups.Load())
+}
+
+// Hammers a small cache from many goroutines, with more identities than fit, so that entries are evicted while lookups for them are in flight. Run with -race.
+func TestCacheDirectoryConcurrent(t *testing.T) {
+	ctx := context.Background()
+
+	const numIdents = 200
+	inner := countingDirectory{MockDirectory: NewMockDirectory()}
+	for i := 0; i < numIdents; i++ {
+		inner.Insert(testNumberedIdentity(i))
+	}
+	dir := NewCacheDirectory(&inner, 20, time.Hour, time.Hour, time.Hour)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for w := 0; w < 64; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				i := (w*7 + j) % numIdents
+				did := syntax.DID(fmt.Sprintf("did:plc:abc%d", i))
+				var ident *Identity
+				var err error
+				switch j % 4 {
+				case 0, 1:
+					ident, err = dir.LookupDID(ctx, did)
+				case 2:
+					ident, err = dir.LookupHandle(ctx, syntax.Handle(fmt.Sprintf("h%d.example.com", i)))
+				case 3:
+					err = dir.Purge(ctx, did.AtIdentifier())
+				}
+				if err == nil && ident != nil && ident.DID != did {
+					err = fmt.Errorf("wrong identity for %s: %s", did, ident.DID)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
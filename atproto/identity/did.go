@@ -94,6 +94,25 @@ func (d *BaseDirectory) ResolveDIDPLC(ctx context.Context, did syntax.DID) (*DID
 		plcURL = DefaultPLCURL
 	}
 
+	var err error
+	for i, u := range append([]string{plcURL}, d.PLCFallbackURLs...) {
+		var doc *DIDDocument
+		doc, err = d.fetchDIDPLC(ctx, u, did)
+		if err == nil {
+			slog.Debug("resolved did:plc", "did", did, "plc_host", u, "fallback", i > 0)
+			return doc, nil
+		}
+		// a 404 is authoritative, and there is no point asking a mirror
+		if errors.Is(err, ErrDIDNotFound) || ctx.Err() != nil {
+			return nil, err
+		}
+		slog.Debug("did:plc resolution failed", "did", did, "plc_host", u, "err", err)
+	}
+	return nil, err
+}
+
+// fetches a DID document from a single PLC directory host
+func (d *BaseDirectory) fetchDIDPLC(ctx context.Context, plcURL string, did syntax.DID) (*DIDDocument, error) {
 	if d.PLCLimiter != nil {
 		if err := d.PLCLimiter.Wait(ctx); err != nil {
 			return nil, fmt.Errorf("failed to wait for PLC limiter: %w", err)
@@ -106,15 +125,19 @@ func (d *BaseDirectory) ResolveDIDPLC(ctx context.Context, did syntax.DID) (*DID
 	}
 	resp, err := d.HTTPClient.Do(req)
 	if err != nil {
+		plcFetches.WithLabelValues("error").Inc()
 		return nil, fmt.Errorf("%w: PLC directory lookup: %w", ErrDIDResolutionFailed, err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
+		plcFetches.WithLabelValues("not-found").Inc()
 		return nil, fmt.Errorf("%w: PLC directory 404", ErrDIDNotFound)
 	}
 	if resp.StatusCode != http.StatusOK {
+		plcFetches.WithLabelValues("error").Inc()
 		return nil, fmt.Errorf("%w: PLC directory status %d", ErrDIDResolutionFailed, resp.StatusCode)
 	}
+	plcFetches.WithLabelValues("ok").Inc()
 
 	var doc DIDDocument
 	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
@@ -0,0 +1,75 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestResolveDIDPLCFallback(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	docJSON, err := os.ReadFile("testdata/did_plc_doc.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	did := syntax.DID("did:plc:ewvi7nxzyoun6zhxrhs64oiz")
+
+	downHits := 0
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downHits++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	mirrorHits := 0
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorHits++
+		if r.URL.Path != "/"+did.String() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(docJSON)
+	}))
+	defer mirror.Close()
+
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	dir := BaseDirectory{
+		PLCURL:          down.URL,
+		PLCFallbackURLs: []string{mirror.URL},
+		PLCLimiter:      limiter,
+	}
+	doc, err := dir.ResolveDIDPLC(ctx, did)
+	assert.NoError(err)
+	if assert.NotNil(doc) {
+		assert.Equal(did.String(), doc.DID.String())
+	}
+	assert.Equal(1, downHits)
+	assert.Equal(1, mirrorHits)
+
+	// a 404 is returned as-is, without trying further hosts
+	dir = BaseDirectory{
+		PLCURL:          mirror.URL,
+		PLCFallbackURLs: []string{down.URL},
+	}
+	_, err = dir.ResolveDIDPLC(ctx, syntax.DID("did:plc:aaaaaaaaaaaaaaaaaaaaaaaa"))
+	assert.True(errors.Is(err, ErrDIDNotFound))
+	assert.Equal(1, downHits)
+
+	// all hosts failing
+	dir = BaseDirectory{
+		PLCURL:          down.URL,
+		PLCFallbackURLs: []string{down.URL},
+	}
+	_, err = dir.ResolveDIDPLC(ctx, did)
+	assert.True(errors.Is(err, ErrDIDResolutionFailed))
+	assert.Equal(3, downHits)
+}
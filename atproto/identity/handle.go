@@ -163,11 +163,9 @@ func (d *BaseDirectory) ResolveHandleWellKnown(ctx context.Context, handle synta
 	return syntax.ParseDID(line)
 }
 
+// Resolves a handle to a DID, trying each configured method (see BaseDirectory.HandleResolutionOrder) in order until one succeeds. All methods are attempted before returning an error.
 func (d *BaseDirectory) ResolveHandle(ctx context.Context, handle syntax.Handle) (syntax.DID, error) {
 	// TODO: *could* do resolution in parallel, but expecting that sequential is sufficient to start
-	var dnsErr error
-	var did syntax.DID
-
 	if handle.IsInvalidHandle() {
 		return "", fmt.Errorf("invalid handle")
 	}
@@ -176,52 +174,79 @@ func (d *BaseDirectory) ResolveHandle(ctx context.Context, handle syntax.Handle)
 		return "", ErrHandleReservedTLD
 	}
 
-	tryDNS := true
-	for _, suffix := range d.SkipDNSDomainSuffixes {
-		if strings.HasSuffix(handle.String(), suffix) {
-			tryDNS = false
-			break
-		}
+	order := d.HandleResolutionOrder
+	if len(order) == 0 {
+		order = DefaultHandleResolutionOrder
 	}
 
-	if tryDNS {
-		start := time.Now()
-		triedAuthoritative := false
-		triedFallback := false
-		did, dnsErr = d.ResolveHandleDNS(ctx, handle)
-		if errors.Is(dnsErr, ErrHandleNotFound) && d.TryAuthoritativeDNS {
-			slog.Debug("attempting authoritative handle DNS resolution", "handle", handle)
-			triedAuthoritative = true
-			// try harder with authoritative lookup
-			did, dnsErr = d.ResolveHandleDNSAuthoritative(ctx, handle)
-		}
-		if errors.Is(dnsErr, ErrHandleNotFound) && len(d.FallbackDNSServers) > 0 {
-			slog.Debug("attempting fallback DNS resolution", "handle", handle)
-			triedFallback = true
-			// try harder with fallback lookup
-			did, dnsErr = d.ResolveHandleDNSFallback(ctx, handle)
+	var errs []error
+	for _, method := range order {
+		var did syntax.DID
+		var err error
+		switch method {
+		case HandleResolutionDNS:
+			if d.SkipDNS(handle) {
+				continue
+			}
+			did, err = d.resolveHandleDNSAll(ctx, handle)
+		case HandleResolutionHTTP:
+			start := time.Now()
+			did, err = d.ResolveHandleWellKnown(ctx, handle)
+			elapsed := time.Since(start)
+			slog.Debug("resolve handle HTTP well-known", "handle", handle, "err", err, "did", did, "duration_ms", elapsed.Milliseconds())
+		default:
+			return "", fmt.Errorf("unknown handle resolution method: %s", method)
 		}
-		elapsed := time.Since(start)
-		slog.Debug("resolve handle DNS", "handle", handle, "err", dnsErr, "did", did, "authoritative", triedAuthoritative, "fallback", triedFallback, "duration_ms", elapsed.Milliseconds())
-		if nil == dnsErr { // if *not* an error
+		if nil == err { // if *not* an error
+			slog.Debug("resolved handle", "handle", handle, "did", did, "method", method)
+			handleResolutions.WithLabelValues(method).Inc()
 			return did, nil
 		}
+		errs = append(errs, err)
 	}
+	handleResolutions.WithLabelValues("none").Inc()
 
-	start := time.Now()
-	did, httpErr := d.ResolveHandleWellKnown(ctx, handle)
-	elapsed := time.Since(start)
-	slog.Debug("resolve handle HTTP well-known", "handle", handle, "err", httpErr, "did", did, "duration_ms", elapsed.Milliseconds())
-	if nil == httpErr { // if *not* an error
-		return did, nil
+	// return the most specific/helpful error
+	for _, err := range errs {
+		if !errors.Is(err, ErrHandleNotFound) {
+			return "", err
+		}
 	}
+	if len(errs) > 0 {
+		return "", errs[0]
+	}
+	return "", fmt.Errorf("%w: no handle resolution methods attempted", ErrHandleResolutionFailed)
+}
 
-	// return the most specific/helpful error
-	if !errors.Is(dnsErr, ErrHandleNotFound) {
-		return "", dnsErr
+// Whether DNS handle resolution is skipped for the handle, because it has one of the SkipDNSDomainSuffixes
+func (d *BaseDirectory) SkipDNS(handle syntax.Handle) bool {
+	for _, suffix := range d.SkipDNSDomainSuffixes {
+		if strings.HasSuffix(handle.String(), suffix) {
+			return true
+		}
 	}
-	if !errors.Is(httpErr, ErrHandleNotFound) {
-		return "", httpErr
+	return false
+}
+
+// DNS handle resolution, including authoritative and fallback nameservers (if configured)
+func (d *BaseDirectory) resolveHandleDNSAll(ctx context.Context, handle syntax.Handle) (syntax.DID, error) {
+	start := time.Now()
+	triedAuthoritative := false
+	triedFallback := false
+	did, dnsErr := d.ResolveHandleDNS(ctx, handle)
+	if errors.Is(dnsErr, ErrHandleNotFound) && d.TryAuthoritativeDNS {
+		slog.Debug("attempting authoritative handle DNS resolution", "handle", handle)
+		triedAuthoritative = true
+		// try harder with authoritative lookup
+		did, dnsErr = d.ResolveHandleDNSAuthoritative(ctx, handle)
+	}
+	if errors.Is(dnsErr, ErrHandleNotFound) && len(d.FallbackDNSServers) > 0 {
+		slog.Debug("attempting fallback DNS resolution", "handle", handle)
+		triedFallback = true
+		// try harder with fallback lookup
+		did, dnsErr = d.ResolveHandleDNSFallback(ctx, handle)
 	}
-	return "", dnsErr
+	elapsed := time.Since(start)
+	slog.Debug("resolve handle DNS", "handle", handle, "err", dnsErr, "did", did, "authoritative", triedAuthoritative, "fallback", triedFallback, "duration_ms", elapsed.Milliseconds())
+	return did, dnsErr
 }
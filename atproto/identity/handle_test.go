@@ -0,0 +1,29 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveHandleOrder(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	h := syntax.Handle("handle.example.com")
+
+	// DNS skipped for this suffix, and it is the only configured method
+	dir := BaseDirectory{
+		SkipDNSDomainSuffixes: []string{".example.com"},
+		HandleResolutionOrder: []string{HandleResolutionDNS},
+	}
+	_, err := dir.ResolveHandle(ctx, h)
+	assert.True(errors.Is(err, ErrHandleResolutionFailed))
+
+	dir.HandleResolutionOrder = []string{"carrier-pigeon"}
+	_, err = dir.ResolveHandle(ctx, h)
+	assert.Error(err)
+}
@@ -34,3 +34,23 @@ var handleRequestsCoalesced = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "atproto_directory_handle_requests_coalesced",
 	Help: "Number of handle requests coalesced",
 })
+
+var handleCacheNegativeHits = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "atproto_directory_handle_cache_negative_hits",
+	Help: "Number of cache hits for ATProto handle lookups where the cached result was an error",
+})
+
+var identityCacheNegativeHits = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "atproto_directory_identity_cache_negative_hits",
+	Help: "Number of cache hits for ATProto identity lookups where the cached result was an error",
+})
+
+var plcFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "atproto_directory_plc_fetches",
+	Help: "Number of DID document fetches from the PLC directory, by result",
+}, []string{"result"})
+
+var handleResolutions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "atproto_directory_handle_resolutions",
+	Help: "Number of handle resolutions, by the method which succeeded (or 'none')",
+}, []string{"method"})
@@ -34,3 +34,18 @@ var handleRequestsCoalesced = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "atproto_redis_directory_handle_requests_coalesced",
 	Help: "Number of handle requests coalesced",
 })
+
+var handleCacheNegativeHits = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "atproto_redis_directory_handle_cache_negative_hits",
+	Help: "Number of cache hits for ATProto handle lookups where the cached result was an error",
+})
+
+var identityCacheNegativeHits = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "atproto_redis_directory_identity_cache_negative_hits",
+	Help: "Number of cache hits for ATProto identity lookups where the cached result was an error",
+})
+
+var redisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "atproto_redis_directory_redis_errors",
+	Help: "Number of errors reading from or writing to redis, by operation",
+}, []string{"op"})
@@ -116,6 +116,7 @@ func (d *RedisDirectory) updateHandle(ctx context.Context, h syntax.Handle) hand
 			TTL:   d.ErrTTL,
 		})
 		if err != nil {
+			redisErrors.WithLabelValues("write").Inc()
 			he.DID = nil
 			he.Err = fmt.Errorf("identity cache write: %w", err)
 			return he
@@ -141,6 +142,7 @@ func (d *RedisDirectory) updateHandle(ctx context.Context, h syntax.Handle) hand
 		TTL:   d.HitTTL,
 	})
 	if err != nil {
+		redisErrors.WithLabelValues("write").Inc()
 		he.DID = nil
 		he.Err = fmt.Errorf("identity cache write: %w", err)
 		return he
@@ -152,6 +154,7 @@ func (d *RedisDirectory) updateHandle(ctx context.Context, h syntax.Handle) hand
 		TTL:   d.HitTTL,
 	})
 	if err != nil {
+		redisErrors.WithLabelValues("write").Inc()
 		he.DID = nil
 		he.Err = fmt.Errorf("identity cache write: %w", err)
 		return he
@@ -166,11 +169,13 @@ func (d *RedisDirectory) ResolveHandle(ctx context.Context, h syntax.Handle) (sy
 	var entry handleEntry
 	err := d.handleCache.Get(ctx, redisDirPrefix+h.String(), &entry)
 	if err != nil && err != cache.ErrCacheMiss {
+		redisErrors.WithLabelValues("read").Inc()
 		return "", fmt.Errorf("identity cache read: %w", err)
 	}
 	if err == nil && !d.isHandleStale(&entry) { // if no error...
 		handleCacheHits.Inc()
 		if entry.Err != nil {
+			handleCacheNegativeHits.Inc()
 			return "", entry.Err
 		} else if entry.DID != nil {
 			return *entry.DID, nil
@@ -191,6 +196,7 @@ func (d *RedisDirectory) ResolveHandle(ctx context.Context, h syntax.Handle) (sy
 			// The result should now be in the cache
 			err := d.handleCache.Get(ctx, redisDirPrefix+h.String(), entry)
 			if err != nil && err != cache.ErrCacheMiss {
+				redisErrors.WithLabelValues("read").Inc()
 				return "", fmt.Errorf("identity cache read: %w", err)
 			}
 			if err == nil && !d.isHandleStale(&entry) { // if no error...
@@ -250,6 +256,7 @@ func (d *RedisDirectory) updateDID(ctx context.Context, did syntax.DID) identity
 		TTL:   d.HitTTL,
 	})
 	if err != nil {
+		redisErrors.WithLabelValues("write").Inc()
 		entry.Identity = nil
 		entry.Err = fmt.Errorf("identity cache write: %v", err)
 		return entry
@@ -262,6 +269,7 @@ func (d *RedisDirectory) updateDID(ctx context.Context, did syntax.DID) identity
 			TTL:   d.HitTTL,
 		})
 		if err != nil {
+			redisErrors.WithLabelValues("write").Inc()
 			entry.Identity = nil
 			entry.Err = fmt.Errorf("identity cache write: %v", err)
 			return entry
@@ -279,10 +287,14 @@ func (d *RedisDirectory) LookupDIDWithCacheState(ctx context.Context, did syntax
 	var entry identityEntry
 	err := d.identityCache.Get(ctx, redisDirPrefix+did.String(), &entry)
 	if err != nil && err != cache.ErrCacheMiss {
+		redisErrors.WithLabelValues("read").Inc()
 		return nil, false, fmt.Errorf("identity cache read: %v", err)
 	}
 	if err == nil && !d.isIdentityStale(&entry) { // if no error...
 		identityCacheHits.Inc()
+		if entry.Err != nil {
+			identityCacheNegativeHits.Inc()
+		}
 		return entry.Identity, true, entry.Err
 	}
 	identityCacheMisses.Inc()
@@ -298,6 +310,7 @@ func (d *RedisDirectory) LookupDIDWithCacheState(ctx context.Context, did syntax
 			// The result should now be in the cache
 			err = d.identityCache.Get(ctx, redisDirPrefix+did.String(), &entry)
 			if err != nil && err != cache.ErrCacheMiss {
+				redisErrors.WithLabelValues("read").Inc()
 				return nil, false, fmt.Errorf("identity cache read: %v", err)
 			}
 			if err == nil && !d.isIdentityStale(&entry) { // if no error...
@@ -0,0 +1,4 @@
+// Automod component for publishing moderation actions to downstream services, instead of the rules engine sending them directly to the mod service.
+//
+// Implementations satisfy the engine's ActionSink interface. Currently the only one publishes to NATS JetStream.
+package actionsink
@@ -0,0 +1,61 @@
+package actionsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/automod/engine"
+
+	"github.com/nats-io/nats.go"
+)
+
+// how long to wait for JetStream to acknowledge a published event, if the context doesn't have an earlier deadline
+var natsAckTimeout = 5 * time.Second
+
+// ActionSink which publishes each ActionEvent as a JSON message to NATS JetStream.
+//
+// The subject is the configured prefix plus the event kind (eg, "automod.actions.account" or "automod.actions.record"), so consumers can subscribe to a subset of events. A JetStream stream capturing the subjects must already exist: each publish waits for the stream to acknowledge that the event was stored, and fails if there is no ack (including when no stream captures the subject).
+type NATSActionSink struct {
+	conn          *nats.Conn
+	js            nats.JetStreamContext
+	subjectPrefix string
+}
+
+var _ engine.ActionSink = (*NATSActionSink)(nil)
+
+// Connects to the NATS server(s) at url (comma-separated for a cluster). The connection reconnects indefinitely in the background if it drops.
+func NewNATSActionSink(url, subjectPrefix string) (*NATSActionSink, error) {
+	if subjectPrefix == "" {
+		return nil, fmt.Errorf("NATS subject prefix is required")
+	}
+	conn, err := nats.Connect(url, nats.Name("automod"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %w", err)
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("configuring NATS JetStream: %w", err)
+	}
+	return &NATSActionSink{conn: conn, js: js, subjectPrefix: subjectPrefix}, nil
+}
+
+func (s *NATSActionSink) PublishAction(ctx context.Context, evt *engine.ActionEvent) error {
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, natsAckTimeout)
+	defer cancel()
+	if _, err := s.js.Publish(s.subjectPrefix+"."+evt.Kind, b, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("publishing to NATS JetStream: %w", err)
+	}
+	return nil
+}
+
+// Flushes any buffered messages, and closes the connection
+func (s *NATSActionSink) Close() error {
+	return s.conn.Drain()
+}
@@ -2,6 +2,7 @@ package cachestore
 
 import (
 	"context"
+	"time"
 )
 
 type CacheStore interface {
@@ -9,3 +10,11 @@ type CacheStore interface {
 	Set(ctx context.Context, name, key string, val string) error
 	Purge(ctx context.Context, name, key string) error
 }
+
+// Store for claiming keys atomically, for a period of time. Used to make sure only one worker (or process, if the store is shared) does something within that period.
+type ClaimStore interface {
+	// Sets the key, only if it is not already set (like the redis SETNX command), expiring after ttl. Returns true if the key was set by this call.
+	SetNX(ctx context.Context, name, key string, val string, ttl time.Duration) (bool, error)
+	// Removes the key, so that it can be claimed again
+	Purge(ctx context.Context, name, key string) error
+}
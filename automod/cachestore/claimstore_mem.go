@@ -0,0 +1,42 @@
+package cachestore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+type MemClaimStore struct {
+	lk sync.Mutex
+	// values are claim expiry times. the LRU TTL is an upper bound on those
+	Data *expirable.LRU[string, time.Time]
+}
+
+var _ ClaimStore = (*MemClaimStore)(nil)
+
+// Claims are dropped after maxTTL, or when the store is over capacity, even if they were set with a longer TTL
+func NewMemClaimStore(capacity int, maxTTL time.Duration) *MemClaimStore {
+	return &MemClaimStore{
+		Data: expirable.NewLRU[string, time.Time](capacity, nil, maxTTL),
+	}
+}
+
+func (s *MemClaimStore) SetNX(ctx context.Context, name, key string, val string, ttl time.Duration) (bool, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	now := time.Now()
+	if expiry, ok := s.Data.Get(name + "/" + key); ok && now.Before(expiry) {
+		return false, nil
+	}
+	s.Data.Add(name+"/"+key, now.Add(ttl))
+	return true, nil
+}
+
+func (s *MemClaimStore) Purge(ctx context.Context, name, key string) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.Data.Remove(name + "/" + key)
+	return nil
+}
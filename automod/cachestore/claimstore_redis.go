@@ -0,0 +1,43 @@
+package cachestore
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type RedisClaimStore struct {
+	Client *redis.Client
+}
+
+var _ ClaimStore = (*RedisClaimStore)(nil)
+
+func NewRedisClaimStore(redisURL string) (*RedisClaimStore, error) {
+	ctx := context.Background()
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	rdb := redis.NewClient(opt)
+	// check redis connection
+	_, err = rdb.Ping(ctx).Result()
+	if err != nil {
+		return nil, err
+	}
+	return &RedisClaimStore{
+		Client: rdb,
+	}, nil
+}
+
+func redisClaimKey(name, key string) string {
+	return "claim/" + name + "/" + key
+}
+
+func (s *RedisClaimStore) SetNX(ctx context.Context, name, key string, val string, ttl time.Duration) (bool, error) {
+	return s.Client.SetNX(ctx, redisClaimKey(name, key), val, ttl).Result()
+}
+
+func (s *RedisClaimStore) Purge(ctx context.Context, name, key string) error {
+	return s.Client.Del(ctx, redisClaimKey(name, key)).Err()
+}
@@ -1,6 +1,6 @@
 // Automod component for caching arbitrary data (as JSON strings) with a fixed TTL and purging.
 //
-// Includes an interface and implementations using redis and in-process memory.
+// Includes an interface and implementations using redis and in-process memory. There is also a separate interface (with implementations) for atomically claiming keys, for things like de-duplication across workers.
 //
 // This is used by the rules engine to cache things like account metadata, improving latency and reducing load on authoritative backend systems.
 package cachestore
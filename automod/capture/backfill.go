@@ -0,0 +1,142 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Summary of a repo backfill run, broken down by collection
+type BackfillStats struct {
+	DID syntax.DID
+	// number of records successfully processed by the engine, per collection
+	Processed map[string]int
+	// number of records which failed to be read or processed, per collection
+	Failed map[string]int
+	// number of records skipped by the collection filter
+	Skipped int
+	// number of records each rule fired on (by rule name)
+	RuleFirings map[string]int
+}
+
+func (s *BackfillStats) TotalProcessed() int {
+	total := 0
+	for _, c := range s.Processed {
+		total += c
+	}
+	return total
+}
+
+func (s *BackfillStats) TotalFailed() int {
+	total := 0
+	for _, c := range s.Failed {
+		total += c
+	}
+	return total
+}
+
+// Fetches the complete repo (CAR file) for an account from its PDS, and processes every record through the engine as "create" ops, the same as if they had come over the firehose.
+//
+// If collections is non-empty, only records in those collections are processed. Failures for individual records are logged and counted, but do not halt the backfill.
+func FetchAndProcessRepo(ctx context.Context, eng *automod.Engine, atid syntax.AtIdentifier, collections []syntax.NSID) (*BackfillStats, error) {
+	ident, err := eng.Directory.Lookup(ctx, atid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve AT identifier: %v", err)
+	}
+	pdsURL := ident.PDSEndpoint()
+	if pdsURL == "" {
+		return nil, fmt.Errorf("could not resolve PDS endpoint for account: %s", ident.DID.String())
+	}
+	pdsClient := xrpc.Client{Host: pdsURL}
+
+	eng.Logger.Info("fetching repo", "did", ident.DID.String(), "pds", pdsURL)
+	repoCAR, err := comatproto.SyncGetRepo(ctx, &pdsClient, ident.DID.String(), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch repo: %v", err)
+	}
+	rr, err := repo.ReadRepoFromCar(ctx, bytes.NewReader(repoCAR))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repo CAR: %v", err)
+	}
+
+	allowed := map[string]bool{}
+	for _, c := range collections {
+		allowed[c.String()] = true
+	}
+	stats := BackfillStats{
+		DID:         ident.DID,
+		Processed:   map[string]int{},
+		Failed:      map[string]int{},
+		RuleFirings: map[string]int{},
+	}
+
+	err = rr.ForEach(ctx, "", func(k string, _ cid.Cid) error {
+		parts := strings.SplitN(k, "/", 3)
+		if len(parts) != 2 {
+			eng.Logger.Warn("skipping invalid repo path", "path", k)
+			return nil
+		}
+		if len(allowed) > 0 && !allowed[parts[0]] {
+			stats.Skipped++
+			return nil
+		}
+		collection, err := syntax.ParseNSID(parts[0])
+		if err != nil {
+			eng.Logger.Warn("skipping invalid repo path", "path", k, "err", err)
+			stats.Failed[parts[0]]++
+			return nil
+		}
+		rkey, err := syntax.ParseRecordKey(parts[1])
+		if err != nil {
+			eng.Logger.Warn("skipping invalid repo path", "path", k, "err", err)
+			stats.Failed[parts[0]]++
+			return nil
+		}
+		rc, recCBOR, err := rr.GetRecordBytes(ctx, k)
+		if err != nil {
+			eng.Logger.Error("reading record from repo CAR", "path", k, "err", err)
+			stats.Failed[parts[0]]++
+			return nil
+		}
+		recCID := syntax.CID(rc.String())
+		op := automod.RecordOp{
+			Action:     automod.CreateOp,
+			DID:        ident.DID,
+			Collection: collection,
+			RecordKey:  rkey,
+			CID:        &recCID,
+			RecordCBOR: *recCBOR,
+		}
+		eff, err := eng.ProcessRecordOpEffects(ctx, op)
+		if err != nil {
+			eng.Logger.Error("engine failed to process record", "path", k, "err", err)
+			stats.Failed[parts[0]]++
+			return nil
+		}
+		stats.Processed[parts[0]]++
+		if eff != nil {
+			// a rule may fire more than once for the same record; count records, not firings
+			fired := map[string]bool{}
+			for _, rf := range eff.RuleFirings {
+				if !fired[rf.Rule] {
+					fired[rf.Rule] = true
+					stats.RuleFirings[rf.Rule]++
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return &stats, fmt.Errorf("iterating over repo records: %v", err)
+	}
+	return &stats, nil
+}
@@ -0,0 +1,139 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/engine"
+	"github.com/bluesky-social/indigo/repo"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	car "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func backfillSpamRule(c *automod.RecordContext, post *appbsky.FeedPost) error {
+	if strings.Contains(post.Text, "spam") {
+		c.AddRecordLabel("spam")
+	}
+	return nil
+}
+
+func backfillLikeRule(c *automod.RecordContext) error {
+	if c.RecordOp.Collection == "app.bsky.feed.like" {
+		c.AddRecordFlag("like")
+	}
+	return nil
+}
+
+// builds a repo CAR file containing the given records (by collection)
+func testRepoCAR(t *testing.T, did syntax.DID, records map[string][]repo.CborMarshaler) []byte {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	r := repo.NewRepo(ctx, did.String(), bs)
+	for nsid, recs := range records {
+		for _, rec := range recs {
+			if _, _, err := r.CreateRecord(ctx, nsid, rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	root, _, err := r.Commit(ctx, func(context.Context, string, []byte) ([]byte, error) { return []byte("sig"), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{root}, Version: 1}, buf); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range keys {
+		blk, err := bs.Get(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := carutil.LdWrite(buf, k.Bytes(), blk.RawData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestFetchAndProcessRepo(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	did := syntax.DID("did:plc:abc111")
+	repoCAR := testRepoCAR(t, did, map[string][]repo.CborMarshaler{
+		"app.bsky.feed.post": {
+			&appbsky.FeedPost{Text: "hello", CreatedAt: "2024-01-01T00:00:00Z"},
+			&appbsky.FeedPost{Text: "spam spam", CreatedAt: "2024-01-01T00:00:00Z"},
+			&appbsky.FeedPost{Text: "more spam", CreatedAt: "2024-01-01T00:00:00Z"},
+		},
+		"app.bsky.feed.like": {
+			&appbsky.FeedLike{CreatedAt: "2024-01-01T00:00:00Z"},
+		},
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/com.atproto.sync.getRepo" || r.URL.Query().Get("did") != did.String() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.ipld.car")
+		w.Write(repoCAR)
+	}))
+	defer srv.Close()
+
+	newEngine := func() *automod.Engine {
+		eng := engine.EngineTestFixture()
+		dir := identity.NewMockDirectory()
+		dir.Insert(identity.Identity{
+			DID:    did,
+			Handle: syntax.Handle("handle.example.com"),
+			Services: map[string]identity.Service{
+				"atproto_pds": {Type: "AtprotoPersonalDataServer", URL: srv.URL},
+			},
+		})
+		eng.Directory = &dir
+		eng.Config.SkipAccountMeta = true
+		eng.Rules = automod.RuleSet{
+			PostRules:   []automod.PostRuleFunc{backfillSpamRule},
+			RecordRules: []automod.RecordRuleFunc{backfillLikeRule},
+		}
+		return &eng
+	}
+
+	stats, err := FetchAndProcessRepo(ctx, newEngine(), did.AtIdentifier(), nil)
+	assert.NoError(err)
+	if assert.NotNil(stats) {
+		assert.Equal(map[string]int{"app.bsky.feed.post": 3, "app.bsky.feed.like": 1}, stats.Processed)
+		assert.Equal(0, stats.TotalFailed())
+		assert.Equal(0, stats.Skipped)
+		assert.Equal(map[string]int{"capture.backfillSpamRule": 2, "capture.backfillLikeRule": 1}, stats.RuleFirings)
+	}
+
+	// collection filter
+	stats, err = FetchAndProcessRepo(ctx, newEngine(), did.AtIdentifier(), []syntax.NSID{"app.bsky.feed.like"})
+	assert.NoError(err)
+	if assert.NotNil(stats) {
+		assert.Equal(map[string]int{"app.bsky.feed.like": 1}, stats.Processed)
+		assert.Equal(3, stats.Skipped)
+		assert.Equal(map[string]int{"capture.backfillLikeRule": 1}, stats.RuleFirings)
+	}
+}
@@ -0,0 +1,158 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/automod"
+
+	"github.com/carlmjohnson/versioninfo"
+	"github.com/ipfs/go-cid"
+)
+
+// Downloads the blobs referenced by the captured post records from the account's PDS, and adds them to the capture (keyed by CID), so that blob rules can be run against the capture without the network.
+//
+// Downloads stop once maxBytes (total) have been captured; any further blobs are skipped, as are blobs which fail to download, or whose content doesn't match their CID. Returns the number of blobs skipped.
+func CaptureBlobs(ctx context.Context, eng *automod.Engine, cap *AccountCapture, maxBytes int64) (int, error) {
+	if cap.AccountMeta.Identity == nil {
+		return 0, fmt.Errorf("capture is missing account identity")
+	}
+	pdsURL := cap.AccountMeta.Identity.PDSEndpoint()
+	if pdsURL == "" {
+		return 0, fmt.Errorf("could not resolve PDS endpoint for account: %s", cap.AccountMeta.Identity.DID)
+	}
+	client := eng.BlobClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if cap.Blobs == nil {
+		cap.Blobs = map[string][]byte{}
+	}
+
+	var total int64
+	for _, b := range cap.Blobs {
+		total += int64(len(b))
+	}
+	skipped := 0
+	for _, pr := range cap.PostRecords {
+		op, err := captureRecordOp(pr)
+		if err != nil {
+			return skipped, err
+		}
+		rec, err := data.UnmarshalCBOR(op.RecordCBOR)
+		if err != nil {
+			return skipped, fmt.Errorf("parsing generic record CBOR: %v", err)
+		}
+		for _, blob := range data.ExtractBlobs(rec) {
+			cid := blob.Ref.String()
+			if _, ok := cap.Blobs[cid]; ok {
+				continue
+			}
+			// the declared size is checked first, to skip over-size blobs without downloading them, but may not be accurate
+			if total+blob.Size > maxBytes {
+				eng.Logger.Warn("skipping blob: capture size limit reached", "uri", pr.Uri, "cid", cid, "size", blob.Size)
+				skipped++
+				continue
+			}
+			buf, err := fetchCaptureBlob(ctx, client, pdsURL, op.DID.String(), cid, maxBytes-total)
+			if err != nil {
+				eng.Logger.Warn("skipping blob: download failed", "uri", pr.Uri, "cid", cid, "err", err)
+				skipped++
+				continue
+			}
+			cap.Blobs[cid] = buf
+			total += int64(len(buf))
+		}
+	}
+	eng.Logger.Info("captured blobs", "did", cap.AccountMeta.Identity.DID.String(), "count", len(cap.Blobs), "bytes", total, "skipped", skipped)
+	return skipped, nil
+}
+
+// downloads a single blob, failing if it is larger than maxBytes, or if the content doesn't match the CID
+func fetchCaptureBlob(ctx context.Context, client *http.Client, pdsURL, did, cidStr string, maxBytes int64) ([]byte, error) {
+	c, err := cid.Decode(cidStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob CID: %w", err)
+	}
+	u := fmt.Sprintf("%s/xrpc/com.atproto.sync.getBlob?did=%s&cid=%s", pdsURL, url.QueryEscape(did), url.QueryEscape(cidStr))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "indigo-automod/"+versioninfo.Short())
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP status %d", resp.StatusCode)
+	}
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > maxBytes {
+		return nil, fmt.Errorf("blob larger than remaining capture size limit (%d bytes)", maxBytes)
+	}
+	// the capture is trusted on replay, so check that the PDS returned the blob which was referenced
+	sum, err := c.Prefix().Sum(buf)
+	if err != nil {
+		return nil, fmt.Errorf("hashing blob: %w", err)
+	}
+	if !sum.Equals(c) {
+		return nil, fmt.Errorf("blob content does not match CID (got %s)", sum)
+	}
+	return buf, nil
+}
+
+// HTTP transport which serves blob downloads (com.atproto.sync.getBlob) from a capture, instead of the network. Requests for blobs which were not captured get a 404, the same as a missing blob on a PDS. Other requests are passed through to the base transport.
+type capturedBlobTransport struct {
+	blobs map[string][]byte
+	base  http.RoundTripper
+}
+
+func (t *capturedBlobTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path != "/xrpc/com.atproto.sync.getBlob" {
+		return t.base.RoundTrip(req)
+	}
+	status := http.StatusOK
+	body, ok := t.blobs[req.URL.Query().Get("cid")]
+	if !ok {
+		status = http.StatusNotFound
+		body = []byte(`{"error":"BlobNotFound","message":"blob not included in capture"}`)
+	}
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Configures the engine to fetch blobs from the capture, if the capture includes any blobs
+func useCapturedBlobs(eng *automod.Engine, capture AccountCapture) {
+	if capture.Blobs == nil {
+		return
+	}
+	client := http.Client{}
+	base := http.DefaultTransport
+	if eng.BlobClient != nil {
+		client = *eng.BlobClient
+		if eng.BlobClient.Transport != nil {
+			base = eng.BlobClient.Transport
+		}
+	}
+	client.Transport = &capturedBlobTransport{blobs: capture.Blobs, base: base}
+	eng.BlobClient = &client
+}
@@ -0,0 +1,139 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/engine"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureBlobs(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	did := syntax.DID("did:plc:abc111")
+	blobs := map[string][]byte{}
+	var records []comatproto.RepoListRecords_Record
+	for i, data := range []string{"small image", "a somewhat larger image"} {
+		c, err := cid.NewPrefixV1(cid.Raw, multihash.SHA2_256).Sum([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs[c.String()] = []byte(data)
+		post := appbsky.FeedPost{
+			Text:      "post with image",
+			CreatedAt: "2024-01-01T00:00:00Z",
+			Embed: &appbsky.FeedPost_Embed{EmbedImages: &appbsky.EmbedImages{Images: []*appbsky.EmbedImages_Image{
+				{Image: &lexutil.LexBlob{Ref: lexutil.LexLink(c), MimeType: "image/png", Size: int64(len(data))}},
+			}}},
+		}
+		records = append(records, comatproto.RepoListRecords_Record{
+			Uri:   fmt.Sprintf("at://%s/app.bsky.feed.post/3kabc%d", did, i),
+			Cid:   "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm",
+			Value: &lexutil.LexiconTypeDecoder{Val: &post},
+		})
+	}
+
+	// if set, the mock PDS returns the wrong content for every blob
+	var corrupt atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := blobs[r.URL.Query().Get("cid")]
+		if r.URL.Path != "/xrpc/com.atproto.sync.getBlob" || r.URL.Query().Get("did") != did.String() || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if corrupt.Load() {
+			data = append([]byte("corrupt "), data...)
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	newCapture := func() AccountCapture {
+		return AccountCapture{
+			CapturedAt: syntax.DatetimeNow(),
+			AccountMeta: automod.AccountMeta{
+				Identity: &identity.Identity{
+					DID:    did,
+					Handle: syntax.Handle("handle.example.com"),
+					Services: map[string]identity.Service{
+						"atproto_pds": {Type: "AtprotoPersonalDataServer", URL: srv.URL},
+					},
+				},
+			},
+			PostRecords: records,
+		}
+	}
+
+	// all blobs fit
+	eng := engine.EngineTestFixture()
+	full := newCapture()
+	skipped, err := CaptureBlobs(ctx, &eng, &full, 1024)
+	assert.NoError(err)
+	assert.Equal(0, skipped)
+	assert.Equal(blobs, full.Blobs)
+
+	// size limit only fits the first blob
+	limited := newCapture()
+	skipped, err = CaptureBlobs(ctx, &eng, &limited, 20)
+	assert.NoError(err)
+	assert.Equal(1, skipped)
+	assert.Equal(1, len(limited.Blobs))
+
+	// blobs which don't match their CID are skipped
+	corrupt.Store(true)
+	mismatched := newCapture()
+	skipped, err = CaptureBlobs(ctx, &eng, &mismatched, 1024)
+	assert.NoError(err)
+	assert.Equal(2, skipped)
+	assert.Empty(mismatched.Blobs)
+	corrupt.Store(false)
+
+	// blobs survive a JSON round-trip, and replay serves them to blob rules without fetching from the PDS
+	srv.Close()
+	raw, err := json.Marshal(full)
+	assert.NoError(err)
+	var loaded AccountCapture
+	assert.NoError(json.Unmarshal(raw, &loaded))
+	assert.Equal(blobs, loaded.Blobs)
+
+	// returns an engine with a blob rule, and the blobs seen by that rule
+	blobEngine := func() (*automod.Engine, map[string][]byte) {
+		var mu sync.Mutex
+		seen := map[string][]byte{}
+		eng := engine.EngineTestFixture()
+		eng.Rules.BlobRules = []automod.BlobRuleFunc{
+			func(c *automod.RecordContext, blob lexutil.LexBlob, data []byte) error {
+				mu.Lock()
+				defer mu.Unlock()
+				seen[blob.Ref.String()] = data
+				return nil
+			},
+		}
+		return &eng, seen
+	}
+	replayEng, seen := blobEngine()
+	assert.NoError(ReplayCapture(ctx, replayEng, loaded))
+	assert.Equal(blobs, seen)
+
+	// blobs which weren't captured are missing (and not fetched), which is logged but doesn't fail the record
+	replayEng, seen = blobEngine()
+	assert.NoError(ReplayCapture(ctx, replayEng, limited))
+	assert.Equal(limited.Blobs, seen)
+}
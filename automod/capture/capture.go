@@ -12,6 +12,8 @@ type AccountCapture struct {
 	CapturedAt  syntax.Datetime                     `json:"capturedAt"`
 	AccountMeta automod.AccountMeta                 `json:"accountMeta"`
 	PostRecords []comatproto.RepoListRecords_Record `json:"postRecords"`
+	// Blobs referenced by the post records, keyed by CID (see CaptureBlobs). Encoded as base64 in JSON.
+	Blobs map[string][]byte `json:"blobs,omitempty"`
 }
 
 func CaptureRecent(ctx context.Context, eng *automod.Engine, atid syntax.AtIdentifier, limit int) (*AccountCapture, error) {
@@ -4,6 +4,8 @@ import (
 	"context"
 	"testing"
 
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/automod"
 	"github.com/bluesky-social/indigo/automod/countstore"
 	"github.com/bluesky-social/indigo/automod/engine"
 	"github.com/stretchr/testify/assert"
@@ -23,3 +25,56 @@ func TestNoOpCaptureReplyRule(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(0, c)
 }
+
+func TestReplayCapture(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	eng := engine.EngineTestFixture()
+	capture := MustLoadCapture("testdata/capture_atprotocom.json")
+	assert.NoError(ReplayCapture(ctx, &eng, capture))
+
+	// captured identity is resolvable without the network
+	ident, err := eng.Directory.LookupDID(ctx, capture.AccountMeta.Identity.DID)
+	assert.NoError(err)
+	assert.Equal(capture.AccountMeta.Identity.Handle, ident.Handle)
+
+	// captured account metadata was seeded in to the cache
+	cached, err := eng.Cache.Get(ctx, "acct", capture.AccountMeta.Identity.DID.String())
+	assert.NoError(err)
+	assert.NotEmpty(cached)
+}
+
+func labelEveryPostRule(c *automod.RecordContext, post *appbsky.FeedPost) error {
+	c.AddRecordLabel("test-label")
+	return nil
+}
+
+func TestDiffCapture(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	capture := MustLoadCapture("testdata/capture_atprotocom.json")
+	engA := engine.EngineTestFixture()
+	engB := engine.EngineTestFixture()
+	engB.Rules.PostRules = append(engB.Rules.PostRules, labelEveryPostRule)
+
+	// identical rulesets
+	same := engine.EngineTestFixture()
+	results, err := DiffCapture(ctx, &engA, &same, capture)
+	assert.NoError(err)
+	assert.Equal(len(capture.PostRecords), len(results))
+	for _, rd := range results {
+		assert.False(rd.Changed(), rd.URI)
+	}
+
+	engA = engine.EngineTestFixture()
+	results, err = DiffCapture(ctx, &engA, &engB, capture)
+	assert.NoError(err)
+	assert.Equal(len(capture.PostRecords), len(results))
+	for _, rd := range results {
+		assert.True(rd.Changed(), rd.URI)
+		assert.Equal([]string{"record-label:test-label"}, rd.Diff.Added)
+		assert.Empty(rd.Diff.Removed)
+	}
+}
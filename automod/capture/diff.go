@@ -0,0 +1,51 @@
+package capture
+
+import (
+	"context"
+
+	"github.com/bluesky-social/indigo/automod"
+)
+
+// Outcome of processing a single record with two engines. See DiffCapture.
+type RecordDiff struct {
+	URI string
+	// Differences in actions, from the first engine to the second
+	Diff automod.EffectsDiff
+	// Errors processing the record with the first and second engines. If either failed, Diff is not meaningful.
+	ErrA error
+	ErrB error
+}
+
+// Returns true if the engines disagreed about the record: either the actions differ, or processing failed with one or both engines
+func (d *RecordDiff) Changed() bool {
+	return d.ErrA != nil || d.ErrB != nil || !d.Diff.IsEmpty()
+}
+
+// Processes all the records from a capture with two engines (eg, configured with different rulesets), in the same way as ReplayCapture, and compares the resulting actions for each record. Returns a result for every record, in capture order.
+//
+// Both engines are seeded with the captured identity and account metadata. They should each have separate local (not shared) cache and counter stores, so that their state doesn't interact, and should be in dry-run mode unless the actions are actually intended.
+func DiffCapture(ctx context.Context, engA, engB *automod.Engine, capture AccountCapture) ([]RecordDiff, error) {
+	for _, eng := range []*automod.Engine{engA, engB} {
+		if err := seedCapture(ctx, eng, capture); err != nil {
+			return nil, err
+		}
+	}
+
+	var out []RecordDiff
+	for _, pr := range capture.PostRecords {
+		op, err := captureRecordOp(pr)
+		if err != nil {
+			out = append(out, RecordDiff{URI: pr.Uri, ErrA: err, ErrB: err})
+			continue
+		}
+		rd := RecordDiff{URI: pr.Uri}
+		effA, errA := engA.ProcessRecordOpEffects(ctx, *op)
+		effB, errB := engB.ProcessRecordOpEffects(ctx, *op)
+		rd.ErrA, rd.ErrB = errA, errB
+		if errA == nil && errB == nil {
+			rd.Diff = automod.DiffEffects(effA, effB)
+		}
+		out = append(out, rd)
+	}
+	return out, nil
+}
@@ -13,32 +13,38 @@ import (
 )
 
 func FetchAndProcessRecord(ctx context.Context, eng *automod.Engine, aturi syntax.ATURI) error {
+	_, err := FetchAndProcessRecordEffects(ctx, eng, aturi)
+	return err
+}
+
+// Same as FetchAndProcessRecord, but returns the effects (actions) resulting from rule execution.
+func FetchAndProcessRecordEffects(ctx context.Context, eng *automod.Engine, aturi syntax.ATURI) (*automod.Effects, error) {
 	// resolve URI, identity, and record
 	if aturi.RecordKey() == "" {
-		return fmt.Errorf("need a full, not partial, AT-URI: %s", aturi)
+		return nil, fmt.Errorf("need a full, not partial, AT-URI: %s", aturi)
 	}
 	ident, err := eng.Directory.Lookup(ctx, aturi.Authority())
 	if err != nil {
-		return fmt.Errorf("resolving AT-URI authority: %v", err)
+		return nil, fmt.Errorf("resolving AT-URI authority: %v", err)
 	}
 	pdsURL := ident.PDSEndpoint()
 	if pdsURL == "" {
-		return fmt.Errorf("could not resolve PDS endpoint for AT-URI account: %s", ident.DID.String())
+		return nil, fmt.Errorf("could not resolve PDS endpoint for AT-URI account: %s", ident.DID.String())
 	}
 	pdsClient := xrpc.Client{Host: pdsURL}
 
 	eng.Logger.Info("fetching record", "did", ident.DID.String(), "collection", aturi.Collection().String(), "rkey", aturi.RecordKey().String())
 	out, err := comatproto.RepoGetRecord(ctx, &pdsClient, "", aturi.Collection().String(), ident.DID.String(), aturi.RecordKey().String())
 	if err != nil {
-		return fmt.Errorf("fetching record from PDS (%s): %v", aturi, err)
+		return nil, fmt.Errorf("fetching record from PDS (%s): %v", aturi, err)
 	}
 	if out.Cid == nil {
-		return fmt.Errorf("expected a CID in getRecord response")
+		return nil, fmt.Errorf("expected a CID in getRecord response")
 	}
 	recCID := syntax.CID(*out.Cid)
 	recBuf := new(bytes.Buffer)
 	if err := out.Value.Val.MarshalCBOR(recBuf); err != nil {
-		return err
+		return nil, err
 	}
 	recBytes := recBuf.Bytes()
 	op := automod.RecordOp{
@@ -49,10 +55,19 @@ func FetchAndProcessRecord(ctx context.Context, eng *automod.Engine, aturi synta
 		CID:        &recCID,
 		RecordCBOR: recBytes,
 	}
-	return eng.ProcessRecordOp(ctx, op)
+	return eng.ProcessRecordOpEffects(ctx, op)
 }
 
+// maximum page size for com.atproto.repo.listRecords
+const listRecordsPageSize = 100
+
+// Fetches up to limit of the account's most recent post records (most-recent first), following the pagination cursor as needed.
 func FetchRecent(ctx context.Context, eng *automod.Engine, atid syntax.AtIdentifier, limit int) (*identity.Identity, []*comatproto.RepoListRecords_Record, error) {
+	return fetchRecent(ctx, eng, atid, limit, nil)
+}
+
+// fetchRecent pages through post records until limit records are fetched, or the end of the collection. If since is not nil, paging also stops after a page which includes a record at or before that marker (the full page is returned, for the caller to filter).
+func fetchRecent(ctx context.Context, eng *automod.Engine, atid syntax.AtIdentifier, limit int, since *syntax.TID) (*identity.Identity, []*comatproto.RepoListRecords_Record, error) {
 	ident, err := eng.Directory.Lookup(ctx, atid)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to resolve AT identifier: %v", err)
@@ -63,31 +78,120 @@ func FetchRecent(ctx context.Context, eng *automod.Engine, atid syntax.AtIdentif
 	}
 	pdsClient := xrpc.Client{Host: pdsURL}
 
-	resp, err := comatproto.RepoListRecords(ctx, &pdsClient, "app.bsky.feed.post", "", int64(limit), ident.DID.String(), false, "", "")
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to fetch record list: %v", err)
+	var records []*comatproto.RepoListRecords_Record
+	cursor := ""
+	pages := 0
+	for len(records) < limit {
+		resp, err := comatproto.RepoListRecords(ctx, &pdsClient, "app.bsky.feed.post", cursor, int64(min(limit-len(records), listRecordsPageSize)), ident.DID.String(), false, "", "")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch record list: %v", err)
+		}
+		pages++
+		records = append(records, resp.Records...)
+		if len(resp.Records) == 0 || resp.Cursor == nil || *resp.Cursor == "" || *resp.Cursor == cursor {
+			break
+		}
+		if since != nil && reachedSinceMarker(resp.Records, *since) {
+			break
+		}
+		cursor = *resp.Cursor
+	}
+	// a PDS may return more records than requested
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	eng.Logger.Info("got recent posts", "did", ident.DID.String(), "pds", pdsURL, "count", len(records), "pages", pages)
+	return ident, records, nil
+}
+
+// whether any record in the page has a TID record key at or before the marker
+func reachedSinceMarker(records []*comatproto.RepoListRecords_Record, since syntax.TID) bool {
+	for _, rec := range records {
+		aturi, err := syntax.ParseATURI(rec.Uri)
+		if err != nil {
+			continue
+		}
+		tid, err := syntax.ParseTID(aturi.RecordKey().String())
+		if err != nil {
+			continue
+		}
+		if tid.Integer() <= since.Integer() {
+			return true
+		}
 	}
-	eng.Logger.Info("got recent posts", "did", ident.DID.String(), "pds", pdsURL, "count", len(resp.Records))
-	return ident, resp.Records, nil
+	return false
 }
 
 func FetchAndProcessRecent(ctx context.Context, eng *automod.Engine, atid syntax.AtIdentifier, limit int) error {
+	_, err := FetchAndProcessRecentSince(ctx, eng, atid, limit, nil)
+	return err
+}
+
+// Parses a marker for incremental processing with FetchAndProcessRecentSince: either a record key (TID), such as returned by a previous run, or a timestamp (RFC 3339 datetime). Returns the TID at or before which records are considered already processed.
+func ParseSinceMarker(raw string) (syntax.TID, error) {
+	if tid, err := syntax.ParseTID(raw); err == nil {
+		return tid, nil
+	}
+	dt, err := syntax.ParseDatetimeLenient(raw)
+	if err != nil {
+		return "", fmt.Errorf("expected a record key (TID) or timestamp: %q", raw)
+	}
+	// maximum clock ID, so that records created in the same microsecond are also before the marker
+	return syntax.NewTIDFromTime(dt.Time(), 0x3FF), nil
+}
+
+// Same as FetchAndProcessRecent, but if since is not nil, only records newer than that marker (see ParseSinceMarker) are processed. Records with non-TID record keys can't be ordered, so are skipped when since is set.
+//
+// Returns the record key of the newest record processed, which can be passed as the marker for the next run to only process records created since this one. Only TID record keys are returned (others can't be parsed as a marker), so if no records with TID record keys were processed, returns the since marker (or an empty string).
+//
+// At most limit records are fetched, even with a marker. If there are more than that many records newer than the marker, the older ones are never processed (the next run continues from the newest record); this is logged as a warning.
+func FetchAndProcessRecentSince(ctx context.Context, eng *automod.Engine, atid syntax.AtIdentifier, limit int, since *syntax.TID) (string, error) {
+	newest := ""
+	if since != nil {
+		newest = since.String()
+	}
 
-	ident, records, err := FetchRecent(ctx, eng, atid, limit)
+	ident, records, err := fetchRecent(ctx, eng, atid, limit, since)
 	if err != nil {
-		return err
+		return newest, err
+	}
+	if since != nil {
+		// records are ordered by record key, most-recent first, so stop at the first one at or before the marker
+		var newer []*comatproto.RepoListRecords_Record
+		reached := false
+		for _, rec := range records {
+			aturi, err := syntax.ParseATURI(rec.Uri)
+			if err != nil {
+				return newest, fmt.Errorf("parsing PDS record response: %v", err)
+			}
+			tid, err := syntax.ParseTID(aturi.RecordKey().String())
+			if err != nil {
+				eng.Logger.Warn("skipping record with non-TID record key", "uri", rec.Uri)
+				continue
+			}
+			if tid.Integer() <= since.Integer() {
+				reached = true
+				break
+			}
+			newer = append(newer, rec)
+		}
+		// fewer records than the limit means the end of the collection was reached
+		if !reached && len(records) >= limit {
+			eng.Logger.Warn("reached the record limit before the since marker; older new records will not be processed", "did", ident.DID.String(), "since", since.String(), "limit", limit)
+		}
+		records = newer
 	}
 	// records are most-recent first; we want recent but oldest-first, so iterate backwards
 	for i := range records {
 		rec := records[len(records)-i-1]
 		aturi, err := syntax.ParseATURI(rec.Uri)
 		if err != nil {
-			return fmt.Errorf("parsing PDS record response: %v", err)
+			return newest, fmt.Errorf("parsing PDS record response: %v", err)
 		}
 		recCID := syntax.CID(rec.Cid)
 		recBuf := new(bytes.Buffer)
 		if err := rec.Value.Val.MarshalCBOR(recBuf); err != nil {
-			return err
+			return newest, err
 		}
 		recBytes := recBuf.Bytes()
 		op := automod.RecordOp{
@@ -100,8 +204,11 @@ func FetchAndProcessRecent(ctx context.Context, eng *automod.Engine, atid syntax
 		}
 		err = eng.ProcessRecordOp(ctx, op)
 		if err != nil {
-			return err
+			return newest, err
+		}
+		if tid, err := syntax.ParseTID(aturi.RecordKey().String()); err == nil {
+			newest = tid.String()
 		}
 	}
-	return nil
+	return newest, nil
 }
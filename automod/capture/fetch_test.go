@@ -0,0 +1,214 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/engine"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// returns an engine which resolves the account to a mock PDS, serving the given post record keys (most-recent first), and a pointer to the record keys processed by rules
+func testRecentEngine(t *testing.T, did syntax.DID, rkeys []string) (*automod.Engine, *[]string) {
+	eng, processed, _ := testPagedRecentEngine(t, did, rkeys, 0)
+	return eng, processed
+}
+
+// same as testRecentEngine, but the mock PDS returns at most pageSize records per request (if non-zero), with a cursor (the last record key) when the page is full, like a real PDS. also returns a pointer to the cursors of each listRecords request
+func testPagedRecentEngine(t *testing.T, did syntax.DID, rkeys []string, pageSize int) (*automod.Engine, *[]string, *[]string) {
+	var cursors []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/com.atproto.repo.listRecords" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		cursor := r.URL.Query().Get("cursor")
+		cursors = append(cursors, cursor)
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 50
+		}
+		if pageSize > 0 && limit > pageSize {
+			limit = pageSize
+		}
+		start := 0
+		if cursor != "" {
+			start = slices.Index(rkeys, cursor) + 1
+		}
+		page := rkeys[start:min(start+limit, len(rkeys))]
+		records := []map[string]any{}
+		for _, rkey := range page {
+			records = append(records, map[string]any{
+				"uri":   fmt.Sprintf("at://%s/app.bsky.feed.post/%s", did, rkey),
+				"cid":   "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm",
+				"value": map[string]any{"$type": "app.bsky.feed.post", "text": "post " + rkey, "createdAt": "2024-01-01T00:00:00Z"},
+			})
+		}
+		out := map[string]any{"records": records}
+		if len(page) == limit {
+			out["cursor"] = page[len(page)-1]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}))
+	t.Cleanup(srv.Close)
+
+	eng := engine.EngineTestFixture()
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{
+		DID:    did,
+		Handle: syntax.Handle("handle.example.com"),
+		Services: map[string]identity.Service{
+			"atproto_pds": {Type: "AtprotoPersonalDataServer", URL: srv.URL},
+		},
+	})
+	eng.Directory = &dir
+	eng.Config.SkipAccountMeta = true
+
+	var processed []string
+	eng.Rules = automod.RuleSet{
+		PostRules: []automod.PostRuleFunc{
+			func(c *automod.RecordContext, post *appbsky.FeedPost) error {
+				processed = append(processed, c.RecordOp.RecordKey.String())
+				return nil
+			},
+		},
+	}
+	return &eng, &processed, &cursors
+}
+
+func TestFetchAndProcessRecentSince(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	did := syntax.DID("did:plc:abc111")
+	now := time.Now()
+	older := syntax.NewTIDFromTime(now.Add(-2*time.Hour), 0).String()
+	old := syntax.NewTIDFromTime(now.Add(-time.Hour), 0).String()
+	recent := syntax.NewTIDFromTime(now, 0).String()
+	rkeys := []string{recent, old, older}
+
+	// no marker: everything, oldest first
+	eng, processed := testRecentEngine(t, did, rkeys)
+	newest, err := FetchAndProcessRecentSince(ctx, eng, did.AtIdentifier(), 20, nil)
+	assert.NoError(err)
+	assert.Equal([]string{older, old, recent}, *processed)
+	assert.Equal(recent, newest)
+
+	// record key marker
+	eng, processed = testRecentEngine(t, did, rkeys)
+	since, err := ParseSinceMarker(older)
+	assert.NoError(err)
+	newest, err = FetchAndProcessRecentSince(ctx, eng, did.AtIdentifier(), 20, &since)
+	assert.NoError(err)
+	assert.Equal([]string{old, recent}, *processed)
+	assert.Equal(recent, newest)
+
+	// timestamp marker
+	eng, processed = testRecentEngine(t, did, rkeys)
+	since, err = ParseSinceMarker(now.Add(-30 * time.Minute).UTC().Format(time.RFC3339))
+	assert.NoError(err)
+	newest, err = FetchAndProcessRecentSince(ctx, eng, did.AtIdentifier(), 20, &since)
+	assert.NoError(err)
+	assert.Equal([]string{recent}, *processed)
+	assert.Equal(recent, newest)
+
+	// nothing new: the marker is returned as-is, for the next run
+	eng, processed = testRecentEngine(t, did, rkeys)
+	since, err = ParseSinceMarker(recent)
+	assert.NoError(err)
+	newest, err = FetchAndProcessRecentSince(ctx, eng, did.AtIdentifier(), 20, &since)
+	assert.NoError(err)
+	assert.Empty(*processed)
+	assert.Equal(recent, newest)
+
+	// records with non-TID record keys are processed without a marker, but never returned as the marker
+	eng, processed = testRecentEngine(t, did, []string{"self", recent, old})
+	newest, err = FetchAndProcessRecentSince(ctx, eng, did.AtIdentifier(), 20, nil)
+	assert.NoError(err)
+	assert.Equal([]string{old, recent, "self"}, *processed)
+	assert.Equal(recent, newest)
+	_, err = ParseSinceMarker(newest)
+	assert.NoError(err)
+
+	eng, processed = testRecentEngine(t, did, []string{"self"})
+	newest, err = FetchAndProcessRecentSince(ctx, eng, did.AtIdentifier(), 20, nil)
+	assert.NoError(err)
+	assert.Equal([]string{"self"}, *processed)
+	assert.Empty(newest)
+
+	_, err = ParseSinceMarker("yesterday")
+	assert.Error(err)
+}
+
+func TestFetchRecentPagination(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+
+	did := syntax.DID("did:plc:abc111")
+	now := time.Now()
+	// 7 records, most-recent first
+	var rkeys []string
+	for i := 0; i < 7; i++ {
+		rkeys = append(rkeys, syntax.NewTIDFromTime(now.Add(-time.Duration(i)*time.Minute), 0).String())
+	}
+	reversed := slices.Clone(rkeys)
+	slices.Reverse(reversed)
+
+	// limit spans several pages, and is honored exactly
+	eng, processed, cursors := testPagedRecentEngine(t, did, rkeys, 2)
+	err := FetchAndProcessRecent(ctx, eng, did.AtIdentifier(), 5)
+	assert.NoError(err)
+	assert.Equal(reversed[2:], *processed)
+	assert.Equal([]string{"", rkeys[1], rkeys[3]}, *cursors)
+
+	// limit beyond the end of the feed: stops at the last (empty) page
+	eng, processed, cursors = testPagedRecentEngine(t, did, rkeys, 2)
+	err = FetchAndProcessRecent(ctx, eng, did.AtIdentifier(), 20)
+	assert.NoError(err)
+	assert.Equal(reversed, *processed)
+	assert.Equal(4, len(*cursors))
+
+	// end of feed on a full page: one more request, for an empty page without a cursor
+	eng, processed, cursors = testPagedRecentEngine(t, did, rkeys[:6], 2)
+	err = FetchAndProcessRecent(ctx, eng, did.AtIdentifier(), 20)
+	assert.NoError(err)
+	assert.Equal(6, len(*processed))
+	assert.Equal([]string{"", rkeys[1], rkeys[3], rkeys[5]}, *cursors)
+
+	// with a since marker, paging stops at the page which includes the marker
+	eng, processed, cursors = testPagedRecentEngine(t, did, rkeys, 2)
+	since, err := ParseSinceMarker(rkeys[3])
+	assert.NoError(err)
+	newest, err := FetchAndProcessRecentSince(ctx, eng, did.AtIdentifier(), 20, &since)
+	assert.NoError(err)
+	assert.Equal([]string{rkeys[2], rkeys[1], rkeys[0]}, *processed)
+	assert.Equal(rkeys[0], newest)
+	assert.Equal([]string{"", rkeys[1]}, *cursors)
+
+	// the limit is still honored with a marker, but hitting it before reaching the marker is a warning
+	eng, processed, _ = testPagedRecentEngine(t, did, rkeys, 2)
+	var logs bytes.Buffer
+	eng.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	since, err = ParseSinceMarker(rkeys[5])
+	assert.NoError(err)
+	newest, err = FetchAndProcessRecentSince(ctx, eng, did.AtIdentifier(), 3, &since)
+	assert.NoError(err)
+	assert.Equal([]string{rkeys[2], rkeys[1], rkeys[0]}, *processed)
+	assert.Equal(rkeys[0], newest)
+	assert.Contains(logs.String(), "reached the record limit before the since marker")
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 
@@ -55,30 +56,85 @@ func ProcessCaptureRules(eng *automod.Engine, capture AccountCapture) error {
 
 	// all the post rules
 	for _, pr := range capture.PostRecords {
-		aturi, err := syntax.ParseATURI(pr.Uri)
+		op, err := captureRecordOp(pr)
 		if err != nil {
 			return err
 		}
-		did, err := aturi.Authority().AsDID()
-		if err != nil {
-			return err
-		}
-		recCID := syntax.CID(pr.Cid)
-		recBuf := new(bytes.Buffer)
-		if err := pr.Value.Val.MarshalCBOR(recBuf); err != nil {
-			return err
+		eng.Logger.Debug("processing record", "did", op.DID)
+		eng.ProcessRecordOp(ctx, *op)
+	}
+	return nil
+}
+
+// Processes all the records from a capture through the engine, without any network identity or account metadata resolution.
+//
+// The engine's directory is replaced with a mock directory containing only the captured identity, and the captured account metadata (including profile) is seeded in to the engine's account metadata cache. If the capture includes blobs (see CaptureBlobs), blob rules are run against those, and blobs which were not captured are treated as missing, instead of being fetched from the network. Callers should ensure the engine has a local (not shared) cache store. Identity rules are not run, because identity events purge cached account metadata.
+//
+// Failures for individual records are logged and counted, but do not halt the replay.
+func ReplayCapture(ctx context.Context, eng *automod.Engine, capture AccountCapture) error {
+	if err := seedCapture(ctx, eng, capture); err != nil {
+		return err
+	}
+
+	failures := 0
+	for _, pr := range capture.PostRecords {
+		op, err := captureRecordOp(pr)
+		if err == nil {
+			err = eng.ProcessRecordOp(ctx, *op)
 		}
-		recBytes := recBuf.Bytes()
-		eng.Logger.Debug("processing record", "did", did)
-		op := automod.RecordOp{
-			Action:     automod.CreateOp,
-			DID:        did,
-			Collection: aturi.Collection(),
-			RecordKey:  aturi.RecordKey(),
-			CID:        &recCID,
-			RecordCBOR: recBytes,
+		if err != nil {
+			eng.Logger.Error("failed to replay record", "uri", pr.Uri, "err", err)
+			failures++
 		}
-		eng.ProcessRecordOp(ctx, op)
 	}
+	eng.Logger.Info("replayed capture", "did", capture.AccountMeta.Identity.DID.String(), "records", len(capture.PostRecords), "failures", failures)
+	if failures > 0 {
+		return fmt.Errorf("failed to replay %d of %d records", failures, len(capture.PostRecords))
+	}
+	return nil
+}
+
+// Replaces the engine's directory with one containing only the captured identity, seeds the captured account metadata in to the engine's cache, and serves any captured blobs to blob rules
+func seedCapture(ctx context.Context, eng *automod.Engine, capture AccountCapture) error {
+	if capture.AccountMeta.Identity == nil {
+		return fmt.Errorf("capture is missing account identity")
+	}
+	dir := identity.NewMockDirectory()
+	dir.Insert(*capture.AccountMeta.Identity)
+	eng.Directory = &dir
+
+	amJSON, err := json.Marshal(capture.AccountMeta)
+	if err != nil {
+		return err
+	}
+	if err := eng.Cache.Set(ctx, "acct", capture.AccountMeta.Identity.DID.String(), string(amJSON)); err != nil {
+		return fmt.Errorf("seeding account meta cache: %w", err)
+	}
+	useCapturedBlobs(eng, capture)
 	return nil
 }
+
+func captureRecordOp(pr comatproto.RepoListRecords_Record) (*automod.RecordOp, error) {
+	aturi, err := syntax.ParseATURI(pr.Uri)
+	if err != nil {
+		return nil, err
+	}
+	did, err := aturi.Authority().AsDID()
+	if err != nil {
+		return nil, err
+	}
+	recCID := syntax.CID(pr.Cid)
+	recBuf := new(bytes.Buffer)
+	if err := pr.Value.Val.MarshalCBOR(recBuf); err != nil {
+		return nil, err
+	}
+	op := automod.RecordOp{
+		Action:     automod.CreateOp,
+		DID:        did,
+		Collection: aturi.Collection(),
+		RecordKey:  aturi.RecordKey(),
+		CID:        &recCID,
+		RecordCBOR: recBuf.Bytes(),
+	}
+	return &op, nil
+}
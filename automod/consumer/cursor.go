@@ -0,0 +1,107 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// how long persisted cursors are kept in redis, after the last update
+var cursorTTL = 14 * 24 * time.Hour
+
+// suffix of the redis key for the timestamp of the event at the firehose cursor
+var cursorTimeKeySuffix = "/time"
+
+// Persisted cursor state for a consumer, for inspecting where it is up to. See ReadCursorStatus.
+type CursorStatus struct {
+	// "firehose" or "jetstream"
+	Source string
+	// redis key the cursor was read from
+	Key string
+	// for the firehose, the event sequence number; for jetstream, the event timestamp (unix microseconds)
+	Cursor int64
+	// timestamp of the event at the cursor, if known. for the firehose, this is approximate, and not available for cursors persisted by older versions
+	EventTime *time.Time
+	// time remaining before the persisted cursor expires (if the consumer stops updating it)
+	TTL time.Duration
+}
+
+// Lag returns how far the cursor is behind the given time, or false if the event time is not known
+func (s *CursorStatus) Lag(now time.Time) (time.Duration, bool) {
+	if s.EventTime == nil {
+		return 0, false
+	}
+	return now.Sub(*s.EventTime), true
+}
+
+// ReadCursorStatus reads the persisted cursor for a consumer of the given source ("firehose" or "jetstream") and upstream host, without modifying anything. Returns nil (and no error) if there is no persisted cursor.
+func ReadCursorStatus(ctx context.Context, rdb *redis.Client, source, host string) (*CursorStatus, error) {
+	var key string
+	switch source {
+	case "firehose":
+		key = cursorKeyForHost(firehoseCursorKey, host)
+	case "jetstream":
+		key = cursorKeyForHost(jetstreamCursorKey, host)
+	default:
+		return nil, fmt.Errorf("unknown cursor source: %s", source)
+	}
+
+	val, err := rdb.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading cursor (%s): %w", key, err)
+	}
+
+	status := CursorStatus{
+		Source: source,
+		Key:    key,
+		Cursor: val,
+	}
+	ttl, err := rdb.TTL(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("reading cursor TTL (%s): %w", key, err)
+	}
+	status.TTL = ttl
+
+	var eventUS int64
+	if source == "jetstream" {
+		eventUS = val
+	} else {
+		eventUS, err = rdb.Get(ctx, key+cursorTimeKeySuffix).Int64()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("reading cursor event time (%s): %w", key, err)
+		}
+	}
+	if eventUS > 0 {
+		t := time.UnixMicro(eventUS).UTC()
+		status.EventTime = &t
+	}
+	return &status, nil
+}
+
+// Special values for a consumer StartCursor
+const (
+	// start from the live tip of the stream, without a cursor
+	CursorLive int64 = -1
+	// start from the oldest event the upstream still has (firehose only)
+	CursorOldest int64 = -2
+)
+
+// ParseCursor parses a start cursor: a non-negative integer (firehose sequence number, or jetstream timestamp in unix microseconds), "live", or "oldest"
+func ParseCursor(raw string) (int64, error) {
+	switch raw {
+	case "live":
+		return CursorLive, nil
+	case "oldest":
+		return CursorOldest, nil
+	}
+	val, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || val < 0 {
+		return 0, fmt.Errorf("invalid cursor (expected a non-negative integer, 'live', or 'oldest'): %s", raw)
+	}
+	return val, nil
+}
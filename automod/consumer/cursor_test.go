@@ -0,0 +1,179 @@
+package consumer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCursor(t *testing.T) {
+	assert := assert.New(t)
+
+	for raw, expected := range map[string]int64{
+		"0":                0,
+		"12345":            12345,
+		"1704067200000000": 1704067200000000,
+		"live":             CursorLive,
+		"oldest":           CursorOldest,
+	} {
+		val, err := ParseCursor(raw)
+		assert.NoError(err, raw)
+		assert.Equal(expected, val, raw)
+	}
+
+	for _, raw := range []string{"", "-1", "-2", "1.5", "abc", "LIVE", " 123", "99999999999999999999"} {
+		_, err := ParseCursor(raw)
+		assert.Error(err, raw)
+	}
+}
+
+func TestReadOnlyCursor(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// a client for a redis server which isn't running, so any attempt to persist a cursor fails
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+
+	fc := FirehoseConsumer{Host: "wss://relay.example.com", RedisClient: rdb, Logger: slog.Default(), lastSeq: 123}
+	assert.Error(fc.PersistCursor(ctx))
+	fc.ReadOnlyCursor = true
+	assert.NoError(fc.PersistCursor(ctx))
+	// returns immediately, instead of persisting on a timer
+	assert.NoError(fc.RunPersistCursor(ctx))
+
+	jc := JetstreamConsumer{Host: "wss://jetstream.example.com", RedisClient: rdb, Logger: slog.Default(), lastCursor: 1704067200000000}
+	assert.Error(jc.PersistCursor(ctx))
+	jc.ReadOnlyCursor = true
+	assert.NoError(jc.PersistCursor(ctx))
+	assert.NoError(jc.RunPersistCursor(ctx))
+}
+
+// starts a minimal redis server, which answers GET and TTL from a fixed set of keys (with no expiry), and errors for any other command. returns its address
+func testRedisServer(t *testing.T, vals map[string]string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					args, err := readRESPCommand(rd)
+					if err != nil {
+						return
+					}
+					var reply string
+					switch strings.ToUpper(args[0]) {
+					case "GET":
+						if v, ok := vals[args[1]]; ok {
+							reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+						} else {
+							reply = "$-1\r\n"
+						}
+					case "TTL":
+						reply = ":-1\r\n"
+					default:
+						reply = "-ERR unknown command\r\n"
+					}
+					if _, err := conn.Write([]byte(reply)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// reads a single command (an array of bulk strings) in the redis protocol
+func readRESPCommand(rd *bufio.Reader) ([]string, error) {
+	readLine := func(prefix byte) (int, error) {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		if len(line) < 2 || line[0] != prefix {
+			return 0, fmt.Errorf("unexpected line: %q", line)
+		}
+		return strconv.Atoi(line[1:])
+	}
+	n, err := readLine('*')
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		size, err := readLine('$')
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return args, nil
+}
+
+func TestReadCursorStatus(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	addr := testRedisServer(t, map[string]string{
+		// cursor persisted by an older version, under the legacy key, which the consumer no longer resumes from
+		"hepa/seq":                                    "111",
+		"hepa/seq/relay.example.com":                  "222",
+		"hepa/seq/relay.example.com/time":             "1704067200000000",
+		"hepa/jetstream-cursor/jetstream.example.com": "1704067200000000",
+	})
+	rdb := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1})
+	defer rdb.Close()
+
+	// only the legacy key: no persisted cursor
+	status, err := ReadCursorStatus(ctx, rdb, "firehose", "wss://other.example.com")
+	assert.NoError(err)
+	assert.Nil(status)
+
+	status, err = ReadCursorStatus(ctx, rdb, "firehose", "wss://relay.example.com")
+	assert.NoError(err)
+	if assert.NotNil(status) {
+		assert.Equal("hepa/seq/relay.example.com", status.Key)
+		assert.Equal(int64(222), status.Cursor)
+		if assert.NotNil(status.EventTime) {
+			assert.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), *status.EventTime)
+		}
+	}
+
+	status, err = ReadCursorStatus(ctx, rdb, "jetstream", "wss://jetstream.example.com")
+	assert.NoError(err)
+	if assert.NotNil(status) {
+		assert.Equal(int64(1704067200000000), status.Cursor)
+		assert.NotNil(status.EventTime)
+	}
+
+	_, err = ReadCursorStatus(ctx, rdb, "other", "wss://relay.example.com")
+	assert.Error(err)
+}
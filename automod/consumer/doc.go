@@ -1,2 +1,4 @@
 // Code for consuming from atproto firehose and ozone event stream, pushing events in to automod engine.
+//
+// Repo events can be consumed either from a relay firehose (FirehoseConsumer) or from Jetstream (JetstreamConsumer). See JetstreamConsumer for differences in the event data available to rules.
 package consumer
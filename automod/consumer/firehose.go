@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -28,14 +29,29 @@ import (
 // TODO: should probably make this not hepa-specific; or even configurable
 var firehoseCursorKey = "hepa/seq"
 
+// Returns the redis key for the cursor of a specific upstream host. Sequence numbers are only meaningful for the host which issued them, so switching relays should not resume from another relay's cursor.
+func cursorKeyForHost(prefix, host string) string {
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return prefix + "/" + strings.ToLower(host)
+}
+
 type FirehoseConsumer struct {
 	Parallelism int
+	// size of the bounded work queue between the websocket reader and the workers. zero for the default (1000)
+	QueueSize   int
 	Logger      *slog.Logger
 	RedisClient *redis.Client
 	Engine      *automod.Engine
 	Host        string
+	// if non-empty, only record ops in these collections are processed; others are skipped before reading record data
+	Collections []syntax.NSID
+	// if set, overrides the persisted cursor for this run: a sequence number, CursorLive, or CursorOldest
+	StartCursor *int64
+	// if true, the cursor is never persisted. for one-off replays (eg, with StartCursor), so that the stored cursor isn't clobbered
+	ReadOnlyCursor bool
 
-	// TODO: prefilter record collections; or predicate function?
 	// TODO: enable/disable event types; or predicate function?
 
 	// lastSeq is the most recent event sequence number we've received and begun to handle.
@@ -43,6 +59,12 @@ type FirehoseConsumer struct {
 	// The value is best-effort (the stream handling itself is concurrent, so event numbers may not be monotonic),
 	// but nonetheless, you must use atomics when updating or reading this (to avoid data races).
 	lastSeq int64
+
+	// timestamp (unix microseconds) of the most recently processed event, for the lag metric. Must use atomics.
+	lastEventUS int64
+
+	// if true, subscribe with an explicit zero cursor (the oldest available event) until a sequence number has been seen
+	fromOldest bool
 }
 
 func (fc *FirehoseConsumer) Run(ctx context.Context) error {
@@ -51,22 +73,48 @@ func (fc *FirehoseConsumer) Run(ctx context.Context) error {
 		return fmt.Errorf("nil engine")
 	}
 
-	cur, err := fc.ReadLastCursor(ctx)
-	if err != nil {
-		return err
+	var cur int64
+	if fc.StartCursor != nil {
+		switch *fc.StartCursor {
+		case CursorLive:
+		case CursorOldest, 0:
+			// an explicit zero cursor is how the oldest available event is requested
+			fc.fromOldest = true
+		default:
+			cur = *fc.StartCursor
+		}
+		fc.Logger.Info("overriding persisted cursor", "start_cursor", *fc.StartCursor, "read_only", fc.ReadOnlyCursor)
+	} else {
+		var err error
+		cur, err = fc.ReadLastCursor(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if cur > 0 {
+		atomic.StoreInt64(&fc.lastSeq, cur)
 	}
 
+	go runLagGauge(ctx, "firehose", &fc.lastEventUS)
+
+	return runWithReconnect(ctx, fc.Logger, "firehose", fc.subscribe)
+}
+
+// connects to upstream and handles events until the connection fails, resuming from the most recently seen sequence number (if any)
+func (fc *FirehoseConsumer) subscribe(ctx context.Context) error {
+	cur := atomic.LoadInt64(&fc.lastSeq)
+
 	dialer := websocket.DefaultDialer
 	u, err := url.Parse(fc.Host)
 	if err != nil {
 		return fmt.Errorf("invalid Host URI: %w", err)
 	}
 	u.Path = "xrpc/com.atproto.sync.subscribeRepos"
-	if cur != 0 {
+	if cur != 0 || fc.fromOldest {
 		u.RawQuery = fmt.Sprintf("cursor=%d", cur)
 	}
 	fc.Logger.Info("subscribing to repo event stream", "upstream", fc.Host, "cursor", cur)
-	con, _, err := dialer.Dial(u.String(), http.Header{
+	con, _, err := dialer.DialContext(ctx, u.String(), http.Header{
 		"User-Agent": []string{fmt.Sprintf("hepa/%s", versioninfo.Short())},
 	})
 	if err != nil {
@@ -76,6 +124,7 @@ func (fc *FirehoseConsumer) Run(ctx context.Context) error {
 	rsc := &events.RepoStreamCallbacks{
 		RepoCommit: func(evt *comatproto.SyncSubscribeRepos_Commit) error {
 			atomic.StoreInt64(&fc.lastSeq, evt.Seq)
+			defer recordEventTimeString(&fc.lastEventUS, evt.Time)
 			return fc.HandleRepoCommit(ctx, evt)
 		},
 		RepoIdentity: func(evt *comatproto.SyncSubscribeRepos_Identity) error {
@@ -83,6 +132,7 @@ func (fc *FirehoseConsumer) Run(ctx context.Context) error {
 			if err := fc.Engine.ProcessIdentityEvent(ctx, *evt); err != nil {
 				fc.Logger.Error("processing repo identity failed", "did", evt.Did, "seq", evt.Seq, "err", err)
 			}
+			recordEventTimeString(&fc.lastEventUS, evt.Time)
 			return nil
 		},
 		RepoAccount: func(evt *comatproto.SyncSubscribeRepos_Account) error {
@@ -90,10 +140,13 @@ func (fc *FirehoseConsumer) Run(ctx context.Context) error {
 			if err := fc.Engine.ProcessAccountEvent(ctx, *evt); err != nil {
 				fc.Logger.Error("processing repo account failed", "did", evt.Did, "seq", evt.Seq, "err", err)
 			}
+			recordEventTimeString(&fc.lastEventUS, evt.Time)
 			return nil
 		},
 		// NOTE: no longer process #handle events
 		// NOTE: no longer process #tombstone events
+		// a single corrupt event shouldn't stall processing with a reconnect loop at the same cursor
+		SkipDecodeErrors: true,
 	}
 
 	var scheduler events.Scheduler
@@ -116,7 +169,13 @@ func (fc *FirehoseConsumer) Run(ctx context.Context) error {
 		fc.Logger.Info("hepa scheduler configured", "scheduler", "autoscaling", "initial", scaleSettings.Concurrency, "max", scaleSettings.MaxConcurrency)
 	}
 
-	return events.HandleRepoStream(ctx, con, scheduler, fc.Logger)
+	queueSize := fc.QueueSize
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+	queued := newQueuedScheduler(ctx, scheduler, queueSize, "firehose", fc.Logger)
+
+	return events.HandleRepoStreamWithCallbacks(ctx, con, queued, rsc, fc.Logger)
 }
 
 // NOTE: for now, this function basically never errors, just logs and returns nil. Should think through error processing better.
@@ -136,6 +195,20 @@ func (fc *FirehoseConsumer) HandleRepoCommit(ctx context.Context, evt *comatprot
 		return nil
 	}
 
+	// skip parsing the CAR entirely if no ops in this commit are in the collection allowlist
+	if len(fc.Collections) > 0 {
+		wanted := false
+		for _, op := range evt.Ops {
+			if collection, _, err := splitRepoPath(op.Path); err == nil && wantCollection(fc.Collections, collection) {
+				wanted = true
+				break
+			}
+		}
+		if !wanted {
+			return nil
+		}
+	}
+
 	rr, err := repo.ReadRepoFromCar(ctx, bytes.NewReader(evt.Blocks))
 	if err != nil {
 		logger.Error("failed to read repo from car", "err", err)
@@ -149,6 +222,10 @@ func (fc *FirehoseConsumer) HandleRepoCommit(ctx context.Context, evt *comatprot
 			logger.Error("invalid path in repo op")
 			return nil
 		}
+		if !wantCollection(fc.Collections, collection) {
+			continue
+		}
+		countRecordOp("firehose", op.Action, collection)
 
 		ek := repomgr.EventKind(op.Action)
 		switch ek {
@@ -216,27 +293,38 @@ func (fc *FirehoseConsumer) ReadLastCursor(ctx context.Context) (int64, error) {
 		return 0, nil
 	}
 
-	val, err := fc.RedisClient.Get(ctx, firehoseCursorKey).Int64()
+	key := cursorKeyForHost(firehoseCursorKey, fc.Host)
+	val, err := fc.RedisClient.Get(ctx, key).Int64()
 	if err == redis.Nil {
-		fc.Logger.Info("no pre-existing cursor in redis")
+		// the legacy (not host-specific) key is deliberately not read: it may be from a different relay
+		fc.Logger.Info("no pre-existing cursor in redis", "key", key)
 		return 0, nil
 	} else if err != nil {
 		return 0, err
 	}
-	fc.Logger.Info("successfully found prior subscription cursor seq in redis", "seq", val)
+	fc.Logger.Info("successfully found prior subscription cursor seq in redis", "seq", val, "key", key)
 	return val, nil
 }
 
 func (fc *FirehoseConsumer) PersistCursor(ctx context.Context) error {
 	// if redis isn't configured, just skip
-	if fc.RedisClient == nil {
+	if fc.RedisClient == nil || fc.ReadOnlyCursor {
 		return nil
 	}
 	lastSeq := atomic.LoadInt64(&fc.lastSeq)
 	if lastSeq <= 0 {
 		return nil
 	}
-	err := fc.RedisClient.Set(ctx, firehoseCursorKey, lastSeq, 14*24*time.Hour).Err()
+	key := cursorKeyForHost(firehoseCursorKey, fc.Host)
+	// the timestamp of the most recent event is stored alongside the seq, for inspecting lag (see ReadCursorStatus). it is approximate, because events are processed concurrently
+	lastEventUS := atomic.LoadInt64(&fc.lastEventUS)
+	_, err := fc.RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, lastSeq, cursorTTL)
+		if lastEventUS > 0 {
+			pipe.Set(ctx, key+cursorTimeKeySuffix, lastEventUS, cursorTTL)
+		}
+		return nil
+	})
 	return err
 }
 
@@ -244,7 +332,7 @@ func (fc *FirehoseConsumer) PersistCursor(ctx context.Context) error {
 func (fc *FirehoseConsumer) RunPersistCursor(ctx context.Context) error {
 
 	// if redis isn't configured, just skip
-	if fc.RedisClient == nil {
+	if fc.RedisClient == nil || fc.ReadOnlyCursor {
 		return nil
 	}
 	ticker := time.NewTicker(5 * time.Second)
@@ -254,7 +342,7 @@ func (fc *FirehoseConsumer) RunPersistCursor(ctx context.Context) error {
 			lastSeq := atomic.LoadInt64(&fc.lastSeq)
 			if lastSeq >= 1 {
 				fc.Logger.Info("persisting final cursor seq value", "seq", lastSeq)
-				err := fc.PersistCursor(ctx)
+				err := fc.PersistCursor(context.Background())
 				if err != nil {
 					fc.Logger.Error("failed to persist cursor", "err", err, "seq", lastSeq)
 				}
@@ -0,0 +1,334 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/data"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+
+	"github.com/carlmjohnson/versioninfo"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// TODO: should probably make this not hepa-specific; or even configurable
+var jetstreamCursorKey = "hepa/jetstream-cursor"
+
+// Consumes from a Jetstream instance (JSON-encoded firehose), as a lighter-weight alternative to the full relay firehose.
+//
+// Jetstream events do not include repo blocks (MST nodes or commit signatures), only the record JSON. Records are re-encoded as CBOR before being passed to the engine, so rules see the same RecordOp fields as with the relay firehose (including RecordCBOR and CID), but the record CID is as reported by Jetstream and is not verified against the record bytes. Commit metadata other than the individual ops (eg, rev, "tooBig") is not available. Identity and account events are passed through with the same fields as the relay firehose.
+type JetstreamConsumer struct {
+	// number of parallel workers. events for the same account are always processed by the same worker, in order
+	Parallelism int
+	Logger      *slog.Logger
+	RedisClient *redis.Client
+	Engine      *automod.Engine
+	// Jetstream host, including scheme (eg, "wss://jetstream2.us-east.bsky.network")
+	Host string
+	// if non-empty, only record ops in these collections are processed. also passed upstream as "wantedCollections", so Jetstream can filter server-side
+	Collections []syntax.NSID
+	// if set, overrides the persisted cursor for this run: a timestamp (unix microseconds), or CursorLive. CursorOldest is not supported
+	StartCursor *int64
+	// if true, the cursor is never persisted. for one-off replays (eg, with StartCursor), so that the stored cursor isn't clobbered
+	ReadOnlyCursor bool
+
+	// lastCursor is the timestamp (in unix microseconds) of the most recent event we've received and begun to handle. Jetstream cursors are timestamps, not sequence numbers.
+	// Must use atomics when updating or reading this.
+	lastCursor int64
+
+	// timestamp (unix microseconds) of the most recently processed event, for the lag metric. Must use atomics.
+	lastEventUS int64
+}
+
+// JSON event from Jetstream
+type JetstreamEvent struct {
+	DID      string                                  `json:"did"`
+	TimeUS   int64                                   `json:"time_us"`
+	Kind     string                                  `json:"kind"`
+	Commit   *JetstreamCommit                        `json:"commit,omitempty"`
+	Identity *comatproto.SyncSubscribeRepos_Identity `json:"identity,omitempty"`
+	Account  *comatproto.SyncSubscribeRepos_Account  `json:"account,omitempty"`
+}
+
+type JetstreamCommit struct {
+	Rev        string          `json:"rev"`
+	Operation  string          `json:"operation"`
+	Collection string          `json:"collection"`
+	RKey       string          `json:"rkey"`
+	Record     json.RawMessage `json:"record,omitempty"`
+	CID        string          `json:"cid,omitempty"`
+}
+
+func (jc *JetstreamConsumer) Run(ctx context.Context) error {
+
+	if jc.Engine == nil {
+		return fmt.Errorf("nil engine")
+	}
+
+	var cur int64
+	if jc.StartCursor != nil {
+		switch *jc.StartCursor {
+		case CursorLive:
+		case CursorOldest:
+			return fmt.Errorf("'oldest' cursor not supported for jetstream")
+		default:
+			cur = *jc.StartCursor
+		}
+		jc.Logger.Info("overriding persisted cursor", "start_cursor", *jc.StartCursor, "read_only", jc.ReadOnlyCursor)
+	} else {
+		var err error
+		cur, err = jc.ReadLastCursor(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if cur > 0 {
+		atomic.StoreInt64(&jc.lastCursor, cur)
+	}
+
+	go runLagGauge(ctx, "jetstream", &jc.lastEventUS)
+
+	return runWithReconnect(ctx, jc.Logger, "jetstream", jc.subscribe)
+}
+
+// connects to upstream and handles events until the connection fails, resuming from the most recently seen cursor (if any)
+func (jc *JetstreamConsumer) subscribe(ctx context.Context) error {
+	cur := atomic.LoadInt64(&jc.lastCursor)
+
+	u, err := url.Parse(jc.Host)
+	if err != nil {
+		return fmt.Errorf("invalid Host URI: %w", err)
+	}
+	u.Path = "subscribe"
+	q := url.Values{}
+	if cur != 0 {
+		q.Set("cursor", fmt.Sprintf("%d", cur))
+	}
+	for _, c := range jc.Collections {
+		q.Add("wantedCollections", c.String())
+	}
+	u.RawQuery = q.Encode()
+	jc.Logger.Info("subscribing to jetstream", "upstream", jc.Host, "cursor", cur)
+	con, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), http.Header{
+		"User-Agent": []string{fmt.Sprintf("hepa/%s", versioninfo.Short())},
+	})
+	if err != nil {
+		return fmt.Errorf("subscribing to jetstream failed (dialing): %w", err)
+	}
+	defer con.Close()
+
+	// unblock the read loop on shutdown
+	connDone := make(chan struct{})
+	defer close(connDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			con.Close()
+		case <-connDone:
+		}
+	}()
+
+	parallelism := jc.Parallelism
+	if parallelism <= 0 {
+		parallelism = 10
+	}
+	queues := make([]chan *JetstreamEvent, parallelism)
+	wg := sync.WaitGroup{}
+	for i := range queues {
+		queues[i] = make(chan *JetstreamEvent, 100)
+		wg.Add(1)
+		go func(q chan *JetstreamEvent) {
+			defer wg.Done()
+			for evt := range q {
+				jc.HandleEvent(ctx, evt)
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, q := range queues {
+			close(q)
+		}
+		wg.Wait()
+	}()
+
+	for {
+		_, msg, err := con.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("reading from jetstream: %w", err)
+		}
+
+		var evt JetstreamEvent
+		if err := json.Unmarshal(msg, &evt); err != nil {
+			jc.Logger.Error("failed to parse jetstream event", "err", err)
+			continue
+		}
+		atomic.StoreInt64(&jc.lastCursor, evt.TimeUS)
+
+		h := fnv.New32a()
+		h.Write([]byte(evt.DID))
+		queues[h.Sum32()%uint32(len(queues))] <- &evt
+	}
+}
+
+// NOTE: like HandleRepoCommit, this function logs errors instead of returning them
+func (jc *JetstreamConsumer) HandleEvent(ctx context.Context, evt *JetstreamEvent) {
+	logger := jc.Logger.With("event", evt.Kind, "did", evt.DID, "time_us", evt.TimeUS)
+	defer recordEventTime(&jc.lastEventUS, evt.TimeUS)
+
+	switch evt.Kind {
+	case "commit":
+		if evt.Commit == nil {
+			logger.Error("commit event missing commit")
+			return
+		}
+		if len(jc.Collections) > 0 {
+			if collection, err := syntax.ParseNSID(evt.Commit.Collection); err != nil || !wantCollection(jc.Collections, collection) {
+				return
+			}
+		}
+		op, err := jetstreamRecordOp(evt)
+		if err != nil {
+			logger.Error("invalid jetstream commit", "err", err)
+			return
+		}
+		countRecordOp("jetstream", evt.Commit.Operation, op.Collection)
+		if err := jc.Engine.ProcessRecordOp(ctx, *op); err != nil {
+			logger.Error("engine failed to process record", "err", err)
+		}
+	case "identity":
+		if evt.Identity == nil {
+			logger.Error("identity event missing identity")
+			return
+		}
+		if err := jc.Engine.ProcessIdentityEvent(ctx, *evt.Identity); err != nil {
+			logger.Error("processing repo identity failed", "err", err)
+		}
+	case "account":
+		if evt.Account == nil {
+			logger.Error("account event missing account")
+			return
+		}
+		if err := jc.Engine.ProcessAccountEvent(ctx, *evt.Account); err != nil {
+			logger.Error("processing repo account failed", "err", err)
+		}
+	default:
+		logger.Debug("ignoring unknown jetstream event kind")
+	}
+}
+
+// converts a Jetstream commit event to an engine record op, re-encoding the record JSON as CBOR
+func jetstreamRecordOp(evt *JetstreamEvent) (*automod.RecordOp, error) {
+	did, err := syntax.ParseDID(evt.DID)
+	if err != nil {
+		return nil, err
+	}
+	collection, err := syntax.ParseNSID(evt.Commit.Collection)
+	if err != nil {
+		return nil, err
+	}
+	rkey, err := syntax.ParseRecordKey(evt.Commit.RKey)
+	if err != nil {
+		return nil, err
+	}
+
+	op := automod.RecordOp{
+		DID:        did,
+		Collection: collection,
+		RecordKey:  rkey,
+	}
+	switch evt.Commit.Operation {
+	case "create":
+		op.Action = automod.CreateOp
+	case "update":
+		op.Action = automod.UpdateOp
+	case "delete":
+		op.Action = automod.DeleteOp
+		return &op, nil
+	default:
+		return nil, fmt.Errorf("unknown commit operation: %s", evt.Commit.Operation)
+	}
+
+	recCID, err := syntax.ParseCID(evt.Commit.CID)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := data.UnmarshalJSON(evt.Commit.Record)
+	if err != nil {
+		return nil, fmt.Errorf("parsing record JSON: %w", err)
+	}
+	recCBOR, err := data.MarshalCBOR(obj)
+	if err != nil {
+		return nil, fmt.Errorf("encoding record CBOR: %w", err)
+	}
+	op.CID = &recCID
+	op.RecordCBOR = recCBOR
+	return &op, nil
+}
+
+func (jc *JetstreamConsumer) ReadLastCursor(ctx context.Context) (int64, error) {
+	// if redis isn't configured, just skip
+	if jc.RedisClient == nil {
+		jc.Logger.Info("redis not configured, skipping cursor read")
+		return 0, nil
+	}
+
+	val, err := jc.RedisClient.Get(ctx, cursorKeyForHost(jetstreamCursorKey, jc.Host)).Int64()
+	if err == redis.Nil {
+		jc.Logger.Info("no pre-existing jetstream cursor in redis")
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	jc.Logger.Info("successfully found prior jetstream cursor in redis", "time_us", val)
+	return val, nil
+}
+
+func (jc *JetstreamConsumer) PersistCursor(ctx context.Context) error {
+	// if redis isn't configured, just skip
+	if jc.RedisClient == nil || jc.ReadOnlyCursor {
+		return nil
+	}
+	lastCursor := atomic.LoadInt64(&jc.lastCursor)
+	if lastCursor <= 0 {
+		return nil
+	}
+	return jc.RedisClient.Set(ctx, cursorKeyForHost(jetstreamCursorKey, jc.Host), lastCursor, cursorTTL).Err()
+}
+
+// this method runs in a loop, persisting the current cursor state every 5 seconds
+func (jc *JetstreamConsumer) RunPersistCursor(ctx context.Context) error {
+
+	// if redis isn't configured, just skip
+	if jc.RedisClient == nil || jc.ReadOnlyCursor {
+		return nil
+	}
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := jc.PersistCursor(context.Background()); err != nil {
+				jc.Logger.Error("failed to persist jetstream cursor", "err", err)
+			}
+			return nil
+		case <-ticker.C:
+			if err := jc.PersistCursor(ctx); err != nil {
+				jc.Logger.Error("failed to persist jetstream cursor", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/engine"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testRecordCID = "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"
+
+func testJetstreamCommit(op, collection, rkey, record string) *JetstreamEvent {
+	evt := JetstreamEvent{
+		DID:    "did:plc:abc111",
+		TimeUS: 1704067200000000,
+		Kind:   "commit",
+		Commit: &JetstreamCommit{
+			Rev:        "3kabc",
+			Operation:  op,
+			Collection: collection,
+			RKey:       rkey,
+		},
+	}
+	if record != "" {
+		evt.Commit.Record = json.RawMessage(record)
+		evt.Commit.CID = testRecordCID
+	}
+	return &evt
+}
+
+func TestJetstreamRecordOp(t *testing.T) {
+	postJSON := `{"$type": "app.bsky.feed.post", "text": "hello world", "createdAt": "2024-01-01T00:00:00Z"}`
+
+	tests := []struct {
+		name   string
+		evt    *JetstreamEvent
+		action string
+		err    bool
+	}{
+		{name: "create", evt: testJetstreamCommit("create", "app.bsky.feed.post", "3kabc", postJSON), action: automod.CreateOp},
+		{name: "update", evt: testJetstreamCommit("update", "app.bsky.feed.post", "3kabc", postJSON), action: automod.UpdateOp},
+		{name: "delete", evt: testJetstreamCommit("delete", "app.bsky.feed.post", "3kabc", ""), action: automod.DeleteOp},
+		{name: "unknown operation", evt: testJetstreamCommit("merge", "app.bsky.feed.post", "3kabc", postJSON), err: true},
+		{name: "invalid collection", evt: testJetstreamCommit("create", "not a collection", "3kabc", postJSON), err: true},
+		{name: "invalid rkey", evt: testJetstreamCommit("create", "app.bsky.feed.post", "..", postJSON), err: true},
+		{name: "create without record", evt: testJetstreamCommit("create", "app.bsky.feed.post", "3kabc", ""), err: true},
+		{name: "invalid record", evt: testJetstreamCommit("create", "app.bsky.feed.post", "3kabc", `{"text": 1.5}`), err: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			op, err := jetstreamRecordOp(tc.evt)
+			if tc.err {
+				assert.Error(err)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+			assert.Equal(tc.action, op.Action)
+			assert.Equal(syntax.DID("did:plc:abc111"), op.DID)
+			assert.Equal(syntax.NSID("app.bsky.feed.post"), op.Collection)
+			assert.Equal(syntax.RecordKey("3kabc"), op.RecordKey)
+			if tc.action == automod.DeleteOp {
+				assert.Nil(op.CID)
+				assert.Nil(op.RecordCBOR)
+				return
+			}
+			if assert.NotNil(op.CID) {
+				assert.Equal(testRecordCID, op.CID.String())
+			}
+			// the record JSON is re-encoded as CBOR, which decodes to the same record
+			var post appbsky.FeedPost
+			assert.NoError(post.UnmarshalCBOR(bytes.NewReader(op.RecordCBOR)))
+			assert.Equal("hello world", post.Text)
+		})
+	}
+}
+
+func TestJetstreamHandleEvent(t *testing.T) {
+	ctx := context.Background()
+	postJSON := `{"$type": "app.bsky.feed.post", "text": "hello world", "createdAt": "2024-01-01T00:00:00Z"}`
+
+	tests := []struct {
+		name        string
+		evt         *JetstreamEvent
+		collections []syntax.NSID
+		// "action collection/rkey" of each record op seen by rules
+		seen []string
+	}{
+		{name: "create", evt: testJetstreamCommit("create", "app.bsky.feed.post", "3kabc", postJSON), seen: []string{"create app.bsky.feed.post/3kabc"}},
+		{name: "update", evt: testJetstreamCommit("update", "app.bsky.feed.post", "3kabc", postJSON), seen: []string{"update app.bsky.feed.post/3kabc"}},
+		{name: "delete", evt: testJetstreamCommit("delete", "app.bsky.feed.post", "3kabc", ""), seen: []string{"delete app.bsky.feed.post/3kabc"}},
+		{name: "wanted collection", evt: testJetstreamCommit("create", "app.bsky.feed.post", "3kabc", postJSON), collections: []syntax.NSID{"app.bsky.feed.post"}, seen: []string{"create app.bsky.feed.post/3kabc"}},
+		{name: "unwanted collection", evt: testJetstreamCommit("create", "app.bsky.feed.like", "3kabc", `{"$type": "app.bsky.feed.like"}`), collections: []syntax.NSID{"app.bsky.feed.post"}},
+		{name: "invalid commit", evt: testJetstreamCommit("merge", "app.bsky.feed.post", "3kabc", postJSON)},
+		{name: "commit missing commit", evt: &JetstreamEvent{DID: "did:plc:abc111", Kind: "commit"}},
+		{name: "unknown kind", evt: &JetstreamEvent{DID: "did:plc:abc111", Kind: "other"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			var mu sync.Mutex
+			seen := []string{}
+			record := func(c *automod.RecordContext) error {
+				mu.Lock()
+				defer mu.Unlock()
+				seen = append(seen, c.RecordOp.Action+" "+c.RecordOp.Collection.String()+"/"+c.RecordOp.RecordKey.String())
+				return nil
+			}
+			eng := engine.EngineTestFixture()
+			eng.Rules = automod.RuleSet{
+				RecordRules:       []automod.RecordRuleFunc{record},
+				RecordDeleteRules: []automod.RecordRuleFunc{record},
+			}
+			jc := JetstreamConsumer{
+				Logger:      slog.Default(),
+				Engine:      &eng,
+				Collections: tc.collections,
+			}
+			jc.HandleEvent(ctx, tc.evt)
+			if tc.seen == nil {
+				tc.seen = []string{}
+			}
+			assert.Equal(tc.seen, seen)
+			// the event time is recorded for the lag metric, even if the event is skipped
+			assert.Equal(tc.evt.TimeUS, jc.lastEventUS)
+		})
+	}
+}
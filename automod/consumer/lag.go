@@ -0,0 +1,53 @@
+package consumer
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// how often the lag gauge is updated
+var lagUpdatePeriod = 5 * time.Second
+
+// Records the timestamp of a processed event (in unix microseconds), if it is more recent than the currently stored value. Events are processed concurrently, so this keeps the value monotonic.
+func recordEventTime(lastEventUS *int64, us int64) {
+	for {
+		prev := atomic.LoadInt64(lastEventUS)
+		if us <= prev {
+			return
+		}
+		if atomic.CompareAndSwapInt64(lastEventUS, prev, us) {
+			return
+		}
+	}
+}
+
+// Parses an event "time" field and records it with recordEventTime. Unparsable timestamps are ignored.
+func recordEventTimeString(lastEventUS *int64, ts string) {
+	t, err := syntax.ParseDatetimeLenient(ts)
+	if err != nil {
+		return
+	}
+	recordEventTime(lastEventUS, t.Time().UnixMicro())
+}
+
+// Periodically updates the lag gauge with the difference between the wall clock and the most recently processed event timestamp, until the context is cancelled.
+func runLagGauge(ctx context.Context, source string, lastEventUS *int64) {
+	ticker := time.NewTicker(lagUpdatePeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			us := atomic.LoadInt64(lastEventUS)
+			if us <= 0 {
+				continue
+			}
+			lag := time.Since(time.UnixMicro(us))
+			consumerLag.WithLabelValues(source).Set(lag.Seconds())
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package consumer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var reconnectCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_consumer_reconnects",
+	Help: "Number of times an event stream consumer reconnected to upstream",
+}, []string{"source"})
+
+var queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "automod_consumer_queue_depth",
+	Help: "Number of events waiting in the consumer work queue",
+}, []string{"source"})
+
+var queueBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_consumer_queue_blocked",
+	Help: "Number of times reading from upstream blocked because the consumer work queue was full",
+}, []string{"source"})
+
+var consumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "automod_consumer_lag_sec",
+	Help: "Seconds between the wall clock and the timestamp of the most recently processed event",
+}, []string{"source"})
+
+var recordOpCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_consumer_record_ops",
+	Help: "Number of repo record operations dispatched to the engine, by operation (create, update, delete) and collection. Uncommon collections are counted as 'other'",
+}, []string{"source", "op", "collection"})
@@ -78,8 +78,13 @@ func (oc *OzoneConsumer) Run(ctx context.Context) error {
 			nil,            // types []string
 		)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
 			oc.Logger.Warn("ozone query events failed; sleeping then will retrying", "err", err, "period", period.String())
-			time.Sleep(period)
+			if !sleepContext(ctx, period) {
+				return nil
+			}
 			continue
 		}
 
@@ -108,11 +113,23 @@ func (oc *OzoneConsumer) Run(ctx context.Context) error {
 		}
 		if !anyNewEvents {
 			oc.Logger.Debug("... ozone poller sleeping", "period", period.String())
-			time.Sleep(period)
+			if !sleepContext(ctx, period) {
+				return nil
+			}
 		}
 	}
 }
 
+// sleeps for d, or until ctx is cancelled; returns false if it was cancelled
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
 func (oc *OzoneConsumer) HandleOzoneEvent(ctx context.Context, eventView *toolsozone.ModerationDefs_ModEventView) error {
 
 	oc.Logger.Debug("received ozone event", "eventID", eventView.Id, "createdAt", eventView.CreatedAt)
@@ -168,7 +185,7 @@ func (oc *OzoneConsumer) RunPersistCursor(ctx context.Context) error {
 			lastCursor := oc.lastCursor.Load()
 			if lastCursor != nil && lastCursor != "" {
 				oc.Logger.Info("persisting final ozone cursor timestamp", "cursor", lastCursor)
-				err := oc.PersistCursor(ctx)
+				err := oc.PersistCursor(context.Background())
 				if err != nil {
 					oc.Logger.Error("failed to persist ozone cursor", "err", err, "cursor", lastCursor)
 				}
@@ -0,0 +1,97 @@
+package consumer
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/events"
+)
+
+// how long the queue must stay full before logging a warning, and minimum period between warnings
+var queueFullWarnPeriod = 30 * time.Second
+
+type queuedWork struct {
+	repo string
+	val  *events.XRPCStreamEvent
+}
+
+// Bounded work queue between the websocket reader and a worker scheduler.
+//
+// Events are never dropped: when the queue is full, AddWork blocks (applying backpressure to the websocket reader) and the blocked counter is incremented. Queue depth is exposed as a metric, to give visibility into whether workers are keeping up with upstream.
+type queuedScheduler struct {
+	inner  events.Scheduler
+	queue  chan queuedWork
+	source string
+	logger *slog.Logger
+
+	// track how long the queue has been full, for warnings
+	lk        sync.Mutex
+	fullSince time.Time
+	lastWarn  time.Time
+
+	done chan struct{}
+}
+
+func newQueuedScheduler(ctx context.Context, inner events.Scheduler, size int, source string, logger *slog.Logger) *queuedScheduler {
+	qs := &queuedScheduler{
+		inner:  inner,
+		queue:  make(chan queuedWork, size),
+		source: source,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+	go qs.run(ctx)
+	return qs
+}
+
+func (qs *queuedScheduler) run(ctx context.Context) {
+	defer close(qs.done)
+	for w := range qs.queue {
+		queueDepth.WithLabelValues(qs.source).Set(float64(len(qs.queue)))
+		if err := qs.inner.AddWork(ctx, w.repo, w.val); err != nil && ctx.Err() == nil {
+			qs.logger.Error("failed to schedule event", "err", err)
+		}
+	}
+}
+
+func (qs *queuedScheduler) AddWork(ctx context.Context, repo string, val *events.XRPCStreamEvent) error {
+	w := queuedWork{repo: repo, val: val}
+	select {
+	case qs.queue <- w:
+		queueDepth.WithLabelValues(qs.source).Set(float64(len(qs.queue)))
+		qs.lk.Lock()
+		qs.fullSince = time.Time{}
+		qs.lk.Unlock()
+		return nil
+	default:
+	}
+
+	// queue is full: workers are not keeping up
+	queueBlocked.WithLabelValues(qs.source).Inc()
+	qs.lk.Lock()
+	now := time.Now()
+	if qs.fullSince.IsZero() {
+		qs.fullSince = now
+	} else if now.Sub(qs.fullSince) > queueFullWarnPeriod && now.Sub(qs.lastWarn) > queueFullWarnPeriod {
+		qs.logger.Warn("event queue has been full; falling behind upstream", "source", qs.source, "size", cap(qs.queue), "fullFor", now.Sub(qs.fullSince).Round(time.Second))
+		qs.lastWarn = now
+	}
+	qs.lk.Unlock()
+
+	select {
+	case qs.queue <- w:
+		queueDepth.WithLabelValues(qs.source).Set(float64(len(qs.queue)))
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drains any queued work in to the inner scheduler, then shuts it down
+func (qs *queuedScheduler) Shutdown() {
+	close(qs.queue)
+	<-qs.done
+	qs.inner.Shutdown()
+}
@@ -0,0 +1,82 @@
+package consumer
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// scheduler which records the events it is given, and blocks each one until released
+type testBlockingScheduler struct {
+	lk       sync.Mutex
+	repos    []string
+	release  chan struct{}
+	shutdown bool
+}
+
+func (s *testBlockingScheduler) AddWork(ctx context.Context, repo string, val *events.XRPCStreamEvent) error {
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.repos = append(s.repos, repo)
+	return nil
+}
+
+func (s *testBlockingScheduler) Shutdown() {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.shutdown = true
+}
+
+func TestQueuedScheduler(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	source := "test-queue"
+	blocked := queueBlocked.WithLabelValues(source)
+	blockedBefore := testutil.ToFloat64(blocked)
+
+	inner := &testBlockingScheduler{release: make(chan struct{})}
+	qs := newQueuedScheduler(ctx, inner, 2, source, slog.Default())
+	evt := &events.XRPCStreamEvent{}
+
+	// one event is taken by the (blocked) inner scheduler, and two more fill the queue
+	assert.NoError(qs.AddWork(ctx, "did:plc:a", evt))
+	assert.Eventually(func() bool { return len(qs.queue) == 0 }, time.Second, time.Millisecond)
+	assert.NoError(qs.AddWork(ctx, "did:plc:b", evt))
+	assert.NoError(qs.AddWork(ctx, "did:plc:c", evt))
+	assert.Equal(2, len(qs.queue))
+	assert.Equal(blockedBefore, testutil.ToFloat64(blocked))
+
+	// the queue is full, so adding more work blocks, until the context is cancelled
+	cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(qs.AddWork(cctx, "did:plc:x", evt), context.DeadlineExceeded)
+	assert.Equal(blockedBefore+1, testutil.ToFloat64(blocked))
+
+	// a blocked enqueue completes once the inner scheduler makes progress
+	added := make(chan error)
+	go func() {
+		added <- qs.AddWork(ctx, "did:plc:d", evt)
+	}()
+	assert.Eventually(func() bool { return testutil.ToFloat64(blocked) == blockedBefore+2 }, time.Second, time.Millisecond)
+	inner.release <- struct{}{}
+	assert.NoError(<-added)
+
+	// shutdown drains all queued events to the inner scheduler, in order, before shutting it down
+	close(inner.release)
+	qs.Shutdown()
+	assert.Equal([]string{"did:plc:a", "did:plc:b", "did:plc:c", "did:plc:d"}, inner.repos)
+	assert.True(inner.shutdown)
+}
@@ -0,0 +1,58 @@
+package consumer
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+var (
+	// initial delay before reconnecting to upstream
+	reconnectBackoffMin = 1 * time.Second
+	// maximum delay between reconnection attempts
+	reconnectBackoffMax = 2 * time.Minute
+	// connections which stay up at least this long reset the backoff
+	reconnectResetAfter = 1 * time.Minute
+	// number of consecutive failures after which log level is escalated from warn to error
+	reconnectEscalateAfter = 5
+)
+
+// Runs the connect function in a loop until the context is cancelled, reconnecting with capped exponential backoff (with jitter) whenever it returns.
+//
+// This never gives up: it is intended for long-running daemons. After several consecutive failures, log messages are escalated to error level.
+func runWithReconnect(ctx context.Context, logger *slog.Logger, source string, connect func(ctx context.Context) error) error {
+	backoff := reconnectBackoffMin
+	failures := 0
+	for {
+		start := time.Now()
+		err := connect(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if time.Since(start) >= reconnectResetAfter {
+			backoff = reconnectBackoffMin
+			failures = 0
+		}
+		failures++
+
+		// "equal jitter": sleep somewhere between half and all of the current backoff
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		level := slog.LevelWarn
+		if failures >= reconnectEscalateAfter {
+			level = slog.LevelError
+		}
+		logger.Log(ctx, level, "upstream connection failed, will reconnect", "source", source, "err", err, "failures", failures, "delay", delay)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		reconnectCount.WithLabelValues(source).Inc()
+		backoff *= 2
+		if backoff > reconnectBackoffMax {
+			backoff = reconnectBackoffMax
+		}
+	}
+}
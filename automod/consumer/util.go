@@ -23,3 +23,49 @@ func splitRepoPath(path string) (syntax.NSID, syntax.RecordKey, error) {
 	}
 	return collection, rkey, nil
 }
+
+// returns true if the collection is in the allowlist, or if the allowlist is empty
+func wantCollection(allowlist []syntax.NSID, collection syntax.NSID) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	for _, c := range allowlist {
+		if c == collection {
+			return true
+		}
+	}
+	return false
+}
+
+// well-known record collections which get their own metrics label. everything else is counted as "other", to keep label cardinality bounded (collection NSIDs are arbitrary and user-controlled)
+var metricsCollections = map[syntax.NSID]bool{
+	"app.bsky.actor.profile":      true,
+	"app.bsky.feed.generator":     true,
+	"app.bsky.feed.like":          true,
+	"app.bsky.feed.post":          true,
+	"app.bsky.feed.postgate":      true,
+	"app.bsky.feed.repost":        true,
+	"app.bsky.feed.threadgate":    true,
+	"app.bsky.graph.block":        true,
+	"app.bsky.graph.follow":       true,
+	"app.bsky.graph.list":         true,
+	"app.bsky.graph.listblock":    true,
+	"app.bsky.graph.listitem":     true,
+	"app.bsky.graph.starterpack":  true,
+	"app.bsky.labeler.service":    true,
+	"chat.bsky.actor.declaration": true,
+}
+
+// counts a record op in the "automod_consumer_record_ops" metric
+func countRecordOp(source, action string, collection syntax.NSID) {
+	switch action {
+	case "create", "update", "delete":
+	default:
+		action = "other"
+	}
+	label := "other"
+	if metricsCollections[collection] {
+		label = collection.String()
+	}
+	recordOpCount.WithLabelValues(source, action, label).Inc()
+}
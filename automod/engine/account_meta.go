@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 )
 
 var (
@@ -26,10 +27,20 @@ type AccountMeta struct {
 	PostsCount           int64
 	Takendown            bool
 	Deactivated          bool
-	// best effort public interpretation of account creation timestamp. not always available, and may be inaccurate/inconsistent for now.
+	// best effort public interpretation of account creation timestamp: from the public profile, then private account metadata, then the PLC directory audit log. nil if it could not be determined, and may be inaccurate/inconsistent for now.
 	CreatedAt *time.Time
 }
 
+// Returns true if the account has a handle which bidirectionally verifies: the DID document declares the handle, and the handle resolves back to the same DID.
+//
+// This is computed from the identity directory lookup (which does the verification, and caches the result along with the rest of the identity), so it does not result in any additional network resolution.
+func (am *AccountMeta) HandleVerified() bool {
+	if am.Identity == nil {
+		return false
+	}
+	return am.Identity.Handle != "" && am.Identity.Handle != syntax.HandleInvalid
+}
+
 type ProfileSummary struct {
 	HasAvatar   bool
 	AvatarCid   *string
@@ -3,11 +3,14 @@ package engine
 import (
 	"bytes"
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod/cachestore"
 	"github.com/bluesky-social/indigo/automod/countstore"
 
 	"github.com/stretchr/testify/assert"
@@ -56,3 +59,129 @@ func TestAccountReportDedupe(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(1, reports)
 }
+
+func TestActionDedupeWindow(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	eng := EngineTestFixture()
+
+	// not configured: everything passes through
+	vals, err := eng.dedupeWindowActions(ctx, "account", "did:plc:abc111", "label", []string{"spam"})
+	assert.NoError(err)
+	assert.Equal([]string{"spam"}, vals)
+	vals, err = eng.dedupeWindowActions(ctx, "account", "did:plc:abc111", "label", []string{"spam"})
+	assert.NoError(err)
+	assert.Equal([]string{"spam"}, vals)
+
+	eng.ActionDedupe = cachestore.NewMemClaimStore(100, time.Hour)
+	eng.Config.ActionDedupeWindow = 50 * time.Millisecond
+
+	vals, err = eng.dedupeWindowActions(ctx, "account", "did:plc:abc111", "label", []string{"spam", "rude"})
+	assert.NoError(err)
+	assert.Equal([]string{"spam", "rude"}, vals)
+
+	// same subject, action, and value are suppressed within the window
+	vals, err = eng.dedupeWindowActions(ctx, "account", "did:plc:abc111", "label", []string{"spam", "nudity"})
+	assert.NoError(err)
+	assert.Equal([]string{"nudity"}, vals)
+
+	// other subjects and action types are independent
+	vals, err = eng.dedupeWindowActions(ctx, "account", "did:plc:abc222", "label", []string{"spam"})
+	assert.NoError(err)
+	assert.Equal([]string{"spam"}, vals)
+	vals, err = eng.dedupeWindowActions(ctx, "account", "did:plc:abc111", "tag", []string{"spam"})
+	assert.NoError(err)
+	assert.Equal([]string{"spam"}, vals)
+
+	reports, err := eng.dedupeWindowReports(ctx, "record", "at://did:plc:abc111/app.bsky.feed.post/abc123", []ModReport{{ReasonType: ReportReasonSpam}, {ReasonType: ReportReasonSpam}})
+	assert.NoError(err)
+	assert.Equal(1, len(reports))
+
+	td, err := eng.dedupeWindowTakedown(ctx, "account", "did:plc:abc111", true)
+	assert.NoError(err)
+	assert.True(td)
+	td, err = eng.dedupeWindowTakedown(ctx, "account", "did:plc:abc111", true)
+	assert.NoError(err)
+	assert.False(td)
+
+	// after the window, actions go through again (even if still in the store)
+	time.Sleep(60 * time.Millisecond)
+	vals, err = eng.dedupeWindowActions(ctx, "account", "did:plc:abc111", "label", []string{"spam"})
+	assert.NoError(err)
+	assert.Equal([]string{"spam"}, vals)
+}
+
+func TestActionDedupeWindowPersist(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	sink := testActionSink{fail: errors.New("sink unavailable")}
+	eng := EngineTestFixture()
+	eng.ActionSink = &sink
+	eng.ActionDedupe = cachestore.NewMemClaimStore(100, time.Hour)
+	eng.Config.ActionDedupeWindow = time.Hour
+	eng.Rules = RuleSet{
+		RecordRules: []RecordRuleFunc{
+			alwaysLabelAndTakedownRule,
+		},
+	}
+
+	cid1 := syntax.CID("cid123")
+	p1 := appbsky.FeedPost{Text: "some post blah"}
+	p1buf := new(bytes.Buffer)
+	assert.NoError(p1.MarshalCBOR(p1buf))
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        syntax.DID("did:plc:abc111"),
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		RecordCBOR: p1buf.Bytes(),
+	}
+	atURI := "at://did:plc:abc111/app.bsky.feed.post/abc123"
+
+	// returns true if the action is claimed in the de-dupe window; unclaimed keys are released again
+	claimed := func(subject, action, val string) bool {
+		ok, err := eng.ActionDedupe.SetNX(ctx, "action-dedupe", dedupeWindowKey(subject, action, val), "test", time.Hour)
+		assert.NoError(err)
+		if ok {
+			assert.NoError(eng.ActionDedupe.Purge(ctx, "action-dedupe", dedupeWindowKey(subject, action, val)))
+		}
+		return !ok
+	}
+
+	// dry-run doesn't claim anything
+	eng.Config.DryRun = true
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	assert.False(claimed(atURI, "label", "spam"))
+	eng.Config.DryRun = false
+
+	// failed publish: the event fails, and actions are not de-duped
+	assert.ErrorIs(eng.ProcessRecordOp(ctx, op), sink.fail)
+	assert.Empty(sink.events)
+	assert.False(claimed("did:plc:abc111", "label", "spam"))
+	assert.False(claimed(atURI, "label", "spam"))
+	assert.False(claimed(atURI, "takedown", "takedown"))
+
+	// circuit-broken takedown is released, while the published label is de-duped
+	sink.fail = nil
+	eng.Config.QuotaModTakedownDay = 1
+	assert.NoError(eng.Counters.Increment(ctx, "automod-quota", "takedown"))
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	if assert.Len(sink.events, 2) {
+		assert.Equal([]string{"spam"}, sink.events[1].Labels)
+		assert.False(sink.events[1].Takedown)
+	}
+	assert.True(claimed(atURI, "label", "spam"))
+	assert.False(claimed(atURI, "takedown", "takedown"))
+
+	// successfully published actions are suppressed within the window
+	eng.Config.QuotaModTakedownDay = 10
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	if assert.Len(sink.events, 3) {
+		assert.Empty(sink.events[2].Labels)
+		assert.True(sink.events[2].Takedown)
+	}
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	assert.Len(sink.events, 3)
+}
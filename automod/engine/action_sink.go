@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Interface for a type that receives moderation actions, as an alternative to the engine sending them directly to the mod service (ozone). For example, to publish actions to a message bus for fan-out to other services.
+type ActionSink interface {
+	PublishAction(ctx context.Context, evt *ActionEvent) error
+}
+
+// A set of new moderation actions on a single subject (account or record), as published to an ActionSink. Actions have already been de-duplicated and circuit-broken, same as when sent to the mod service.
+type ActionEvent struct {
+	// "account" or "record"
+	Kind string `json:"kind"`
+	DID  string `json:"did"`
+	// for record actions
+	URI string `json:"uri,omitempty"`
+	CID string `json:"cid,omitempty"`
+	// names of rules which enqueued any actions for the event
+	Rules         []string       `json:"rules,omitempty"`
+	Labels        []string       `json:"labels,omitempty"`
+	Tags          []string       `json:"tags,omitempty"`
+	Reports       []ActionReport `json:"reports,omitempty"`
+	Takedown      bool           `json:"takedown,omitempty"`
+	Escalate      bool           `json:"escalate,omitempty"`
+	Acknowledge   bool           `json:"acknowledge,omitempty"`
+	BlobTakedowns []string       `json:"blobTakedowns,omitempty"`
+	CreatedAt     string         `json:"createdAt"`
+}
+
+type ActionReport struct {
+	ReasonType string `json:"reasonType"`
+	Comment    string `json:"comment"`
+}
+
+func newActionEvent(kind, did string, eff *Effects, labels, tags []string, reports []ModReport) ActionEvent {
+	evt := ActionEvent{
+		Kind:      kind,
+		DID:       did,
+		Labels:    labels,
+		Tags:      tags,
+		CreatedAt: syntax.DatetimeNow().String(),
+		Rules:     firedRuleNames(eff),
+	}
+	for _, r := range reports {
+		evt.Reports = append(evt.Reports, ActionReport{ReasonType: r.ReasonType, Comment: r.Comment})
+	}
+	return evt
+}
+
+func (evt *ActionEvent) isEmpty() bool {
+	return len(evt.Labels) == 0 && len(evt.Tags) == 0 && len(evt.Reports) == 0 && !evt.Takedown && !evt.Escalate && !evt.Acknowledge
+}
+
+// publishes actions to the ActionSink, and updates action metrics (as when persisting to the mod service). Errors are logged and returned; the caller fails the event, and de-dupe window claims for the actions are released, so they are retried the next time rules fire.
+func (eng *Engine) publishAction(ctx context.Context, logger *slog.Logger, evt *ActionEvent) error {
+	logger.Info("publishing actions to sink", "labels", evt.Labels, "tags", evt.Tags, "reports", len(evt.Reports), "takedown", evt.Takedown, "escalate", evt.Escalate, "acknowledge", evt.Acknowledge)
+	for _, val := range evt.Labels {
+		// note: WithLabelValues is a prometheus label, not an atproto label
+		actionNewLabelCount.WithLabelValues(evt.Kind, val).Inc()
+	}
+	for _, val := range evt.Tags {
+		actionNewTagCount.WithLabelValues(evt.Kind, val).Inc()
+	}
+	for range evt.Reports {
+		actionNewReportCount.WithLabelValues(evt.Kind).Inc()
+	}
+	if evt.Takedown {
+		actionNewTakedownCount.WithLabelValues(evt.Kind).Inc()
+	}
+	if evt.Escalate {
+		actionNewEscalationCount.WithLabelValues(evt.Kind).Inc()
+	}
+	if evt.Acknowledge {
+		actionNewAcknowledgeCount.WithLabelValues(evt.Kind).Inc()
+	}
+	if err := eng.ActionSink.PublishAction(ctx, evt); err != nil {
+		actionSinkErrorCount.Inc()
+		logger.Error("failed to publish actions to sink", "err", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ActionSink which just records events, or fails if fail is set
+type testActionSink struct {
+	lk     sync.Mutex
+	events []ActionEvent
+	fail   error
+}
+
+func (s *testActionSink) PublishAction(ctx context.Context, evt *ActionEvent) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.events = append(s.events, *evt)
+	return nil
+}
+
+func TestActionSink(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// actions should not be sent directly to the mod service
+	var mutations atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			mutations.Add(1)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	sink := testActionSink{}
+	eng := EngineTestFixture()
+	dir := identity.NewMockDirectory()
+	eng.Directory = &dir
+	eng.ActionSink = &sink
+	eng.OzoneClient = &xrpc.Client{
+		Host: srv.URL,
+		Auth: &xrpc.AuthInfo{Did: "did:plc:automod"},
+	}
+	eng.Rules = RuleSet{
+		RecordRules: []RecordRuleFunc{
+			alwaysLabelAndTakedownRule,
+		},
+	}
+
+	ident := identity.Identity{
+		DID:    syntax.DID("did:plc:abc111"),
+		Handle: syntax.Handle("handle.example.com"),
+	}
+	dir.Insert(ident)
+
+	cid1 := syntax.CID("cid123")
+	p1 := appbsky.FeedPost{Text: "some post blah"}
+	p1buf := new(bytes.Buffer)
+	assert.NoError(p1.MarshalCBOR(p1buf))
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        ident.DID,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		RecordCBOR: p1buf.Bytes(),
+	}
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	assert.Equal(int64(0), mutations.Load())
+
+	assert.Equal(2, len(sink.events))
+	acct, rec := sink.events[0], sink.events[1]
+	assert.Equal("account", acct.Kind)
+	assert.Equal("did:plc:abc111", acct.DID)
+	assert.Equal([]string{"spam"}, acct.Labels)
+	assert.False(acct.Takedown)
+
+	assert.Equal("record", rec.Kind)
+	assert.Equal("at://did:plc:abc111/app.bsky.feed.post/abc123", rec.URI)
+	assert.Equal("cid123", rec.CID)
+	assert.Equal([]string{"spam"}, rec.Labels)
+	assert.True(rec.Takedown)
+	assert.Equal([]ActionReport{{ReasonType: ReportReasonOther, Comment: "test report"}}, rec.Reports)
+	assert.NotEmpty(rec.Rules)
+	assert.NotEmpty(rec.CreatedAt)
+}
@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Record of a single rule firing (a rule which enqueued moderation actions), as written to an AuditSink
+type AuditEntry struct {
+	Timestamp string `json:"timestamp"`
+	Rule      string `json:"rule"`
+	// "identity", "account", "record", "notification", or "ozone"
+	EventType string `json:"eventType"`
+	// account DID, or record AT-URI
+	Subject string   `json:"subject"`
+	Actions []string `json:"actions"`
+	// SHA-256 (hex) of the inputs the rule was evaluated against (eg, the record CBOR), so that decisions can be tied back to exact content without storing it
+	InputsHash string `json:"inputsHash"`
+	// if true, the engine was in dry-run mode, and actions were not sent to the mod service
+	DryRun bool `json:"dryRun,omitempty"`
+	// what happened to the event's actions: "persisted", "failed" (with the error in Error), "dry-run" (only logged, see DryRun), or "not-persisted" (notification events, whose only effect is whether the notification is rejected). Entries are written after persistence is attempted, so this is the final outcome
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+const (
+	AuditOutcomePersisted    = "persisted"
+	AuditOutcomeFailed       = "failed"
+	AuditOutcomeDryRun       = "dry-run"
+	AuditOutcomeNotPersisted = "not-persisted"
+)
+
+// Interface for a durable destination of audit entries (eg, a file or database table).
+//
+// Writes happen on a single background goroutine (see AuditLogger), so implementations don't need to be safe for concurrent use.
+type AuditSink interface {
+	WriteAuditEntry(entry *AuditEntry) error
+	Close() error
+}
+
+// AuditSink which writes entries as JSON lines
+type JSONLinesAuditSink struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func NewJSONLinesAuditSink(w io.Writer) *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{w: w, enc: json.NewEncoder(w)}
+}
+
+// Opens (or creates) the file at the given path for appending JSON lines. A path of "-" writes to stdout.
+func NewFileAuditSink(path string) (*JSONLinesAuditSink, error) {
+	if path == "-" {
+		return NewJSONLinesAuditSink(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log file: %w", err)
+	}
+	return NewJSONLinesAuditSink(f), nil
+}
+
+func (s *JSONLinesAuditSink) WriteAuditEntry(entry *AuditEntry) error {
+	return s.enc.Encode(entry)
+}
+
+func (s *JSONLinesAuditSink) Close() error {
+	if f, ok := s.w.(*os.File); ok && f != os.Stdout {
+		return f.Close()
+	}
+	return nil
+}
+
+// Asynchronous, buffered writer of audit entries to an AuditSink.
+//
+// Logging never blocks event processing: if the buffer is full (eg, the sink is slow or failing), entries are dropped and counted in the "automod_audit_entries_dropped" metric.
+type AuditLogger struct {
+	sink   AuditSink
+	logger *slog.Logger
+	queue  chan *AuditEntry
+	done   chan struct{}
+
+	// guards closing the queue, so that Log can be called concurrently with (or after) Close
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Creates an AuditLogger and starts the background writer. bufferSize defaults to 1000 if not positive.
+func NewAuditLogger(sink AuditSink, bufferSize int, logger *slog.Logger) *AuditLogger {
+	if bufferSize <= 0 {
+		bufferSize = 1000
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	a := &AuditLogger{
+		sink:   sink,
+		logger: logger,
+		queue:  make(chan *AuditEntry, bufferSize),
+		done:   make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *AuditLogger) run() {
+	defer close(a.done)
+	for entry := range a.queue {
+		if err := a.sink.WriteAuditEntry(entry); err != nil {
+			auditErrorCount.Inc()
+			a.logger.Error("failed to write audit log entry", "rule", entry.Rule, "subject", entry.Subject, "err", err)
+		}
+	}
+}
+
+// Enqueues an entry to be written; never blocks. Entries logged after Close are dropped.
+func (a *AuditLogger) Log(entry *AuditEntry) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		auditDroppedCount.Inc()
+		return
+	}
+	select {
+	case a.queue <- entry:
+	default:
+		auditDroppedCount.Inc()
+	}
+}
+
+// Flushes any buffered entries, and closes the sink. Safe to call more than once; only the first call closes the sink.
+func (a *AuditLogger) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		<-a.done
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+	<-a.done
+	return a.sink.Close()
+}
+
+// hashes the inputs to rule evaluation, for AuditEntry.InputsHash
+func auditInputsHash(parts ...[]byte) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+		// separator, so that different splits of the same bytes hash differently
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Writes an audit entry for each rule which fired while processing an event, with the result of persisting the event's actions (persistErr). No-op if audit logging isn't configured.
+func (eng *Engine) auditRuleFirings(eventType, subject, inputsHash string, eff *Effects, persistErr error) {
+	if eng.AuditLog == nil || eff == nil {
+		return
+	}
+	now := syntax.DatetimeNow().String()
+	outcome := AuditOutcomePersisted
+	errMsg := ""
+	switch {
+	case persistErr != nil:
+		outcome = AuditOutcomeFailed
+		errMsg = persistErr.Error()
+	case eventType == "notification":
+		// notification rules only decide whether to reject the notification; other actions are never persisted
+		outcome = AuditOutcomeNotPersisted
+	case eng.Config.DryRun:
+		outcome = AuditOutcomeDryRun
+	}
+	for _, f := range eff.RuleFirings {
+		eng.AuditLog.Log(&AuditEntry{
+			Timestamp:  now,
+			Rule:       f.Rule,
+			EventType:  eventType,
+			Subject:    subject,
+			Actions:    f.Actions,
+			InputsHash: inputsHash,
+			DryRun:     eng.Config.DryRun,
+			Outcome:    outcome,
+			Error:      errMsg,
+		})
+	}
+}
+
+// marshals an event for hashing, ignoring errors (which would only happen for invalid types)
+func auditJSON(v any) []byte {
+	b, _ := json.Marshal(v)
+	return b
+}
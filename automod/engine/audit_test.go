@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestAuditLog(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	eng := EngineTestFixture()
+	var buf bytes.Buffer
+	eng.AuditLog = NewAuditLogger(NewJSONLinesAuditSink(nopCloser{&buf}), 10, nil)
+
+	cid1 := syntax.CID("cid123")
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        syntax.DID("did:plc:abc111"),
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+	}
+	for _, p := range []appbsky.FeedPost{
+		{Text: "no match"},
+		{Text: "match", Tags: []string{"slur"}},
+	} {
+		cbor := new(bytes.Buffer)
+		assert.NoError(p.MarshalCBOR(cbor))
+		op.RecordCBOR = cbor.Bytes()
+		assert.NoError(eng.ProcessRecordOp(ctx, op))
+	}
+	assert.NoError(eng.AuditLog.Close())
+
+	// only the rule firing is logged
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !assert.Len(lines, 1) {
+		return
+	}
+	var entry AuditEntry
+	assert.NoError(json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal("engine.simpleRule", entry.Rule)
+	assert.Equal("record", entry.EventType)
+	assert.Equal("at://did:plc:abc111/app.bsky.feed.post/abc123", entry.Subject)
+	assert.Equal([]string{"record-label:bad-hashtag"}, entry.Actions)
+	assert.Equal(auditInputsHash([]byte(CreateOp), []byte(entry.Subject), op.RecordCBOR), entry.InputsHash)
+	assert.Len(entry.InputsHash, 64)
+	assert.False(entry.DryRun)
+	assert.Equal(AuditOutcomePersisted, entry.Outcome)
+	assert.Empty(entry.Error)
+}
+
+func TestAuditLogOutcome(t *testing.T) {
+	assert := assert.New(t)
+
+	eng := EngineTestFixture()
+	eff := &Effects{RuleFirings: []RuleFiring{{Rule: "some-rule", Actions: []string{"account-takedown"}}}}
+	audit := func(eventType string, dryRun bool, persistErr error) AuditEntry {
+		var buf bytes.Buffer
+		eng.AuditLog = NewAuditLogger(NewJSONLinesAuditSink(nopCloser{&buf}), 10, nil)
+		eng.Config.DryRun = dryRun
+		eng.auditRuleFirings(eventType, "did:plc:abc111", "hash", eff, persistErr)
+		assert.NoError(eng.AuditLog.Close())
+		var entry AuditEntry
+		assert.NoError(json.Unmarshal(buf.Bytes(), &entry))
+		return entry
+	}
+
+	entry := audit("account", false, errors.New("ozone unavailable"))
+	assert.Equal("some-rule", entry.Rule)
+	assert.Equal(AuditOutcomeFailed, entry.Outcome)
+	assert.Equal("ozone unavailable", entry.Error)
+
+	entry = audit("account", false, nil)
+	assert.Equal(AuditOutcomePersisted, entry.Outcome)
+	assert.Empty(entry.Error)
+
+	entry = audit("account", true, nil)
+	assert.Equal(AuditOutcomeDryRun, entry.Outcome)
+	assert.True(entry.DryRun)
+
+	entry = audit("notification", false, nil)
+	assert.Equal(AuditOutcomeNotPersisted, entry.Outcome)
+	entry = audit("notification", true, nil)
+	assert.Equal(AuditOutcomeNotPersisted, entry.Outcome)
+	assert.True(entry.DryRun)
+}
+
+func TestAuditLogAfterClose(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	a := NewAuditLogger(NewJSONLinesAuditSink(nopCloser{&buf}), 10, nil)
+	a.Log(&AuditEntry{Rule: "before"})
+	assert.NoError(a.Close())
+
+	// events still being processed during shutdown may log after Close; those entries are dropped, instead of panicking
+	droppedBefore := testutil.ToFloat64(auditDroppedCount)
+	a.Log(&AuditEntry{Rule: "after"})
+	assert.Equal(droppedBefore+1, testutil.ToFloat64(auditDroppedCount))
+	assert.NoError(a.Close())
+	assert.Equal(1, strings.Count(buf.String(), "\n"))
+	assert.Contains(buf.String(), `"before"`)
+}
+
+// AuditSink which blocks until released
+type blockingAuditSink struct {
+	release chan struct{}
+	written int
+}
+
+func (s *blockingAuditSink) WriteAuditEntry(entry *AuditEntry) error {
+	<-s.release
+	s.written++
+	return nil
+}
+
+func (s *blockingAuditSink) Close() error { return nil }
+
+func TestAuditLogOverflow(t *testing.T) {
+	assert := assert.New(t)
+
+	droppedBefore := testutil.ToFloat64(auditDroppedCount)
+	sink := &blockingAuditSink{release: make(chan struct{})}
+	a := NewAuditLogger(sink, 2, nil)
+
+	// the writer goroutine holds at most one entry, and the buffer two more; the rest are dropped without blocking
+	for i := 0; i < 10; i++ {
+		a.Log(&AuditEntry{Rule: "rule"})
+	}
+	dropped := testutil.ToFloat64(auditDroppedCount) - droppedBefore
+	assert.GreaterOrEqual(dropped, 7.0)
+
+	close(sink.release)
+	assert.NoError(a.Close())
+	assert.Equal(10, sink.written+int(dropped))
+}
+
+func TestNewActions(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(newActions([]string{"a"}, []string{"a"}))
+	assert.Equal([]string{"b"}, newActions([]string{"a"}, []string{"a", "b"}))
+	assert.Equal([]string{"a"}, newActions([]string{"a", "c"}, []string{"a", "a", "c"}))
+}
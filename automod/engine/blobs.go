@@ -62,7 +62,7 @@ func (c *RecordContext) fetchBlob(blob lexutil.LexBlob) ([]byte, error) {
 
 	req.Header.Set("User-Agent", "indigo-automod/"+versioninfo.Short())
 	// TODO: more robust PDS hostname check (eg, future trailing slash or partial path)
-	if c.engine.BskyClient.Headers != nil && strings.HasSuffix(pdsEndpoint, ".bsky.network") {
+	if c.engine.BskyClient != nil && c.engine.BskyClient.Headers != nil && strings.HasSuffix(pdsEndpoint, ".bsky.network") {
 		val, ok := c.engine.BskyClient.Headers["x-ratelimit-bypass"]
 		if ok {
 			req.Header.Set("x-ratelimit-bypass", val)
@@ -76,6 +76,7 @@ func (c *RecordContext) fetchBlob(blob lexutil.LexBlob) ([]byte, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
+		blobDownloadCount.WithLabelValues("error").Inc()
 		return nil, err
 	}
 	defer resp.Body.Close()
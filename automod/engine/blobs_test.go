@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/ipfs/go-cid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// http.RoundTripper which counts requests, and fails all of them
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return nil, http.ErrNotSupported
+}
+
+func TestSkipBlobFetch(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	eng := EngineTestFixture()
+	transport := &countingTransport{}
+	eng.BlobClient = &http.Client{Transport: transport}
+	assert.False(eng.Rules.NeedsBlobs())
+
+	blobCID, err := cid.Decode("bafkreiccldh766hwcnuxnf2wh6jgzepf2nlu2lvcllt63eww5p6chi4ity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := appbsky.FeedPost{
+		Text: "post with an image",
+		Embed: &appbsky.FeedPost_Embed{
+			EmbedImages: &appbsky.EmbedImages{
+				Images: []*appbsky.EmbedImages_Image{
+					{Image: &lexutil.LexBlob{Ref: lexutil.LexLink(blobCID), MimeType: "image/png", Size: 1234}},
+				},
+			},
+		},
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(post.MarshalCBOR(buf))
+	cid1 := syntax.CID("cid123")
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        syntax.DID("did:plc:abc111"),
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		RecordCBOR: buf.Bytes(),
+	}
+
+	skippedBefore := testutil.ToFloat64(blobFetchSkipped)
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	assert.Equal(0, transport.requests)
+	assert.Equal(skippedBefore+1, testutil.ToFloat64(blobFetchSkipped))
+
+	// with a blob rule configured, the blob is fetched
+	eng.Rules.BlobRules = []BlobRuleFunc{func(c *RecordContext, blob lexutil.LexBlob, data []byte) error { return nil }}
+	assert.True(eng.Rules.NeedsBlobs())
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	assert.Equal(1, transport.requests)
+	assert.Equal(skippedBefore+1, testutil.ToFloat64(blobFetchSkipped))
+}
@@ -259,6 +259,12 @@ func (c *BaseContext) IncrementPeriod(name, val string, period string) {
 	c.effects.IncrementPeriod(name, val, period)
 }
 
+// Runs part of a rule under an explicit name, which is used for that part in rule metrics and audit logs, instead of the name of the rule function. This is for rules which aren't simple named functions: closures (which would otherwise be named after the enclosing function, eg "rules.init.func1"), and rule functions which evaluate several configured sub-rules (eg, declarative rules). Actions enqueued and notifications requested by fn are only attributed to the explicit name, not also to the calling rule.
+func (c *BaseContext) RunNamedRule(name string, fn func() error) error {
+	return observeNamedRule(c.effects.currentRuleType(), name, c.effects, fn)
+}
+
+// Requests a notification to the given service. The notification includes the name of the rule which requested it (see RunNamedRule), even if Notify was called from a helper function.
 func (c *BaseContext) Notify(srv string) {
 	c.effects.Notify(srv)
 }
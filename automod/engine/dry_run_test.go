@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod/countstore"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func alwaysLabelAndTakedownRule(c *RecordContext) error {
+	c.AddAccountLabel("spam")
+	c.AddRecordLabel("spam")
+	c.TakedownRecord()
+	c.ReportRecord(ReportReasonOther, "test report")
+	return nil
+}
+
+func TestDryRun(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// any procedure call (POST) to the mod service would be a mutation
+	var mutations atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			mutations.Add(1)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	eng := EngineTestFixture()
+	dir := identity.NewMockDirectory()
+	eng.Directory = &dir
+	eng.Config.DryRun = true
+	eng.OzoneClient = &xrpc.Client{
+		Host: srv.URL,
+		Auth: &xrpc.AuthInfo{Did: "did:plc:automod"},
+	}
+	eng.Rules = RuleSet{
+		RecordRules: []RecordRuleFunc{
+			alwaysLabelAndTakedownRule,
+		},
+	}
+
+	ident := identity.Identity{
+		DID:    syntax.DID("did:plc:abc111"),
+		Handle: syntax.Handle("handle.example.com"),
+	}
+	dir.Insert(ident)
+
+	cid1 := syntax.CID("cid123")
+	p1 := appbsky.FeedPost{Text: "some post blah"}
+	p1buf := new(bytes.Buffer)
+	assert.NoError(p1.MarshalCBOR(p1buf))
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        ident.DID,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		RecordCBOR: p1buf.Bytes(),
+	}
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+
+	assert.Equal(int64(0), mutations.Load())
+
+	// quota and report de-dupe counters are untouched, so a dry run doesn't use up the live quota or suppress later reports
+	takedowns, err := eng.Counters.GetCount(ctx, "automod-quota", "takedown", countstore.PeriodDay)
+	assert.NoError(err)
+	assert.Equal(0, takedowns)
+	reports, err := eng.Counters.GetCount(ctx, "automod-account-report-"+ReasonShortName(ReportReasonOther), op.ATURI().String(), countstore.PeriodDay)
+	assert.NoError(err)
+	assert.Equal(0, reports)
+
+	// rule counters are still persisted, since rules depend on them
+	eng.Rules.RecordRules = append(eng.Rules.RecordRules, func(c *RecordContext) error {
+		c.Increment("dry-run-test", "post")
+		return nil
+	})
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	count, err := eng.Counters.GetCount(ctx, "dry-run-test", "post", countstore.PeriodTotal)
+	assert.NoError(err)
+	assert.Equal(1, count)
+	assert.Equal(int64(0), mutations.Load())
+}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"sort"
 	"sync"
 )
 
@@ -22,6 +23,8 @@ type CounterDistinctRef struct {
 type Effects struct {
 	// internal field for ensuring concurrent mutations are safe
 	mu sync.Mutex
+	// type of the rules currently running (eg, "post"), for metrics of named sub-rules (see BaseContext.RunNamedRule)
+	ruleType string
 	// List of counters which should be incremented as part of processing this event. These are collected during rule execution and persisted in bulk at the end.
 	CounterIncrements []CounterRef
 	// Similar to "CounterIncrements", but for "distinct" style counters
@@ -56,6 +59,21 @@ type Effects struct {
 	RejectEvent bool
 	// Services, if any, which should blast out a notification about this even (eg, Slack)
 	NotifyServices []string
+	// Names of the rules which requested notifications, for inclusion in the notification
+	NotifyRules []string
+	// set by Notify, and cleared once the running rule has been added to NotifyRules (see observeNamedRule)
+	notifyPending bool
+	// Number of rules evaluated while processing the event
+	RulesEvaluated int
+	// Rules which enqueued any actions, in execution order, with the actions each one enqueued. Used for audit logging (see AuditLogger).
+	RuleFirings []RuleFiring
+}
+
+// A single rule which enqueued actions while running
+type RuleFiring struct {
+	Rule string
+	// Short descriptions of the actions enqueued by the rule (see Effects.actionList)
+	Actions []string
 }
 
 // Enqueues the named counter to be incremented at the end of all rule processing. Will automatically increment for all time periods.
@@ -220,6 +238,7 @@ func (e *Effects) TakedownBlob(cid string) {
 func (e *Effects) Notify(srv string) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	e.notifyPending = true
 	for _, v := range e.NotifyServices {
 		if v == srv {
 			return
@@ -228,6 +247,173 @@ func (e *Effects) Notify(srv string) {
 	e.NotifyServices = append(e.NotifyServices, srv)
 }
 
+// Records the name of a rule which requested a notification
+func (e *Effects) NotifyRule(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, v := range e.NotifyRules {
+		if v == name {
+			return
+		}
+	}
+	e.NotifyRules = append(e.NotifyRules, name)
+}
+
 func (e *Effects) Reject() {
 	e.RejectEvent = true
 }
+
+// Short descriptions (eg, "account-label:spam", "record-takedown") of all the moderation actions, flags, and notifications currently enqueued (not counting counter increments). Used to detect whether a specific rule "matched", and which actions it enqueued.
+func (e *Effects) actionList() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []string
+	for _, vals := range []struct {
+		kind string
+		vals []string
+	}{
+		{"account-label", e.AccountLabels},
+		{"account-tag", e.AccountTags},
+		{"account-flag", e.AccountFlags},
+		{"record-label", e.RecordLabels},
+		{"record-tag", e.RecordTags},
+		{"record-flag", e.RecordFlags},
+		{"blob-takedown", e.BlobTakedowns},
+		{"notify", e.NotifyServices},
+	} {
+		for _, v := range vals.vals {
+			out = append(out, vals.kind+":"+v)
+		}
+	}
+	for _, r := range e.AccountReports {
+		out = append(out, "account-report:"+r.ReasonType)
+	}
+	for _, r := range e.RecordReports {
+		out = append(out, "record-report:"+r.ReasonType)
+	}
+	for _, b := range []struct {
+		kind string
+		val  bool
+	}{
+		{"account-takedown", e.AccountTakedown},
+		{"account-escalate", e.AccountEscalate},
+		{"account-acknowledge", e.AccountAcknowledge},
+		{"record-takedown", e.RecordTakedown},
+		{"reject-event", e.RejectEvent},
+	} {
+		if b.val {
+			out = append(out, b.kind)
+		}
+	}
+	return out
+}
+
+// Returns the entries in 'after' which were not in 'before' (both as returned by actionList)
+func newActions(before, after []string) []string {
+	if len(after) <= len(before) {
+		return nil
+	}
+	seen := make(map[string]int, len(before))
+	for _, a := range before {
+		seen[a]++
+	}
+	var out []string
+	for _, a := range after {
+		if seen[a] > 0 {
+			seen[a]--
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// Differences in moderation actions between two sets of effects, eg from processing the same event with two different rulesets. Entries are short descriptions of actions, as in RuleFiring.
+type EffectsDiff struct {
+	// actions in the second effects, but not the first
+	Added []string
+	// actions in the first effects, but not the second
+	Removed []string
+}
+
+func (d *EffectsDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// Compares the moderation actions (and flags and notifications, but not counters) in two sets of effects. Either may be nil, which is treated as no actions. Duplicate actions are ignored, and the output is sorted.
+func DiffEffects(a, b *Effects) EffectsDiff {
+	actionSet := func(e *Effects) map[string]bool {
+		set := map[string]bool{}
+		if e != nil {
+			for _, act := range e.actionList() {
+				set[act] = true
+			}
+		}
+		return set
+	}
+	before, after := actionSet(a), actionSet(b)
+	var diff EffectsDiff
+	for act := range after {
+		if !before[act] {
+			diff.Added = append(diff.Added, act)
+		}
+	}
+	for act := range before {
+		if !after[act] {
+			diff.Removed = append(diff.Removed, act)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+func (e *Effects) countRuleEval() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.RulesEvaluated++
+}
+
+func (e *Effects) addRuleFiring(rule string, actions []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.RuleFirings = append(e.RuleFirings, RuleFiring{Rule: rule, Actions: actions})
+}
+
+func (e *Effects) ruleFiringCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.RuleFirings)
+}
+
+// actions of the rule firings recorded after the first n
+func (e *Effects) ruleFiringActionsSince(n int) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []string
+	for _, rf := range e.RuleFirings[n:] {
+		out = append(out, rf.Actions...)
+	}
+	return out
+}
+
+// sets whether a notification is pending attribution to a rule, returning the previous value
+func (e *Effects) swapNotifyPending(pending bool) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	prev := e.notifyPending
+	e.notifyPending = pending
+	return prev
+}
+
+func (e *Effects) setRuleType(ruleType string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ruleType = ruleType
+}
+
+func (e *Effects) currentRuleType() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.ruleType
+}
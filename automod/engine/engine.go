@@ -15,6 +15,10 @@ import (
 	"github.com/bluesky-social/indigo/automod/flagstore"
 	"github.com/bluesky-social/indigo/automod/setstore"
 	"github.com/bluesky-social/indigo/xrpc"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -36,14 +40,22 @@ type Engine struct {
 	Flags     flagstore.FlagStore
 	// unlike the other sub-modules, this field (Notifier) may be nil
 	Notifier Notifier
+	// durable log of every rule firing, independent of notifications. may be nil, which disables audit logging
+	AuditLog *AuditLogger
+	// used to suppress identical moderation actions within a time window (see EngineConfig.ActionDedupeWindow). actions are claimed atomically before being persisted, and released if not persisted. may be nil, which disables this de-duplication
+	ActionDedupe cachestore.ClaimStore
 	// use to fetch public account metadata from AppView; no auth
 	BskyClient *xrpc.Client
 	// used to persist moderation actions in ozone moderation service; optional, admin auth
 	OzoneClient *xrpc.Client
+	// if set, moderation actions are published to this sink (eg, a message bus) instead of being sent to the mod service with OzoneClient. OzoneClient is still used, if configured, to fetch existing record moderation state. may be nil, which is the default
+	ActionSink ActionSink
 	// used to fetch private account metadata from PDS or entryway; optional, admin auth
 	AdminClient *xrpc.Client
 	// used to fetch blobs from upstream PDS instances
 	BlobClient *http.Client
+	// if not nil, requests to the PLC directory (see EngineConfig.PLCHost) wait on this limiter. this should be the same limiter as the identity directory uses (identity.BaseDirectory.PLCLimiter), so that all PLC requests count against a single limit
+	PLCLimiter *rate.Limiter
 
 	// internal configuration
 	Config EngineConfig
@@ -60,6 +72,12 @@ type EngineConfig struct {
 	QuotaModTakedownDay int
 	// number of misc actions automod can do per day, for all subjects combined (circuit breaker)
 	QuotaModActionDay int
+	// PLC directory host (eg, "https://plc.directory"). if set, used to determine account creation time from the PLC audit log, when not available from other account metadata
+	PLCHost string
+	// identical moderation actions (same subject, action type, and value) within this period are suppressed. requires ActionDedupe to be configured; zero disables
+	ActionDedupeWindow time.Duration
+	// if enabled, rules (and their counters) still run, but moderation actions (labels, tags, reports, takedowns, etc) are logged instead of being sent to the mod service. de-dupe window, quota, and circuit-breaker counters, flags, and notifications are skipped too
+	DryRun bool
 }
 
 // Entrypoint for external code pushing #identity events in to the engine.
@@ -67,6 +85,11 @@ type EngineConfig struct {
 // This method can be called concurrently, though cached state may end up inconsistent if multiple events for the same account (DID) are processed in parallel.
 func (eng *Engine) ProcessIdentityEvent(ctx context.Context, evt comatproto.SyncSubscribeRepos_Identity) error {
 	eventProcessCount.WithLabelValues("identity").Inc()
+	ctx, span := tracer.Start(ctx, "automod.ProcessIdentityEvent", trace.WithAttributes(
+		attribute.String("automod.event_type", "identity"),
+		attribute.String("automod.did", evt.Did),
+	))
+	defer span.End()
 	start := time.Now()
 	defer func() {
 		duration := time.Since(start)
@@ -122,7 +145,10 @@ func (eng *Engine) ProcessIdentityEvent(ctx context.Context, evt comatproto.Sync
 		return fmt.Errorf("rule execution failed: %w", err)
 	}
 	eng.CanonicalLogLineAccount(&ac)
-	if err := eng.persistAccountModActions(&ac); err != nil {
+	traceEffects(span, ac.effects)
+	err = eng.persistAccountModActions(&ac)
+	eng.auditRuleFirings("identity", did.String(), auditInputsHash(auditJSON(evt)), ac.effects, err)
+	if err != nil {
 		eventErrorCount.WithLabelValues("identity").Inc()
 		return fmt.Errorf("failed to persist actions for identity event: %w", err)
 	}
@@ -138,6 +164,11 @@ func (eng *Engine) ProcessIdentityEvent(ctx context.Context, evt comatproto.Sync
 // This method can be called concurrently, though cached state may end up inconsistent if multiple events for the same account (DID) are processed in parallel.
 func (eng *Engine) ProcessAccountEvent(ctx context.Context, evt comatproto.SyncSubscribeRepos_Account) error {
 	eventProcessCount.WithLabelValues("account").Inc()
+	ctx, span := tracer.Start(ctx, "automod.ProcessAccountEvent", trace.WithAttributes(
+		attribute.String("automod.event_type", "account"),
+		attribute.String("automod.did", evt.Did),
+	))
+	defer span.End()
 	start := time.Now()
 	defer func() {
 		duration := time.Since(start)
@@ -193,7 +224,10 @@ func (eng *Engine) ProcessAccountEvent(ctx context.Context, evt comatproto.SyncS
 		return fmt.Errorf("rule execution failed: %w", err)
 	}
 	eng.CanonicalLogLineAccount(&ac)
-	if err := eng.persistAccountModActions(&ac); err != nil {
+	traceEffects(span, ac.effects)
+	err = eng.persistAccountModActions(&ac)
+	eng.auditRuleFirings("account", did.String(), auditInputsHash(auditJSON(evt)), ac.effects, err)
+	if err != nil {
 		eventErrorCount.WithLabelValues("account").Inc()
 		return fmt.Errorf("failed to persist actions for account event: %w", err)
 	}
@@ -208,7 +242,22 @@ func (eng *Engine) ProcessAccountEvent(ctx context.Context, evt comatproto.SyncS
 //
 // This method can be called concurrently, though cached state may end up inconsistent if multiple events for the same account (DID) are processed in parallel.
 func (eng *Engine) ProcessRecordOp(ctx context.Context, op RecordOp) error {
+	_, err := eng.ProcessRecordOpEffects(ctx, op)
+	return err
+}
+
+// Same as ProcessRecordOp, but also returns the effects (actions, counters, etc) resulting from rule execution. The effects have already been persisted (or logged, in dry-run mode) by the time this returns.
+//
+// Effects may be nil if there was an error, or if rule execution panicked.
+func (eng *Engine) ProcessRecordOpEffects(ctx context.Context, op RecordOp) (*Effects, error) {
 	eventProcessCount.WithLabelValues("record").Inc()
+	ctx, span := tracer.Start(ctx, "automod.ProcessRecordOp", trace.WithAttributes(
+		attribute.String("automod.event_type", "record"),
+		attribute.String("automod.did", op.DID.String()),
+		attribute.String("automod.collection", op.Collection.String()),
+		attribute.String("automod.operation", op.Action),
+	))
+	defer span.End()
 	start := time.Now()
 	defer func() {
 		duration := time.Since(start)
@@ -226,16 +275,16 @@ func (eng *Engine) ProcessRecordOp(ctx context.Context, op RecordOp) error {
 
 	if err := op.Validate(); err != nil {
 		eventErrorCount.WithLabelValues("record").Inc()
-		return fmt.Errorf("bad record op: %w", err)
+		return nil, fmt.Errorf("bad record op: %w", err)
 	}
 	ident, err := eng.Directory.LookupDID(ctx, op.DID)
 	if err != nil {
 		eventErrorCount.WithLabelValues("record").Inc()
-		return fmt.Errorf("resolving identity: %w", err)
+		return nil, fmt.Errorf("resolving identity: %w", err)
 	}
 	if ident == nil {
 		eventErrorCount.WithLabelValues("record").Inc()
-		return fmt.Errorf("identity not found for DID: %s", op.DID)
+		return nil, fmt.Errorf("identity not found for DID: %s", op.DID)
 	}
 
 	var am *AccountMeta
@@ -243,7 +292,7 @@ func (eng *Engine) ProcessRecordOp(ctx context.Context, op RecordOp) error {
 		am, err = eng.GetAccountMeta(ctx, ident)
 		if err != nil {
 			eventErrorCount.WithLabelValues("identity").Inc()
-			return fmt.Errorf("failed to fetch account metadata: %w", err)
+			return nil, fmt.Errorf("failed to fetch account metadata: %w", err)
 		}
 	} else {
 		am = &AccountMeta{
@@ -257,38 +306,50 @@ func (eng *Engine) ProcessRecordOp(ctx context.Context, op RecordOp) error {
 	case CreateOp, UpdateOp:
 		if err := eng.Rules.CallRecordRules(&rc); err != nil {
 			eventErrorCount.WithLabelValues("record").Inc()
-			return fmt.Errorf("rule execution failed: %w", err)
+			return nil, fmt.Errorf("rule execution failed: %w", err)
 		}
 	case DeleteOp:
 		if err := eng.Rules.CallRecordDeleteRules(&rc); err != nil {
 			eventErrorCount.WithLabelValues("record").Inc()
-			return fmt.Errorf("rule execution failed: %w", err)
+			return nil, fmt.Errorf("rule execution failed: %w", err)
 		}
 	default:
 		eventErrorCount.WithLabelValues("record").Inc()
-		return fmt.Errorf("unexpected op action: %s", op.Action)
+		return nil, fmt.Errorf("unexpected op action: %s", op.Action)
 	}
 	eng.CanonicalLogLineRecord(&rc)
+	traceEffects(span, rc.effects)
 	// purge the account meta cache when profile is updated
 	if rc.RecordOp.Collection == "app.bsky.actor.profile" {
 		if err := eng.PurgeAccountCaches(ctx, op.DID); err != nil {
 			eng.Logger.Error("failed to purge identity cache", "err", err)
 		}
 	}
-	if err := eng.persistRecordModActions(&rc); err != nil {
+	err = eng.persistRecordModActions(&rc)
+	if eng.AuditLog != nil {
+		uri := op.ATURI().String()
+		eng.auditRuleFirings("record", uri, auditInputsHash([]byte(op.Action), []byte(uri), op.RecordCBOR), rc.effects, err)
+	}
+	if err != nil {
 		eventErrorCount.WithLabelValues("record").Inc()
-		return fmt.Errorf("failed to persist actions for record event: %w", err)
+		return nil, fmt.Errorf("failed to persist actions for record event: %w", err)
 	}
 	if err := eng.persistCounters(ctx, rc.effects); err != nil {
 		eventErrorCount.WithLabelValues("record").Inc()
-		return fmt.Errorf("failed to persist counts for record event: %w", err)
+		return nil, fmt.Errorf("failed to persist counts for record event: %w", err)
 	}
-	return nil
+	return rc.effects, nil
 }
 
 // returns a boolean indicating "block the event"
 func (eng *Engine) ProcessNotificationEvent(ctx context.Context, senderDID, recipientDID syntax.DID, reason string, subject syntax.ATURI) (bool, error) {
 	eventProcessCount.WithLabelValues("notif").Inc()
+	ctx, span := tracer.Start(ctx, "automod.ProcessNotificationEvent", trace.WithAttributes(
+		attribute.String("automod.event_type", "notification"),
+		attribute.String("automod.did", senderDID.String()),
+		attribute.String("automod.reason", reason),
+	))
+	defer span.End()
 	start := time.Now()
 	defer func() {
 		duration := time.Since(start)
@@ -341,6 +402,8 @@ func (eng *Engine) ProcessNotificationEvent(ctx context.Context, senderDID, reci
 		return false, fmt.Errorf("rule execution failed: %w", err)
 	}
 	eng.CanonicalLogLineNotification(&nc)
+	traceEffects(span, nc.effects)
+	eng.auditRuleFirings("notification", senderDID.String(), auditInputsHash([]byte(senderDID), []byte(recipientDID), []byte(reason), []byte(subject)), nc.effects, nil)
 	return nc.effects.RejectEvent, nil
 }
 
@@ -7,6 +7,9 @@ import (
 
 	toolsozone "github.com/bluesky-social/indigo/api/ozone"
 	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func NewOzoneEventContext(ctx context.Context, eng *Engine, eventView *toolsozone.ModerationDefs_ModEventView) (*OzoneEventContext, error) {
@@ -151,6 +154,10 @@ func NewOzoneEventContext(ctx context.Context, eng *Engine, eventView *toolsozon
 // This method can be called concurrently, though cached state may end up inconsistent if multiple events for the same account (DID) are processed in parallel.
 func (eng *Engine) ProcessOzoneEvent(ctx context.Context, eventView *toolsozone.ModerationDefs_ModEventView) error {
 	eventProcessCount.WithLabelValues("ozone").Inc()
+	ctx, span := tracer.Start(ctx, "automod.ProcessOzoneEvent", trace.WithAttributes(
+		attribute.String("automod.event_type", "ozone"),
+	))
+	defer span.End()
 	start := time.Now()
 	defer func() {
 		duration := time.Since(start)
@@ -186,6 +193,7 @@ func (eng *Engine) ProcessOzoneEvent(ctx context.Context, eventView *toolsozone.
 	}
 
 	eng.CanonicalLogLineOzoneEvent(ec)
+	traceEffects(span, ec.effects)
 
 	// some ozone events should result in account meta cache flushes
 	if (ec.Event.EventType == "takedown" || ec.Event.EventType == "reverseTakedown" || ec.Event.EventType == "label" || ec.Event.EventType == "tag") && ec.SubjectRecord == nil {
@@ -193,7 +201,9 @@ func (eng *Engine) ProcessOzoneEvent(ctx context.Context, eventView *toolsozone.
 			eng.Logger.Error("failed to purge identity cache", "err", err, "did", ec.Event.SubjectDID)
 		}
 	}
-	if err := eng.persistAccountModActions(&ec.AccountContext); err != nil {
+	err = eng.persistAccountModActions(&ec.AccountContext)
+	eng.auditRuleFirings("ozone", ec.Account.Identity.DID.String(), auditInputsHash(auditJSON(eventView)), ec.effects, err)
+	if err != nil {
 		eventErrorCount.WithLabelValues("ozoneEvent").Inc()
 		return fmt.Errorf("failed to persist actions for ozone event: %w", err)
 	}
@@ -49,3 +49,45 @@ func TestEngineBasics(t *testing.T) {
 	op.RecordCBOR = p2cbor
 	assert.NoError(eng.ProcessRecordOp(ctx, op))
 }
+
+func TestHandleVerified(t *testing.T) {
+	assert := assert.New(t)
+
+	am := AccountMeta{}
+	assert.False(am.HandleVerified())
+
+	am.Identity = &identity.Identity{
+		DID:    syntax.DID("did:plc:abc111"),
+		Handle: syntax.Handle("handle.example.com"),
+	}
+	assert.True(am.HandleVerified())
+
+	// directory lookups mark handles which fail bidirectional verification as invalid
+	am.Identity.Handle = syntax.HandleInvalid
+	assert.False(am.HandleVerified())
+}
+
+func TestDiffEffects(t *testing.T) {
+	assert := assert.New(t)
+
+	a := &Effects{}
+	a.AddAccountLabel("spam")
+	a.AddRecordLabel("spam")
+	a.ReportRecord(ReportReasonSpam, "first")
+	b := &Effects{}
+	b.AddRecordLabel("spam")
+	b.ReportRecord(ReportReasonSpam, "second")
+	b.TakedownRecord()
+
+	diff := DiffEffects(a, b)
+	assert.Equal([]string{"record-takedown"}, diff.Added)
+	assert.Equal([]string{"account-label:spam"}, diff.Removed)
+	assert.False(diff.IsEmpty())
+
+	diff = DiffEffects(nil, b)
+	assert.Equal([]string{"record-label:spam", "record-report:" + ReportReasonSpam, "record-takedown"}, diff.Added)
+	assert.Empty(diff.Removed)
+
+	diff = DiffEffects(a, a)
+	assert.True(diff.IsEmpty())
+}
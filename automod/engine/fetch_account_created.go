@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// single entry from a PLC directory audit log (`/{did}/log/audit`). only the fields needed here are parsed
+type plcAuditLogEntry struct {
+	CreatedAt string `json:"createdAt"`
+	Nullified bool   `json:"nullified"`
+}
+
+// Fetches the account creation time for a did:plc account, as the timestamp of the first operation in the PLC directory audit log.
+//
+// Returns nil (with no error) for non-PLC DIDs, or if PLC host is not configured. Requests are rate-limited by Engine.PLCLimiter.
+func (e *Engine) fetchPLCCreatedAt(ctx context.Context, did syntax.DID) (*time.Time, error) {
+	if e.Config.PLCHost == "" || did.Method() != "plc" {
+		return nil, nil
+	}
+	if e.PLCLimiter != nil {
+		if err := e.PLCLimiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("failed to wait for PLC limiter: %w", err)
+		}
+	}
+	u := strings.TrimSuffix(e.Config.PLCHost, "/") + "/" + url.PathEscape(did.String()) + "/log/audit"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := e.BlobClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching PLC audit log: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching PLC audit log: HTTP status %d", resp.StatusCode)
+	}
+	var entries []plcAuditLogEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("parsing PLC audit log: %w", err)
+	}
+	// the log is in chronological order; the genesis operation can not be nullified, but skip any nullified entries just in case
+	for _, entry := range entries {
+		if entry.Nullified {
+			continue
+		}
+		ts, err := syntax.ParseDatetimeTime(entry.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PLC audit log createdAt: %w", err)
+		}
+		return &ts, nil
+	}
+	return nil, nil
+}
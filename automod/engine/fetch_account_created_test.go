@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestFetchPLCCreatedAt(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/did:plc:abc111/log/audit" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"did":"did:plc:abc111","createdAt":"2024-01-02T03:04:05.000Z","nullified":false},{"did":"did:plc:abc111","createdAt":"2024-06-01T00:00:00.000Z","nullified":false}]`))
+	}))
+	defer srv.Close()
+
+	eng := EngineTestFixture()
+
+	// not configured
+	ts, err := eng.fetchPLCCreatedAt(ctx, syntax.DID("did:plc:abc111"))
+	assert.NoError(err)
+	assert.Nil(ts)
+
+	eng.Config.PLCHost = srv.URL
+	ts, err = eng.fetchPLCCreatedAt(ctx, syntax.DID("did:plc:abc111"))
+	assert.NoError(err)
+	if assert.NotNil(ts) {
+		assert.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), ts.UTC())
+	}
+
+	// non-PLC DIDs are skipped
+	ts, err = eng.fetchPLCCreatedAt(ctx, syntax.DID("did:web:example.com"))
+	assert.NoError(err)
+	assert.Nil(ts)
+
+	_, err = eng.fetchPLCCreatedAt(ctx, syntax.DID("did:plc:abc222"))
+	assert.Error(err)
+
+	// requests wait on the PLC rate limiter
+	eng.PLCLimiter = rate.NewLimiter(0, 0)
+	_, err = eng.fetchPLCCreatedAt(ctx, syntax.DID("did:plc:abc111"))
+	assert.ErrorContains(err, "PLC limiter")
+}
@@ -187,6 +187,16 @@ func (e *Engine) GetAccountMeta(ctx context.Context, ident *identity.Identity) (
 		}
 	}
 
+	// last resort: PLC directory audit log. the result is cached along with the rest of the account metadata
+	if am.CreatedAt == nil {
+		ts, err := e.fetchPLCCreatedAt(ctx, ident.DID)
+		if err != nil {
+			logger.Warn("failed to fetch account creation time from PLC", "err", err)
+		} else if ts != nil {
+			am.CreatedAt = ts
+		}
+	}
+
 	if am.CreatedAt == nil {
 		logger.Warn("account metadata missing CreatedAt time")
 	}
@@ -67,10 +67,51 @@ var accountRelationshipFetches = promauto.NewCounter(prometheus.CounterOpts{
 
 var blobDownloadCount = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name: "automod_blob_downloads",
-	Help: "Number of blobs downloaded, by HTTP status code",
+	Help: "Number of blob download attempts, by HTTP status code (or 'error' if the request failed)",
 }, []string{"status"})
 
+var blobFetchSkipped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "automod_blob_fetches_skipped",
+	Help: "Number of records for which blob fetching was skipped entirely, because the ruleset has no blob rules",
+})
+
 var blobDownloadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
 	Name: "automod_blob_download_duration_sec",
 	Help: "Duration of blob download attempts",
 })
+
+var ruleEvalCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_rule_evaluations",
+	Help: "Number of times each rule was evaluated",
+}, []string{"type", "rule"})
+
+var ruleMatchCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_rule_matches",
+	Help: "Number of times each rule resulted in a moderation action, flag, or notification",
+}, []string{"type", "rule"})
+
+var ruleEvalDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "automod_rule_duration_sec",
+	Help:    "Duration of individual rule evaluation",
+	Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+}, []string{"type", "rule"})
+
+var actionDedupeSuppressedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_action_dedupe_suppressed",
+	Help: "Number of moderation actions suppressed as duplicates within the de-dupe window",
+}, []string{"type", "action"})
+
+var actionSinkErrorCount = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "automod_action_sink_errors",
+	Help: "Number of failures publishing moderation actions to the action sink",
+})
+
+var auditDroppedCount = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "automod_audit_entries_dropped",
+	Help: "Number of audit log entries dropped because the write buffer was full",
+})
+
+var auditErrorCount = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "automod_audit_entries_errors",
+	Help: "Number of audit log entries which failed to be written to the audit sink",
+})
@@ -49,16 +49,57 @@ func (eng *Engine) persistAccountModActions(c *AccountContext) error {
 	newTags := dedupeTagActions(c.effects.AccountTags, existingTags)
 	newFlags := dedupeFlagActions(c.effects.AccountFlags, c.Account.AccountFlags)
 
+	// in dry-run mode, stop before anything with side effects: de-dupe window and quota counters, circuit breakers, notifications, and flags
+	if eng.Config.DryRun {
+		if len(newLabels) > 0 || len(newTags) > 0 || len(newFlags) > 0 || len(c.effects.AccountReports) > 0 || c.effects.AccountTakedown || c.effects.AccountEscalate || c.effects.AccountAcknowledge {
+			c.Logger.Info("dry-run: not persisting account actions",
+				"did", c.Account.Identity.DID.String(),
+				"rules", firedRuleNames(c.effects),
+				"newLabels", newLabels,
+				"newTags", newTags,
+				"newFlags", newFlags,
+				"reports", reportReasons(c.effects.AccountReports),
+				"takedown", c.effects.AccountTakedown && !c.Account.Takendown,
+				"escalate", c.effects.AccountEscalate,
+				"acknowledge", c.effects.AccountAcknowledge,
+			)
+		}
+		return nil
+	}
+
 	// don't report the same account multiple times on the same day for the same reason. this is a quick check; we also query the mod service API just before creating the report.
 	partialReports, err := eng.dedupeReportActions(ctx, c.Account.Identity.DID.String(), c.effects.AccountReports)
 	if err != nil {
 		return fmt.Errorf("de-duplicating reports: %w", err)
 	}
+
+	// suppress identical actions repeated within a short window (eg, during a burst of events for the same account). claims for actions which don't get persisted are released on return
+	did := c.Account.Identity.DID.String()
+	claims := windowClaims{subject: did}
+	defer eng.releaseWindowClaims(ctx, c.Logger, &claims)
+	if newLabels, err = eng.dedupeWindowActions(ctx, "account", did, "label", newLabels); err != nil {
+		return fmt.Errorf("de-duplicating labels: %w", err)
+	}
+	claims.labels = newLabels
+	if newTags, err = eng.dedupeWindowActions(ctx, "account", did, "tag", newTags); err != nil {
+		return fmt.Errorf("de-duplicating tags: %w", err)
+	}
+	claims.tags = newTags
+	if partialReports, err = eng.dedupeWindowReports(ctx, "account", did, partialReports); err != nil {
+		return fmt.Errorf("de-duplicating reports: %w", err)
+	}
+	claims.reports = partialReports
+	partialTakedown, err := eng.dedupeWindowTakedown(ctx, "account", did, c.effects.AccountTakedown && !c.Account.Takendown)
+	if err != nil {
+		return fmt.Errorf("de-duplicating takedowns: %w", err)
+	}
+	claims.takedown = partialTakedown
+
 	newReports, err := eng.circuitBreakReports(ctx, partialReports)
 	if err != nil {
 		return fmt.Errorf("circuit-breaking reports: %w", err)
 	}
-	newTakedown, err := eng.circuitBreakTakedown(ctx, c.effects.AccountTakedown && !c.Account.Takendown)
+	newTakedown, err := eng.circuitBreakTakedown(ctx, partialTakedown)
 	if err != nil {
 		return fmt.Errorf("circuit-breaking takedowns: %w", err)
 	}
@@ -101,6 +142,24 @@ func (eng *Engine) persistAccountModActions(c *AccountContext) error {
 		eng.Flags.Add(ctx, c.Account.Identity.DID.String(), newFlags)
 	}
 
+	if eng.ActionSink != nil {
+		evt := newActionEvent("account", did, c.effects, newLabels, newTags, newReports)
+		evt.Takedown = newTakedown
+		// we don't want to escalate if there is a takedown
+		evt.Escalate = newEscalation && !newTakedown
+		evt.Acknowledge = newAcknowledge
+		if !evt.isEmpty() {
+			if err := eng.publishAction(ctx, c.Logger, &evt); err != nil {
+				return fmt.Errorf("publishing account actions: %w", err)
+			}
+			claims.persisted(newReports, newTakedown)
+		}
+		if anyModActions {
+			return eng.PurgeAccountCaches(ctx, c.Account.Identity.DID)
+		}
+		return nil
+	}
+
 	// if we can't actually talk to service, bail out early
 	if eng.OzoneClient == nil {
 		if anyModActions {
@@ -135,6 +194,8 @@ func (eng *Engine) persistAccountModActions(c *AccountContext) error {
 		})
 		if err != nil {
 			c.Logger.Error("failed to create account labels", "err", err)
+		} else {
+			claims.labels = nil
 		}
 	}
 
@@ -162,20 +223,27 @@ func (eng *Engine) persistAccountModActions(c *AccountContext) error {
 		})
 		if err != nil {
 			c.Logger.Error("failed to create account tags", "err", err)
+		} else {
+			claims.tags = nil
 		}
 	}
 
 	// reports are additionally de-duped when persisting the action, so track with a flag
 	createdReports := false
+	failedReports := []ModReport{}
 	for _, mr := range newReports {
 		created, err := eng.createReportIfFresh(ctx, xrpcc, c.Account.Identity.DID, mr)
 		if err != nil {
 			c.Logger.Error("failed to create account report", "err", err)
+			failedReports = append(failedReports, mr)
 		}
 		if created {
 			createdReports = true
 		}
 	}
+	if len(newReports) > 0 {
+		claims.reports = failedReports
+	}
 
 	if newTakedown {
 		c.Logger.Warn("account-takedown")
@@ -196,6 +264,8 @@ func (eng *Engine) persistAccountModActions(c *AccountContext) error {
 		})
 		if err != nil {
 			c.Logger.Error("failed to execute account takedown", "err", err)
+		} else {
+			claims.takedown = false
 		}
 
 		// we don't want to escalate if there is a takedown
@@ -303,16 +373,54 @@ func (eng *Engine) persistRecordModActions(c *RecordContext) error {
 		newFlags = dedupeFlagActions(newFlags, existingFlags)
 	}
 
+	// in dry-run mode, stop before anything with side effects (see persistAccountModActions)
+	if eng.Config.DryRun {
+		if len(newLabels) > 0 || len(newTags) > 0 || len(newFlags) > 0 || len(c.effects.RecordReports) > 0 || c.effects.RecordTakedown {
+			c.Logger.Info("dry-run: not persisting record actions",
+				"uri", atURI,
+				"rules", firedRuleNames(c.effects),
+				"newLabels", newLabels,
+				"newTags", newTags,
+				"newFlags", newFlags,
+				"reports", reportReasons(c.effects.RecordReports),
+				"takedown", c.effects.RecordTakedown,
+			)
+		}
+		return nil
+	}
+
 	// don't report the same record multiple times on the same day for the same reason. this is a quick check; we also query the mod service API just before creating the report.
 	partialReports, err := eng.dedupeReportActions(ctx, atURI, c.effects.RecordReports)
 	if err != nil {
 		return fmt.Errorf("de-duplicating reports: %w", err)
 	}
+
+	// suppress identical actions repeated within a short window (eg, the same record processed multiple times during a backfill). claims for actions which don't get persisted are released on return
+	claims := windowClaims{subject: atURI}
+	defer eng.releaseWindowClaims(ctx, c.Logger, &claims)
+	if newLabels, err = eng.dedupeWindowActions(ctx, "record", atURI, "label", newLabels); err != nil {
+		return fmt.Errorf("de-duplicating labels: %w", err)
+	}
+	claims.labels = newLabels
+	if newTags, err = eng.dedupeWindowActions(ctx, "record", atURI, "tag", newTags); err != nil {
+		return fmt.Errorf("de-duplicating tags: %w", err)
+	}
+	claims.tags = newTags
+	if partialReports, err = eng.dedupeWindowReports(ctx, "record", atURI, partialReports); err != nil {
+		return fmt.Errorf("de-duplicating reports: %w", err)
+	}
+	claims.reports = partialReports
+	partialTakedown, err := eng.dedupeWindowTakedown(ctx, "record", atURI, c.effects.RecordTakedown)
+	if err != nil {
+		return fmt.Errorf("de-duplicating takedowns: %w", err)
+	}
+	claims.takedown = partialTakedown
+
 	newReports, err := eng.circuitBreakReports(ctx, partialReports)
 	if err != nil {
 		return fmt.Errorf("failed to circuit break reports: %w", err)
 	}
-	newTakedown, err := eng.circuitBreakTakedown(ctx, c.effects.RecordTakedown)
+	newTakedown, err := eng.circuitBreakTakedown(ctx, partialTakedown)
 	if err != nil {
 		return fmt.Errorf("failed to circuit break takedowns: %w", err)
 	}
@@ -341,6 +449,25 @@ func (eng *Engine) persistRecordModActions(c *RecordContext) error {
 		return nil
 	}
 
+	if eng.ActionSink != nil {
+		evt := newActionEvent("record", c.RecordOp.DID.String(), c.effects, newLabels, newTags, newReports)
+		evt.URI = atURI
+		if c.RecordOp.CID != nil {
+			evt.CID = c.RecordOp.CID.String()
+		}
+		evt.Takedown = newTakedown
+		if newTakedown {
+			evt.BlobTakedowns = dedupeStrings(c.effects.BlobTakedowns)
+		}
+		if !evt.isEmpty() {
+			if err := eng.publishAction(ctx, c.Logger, &evt); err != nil {
+				return fmt.Errorf("publishing record actions: %w", err)
+			}
+			claims.persisted(newReports, newTakedown)
+		}
+		return nil
+	}
+
 	if eng.OzoneClient == nil {
 		c.Logger.Warn("not persisting actions because mod service client not configured")
 		return nil
@@ -379,6 +506,8 @@ func (eng *Engine) persistRecordModActions(c *RecordContext) error {
 		})
 		if err != nil {
 			c.Logger.Error("failed to create record label", "err", err)
+		} else {
+			claims.labels = nil
 		}
 	}
 
@@ -404,15 +533,22 @@ func (eng *Engine) persistRecordModActions(c *RecordContext) error {
 		})
 		if err != nil {
 			c.Logger.Error("failed to create record tag", "err", err)
+		} else {
+			claims.tags = nil
 		}
 	}
 
+	failedReports := []ModReport{}
 	for _, mr := range newReports {
 		_, err := eng.createRecordReportIfFresh(ctx, xrpcc, c.RecordOp.ATURI(), c.RecordOp.CID, mr)
 		if err != nil {
 			c.Logger.Error("failed to create record report", "err", err)
+			failedReports = append(failedReports, mr)
 		}
 	}
+	if len(newReports) > 0 {
+		claims.reports = failedReports
+	}
 
 	if newTakedown {
 		c.Logger.Warn("record-takedown")
@@ -432,6 +568,8 @@ func (eng *Engine) persistRecordModActions(c *RecordContext) error {
 		})
 		if err != nil {
 			c.Logger.Error("failed to execute record takedown", "err", err)
+		} else {
+			claims.takedown = false
 		}
 	}
 
@@ -3,6 +3,7 @@ package engine
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
@@ -69,6 +70,24 @@ func dedupeFlagActions(flags, existing []string) []string {
 	return newFlags
 }
 
+// short reason names of a set of reports, for logging
+func reportReasons(reports []ModReport) []string {
+	reasons := make([]string, len(reports))
+	for i, r := range reports {
+		reasons[i] = ReasonShortName(r.ReasonType)
+	}
+	return reasons
+}
+
+// names of the rules which fired (de-duplicated), for logging and action events
+func firedRuleNames(eff *Effects) []string {
+	names := []string{}
+	for _, rf := range eff.RuleFirings {
+		names = append(names, rf.Rule)
+	}
+	return dedupeStrings(names)
+}
+
 func (eng *Engine) dedupeReportActions(ctx context.Context, subject string, reports []ModReport) ([]ModReport, error) {
 	newReports := []ModReport{}
 	for _, r := range reports {
@@ -90,6 +109,116 @@ func (eng *Engine) dedupeReportActions(ctx context.Context, subject string, repo
 	return newReports, nil
 }
 
+func (eng *Engine) dedupeWindowEnabled() bool {
+	return eng.ActionDedupe != nil && eng.Config.ActionDedupeWindow > 0
+}
+
+func dedupeWindowKey(subject, action, val string) string {
+	return subject + "/" + action + "/" + val
+}
+
+// Filters out action values which were already actioned for the same subject (DID or AT-URI) and action type within the configured de-dupe window, and claims the remaining values. Claims are atomic, so only one worker will action a given value. Returns all values unchanged if the window is not configured.
+//
+// Claimed values which end up not being persisted (eg, because of a circuit breaker, or a failed mod service request) must be released (see windowClaims), so that the action isn't suppressed for the rest of the window.
+//
+// This is in addition to the other de-dupe helpers, which compare against existing moderation state; this helper catches repeated actions during bursts (eg, backfills) before that state has been updated.
+func (eng *Engine) dedupeWindowActions(ctx context.Context, subjectType, subject, action string, vals []string) ([]string, error) {
+	if !eng.dedupeWindowEnabled() || len(vals) == 0 {
+		return vals, nil
+	}
+	now := time.Now().Format(time.RFC3339Nano)
+	fresh := []string{}
+	for _, val := range vals {
+		ok, err := eng.ActionDedupe.SetNX(ctx, "action-dedupe", dedupeWindowKey(subject, action, val), now, eng.Config.ActionDedupeWindow)
+		if err != nil {
+			eng.releaseWindowActions(ctx, eng.Logger, subject, action, fresh)
+			return nil, fmt.Errorf("claiming action de-dupe key: %w", err)
+		}
+		if !ok {
+			eng.Logger.Debug("suppressing duplicate action", "subject", subject, "action", action, "val", val)
+			actionDedupeSuppressedCount.WithLabelValues(subjectType, action).Inc()
+			continue
+		}
+		fresh = append(fresh, val)
+	}
+	return fresh, nil
+}
+
+// Releases de-dupe window claims (see dedupeWindowActions) for actions which were not persisted. Failures are logged, not returned: the worst case is that the action is suppressed until the end of the window.
+func (eng *Engine) releaseWindowActions(ctx context.Context, logger *slog.Logger, subject, action string, vals []string) {
+	if !eng.dedupeWindowEnabled() {
+		return
+	}
+	for _, val := range vals {
+		if err := eng.ActionDedupe.Purge(ctx, "action-dedupe", dedupeWindowKey(subject, action, val)); err != nil {
+			logger.Warn("failed to release action de-dupe key", "subject", subject, "action", action, "val", val, "err", err)
+		}
+	}
+}
+
+// De-dupe window claims for the actions on a single subject. Actions are removed from this set as they are persisted; whatever remains when persisting is finished (eg, actions dropped by circuit breakers, or failed mod service requests) gets released.
+type windowClaims struct {
+	subject  string
+	labels   []string
+	tags     []string
+	reports  []ModReport
+	takedown bool
+}
+
+// marks all the claimed labels and tags as persisted, along with the given reports and takedown (which may have been dropped by circuit breakers after being claimed)
+func (wc *windowClaims) persisted(reports []ModReport, takedown bool) {
+	wc.labels = nil
+	wc.tags = nil
+	if len(reports) > 0 {
+		wc.reports = nil
+	}
+	if takedown {
+		wc.takedown = false
+	}
+}
+
+func (eng *Engine) releaseWindowClaims(ctx context.Context, logger *slog.Logger, wc *windowClaims) {
+	eng.releaseWindowActions(ctx, logger, wc.subject, "label", wc.labels)
+	eng.releaseWindowActions(ctx, logger, wc.subject, "tag", wc.tags)
+	for _, r := range wc.reports {
+		eng.releaseWindowActions(ctx, logger, wc.subject, "report", []string{r.ReasonType})
+	}
+	if wc.takedown {
+		eng.releaseWindowActions(ctx, logger, wc.subject, "takedown", []string{"takedown"})
+	}
+}
+
+// same as dedupeWindowActions, for reports (by reason type)
+func (eng *Engine) dedupeWindowReports(ctx context.Context, subjectType, subject string, reports []ModReport) ([]ModReport, error) {
+	if !eng.dedupeWindowEnabled() || len(reports) == 0 {
+		return reports, nil
+	}
+	fresh := []ModReport{}
+	for _, r := range reports {
+		ok, err := eng.dedupeWindowActions(ctx, subjectType, subject, "report", []string{r.ReasonType})
+		if err != nil {
+			eng.releaseWindowClaims(ctx, eng.Logger, &windowClaims{subject: subject, reports: fresh})
+			return nil, err
+		}
+		if len(ok) > 0 {
+			fresh = append(fresh, r)
+		}
+	}
+	return fresh, nil
+}
+
+// same as dedupeWindowActions, for takedowns
+func (eng *Engine) dedupeWindowTakedown(ctx context.Context, subjectType, subject string, takedown bool) (bool, error) {
+	if !takedown {
+		return false, nil
+	}
+	ok, err := eng.dedupeWindowActions(ctx, subjectType, subject, "takedown", []string{"takedown"})
+	if err != nil {
+		return false, err
+	}
+	return len(ok) > 0, nil
+}
+
 func (eng *Engine) circuitBreakReports(ctx context.Context, reports []ModReport) ([]ModReport, error) {
 	if len(reports) == 0 {
 		return []ModReport{}, nil
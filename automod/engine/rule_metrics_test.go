@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleMetrics(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	assert.Equal("engine.simpleRule", ruleName(PostRuleFunc(simpleRule)))
+
+	evals := ruleEvalCount.WithLabelValues("post", "engine.simpleRule")
+	matches := ruleMatchCount.WithLabelValues("post", "engine.simpleRule")
+	evalsBefore := testutil.ToFloat64(evals)
+	matchesBefore := testutil.ToFloat64(matches)
+
+	eng := EngineTestFixture()
+	cid1 := syntax.CID("cid123")
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        syntax.DID("did:plc:abc111"),
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+	}
+
+	// no match
+	p1 := appbsky.FeedPost{Text: "some post blah"}
+	buf := new(bytes.Buffer)
+	assert.NoError(p1.MarshalCBOR(buf))
+	op.RecordCBOR = buf.Bytes()
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	assert.Equal(evalsBefore+1, testutil.ToFloat64(evals))
+	assert.Equal(matchesBefore, testutil.ToFloat64(matches))
+
+	// match
+	p2 := appbsky.FeedPost{Text: "some post blah", Tags: []string{"slur"}}
+	buf = new(bytes.Buffer)
+	assert.NoError(p2.MarshalCBOR(buf))
+	op.RecordCBOR = buf.Bytes()
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	assert.Equal(evalsBefore+2, testutil.ToFloat64(evals))
+	assert.Equal(matchesBefore+1, testutil.ToFloat64(matches))
+}
+
+func TestRunNamedRule(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	named := ruleMatchCount.WithLabelValues("post", "named-closure")
+	namedBefore := testutil.ToFloat64(named)
+
+	eng := EngineTestFixture()
+	eng.Rules = RuleSet{
+		PostRules: []PostRuleFunc{
+			func(c *RecordContext, post *appbsky.FeedPost) error {
+				return c.RunNamedRule("named-closure", func() error {
+					c.AddRecordFlag("named")
+					return nil
+				})
+			},
+		},
+	}
+	cid1 := syntax.CID("cid123")
+	p1 := appbsky.FeedPost{Text: "some post blah"}
+	buf := new(bytes.Buffer)
+	assert.NoError(p1.MarshalCBOR(buf))
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        syntax.DID("did:plc:abc111"),
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		RecordCBOR: buf.Bytes(),
+	}
+	eff, err := eng.ProcessRecordOpEffects(ctx, op)
+	assert.NoError(err)
+
+	// the flag is only attributed to the named sub-rule, not also to the enclosing closure
+	if assert.Len(eff.RuleFirings, 1) {
+		assert.Equal("named-closure", eff.RuleFirings[0].Rule)
+	}
+	assert.Equal(namedBefore+1, testutil.ToFloat64(named))
+}
@@ -3,7 +3,10 @@ package engine
 import (
 	"bytes"
 	"fmt"
+	"reflect"
+	"runtime"
 	"sync"
+	"time"
 
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
 	lexutil "github.com/bluesky-social/indigo/lex/util"
@@ -22,11 +25,16 @@ type RuleSet struct {
 	OzoneEventRules   []OzoneEventRuleFunc
 }
 
+// Returns true if any rules in the set need blob contents, meaning that blobs referenced by records will be downloaded. For text-only rulesets, blobs are never fetched.
+func (r *RuleSet) NeedsBlobs() bool {
+	return len(r.BlobRules) > 0
+}
+
 // Executes all the various record-related rules. Only dispatches execution, does no other de-dupe or pre/post processing.
 func (r *RuleSet) CallRecordRules(c *RecordContext) error {
 	// first the generic rules
 	for _, f := range r.RecordRules {
-		err := f(c)
+		err := observeRule("record", f, c.effects, func() error { return f(c) })
 		if err != nil {
 			c.Logger.Error("record rule execution failed", "err", err)
 		}
@@ -39,7 +47,7 @@ func (r *RuleSet) CallRecordRules(c *RecordContext) error {
 			return fmt.Errorf("failed to parse app.bsky.feed.post record: %v", err)
 		}
 		for _, f := range r.PostRules {
-			err := f(c, &post)
+			err := observeRule("post", f, c.effects, func() error { return f(c, &post) })
 			if err != nil {
 				c.Logger.Error("post rule execution failed", "err", err)
 			}
@@ -50,14 +58,15 @@ func (r *RuleSet) CallRecordRules(c *RecordContext) error {
 			return fmt.Errorf("failed to parse app.bsky.actor.profile record: %v", err)
 		}
 		for _, f := range r.ProfileRules {
-			err := f(c, &profile)
+			err := observeRule("profile", f, c.effects, func() error { return f(c, &profile) })
 			if err != nil {
 				c.Logger.Error("profile rule execution failed", "err", err)
 			}
 		}
 	}
-	// then blob rules, if any
-	if len(r.BlobRules) == 0 {
+	// then blob rules, if any. blobs are only downloaded if there are rules to process them
+	if !r.NeedsBlobs() {
+		blobFetchSkipped.Inc()
 		return nil
 	}
 	err := r.fetchAndProcessBlobs(c)
@@ -71,7 +80,7 @@ func (r *RuleSet) CallRecordRules(c *RecordContext) error {
 // NOTE: this will probably be removed and merged in to `CallRecordRules`
 func (r *RuleSet) CallRecordDeleteRules(c *RecordContext) error {
 	for _, f := range r.RecordDeleteRules {
-		err := f(c)
+		err := observeRule("record_delete", f, c.effects, func() error { return f(c) })
 		if err != nil {
 			c.Logger.Error("record delete rule execution failed", "err", err)
 		}
@@ -82,7 +91,7 @@ func (r *RuleSet) CallRecordDeleteRules(c *RecordContext) error {
 // Executes rules for identity update events.
 func (r *RuleSet) CallIdentityRules(c *AccountContext) error {
 	for _, f := range r.IdentityRules {
-		err := f(c)
+		err := observeRule("identity", f, c.effects, func() error { return f(c) })
 		if err != nil {
 			c.Logger.Error("identity rule execution failed", "err", err)
 		}
@@ -93,7 +102,7 @@ func (r *RuleSet) CallIdentityRules(c *AccountContext) error {
 // Executes rules for account update events.
 func (r *RuleSet) CallAccountRules(c *AccountContext) error {
 	for _, f := range r.AccountRules {
-		err := f(c)
+		err := observeRule("account", f, c.effects, func() error { return f(c) })
 		if err != nil {
 			c.Logger.Error("account rule execution failed", "err", err)
 		}
@@ -103,7 +112,7 @@ func (r *RuleSet) CallAccountRules(c *AccountContext) error {
 
 func (r *RuleSet) CallNotificationRules(c *NotificationContext) error {
 	for _, f := range r.NotificationRules {
-		err := f(c)
+		err := observeRule("notification", f, c.effects, func() error { return f(c) })
 		if err != nil {
 			c.Logger.Error("notification rule execution failed", "err", err)
 		}
@@ -113,7 +122,7 @@ func (r *RuleSet) CallNotificationRules(c *NotificationContext) error {
 
 func (r *RuleSet) CallOzoneEventRules(c *OzoneEventContext) error {
 	for _, f := range r.OzoneEventRules {
-		err := f(c)
+		err := observeRule("ozone_event", f, c.effects, func() error { return f(c) })
 		if err != nil {
 			c.Logger.Error("ozone event rule execution failed", "err", err)
 		}
@@ -170,7 +179,7 @@ func (r *RuleSet) processBlob(c *RecordContext, blob lexutil.LexBlob, data []byt
 		wg.Add(1)
 		go func(brf BlobRuleFunc) {
 			defer wg.Done()
-			err := brf(c, blob, data)
+			err := observeRule("blob", brf, c.effects, func() error { return brf(c, blob, data) })
 			if err != nil {
 				errChan <- err
 				return
@@ -189,3 +198,51 @@ func (r *RuleSet) processBlob(c *RecordContext, blob lexutil.LexBlob, data []byt
 	}
 	return nil
 }
+
+// cache of rule function names, keyed by function pointer
+var ruleNames sync.Map
+
+// returns a short human-readable name for a rule function (eg, "rules.BadHashtagsPostRule")
+func ruleName(rule any) string {
+	ptr := reflect.ValueOf(rule).Pointer()
+	if name, ok := ruleNames.Load(ptr); ok {
+		return name.(string)
+	}
+	name := "unknown"
+	if fn := runtime.FuncForPC(ptr); fn != nil {
+		name = shortFuncName(fn.Name())
+	}
+	ruleNames.Store(ptr, name)
+	return name
+}
+
+// Executes a single rule (via the call closure), recording per-rule evaluation, match, and duration metrics. Matching rules are also recorded in the effects, for audit logging. The rule is named after its function; see BaseContext.RunNamedRule for explicit names.
+//
+// A rule is counted as "matched" if the number of actions in the effects increased while it ran. Blob rules run concurrently, so matches for those may be mis-attributed between rules on the same record.
+func observeRule(ruleType string, rule any, effects *Effects, call func() error) error {
+	effects.setRuleType(ruleType)
+	return observeNamedRule(ruleType, ruleName(rule), effects, call)
+}
+
+func observeNamedRule(ruleType, name string, effects *Effects, call func() error) error {
+	before := effects.actionList()
+	firingsBefore := effects.ruleFiringCount()
+	// notifications requested by an enclosing rule before this one was called are set aside, and restored after
+	notifyBefore := effects.swapNotifyPending(false)
+	start := time.Now()
+	err := call()
+	ruleEvalDuration.WithLabelValues(ruleType, name).Observe(time.Since(start).Seconds())
+	ruleEvalCount.WithLabelValues(ruleType, name).Inc()
+	effects.countRuleEval()
+	if effects.swapNotifyPending(notifyBefore) {
+		effects.NotifyRule(name)
+	}
+	actions := newActions(before, effects.actionList())
+	// actions already attributed to named sub-rules run by this rule
+	actions = newActions(effects.ruleFiringActionsSince(firingsBefore), actions)
+	if len(actions) > 0 {
+		ruleMatchCount.WithLabelValues(ruleType, name).Inc()
+		effects.addRuleFiring(name, actions)
+	}
+	return err
+}
@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Spans are exported if the process configured a global OTEL tracer provider (eg, hepa with OTEL_EXPORTER_OTLP_ENDPOINT set); otherwise this is a no-op tracer.
+var tracer = otel.Tracer("automod")
+
+// Records the outcome of rule execution on an event span: how many rules were evaluated, which rules fired, and the actions they enqueued.
+func traceEffects(span trace.Span, eff *Effects) {
+	if eff == nil || !span.IsRecording() {
+		return
+	}
+	actions := eff.actionList()
+	eff.mu.Lock()
+	evaluated := eff.RulesEvaluated
+	var fired []string
+	for _, f := range eff.RuleFirings {
+		fired = append(fired, f.Rule)
+	}
+	eff.mu.Unlock()
+	span.SetAttributes(
+		attribute.Int("automod.rules_evaluated", evaluated),
+		attribute.StringSlice("automod.rules_fired", fired),
+		attribute.StringSlice("automod.actions", actions),
+		attribute.Int("automod.action_count", len(actions)),
+	)
+}
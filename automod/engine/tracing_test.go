@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRecordSpan(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := tracesdk.NewTracerProvider(tracesdk.WithSpanProcessor(recorder))
+	defer provider.Shutdown(ctx)
+	origTracer := tracer
+	tracer = provider.Tracer("automod")
+	defer func() { tracer = origTracer }()
+
+	eng := EngineTestFixture()
+	cid1 := syntax.CID("cid123")
+	p := appbsky.FeedPost{Text: "match", Tags: []string{"slur"}}
+	buf := new(bytes.Buffer)
+	assert.NoError(p.MarshalCBOR(buf))
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        syntax.DID("did:plc:abc111"),
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		RecordCBOR: buf.Bytes(),
+	}
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+
+	spans := recorder.Ended()
+	if !assert.Len(spans, 1) {
+		return
+	}
+	assert.Equal("automod.ProcessRecordOp", spans[0].Name())
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range spans[0].Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	assert.Equal("app.bsky.feed.post", attrs["automod.collection"].AsString())
+	assert.Equal("create", attrs["automod.operation"].AsString())
+	assert.Equal(int64(1), attrs["automod.rules_evaluated"].AsInt64())
+	assert.Equal([]string{"engine.simpleRule"}, attrs["automod.rules_fired"].AsStringSlice())
+	assert.Equal([]string{"record-label:bad-hashtag"}, attrs["automod.actions"].AsStringSlice())
+}
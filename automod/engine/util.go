@@ -35,3 +35,11 @@ func cidFromCdnUrl(str *string) *string {
 
 	return &strings.Split(parts[5], "@")[0]
 }
+
+// trims the package path from a fully-qualified function name, eg "github.com/bluesky-social/indigo/automod/rules.BadHashtagsPostRule" becomes "rules.BadHashtagsPostRule"
+func shortFuncName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
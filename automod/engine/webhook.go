@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Structured notification about moderation actions, sent as JSON by WebhookNotifier
+type WebhookNotification struct {
+	// "account" or "record"
+	Kind     string          `json:"kind"`
+	DID      string          `json:"did"`
+	Handle   string          `json:"handle"`
+	URI      string          `json:"uri,omitempty"`
+	Rules    []string        `json:"rules,omitempty"`
+	Labels   []string        `json:"labels,omitempty"`
+	Flags    []string        `json:"flags,omitempty"`
+	Reports  []WebhookReport `json:"reports,omitempty"`
+	Takedown bool            `json:"takedown"`
+}
+
+type WebhookReport struct {
+	ReasonType string `json:"reasonType"`
+	Comment    string `json:"comment"`
+}
+
+func newWebhookNotification(kind string, acct AccountMeta, rules, labels, flags []string, reports []ModReport, takedown bool) WebhookNotification {
+	n := WebhookNotification{
+		Kind:     kind,
+		DID:      acct.Identity.DID.String(),
+		Handle:   acct.Identity.Handle.String(),
+		Rules:    rules,
+		Labels:   labels,
+		Flags:    flags,
+		Takedown: takedown,
+	}
+	for _, r := range reports {
+		n.Reports = append(n.Reports, WebhookReport{ReasonType: r.ReasonType, Comment: r.Comment})
+	}
+	return n
+}
+
+// Notifier which POSTs a JSON WebhookNotification to an arbitrary URL.
+//
+// Rules request notifications by service name; like SlackNotifier, this only delivers notifications for its own service name.
+type WebhookNotifier struct {
+	WebhookURL string
+	// service name this notifier delivers for. Defaults to "webhook"
+	Service string
+}
+
+func (n *WebhookNotifier) service() string {
+	if n.Service == "" {
+		return "webhook"
+	}
+	return n.Service
+}
+
+func (n *WebhookNotifier) SendAccount(ctx context.Context, service string, c *AccountContext) error {
+	if service != n.service() {
+		return nil
+	}
+	body := newWebhookNotification("account", c.Account, c.effects.NotifyRules, c.effects.AccountLabels, c.effects.AccountFlags, c.effects.AccountReports, c.effects.AccountTakedown)
+	c.Logger.Debug("sending webhook notification")
+	return postWebhookJSON(ctx, n.WebhookURL, body)
+}
+
+func (n *WebhookNotifier) SendRecord(ctx context.Context, service string, c *RecordContext) error {
+	if service != n.service() {
+		return nil
+	}
+	body := newWebhookNotification("record", c.Account, c.effects.NotifyRules, c.effects.RecordLabels, c.effects.RecordFlags, c.effects.RecordReports, c.effects.RecordTakedown)
+	body.URI = c.RecordOp.ATURI().String()
+	c.Logger.Debug("sending webhook notification")
+	return postWebhookJSON(ctx, n.WebhookURL, body)
+}
+
+// Notifier which sends a message to a Discord channel via webhook.
+//
+// Like WebhookNotifier, this only delivers notifications for its own service name.
+type DiscordNotifier struct {
+	DiscordWebhookURL string
+	// service name this notifier delivers for. Defaults to "discord"
+	Service string
+}
+
+func (n *DiscordNotifier) service() string {
+	if n.Service == "" {
+		return "discord"
+	}
+	return n.Service
+}
+
+type DiscordWebhookBody struct {
+	Content string `json:"content"`
+}
+
+func (n *DiscordNotifier) SendAccount(ctx context.Context, service string, c *AccountContext) error {
+	if service != n.service() {
+		return nil
+	}
+	msg := discordBody("⚠️ Automod Account Action ⚠️\n", c.Account, c.effects.NotifyRules, c.effects.AccountLabels, c.effects.AccountFlags, c.effects.AccountReports, c.effects.AccountTakedown)
+	c.Logger.Debug("sending discord notification")
+	return postWebhookJSON(ctx, n.DiscordWebhookURL, DiscordWebhookBody{Content: msg})
+}
+
+func (n *DiscordNotifier) SendRecord(ctx context.Context, service string, c *RecordContext) error {
+	if service != n.service() {
+		return nil
+	}
+	msg := discordBody("⚠️ Automod Record Action ⚠️\n", c.Account, c.effects.NotifyRules, c.effects.RecordLabels, c.effects.RecordFlags, c.effects.RecordReports, c.effects.RecordTakedown)
+	msg += fmt.Sprintf("`%s`\n", c.RecordOp.ATURI())
+	c.Logger.Debug("sending discord notification")
+	return postWebhookJSON(ctx, n.DiscordWebhookURL, DiscordWebhookBody{Content: msg})
+}
+
+func discordBody(header string, acct AccountMeta, rules, newLabels, newFlags []string, newReports []ModReport, newTakedown bool) string {
+	msg := header
+	msg += fmt.Sprintf("`%s` / `%s` / [bsky](<https://bsky.app/profile/%s>)\n",
+		acct.Identity.DID,
+		acct.Identity.Handle,
+		acct.Identity.DID,
+	)
+	if len(rules) > 0 {
+		msg += fmt.Sprintf("Rules: `%s`\n", strings.Join(rules, ", "))
+	}
+	if len(newLabels) > 0 {
+		msg += fmt.Sprintf("Labels: `%s`\n", strings.Join(newLabels, ", "))
+	}
+	if len(newFlags) > 0 {
+		msg += fmt.Sprintf("Flags: `%s`\n", strings.Join(newFlags, ", "))
+	}
+	for _, rep := range newReports {
+		msg += fmt.Sprintf("Report `%s`: %s\n", rep.ReasonType, rep.Comment)
+	}
+	if newTakedown {
+		msg += "Takedown!\n"
+	}
+	return msg
+}
+
+// POSTs a JSON body to a webhook URL, treating any 2xx response as success
+func postWebhookJSON(ctx context.Context, webhookURL string, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed webhook POST request. status=%d", resp.StatusCode)
+	}
+	return nil
+}
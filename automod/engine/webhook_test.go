@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func notifyLabelRecordRule(c *RecordContext) error {
+	c.AddRecordLabel("spam")
+	c.Notify("slack")
+	return nil
+}
+
+func notifyHelper(c *RecordContext) {
+	c.Notify("slack")
+}
+
+// notifies via a helper function, and via a named sub-rule
+func notifyHelperRecordRule(c *RecordContext) error {
+	notifyHelper(c)
+	return c.RunNamedRule("named-notify", func() error {
+		notifyHelper(c)
+		return nil
+	})
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var got []WebhookNotification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n WebhookNotification
+		assert.NoError(json.NewDecoder(r.Body).Decode(&n))
+		got = append(got, n)
+	}))
+	defer srv.Close()
+
+	eng := EngineTestFixture()
+	// the rule requests a "slack" notification, which a default webhook notifier doesn't deliver
+	eng.Notifier = &WebhookNotifier{WebhookURL: srv.URL}
+	eng.Rules = RuleSet{
+		RecordRules: []RecordRuleFunc{
+			notifyLabelRecordRule,
+		},
+	}
+
+	cid1 := syntax.CID("cid123")
+	p1 := appbsky.FeedPost{Text: "some post blah"}
+	p1buf := new(bytes.Buffer)
+	assert.NoError(p1.MarshalCBOR(p1buf))
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        syntax.DID("did:plc:abc111"),
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		RecordCBOR: p1buf.Bytes(),
+	}
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	assert.Empty(got)
+
+	eng = EngineTestFixture()
+	eng.Notifier = &WebhookNotifier{WebhookURL: srv.URL, Service: "slack"}
+	eng.Rules = RuleSet{
+		RecordRules: []RecordRuleFunc{
+			notifyLabelRecordRule,
+			notifyHelperRecordRule,
+		},
+	}
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+
+	if assert.Len(got, 1) {
+		n := got[0]
+		assert.Equal("record", n.Kind)
+		assert.Equal("did:plc:abc111", n.DID)
+		assert.Equal("at://did:plc:abc111/app.bsky.feed.post/abc123", n.URI)
+		assert.Equal([]string{"spam"}, n.Labels)
+		// notifications are credited to the rules, not the helper function
+		assert.Equal([]string{"engine.notifyLabelRecordRule", "named-notify", "engine.notifyHelperRecordRule"}, n.Rules)
+		assert.False(n.Takedown)
+	}
+}
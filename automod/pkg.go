@@ -14,12 +14,23 @@ type RuleSet = engine.RuleSet
 
 type Notifier = engine.Notifier
 type SlackNotifier = engine.SlackNotifier
+type DiscordNotifier = engine.DiscordNotifier
+type WebhookNotifier = engine.WebhookNotifier
+
+type AuditLogger = engine.AuditLogger
+type AuditSink = engine.AuditSink
+type AuditEntry = engine.AuditEntry
+
+type ActionSink = engine.ActionSink
+type ActionEvent = engine.ActionEvent
 
 type AccountContext = engine.AccountContext
 type RecordContext = engine.RecordContext
 type OzoneEventContext = engine.OzoneEventContext
 type NotificationContext = engine.NotificationContext
 type RecordOp = engine.RecordOp
+type Effects = engine.Effects
+type EffectsDiff = engine.EffectsDiff
 
 type IdentityRuleFunc = engine.IdentityRuleFunc
 type RecordRuleFunc = engine.RecordRuleFunc
@@ -44,4 +55,6 @@ var (
 	CreateOp = engine.CreateOp
 	UpdateOp = engine.UpdateOp
 	DeleteOp = engine.DeleteOp
+
+	DiffEffects = engine.DiffEffects
 )
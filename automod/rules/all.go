@@ -4,6 +4,16 @@ import (
 	"github.com/bluesky-social/indigo/automod"
 )
 
+// Names of the static sets (see setstore) referenced by DefaultRules. Rules still run if a set is missing, but never match against it.
+var DefaultRulesSets = []string{
+	"bad-hashtags",
+	"bad-words",
+	"worst-words",
+	"harassment-target-dids",
+	"promo-domain",
+	"trivial-spam-text",
+}
+
 // IMPORTANT: reminder that these are the indigo-edition rules, not production rules
 func DefaultRules() automod.RuleSet {
 	rules := automod.RuleSet{
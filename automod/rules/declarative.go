@@ -0,0 +1,352 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/helpers"
+)
+
+// A set of simple, declarative rules, usually loaded from a JSON file. See LoadDeclarativeRuleset.
+//
+// Example:
+//
+//	{"rules": [
+//	  {"name": "crypto-spam", "type": "keyword", "values": ["airdrop"], "actions": {"recordFlags": ["crypto-spam"]}},
+//	  {"name": "bad-domain", "type": "domain", "target": "both", "values": ["spam.example.com"], "actions": {"report": {"reasonType": "spam", "comment": "link to known spam domain"}}}
+//	]}
+type DeclarativeRuleset struct {
+	Rules []DeclarativeRule `json:"rules"`
+}
+
+type DeclarativeRule struct {
+	// short unique name, used in logs and report comments
+	Name string `json:"name"`
+	// "keyword" (matches single-word text tokens, case-insensitive), "regex" (matches raw text), or "domain" (matches link hostnames, including subdomains)
+	Type string `json:"type"`
+	// which records to match: "post" (default), "profile", or "both"
+	Target string `json:"target,omitempty"`
+	// keywords, regular expressions, or domains, depending on Type. any one value matching counts as a match
+	Values []string `json:"values,omitempty"`
+	// names of static sets (see setstore) whose members also count as matches. only supported for "keyword" and "domain" rules
+	Sets    []string           `json:"sets,omitempty"`
+	Actions DeclarativeActions `json:"actions"`
+
+	keywords map[string]bool
+	regexes  []*regexp.Regexp
+}
+
+// Actions to take when a declarative rule matches. At least one must be configured.
+type DeclarativeActions struct {
+	RecordLabels   []string           `json:"recordLabels,omitempty"`
+	RecordFlags    []string           `json:"recordFlags,omitempty"`
+	RecordTags     []string           `json:"recordTags,omitempty"`
+	AccountLabels  []string           `json:"accountLabels,omitempty"`
+	AccountFlags   []string           `json:"accountFlags,omitempty"`
+	Report         *DeclarativeReport `json:"report,omitempty"`
+	RecordTakedown bool               `json:"recordTakedown,omitempty"`
+	// notification services (eg, "slack")
+	Notify []string `json:"notify,omitempty"`
+}
+
+type DeclarativeReport struct {
+	// either a full reason type (eg, "com.atproto.moderation.defs#reasonSpam") or the short form (eg, "spam")
+	ReasonType string `json:"reasonType"`
+	Comment    string `json:"comment,omitempty"`
+}
+
+var shortReportReasons = map[string]string{
+	"spam":       automod.ReportReasonSpam,
+	"violation":  automod.ReportReasonViolation,
+	"misleading": automod.ReportReasonMisleading,
+	"sexual":     automod.ReportReasonSexual,
+	"rude":       automod.ReportReasonRude,
+	"other":      automod.ReportReasonOther,
+}
+
+// Reads, parses, and validates a declarative ruleset JSON file. Errors include the line and column (for syntax errors) or the rule index and field (for invalid rules). If multiple rules are invalid, all the errors are returned (joined with errors.Join).
+func LoadDeclarativeRuleset(path string) (*DeclarativeRuleset, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDeclarativeRuleset(raw)
+}
+
+func ParseDeclarativeRuleset(raw []byte) (*DeclarativeRuleset, error) {
+	var drs DeclarativeRuleset
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&drs); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) {
+			line, col := offsetPosition(raw, syntaxErr.Offset)
+			return nil, fmt.Errorf("ruleset syntax error at line %d, column %d: %w", line, col, err)
+		} else if errors.As(err, &typeErr) {
+			line, col := offsetPosition(raw, typeErr.Offset)
+			return nil, fmt.Errorf("ruleset field %q has wrong type at line %d, column %d: %w", typeErr.Field, line, col, err)
+		}
+		return nil, fmt.Errorf("parsing ruleset: %w", err)
+	}
+	if len(drs.Rules) == 0 {
+		return nil, fmt.Errorf("ruleset contains no rules")
+	}
+	var errs []error
+	names := map[string]bool{}
+	for i := range drs.Rules {
+		r := &drs.Rules[i]
+		if err := r.compile(); err != nil {
+			errs = append(errs, fmt.Errorf("rule %d (%q): %w", i, r.Name, err))
+			continue
+		}
+		if names[r.Name] {
+			errs = append(errs, fmt.Errorf("rule %d (%q): field \"name\": duplicate rule name", i, r.Name))
+		}
+		names[r.Name] = true
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &drs, nil
+}
+
+// Returns the (de-duplicated) names of all static sets referenced by rules in the ruleset, in order of first reference
+func (drs *DeclarativeRuleset) SetNames() []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, r := range drs.Rules {
+		for _, name := range r.Sets {
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	return out
+}
+
+// returns 1-indexed line and column for a byte offset
+func offsetPosition(raw []byte, offset int64) (int, int) {
+	if offset > int64(len(raw)) {
+		offset = int64(len(raw))
+	}
+	before := raw[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// validates the rule and pre-computes matchers
+func (r *DeclarativeRule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("field \"name\": required")
+	}
+	switch r.Target {
+	case "":
+		r.Target = "post"
+	case "post", "profile", "both":
+	default:
+		return fmt.Errorf("field \"target\": unknown target %q (expected post, profile, or both)", r.Target)
+	}
+	if len(r.Values) == 0 && len(r.Sets) == 0 {
+		return fmt.Errorf("field \"values\": at least one value (or set) required")
+	}
+	for j, name := range r.Sets {
+		if name == "" {
+			return fmt.Errorf("field \"sets\" (index %d): empty set name", j)
+		}
+	}
+	switch r.Type {
+	case "keyword":
+		r.keywords = map[string]bool{}
+		for _, v := range r.Values {
+			r.keywords[strings.ToLower(strings.TrimSpace(v))] = true
+		}
+	case "regex":
+		if len(r.Sets) > 0 {
+			return fmt.Errorf("field \"sets\": not supported for regex rules")
+		}
+		for j, v := range r.Values {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return fmt.Errorf("field \"values\" (index %d): invalid regex: %w", j, err)
+			}
+			r.regexes = append(r.regexes, re)
+		}
+	case "domain":
+		r.keywords = map[string]bool{}
+		for _, v := range r.Values {
+			r.keywords[strings.ToLower(strings.TrimPrefix(strings.TrimSpace(v), "."))] = true
+		}
+	default:
+		return fmt.Errorf("field \"type\": unknown type %q (expected keyword, regex, or domain)", r.Type)
+	}
+
+	a := &r.Actions
+	if len(a.RecordLabels)+len(a.RecordFlags)+len(a.RecordTags)+len(a.AccountLabels)+len(a.AccountFlags)+len(a.Notify) == 0 && a.Report == nil && !a.RecordTakedown {
+		return fmt.Errorf("field \"actions\": at least one action required")
+	}
+	if a.Report != nil {
+		if full, ok := shortReportReasons[a.Report.ReasonType]; ok {
+			a.Report.ReasonType = full
+		} else if !strings.HasPrefix(a.Report.ReasonType, "com.atproto.moderation.defs#reason") {
+			return fmt.Errorf("field \"actions.report.reasonType\": unknown reason type %q", a.Report.ReasonType)
+		}
+	}
+	return nil
+}
+
+// returns true if the value is a member of any of the rule's sets
+func (r *DeclarativeRule) inSets(c *automod.RecordContext, val string) bool {
+	for _, name := range r.Sets {
+		if c.InSet(name, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the first matching value, or empty string if no match
+func (r *DeclarativeRule) match(c *automod.RecordContext, text string, tokens, urls []string) string {
+	switch r.Type {
+	case "keyword":
+		for _, tok := range tokens {
+			if r.keywords[tok] || r.inSets(c, tok) {
+				return tok
+			}
+		}
+	case "regex":
+		for _, re := range r.regexes {
+			if m := re.FindString(text); m != "" {
+				return m
+			}
+		}
+	case "domain":
+		for _, raw := range urls {
+			// URLs extracted from text may not include a scheme
+			if !strings.Contains(raw, "://") {
+				raw = "https://" + raw
+			}
+			u, err := url.Parse(raw)
+			if err != nil {
+				continue
+			}
+			host := strings.ToLower(u.Hostname())
+			for host != "" {
+				if r.keywords[host] || r.inSets(c, host) {
+					return host
+				}
+				i := strings.Index(host, ".")
+				if i < 0 {
+					break
+				}
+				host = host[i+1:]
+			}
+		}
+	}
+	return ""
+}
+
+// name of the rule in metrics and audit logs
+func (r *DeclarativeRule) ruleName() string {
+	return "declarative." + r.Name
+}
+
+func (r *DeclarativeRule) apply(c *automod.RecordContext, matched string) {
+	a := r.Actions
+	for _, v := range a.RecordLabels {
+		c.AddRecordLabel(v)
+	}
+	for _, v := range a.RecordFlags {
+		c.AddRecordFlag(v)
+	}
+	for _, v := range a.RecordTags {
+		c.AddRecordTag(v)
+	}
+	for _, v := range a.AccountLabels {
+		c.AddAccountLabel(v)
+	}
+	for _, v := range a.AccountFlags {
+		c.AddAccountFlag(v)
+	}
+	if a.Report != nil {
+		comment := a.Report.Comment
+		if comment == "" {
+			comment = fmt.Sprintf("matched rule %s: %s", r.Name, matched)
+		}
+		c.ReportRecord(a.Report.ReasonType, comment)
+	}
+	if a.RecordTakedown {
+		c.TakedownRecord()
+	}
+	for _, srv := range a.Notify {
+		c.Notify(srv)
+	}
+}
+
+func (drs *DeclarativeRuleset) PostRule(c *automod.RecordContext, post *appbsky.FeedPost) error {
+	tokens := helpers.ExtractTextTokensPost(post)
+	urls := helpers.ExtractTextURLs(post.Text)
+	if facets, err := helpers.ExtractFacets(post); err == nil {
+		for _, f := range facets {
+			if f.URL != nil {
+				urls = append(urls, *f.URL)
+			}
+		}
+	}
+	for i := range drs.Rules {
+		r := &drs.Rules[i]
+		if r.Target == "profile" {
+			continue
+		}
+		// each declarative rule is evaluated under its own name, for metrics and audit logs
+		c.RunNamedRule(r.ruleName(), func() error {
+			if m := r.match(c, post.Text, tokens, urls); m != "" {
+				c.Logger.Debug("declarative rule matched", "rule", r.Name, "match", m)
+				r.apply(c, m)
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+var _ automod.PostRuleFunc = (&DeclarativeRuleset{}).PostRule
+
+func (drs *DeclarativeRuleset) ProfileRule(c *automod.RecordContext, profile *appbsky.ActorProfile) error {
+	text := ""
+	if profile.DisplayName != nil {
+		text += *profile.DisplayName
+	}
+	if profile.Description != nil {
+		text += "\n" + *profile.Description
+	}
+	tokens := helpers.ExtractTextTokensProfile(profile)
+	urls := helpers.ExtractTextURLsProfile(profile)
+	for i := range drs.Rules {
+		r := &drs.Rules[i]
+		if r.Target == "post" {
+			continue
+		}
+		// each declarative rule is evaluated under its own name, for metrics and audit logs
+		c.RunNamedRule(r.ruleName(), func() error {
+			if m := r.match(c, text, tokens, urls); m != "" {
+				c.Logger.Debug("declarative rule matched", "rule", r.Name, "match", m)
+				r.apply(c, m)
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+var _ automod.ProfileRuleFunc = (&DeclarativeRuleset{}).ProfileRule
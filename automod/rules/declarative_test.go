@@ -0,0 +1,164 @@
+package rules
+
+import (
+	"context"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/engine"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testDeclarativeRuleset = `{"rules": [
+  {"name": "crypto-spam", "type": "keyword", "values": ["Airdrop"], "actions": {"recordFlags": ["crypto-spam"]}},
+  {"name": "phone-number", "type": "regex", "target": "both", "values": ["\\d{3}-\\d{4}"], "actions": {"recordTags": ["phone"]}},
+  {"name": "bad-domain", "type": "domain", "values": ["spam.example.com"], "actions": {"report": {"reasonType": "spam"}}}
+]}`
+
+func TestDeclarativeRuleset(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	drs, err := ParseDeclarativeRuleset([]byte(testDeclarativeRuleset))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eng := engine.EngineTestFixture()
+	am1 := automod.AccountMeta{
+		Identity: &identity.Identity{
+			DID:    syntax.DID("did:plc:abc111"),
+			Handle: syntax.Handle("handle.example.com"),
+		},
+	}
+	cid1 := syntax.CID("cid123")
+	op := engine.RecordOp{
+		Action:     engine.CreateOp,
+		DID:        am1.Identity.DID,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+	}
+
+	p1 := appbsky.FeedPost{Text: "free AIRDROP, call 555-1234 or see www.spam.example.com/claim"}
+	c1 := engine.NewRecordContext(ctx, &eng, am1, op)
+	assert.NoError(drs.PostRule(&c1, &p1))
+	eff1 := engine.ExtractEffects(&c1.BaseContext)
+	assert.Equal([]string{"crypto-spam"}, eff1.RecordFlags)
+	assert.Equal([]string{"phone"}, eff1.RecordTags)
+	if assert.Len(eff1.RecordReports, 1) {
+		assert.Equal(automod.ReportReasonSpam, eff1.RecordReports[0].ReasonType)
+	}
+	// each matching declarative rule is attributed under its own name
+	var fired []string
+	for _, rf := range eff1.RuleFirings {
+		fired = append(fired, rf.Rule)
+	}
+	assert.Equal([]string{"declarative.crypto-spam", "declarative.phone-number", "declarative.bad-domain"}, fired)
+
+	p2 := appbsky.FeedPost{Text: "nothing to see here, example.com is fine"}
+	c2 := engine.NewRecordContext(ctx, &eng, am1, op)
+	assert.NoError(drs.PostRule(&c2, &p2))
+	eff2 := engine.ExtractEffects(&c2.BaseContext)
+	assert.Empty(eff2.RecordFlags)
+	assert.Empty(eff2.RecordTags)
+	assert.Empty(eff2.RecordReports)
+
+	// only the "both" rule applies to profiles
+	desc := "airdrop! call 555-1234"
+	profile := appbsky.ActorProfile{Description: &desc}
+	c3 := engine.NewRecordContext(ctx, &eng, am1, op)
+	assert.NoError(drs.ProfileRule(&c3, &profile))
+	eff3 := engine.ExtractEffects(&c3.BaseContext)
+	assert.Empty(eff3.RecordFlags)
+	assert.Equal([]string{"phone"}, eff3.RecordTags)
+}
+
+func TestDeclarativeRulesetErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		raw    string
+		errMsg string
+	}{
+		{raw: "{\"rules\": [\n  {\"name\": \"x\",}\n]}", errMsg: "line 2"},
+		{raw: `{"rules": [{"name": "x", "type": "keyword", "values": "airdrop"}]}`, errMsg: "values"},
+		{raw: `{"rules": [{"name": "x", "type": "keyword", "values": ["a"], "actions": {"recordFlags": ["f"]}, "extra": 1}]}`, errMsg: "extra"},
+		{raw: `{"rules": []}`, errMsg: "no rules"},
+		{raw: `{"rules": [{"name": "x", "type": "glob", "values": ["a"], "actions": {"recordFlags": ["f"]}}]}`, errMsg: "rule 0 (\"x\"): field \"type\""},
+		{raw: `{"rules": [{"name": "x", "type": "regex", "values": ["("], "actions": {"recordFlags": ["f"]}}]}`, errMsg: "invalid regex"},
+		{raw: `{"rules": [{"name": "x", "type": "keyword", "values": ["a"], "actions": {}}]}`, errMsg: "field \"actions\""},
+		{raw: `{"rules": [{"name": "x", "type": "keyword", "values": ["a"], "actions": {"report": {"reasonType": "mean"}}}]}`, errMsg: "reasonType"},
+		{raw: `{"rules": [{"name": "x", "type": "keyword", "values": ["a"], "actions": {"recordFlags": ["f"]}}, {"name": "x", "type": "keyword", "values": ["b"], "actions": {"recordFlags": ["f"]}}]}`, errMsg: "duplicate"},
+	}
+	for _, f := range fixtures {
+		_, err := ParseDeclarativeRuleset([]byte(f.raw))
+		if assert.Error(err, f.raw) {
+			assert.Contains(err.Error(), f.errMsg)
+		}
+	}
+}
+
+func TestDeclarativeRulesetSets(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	drs, err := ParseDeclarativeRuleset([]byte(`{"rules": [
+  {"name": "bad-word-set", "type": "keyword", "sets": ["bad-words", "worst-words"], "actions": {"recordFlags": ["bad-word"]}},
+  {"name": "bad-word-set-2", "type": "keyword", "values": ["extra"], "sets": ["bad-words"], "actions": {"recordTags": ["bad-word"]}}
+]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal([]string{"bad-words", "worst-words"}, drs.SetNames())
+
+	eng := engine.EngineTestFixture()
+	am1 := automod.AccountMeta{
+		Identity: &identity.Identity{
+			DID:    syntax.DID("did:plc:abc111"),
+			Handle: syntax.Handle("handle.example.com"),
+		},
+	}
+	op := engine.RecordOp{
+		Action:     engine.CreateOp,
+		DID:        am1.Identity.DID,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+	}
+
+	p1 := appbsky.FeedPost{Text: "some hardr text"}
+	c1 := engine.NewRecordContext(ctx, &eng, am1, op)
+	assert.NoError(drs.PostRule(&c1, &p1))
+	eff1 := engine.ExtractEffects(&c1.BaseContext)
+	assert.Equal([]string{"bad-word"}, eff1.RecordFlags)
+	assert.Equal([]string{"bad-word"}, eff1.RecordTags)
+
+	p2 := appbsky.FeedPost{Text: "some extra text"}
+	c2 := engine.NewRecordContext(ctx, &eng, am1, op)
+	assert.NoError(drs.PostRule(&c2, &p2))
+	eff2 := engine.ExtractEffects(&c2.BaseContext)
+	assert.Empty(eff2.RecordFlags)
+	assert.Equal([]string{"bad-word"}, eff2.RecordTags)
+}
+
+func TestDeclarativeRulesetMultipleErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ParseDeclarativeRuleset([]byte(`{"rules": [
+  {"name": "a", "type": "regex", "values": ["("], "actions": {"recordFlags": ["f"]}},
+  {"name": "b", "type": "keyword", "values": ["ok"], "actions": {"recordFlags": ["f"]}},
+  {"name": "c", "type": "regex", "sets": ["bad-words"], "actions": {"recordFlags": ["f"]}}
+]}`))
+	if assert.Error(err) {
+		joined, ok := err.(interface{ Unwrap() []error })
+		if assert.True(ok) {
+			assert.Len(joined.Unwrap(), 2)
+		}
+		assert.Contains(err.Error(), "rule 0 (\"a\")")
+		assert.Contains(err.Error(), "rule 2 (\"c\"): field \"sets\"")
+	}
+}
@@ -59,3 +59,12 @@ func (s *MemSetStore) LoadFromFileJSON(p string) error {
 	}
 	return nil
 }
+
+// Returns the number of values in each set
+func (s MemSetStore) Sizes() map[string]int {
+	out := make(map[string]int, len(s.Sets))
+	for name, set := range s.Sets {
+		out[name] = len(set)
+	}
+	return out
+}
@@ -0,0 +1,33 @@
+package setstore
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// SetStore wrapper which allows the entire underlying set of sets to be atomically replaced, eg when reloading from a file.
+//
+// Readers never see a partially-loaded state: they see either the old sets or the new sets.
+type ReloadableSetStore struct {
+	current atomic.Pointer[MemSetStore]
+}
+
+func NewReloadableSetStore(initial MemSetStore) *ReloadableSetStore {
+	r := ReloadableSetStore{}
+	r.current.Store(&initial)
+	return &r
+}
+
+func (r *ReloadableSetStore) InSet(ctx context.Context, name, val string) (bool, error) {
+	return r.current.Load().InSet(ctx, name, val)
+}
+
+// Replaces all sets with the provided store. The provided store must not be mutated after this call.
+func (r *ReloadableSetStore) Swap(next MemSetStore) {
+	r.current.Store(&next)
+}
+
+// Returns the number of values in each set
+func (r *ReloadableSetStore) Sizes() map[string]int {
+	return r.current.Load().Sizes()
+}
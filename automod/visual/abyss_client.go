@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bluesky-social/indigo/automod/cachestore"
 	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/bluesky-social/indigo/util"
 
@@ -21,6 +22,17 @@ type AbyssClient struct {
 	Host            string
 	Password        string
 	RatelimitBypass string
+	// optional cache of scan results, keyed by blob CID. if nil, every blob is scanned
+	Cache cachestore.CacheStore
+
+	breaker *circuitBreaker
+}
+
+// Included in scan result cache keys. Bump this when the abyss scan API or response semantics change, to invalidate previously cached results.
+const abyssScanAPIVersion = "v1"
+
+func abyssCacheKey(blobCID string) string {
+	return abyssScanAPIVersion + "/" + blobCID
 }
 
 func NewAbyssClient(host, password, ratelimitBypass string) AbyssClient {
@@ -29,10 +41,63 @@ func NewAbyssClient(host, password, ratelimitBypass string) AbyssClient {
 		Host:            host,
 		Password:        password,
 		RatelimitBypass: password,
+		breaker:         newCircuitBreaker("abyss"),
 	}
 }
 
+// Sends the blob to abyss for scanning. If the abyss circuit breaker is open, returns ErrBackendUnavailable without making a request.
 func (ac *AbyssClient) ScanBlob(ctx context.Context, blob lexutil.LexBlob, blobBytes []byte, params map[string]string) (*AbyssScanResp, error) {
+	cid := blob.Ref.String()
+	if ac.Cache != nil {
+		if cached := ac.cachedScan(ctx, cid); cached != nil {
+			return cached, nil
+		}
+	}
+	if !ac.breaker.allow() {
+		return nil, ErrBackendUnavailable
+	}
+	resp, err := ac.scanBlob(ctx, blob, blobBytes, params)
+	ac.breaker.record(ctx, err)
+	if err != nil {
+		return nil, err
+	}
+	// only successful scans are cached, so failures get retried next time the blob is seen
+	if ac.Cache != nil && resp.Match != nil && resp.Match.Status == "success" {
+		b, err := json.Marshal(resp)
+		if err != nil {
+			return nil, err
+		}
+		if err := ac.Cache.Set(ctx, "abyss-scan", abyssCacheKey(cid), string(b)); err != nil {
+			slog.Warn("failed to cache abyss scan result", "cid", cid, "err", err)
+		}
+	}
+	return resp, nil
+}
+
+// returns nil on cache miss (or any cache error)
+func (ac *AbyssClient) cachedScan(ctx context.Context, cid string) *AbyssScanResp {
+	val, err := ac.Cache.Get(ctx, "abyss-scan", abyssCacheKey(cid))
+	if err != nil {
+		slog.Warn("failed to read abyss scan cache", "cid", cid, "err", err)
+		abyssCacheCount.WithLabelValues("error").Inc()
+		return nil
+	}
+	if val == "" {
+		abyssCacheCount.WithLabelValues("miss").Inc()
+		return nil
+	}
+	var resp AbyssScanResp
+	if err := json.Unmarshal([]byte(val), &resp); err != nil {
+		slog.Warn("failed to parse cached abyss scan result", "cid", cid, "err", err)
+		abyssCacheCount.WithLabelValues("error").Inc()
+		return nil
+	}
+	abyssCacheCount.WithLabelValues("hit").Inc()
+	slog.Debug("abyss scan cache hit", "cid", cid)
+	return &resp
+}
+
+func (ac *AbyssClient) scanBlob(ctx context.Context, blob lexutil.LexBlob, blobBytes []byte, params map[string]string) (*AbyssScanResp, error) {
 
 	slog.Debug("sending blob to abyss", "cid", blob.Ref.String(), "mimetype", blob.MimeType, "size", len(blobBytes))
 
@@ -1,6 +1,7 @@
 package visual
 
 import (
+	"errors"
 	"strings"
 
 	"github.com/bluesky-social/indigo/automod"
@@ -24,7 +25,10 @@ func (ac *AbyssClient) AbyssScanBlobRule(c *automod.RecordContext, blob lexutil.
 	params["uri"] = c.RecordOp.ATURI().String()
 
 	resp, err := ac.ScanBlob(c.Ctx, blob, data, params)
-	if err != nil {
+	if errors.Is(err, ErrBackendUnavailable) {
+		c.Logger.Debug("skipping abyss scan", "err", err)
+		return nil
+	} else if err != nil {
 		return err
 	}
 
@@ -0,0 +1,53 @@
+package visual
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/automod/cachestore"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAbyssScanCache(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"match": {"status": "success", "hits": [{"label": "csam"}]}}`))
+	}))
+	defer srv.Close()
+
+	ac := NewAbyssClient(srv.URL, "password", "")
+	ac.Cache = cachestore.NewMemCacheStore(10, time.Hour)
+
+	c, err := cid.Decode("bafkreiccldh766hwcnuxnf2wh6jgzepf2nlu2lvcllt63eww5p6chi4ity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := lexutil.LexBlob{Ref: lexutil.LexLink(c), MimeType: "image/jpeg", Size: 4}
+
+	for i := 0; i < 3; i++ {
+		resp, err := ac.ScanBlob(ctx, blob, []byte("data"), map[string]string{})
+		assert.NoError(err)
+		assert.NotNil(resp.Match)
+		assert.True(resp.Match.IsAbuseMatch())
+	}
+	assert.Equal(1, requests)
+
+	// results cached under an older API version are not used
+	ac.Cache.Purge(ctx, "abyss-scan", abyssCacheKey(c.String()))
+	ac.Cache.Set(ctx, "abyss-scan", "v0/"+c.String(), `{"match": {"status": "success", "hits": []}}`)
+	resp, err := ac.ScanBlob(ctx, blob, []byte("data"), map[string]string{})
+	assert.NoError(err)
+	assert.True(resp.Match.IsAbuseMatch())
+	assert.Equal(2, requests)
+}
@@ -0,0 +1,101 @@
+package visual
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Returned by image backend clients when the circuit breaker is open and the call was skipped. Rules treat this as a neutral result (no labels or matches).
+var ErrBackendUnavailable = errors.New("image backend temporarily unavailable (circuit breaker open)")
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = time.Minute
+)
+
+// Simple consecutive-failure circuit breaker for remote image backends (Hive, abyss).
+//
+// After Threshold consecutive failures, the breaker opens and all calls are short-circuited for Cooldown. After the cooldown, the breaker is half-open: exactly one trial call is let through, and others are still skipped until its result is recorded. If the trial call succeeds the breaker closes, and if it fails the breaker re-opens for another cooldown period.
+//
+// A nil *circuitBreaker is always closed.
+type circuitBreaker struct {
+	Backend   string
+	Threshold int
+	Cooldown  time.Duration
+
+	lk        sync.Mutex
+	failures  int
+	openUntil time.Time
+	// set while the half-open trial call is in flight
+	probing bool
+}
+
+func newCircuitBreaker(backend string) *circuitBreaker {
+	breakerOpen.WithLabelValues(backend).Set(0)
+	return &circuitBreaker{
+		Backend:   backend,
+		Threshold: defaultBreakerThreshold,
+		Cooldown:  defaultBreakerCooldown,
+	}
+}
+
+// returns false if the breaker is open, and calls should be skipped
+func (cb *circuitBreaker) allow() bool {
+	if cb == nil {
+		return true
+	}
+	cb.lk.Lock()
+	defer cb.lk.Unlock()
+	if cb.openUntil.IsZero() {
+		return true
+	}
+	if !cb.probing && time.Now().After(cb.openUntil) {
+		cb.probing = true
+		return true
+	}
+	breakerSkipped.WithLabelValues(cb.Backend).Inc()
+	return false
+}
+
+// records the result of a call to the backend. errors caused by the caller's context being cancelled are not counted as failures
+func (cb *circuitBreaker) record(ctx context.Context, err error) {
+	if cb == nil {
+		return
+	}
+	cb.lk.Lock()
+	defer cb.lk.Unlock()
+	// any result ends the trial call (if this was it). a cancelled trial call doesn't count either way, so the next call is let through instead
+	cb.probing = false
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	if err == nil {
+		if !cb.openUntil.IsZero() {
+			slog.Info("image backend circuit breaker closed", "backend", cb.Backend)
+			breakerOpen.WithLabelValues(cb.Backend).Set(0)
+		}
+		cb.failures = 0
+		cb.openUntil = time.Time{}
+		return
+	}
+
+	cb.failures++
+	threshold := cb.Threshold
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	// re-open immediately if the trial call after a cooldown fails
+	if cb.failures >= threshold || !cb.openUntil.IsZero() {
+		if cb.openUntil.IsZero() {
+			slog.Warn("image backend circuit breaker opened", "backend", cb.Backend, "failures", cb.failures, "cooldown", cb.Cooldown, "err", err)
+			breakerOpen.WithLabelValues(cb.Backend).Set(1)
+			breakerTrips.WithLabelValues(cb.Backend).Inc()
+		}
+		cb.openUntil = time.Now().Add(cb.Cooldown)
+		cb.failures = 0
+	}
+}
@@ -0,0 +1,100 @@
+package visual
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	failure := fmt.Errorf("backend down")
+
+	cb := newCircuitBreaker("test")
+	cb.Threshold = 3
+	cb.Cooldown = 50 * time.Millisecond
+
+	// successes reset the failure count
+	cb.record(ctx, failure)
+	cb.record(ctx, failure)
+	cb.record(ctx, nil)
+	cb.record(ctx, failure)
+	assert.True(cb.allow())
+
+	// trips after consecutive failures
+	cb.record(ctx, failure)
+	cb.record(ctx, failure)
+	assert.False(cb.allow())
+
+	// only one trial call after cooldown; failure re-opens immediately
+	time.Sleep(60 * time.Millisecond)
+	assert.True(cb.allow())
+	assert.False(cb.allow())
+	assert.False(cb.allow())
+	cb.record(ctx, failure)
+	assert.False(cb.allow())
+
+	// a cancelled trial call doesn't count, and lets the next call through
+	time.Sleep(60 * time.Millisecond)
+	assert.True(cb.allow())
+	assert.False(cb.allow())
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	cb.record(cctx, context.Canceled)
+	assert.True(cb.allow())
+	cb.record(ctx, failure)
+	assert.False(cb.allow())
+
+	// trial call success closes the breaker
+	time.Sleep(60 * time.Millisecond)
+	assert.True(cb.allow())
+	cb.record(ctx, nil)
+	assert.True(cb.allow())
+
+	// cancelled requests are not counted
+	for i := 0; i < 5; i++ {
+		cb.record(cctx, context.Canceled)
+	}
+	assert.True(cb.allow())
+
+	// nil breaker is always closed
+	var nilBreaker *circuitBreaker
+	assert.True(nilBreaker.allow())
+	nilBreaker.record(ctx, failure)
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	cb := newCircuitBreaker("test")
+	cb.Threshold = 1
+	cb.Cooldown = 10 * time.Millisecond
+	cb.record(ctx, fmt.Errorf("backend down"))
+	time.Sleep(20 * time.Millisecond)
+
+	// concurrent calls after the cooldown: only one gets through
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cb.allow() {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(int64(1), allowed.Load())
+
+	cb.record(ctx, nil)
+	assert.True(cb.allow())
+	assert.True(cb.allow())
+}
@@ -22,6 +22,8 @@ type HiveAIClient struct {
 	ApiToken string
 
 	PreScreenClient *PreScreenClient
+
+	breaker *circuitBreaker
 }
 
 // schema: https://docs.thehive.ai/reference/classification
@@ -51,6 +53,7 @@ func NewHiveAIClient(token string) HiveAIClient {
 	return HiveAIClient{
 		Client:   *util.RobustHTTPClient(),
 		ApiToken: token,
+		breaker:  newCircuitBreaker("hive"),
 	}
 }
 
@@ -170,7 +173,17 @@ func (resp *HiveAIResp) SummarizeLabels() []string {
 	return labels
 }
 
+// Sends the blob to Hive for classification, and returns any labels. If the Hive circuit breaker is open, returns ErrBackendUnavailable without making a request.
 func (hal *HiveAIClient) LabelBlob(ctx context.Context, blob lexutil.LexBlob, blobBytes []byte) ([]string, error) {
+	if !hal.breaker.allow() {
+		return nil, ErrBackendUnavailable
+	}
+	labels, err := hal.labelBlob(ctx, blob, blobBytes)
+	hal.breaker.record(ctx, err)
+	return labels, err
+}
+
+func (hal *HiveAIClient) labelBlob(ctx context.Context, blob lexutil.LexBlob, blobBytes []byte) ([]string, error) {
 
 	slog.Debug("sending blob to Hive AI", "cid", blob.Ref.String(), "mimetype", blob.MimeType, "size", len(blobBytes))
 
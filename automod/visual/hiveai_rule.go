@@ -1,6 +1,7 @@
 package visual
 
 import (
+	"errors"
 	"strings"
 	"time"
 
@@ -27,7 +28,10 @@ func (hal *HiveAIClient) HiveLabelBlobRule(c *automod.RecordContext, blob lexuti
 	}
 
 	labels, err := hal.LabelBlob(c.Ctx, blob, data)
-	if err != nil {
+	if errors.Is(err, ErrBackendUnavailable) {
+		c.Logger.Debug("skipping hive labeling", "err", err)
+		return nil
+	} else if err != nil {
 		return err
 	}
 
@@ -24,3 +24,23 @@ var abyssAPICount = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name: "automod_abyss_api_count",
 	Help: "Number of abyss image scanning API calls, by HTTP status code",
 }, []string{"status"})
+
+var breakerOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "automod_image_backend_breaker_open",
+	Help: "Whether the circuit breaker for an image backend is open (1) or closed (0)",
+}, []string{"backend"})
+
+var breakerTrips = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_image_backend_breaker_trips",
+	Help: "Number of times the circuit breaker for an image backend has opened",
+}, []string{"backend"})
+
+var breakerSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_image_backend_breaker_skipped",
+	Help: "Number of image backend calls skipped because the circuit breaker was open",
+}, []string{"backend"})
+
+var abyssCacheCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_abyss_cache_count",
+	Help: "Number of abyss scan result cache lookups, by result (hit, miss, error)",
+}, []string{"result"})
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/capture"
+)
+
+// JSON response body for the /admin/reprocess endpoint
+type ReprocessResponse struct {
+	URI             string         `json:"uri"`
+	AccountLabels   []string       `json:"accountLabels,omitempty"`
+	AccountFlags    []string       `json:"accountFlags,omitempty"`
+	AccountTags     []string       `json:"accountTags,omitempty"`
+	AccountReports  []ReportAction `json:"accountReports,omitempty"`
+	AccountTakedown bool           `json:"accountTakedown"`
+	RecordLabels    []string       `json:"recordLabels,omitempty"`
+	RecordFlags     []string       `json:"recordFlags,omitempty"`
+	RecordTags      []string       `json:"recordTags,omitempty"`
+	RecordReports   []ReportAction `json:"recordReports,omitempty"`
+	RecordTakedown  bool           `json:"recordTakedown"`
+	BlobTakedowns   []string       `json:"blobTakedowns,omitempty"`
+	NotifyServices  []string       `json:"notifyServices,omitempty"`
+	DryRun          bool           `json:"dryRun"`
+}
+
+type ReportAction struct {
+	ReasonType string `json:"reasonType"`
+	Comment    string `json:"comment"`
+}
+
+type adminError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Wraps an admin HTTP handler with authentication. Uses the same "admin" HTTP Basic auth scheme as atproto admin endpoints (username "admin", password is the admin token).
+func (s *Server) adminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || subtle.ConstantTimeCompare([]byte(pass), []byte(s.adminToken)) != 1 {
+			writeAdminJSON(w, http.StatusUnauthorized, adminError{Error: "AuthRequired", Message: "admin auth required"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Fetches a single record (by AT-URI, from the "uri" query parameter) and processes it through the live engine, returning the resulting actions as JSON. Actions are persisted the same as for firehose events (unless in dry-run mode).
+func (s *Server) handleReprocess(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAdminJSON(w, http.StatusMethodNotAllowed, adminError{Error: "MethodNotAllowed", Message: "use POST"})
+		return
+	}
+	aturi, err := syntax.ParseATURI(r.URL.Query().Get("uri"))
+	if err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, adminError{Error: "InvalidRequest", Message: "invalid 'uri' parameter: " + err.Error()})
+		return
+	}
+	if aturi.RecordKey() == "" {
+		writeAdminJSON(w, http.StatusBadRequest, adminError{Error: "InvalidRequest", Message: "need a full, not partial, AT-URI"})
+		return
+	}
+
+	s.logger.Info("admin reprocess request", "uri", aturi.String())
+	eff, err := capture.FetchAndProcessRecordEffects(r.Context(), s.Engine, aturi)
+	if err != nil {
+		s.logger.Warn("admin reprocess failed", "uri", aturi.String(), "err", err)
+		writeAdminJSON(w, http.StatusBadGateway, adminError{Error: "ProcessingFailed", Message: err.Error()})
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, newReprocessResponse(aturi, eff, s.Engine.Config.DryRun))
+}
+
+func newReprocessResponse(aturi syntax.ATURI, eff *automod.Effects, dryRun bool) ReprocessResponse {
+	resp := ReprocessResponse{
+		URI:    aturi.String(),
+		DryRun: dryRun,
+	}
+	if eff == nil {
+		return resp
+	}
+	resp.AccountLabels = eff.AccountLabels
+	resp.AccountFlags = eff.AccountFlags
+	resp.AccountTags = eff.AccountTags
+	resp.AccountTakedown = eff.AccountTakedown
+	resp.RecordLabels = eff.RecordLabels
+	resp.RecordFlags = eff.RecordFlags
+	resp.RecordTags = eff.RecordTags
+	resp.RecordTakedown = eff.RecordTakedown
+	resp.BlobTakedowns = eff.BlobTakedowns
+	resp.NotifyServices = eff.NotifyServices
+	for _, rep := range eff.AccountReports {
+		resp.AccountReports = append(resp.AccountReports, ReportAction{ReasonType: rep.ReasonType, Comment: rep.Comment})
+	}
+	for _, rep := range eff.RecordReports {
+		resp.RecordReports = append(resp.RecordReports, ReportAction{ReasonType: rep.ReasonType, Comment: rep.Comment})
+	}
+	return resp
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminReprocess(t *testing.T) {
+	assert := assert.New(t)
+
+	// mock PDS, serving a single post record
+	aturi := "at://did:plc:abc111/app.bsky.feed.post/3kabc"
+	pds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/xrpc/com.atproto.repo.getRecord" || q.Get("repo") != "did:plc:abc111" || q.Get("rkey") != "3kabc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"uri":"` + aturi + `","cid":"bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm","value":{"$type":"app.bsky.feed.post","text":"some post blah","createdAt":"2024-01-01T00:00:00Z"}}`))
+	}))
+	defer pds.Close()
+
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{
+		DID:    syntax.DID("did:plc:abc111"),
+		Handle: syntax.Handle("handle.example.com"),
+		Services: map[string]identity.Service{
+			"atproto_pds": {Type: "AtprotoPersonalDataServer", URL: pds.URL},
+		},
+	})
+	srv, err := NewServerWithClients(&dir, Config{
+		RelayHost:   "wss://relay.example.com",
+		RulesetName: "default",
+		AdminToken:  "secret",
+		DryRun:      true,
+	}, ServerClients{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Engine.Config.SkipAccountMeta = true
+	srv.Engine.Rules = automod.RuleSet{
+		PostRules: []automod.PostRuleFunc{
+			func(c *automod.RecordContext, post *appbsky.FeedPost) error {
+				c.AddRecordLabel("spam")
+				return nil
+			},
+		},
+	}
+	handler := srv.adminAuth(srv.handleReprocess)
+
+	reprocess := func(method, user, pass, uri string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/reprocess?uri="+url.QueryEscape(uri), nil)
+		if user != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	// auth is required, and checked before anything else
+	assert.Equal(http.StatusUnauthorized, reprocess(http.MethodPost, "", "", aturi).Code)
+	assert.Equal(http.StatusUnauthorized, reprocess(http.MethodPost, "admin", "wrong", aturi).Code)
+	assert.Equal(http.StatusUnauthorized, reprocess(http.MethodPost, "other", "secret", aturi).Code)
+	assert.Equal(http.StatusUnauthorized, reprocess(http.MethodGet, "admin", "", "not-a-uri").Code)
+
+	// request validation
+	assert.Equal(http.StatusMethodNotAllowed, reprocess(http.MethodGet, "admin", "secret", aturi).Code)
+	assert.Equal(http.StatusBadRequest, reprocess(http.MethodPost, "admin", "secret", "not-a-uri").Code)
+	assert.Equal(http.StatusBadRequest, reprocess(http.MethodPost, "admin", "secret", "at://did:plc:abc111/app.bsky.feed.post").Code)
+
+	// record which can't be fetched
+	assert.Equal(http.StatusBadGateway, reprocess(http.MethodPost, "admin", "secret", "at://did:plc:abc111/app.bsky.feed.post/3kzzz").Code)
+
+	rec := reprocess(http.MethodPost, "admin", "secret", aturi)
+	assert.Equal(http.StatusOK, rec.Code)
+	var resp ReprocessResponse
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(aturi, resp.URI)
+	assert.Equal([]string{"spam"}, resp.RecordLabels)
+	assert.False(resp.RecordTakedown)
+	assert.True(resp.DryRun)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/automod/consumer"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/urfave/cli/v2"
+)
+
+var cursorStatusCmd = &cli.Command{
+	Name:  "cursor-status",
+	Usage: "print the persisted firehose (or jetstream) cursor, and how far behind it is",
+	Description: `Reads the cursor persisted in Redis (--redis-url) for the configured --firehose-source and upstream host, and prints the cursor, the timestamp of the corresponding event, and the lag versus the current time. Read-only; safe to run against a live deployment.
+
+The event timestamp for relay cursors is only available once a consumer of this version has persisted the cursor.`,
+	Action: func(cctx *cli.Context) error {
+		if cctx.String("redis-url") == "" {
+			return fmt.Errorf("cursors are only persisted in Redis; --redis-url is required")
+		}
+		opt, err := redis.ParseURL(cctx.String("redis-url"))
+		if err != nil {
+			return fmt.Errorf("parsing redis URL: %v", err)
+		}
+		source, host, err := cursorSourceHost(cctx)
+		if err != nil {
+			return err
+		}
+		rdb := redis.NewClient(opt)
+		defer rdb.Close()
+
+		status, err := consumer.ReadCursorStatus(cctx.Context, rdb, source, host)
+		if err != nil {
+			return err
+		}
+		if status == nil {
+			return cli.Exit(fmt.Sprintf("no persisted %s cursor for %s", source, host), 1)
+		}
+
+		fmt.Printf("source:\t%s\n", status.Source)
+		fmt.Printf("host:\t%s\n", host)
+		fmt.Printf("key:\t%s\n", status.Key)
+		fmt.Printf("cursor:\t%d\n", status.Cursor)
+		if lag, ok := status.Lag(time.Now()); ok {
+			fmt.Printf("event_time:\t%s\n", status.EventTime.Format(time.RFC3339))
+			fmt.Printf("lag:\t%s\n", lag.Round(time.Second))
+		} else {
+			fmt.Printf("event_time:\tunknown\n")
+			fmt.Printf("lag:\tunknown\n")
+		}
+		if status.TTL > 0 {
+			fmt.Printf("expires_in:\t%s\n", status.TTL.Round(time.Second))
+		}
+		return nil
+	},
+}
+
+// returns the cursor source name and upstream host for the configured --firehose-source. The host is normalized the same way as by the consumer (see normalizeHostFlags), since the cursor is persisted under the normalized host.
+func cursorSourceHost(cctx *cli.Context) (string, string, error) {
+	if err := normalizeHostFlags(cctx); err != nil {
+		return "", "", err
+	}
+	switch cctx.String("firehose-source") {
+	case "relay":
+		return "firehose", cctx.String("atp-relay-host"), nil
+	case "jetstream":
+		return "jetstream", cctx.String("jetstream-host"), nil
+	default:
+		return "", "", fmt.Errorf("unknown firehose-source: %s", cctx.String("firehose-source"))
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+)
+
+func TestCursorSourceHost(t *testing.T) {
+	assert := assert.New(t)
+
+	sourceHost := func(args ...string) (string, string, error) {
+		var source, host string
+		app := cli.App{
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "firehose-source", Value: "relay"},
+				&cli.StringFlag{Name: "atp-relay-host", Value: "wss://bsky.network"},
+				&cli.StringFlag{Name: "jetstream-host"},
+			},
+			Action: func(cctx *cli.Context) error {
+				var err error
+				source, host, err = cursorSourceHost(cctx)
+				return err
+			},
+		}
+		err := app.Run(append([]string{"hepa"}, args...))
+		return source, host, err
+	}
+
+	source, host, err := sourceHost()
+	assert.NoError(err)
+	assert.Equal("firehose", source)
+	assert.Equal("wss://bsky.network", host)
+
+	// the host is normalized the same way as by the consumer, so that the persisted cursor is found
+	source, host, err = sourceHost("--atp-relay-host", "WSS://Relay.Example.com:443")
+	assert.NoError(err)
+	assert.Equal("firehose", source)
+	assert.Equal("wss://relay.example.com:443", host)
+
+	source, host, err = sourceHost("--firehose-source", "jetstream", "--jetstream-host", " wss://Jetstream.Example.com")
+	assert.NoError(err)
+	assert.Equal("jetstream", source)
+	assert.Equal("wss://jetstream.example.com", host)
+
+	_, _, err = sourceHost("--atp-relay-host", "relay.example.com")
+	assert.ErrorContains(err, "--atp-relay-host")
+	_, _, err = sourceHost("--firehose-source", "carrier-pigeon")
+	assert.ErrorContains(err, "unknown firehose-source")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod/capture"
+
+	"github.com/urfave/cli/v2"
+)
+
+var diffRulesetsCmd = &cli.Command{
+	Name:      "diff-rulesets",
+	Usage:     "compare the moderation actions of two rulesets on a sample of records",
+	ArgsUsage: `<ruleset-a> <ruleset-b>`,
+	Description: `Each ruleset is selected as '<name>' or '<name>:<ruleset-file>', where the name is a built-in ruleset (as with --ruleset), and the optional file is a declarative rules file (as with --ruleset-file). For example: 'diff-rulesets default default:new-rules.json --capture capture.json'.
+
+The sample is either recent posts from an account (--account, fetched from the network), or a capture JSON file (--capture, from capture-recent). Every record is processed with both rulesets, using separate in-process state (counters, caches) and in dry-run mode, so nothing is persisted and no actions are taken.
+
+Records where the actions differ (labels, tags, flags, reports, takedowns, etc) are printed with '+' for actions only taken by ruleset B, and '-' for actions only taken by ruleset A. Exits non-zero if there were any differences.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "account",
+			Usage: "handle or DID of account to sample recent posts from",
+		},
+		&cli.StringFlag{
+			Name:  "capture",
+			Usage: "path to a capture JSON file (from capture-recent) to use as the sample",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "how many recent posts to sample, with --account",
+			Value: 20,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := cctx.Context
+		if cctx.Args().Len() != 2 {
+			return fmt.Errorf("expected two ruleset selector arguments")
+		}
+		if (cctx.String("account") == "") == (cctx.String("capture") == "") {
+			return fmt.Errorf("exactly one of --account or --capture is required")
+		}
+
+		var servers []*Server
+		for _, sel := range cctx.Args().Slice() {
+			name, file, _ := strings.Cut(sel, ":")
+			if name == "" {
+				return fmt.Errorf("invalid ruleset selector (expected '<name>' or '<name>:<ruleset-file>'): %q", sel)
+			}
+			srv, err := configEphemeralServerWith(cctx, func(config *Config) {
+				config.RulesetName = name
+				config.RulesetFile = file
+				// each ruleset gets independent, local state
+				configOffline(config)
+			})
+			if err != nil {
+				return fmt.Errorf("ruleset %q: %w", sel, err)
+			}
+			servers = append(servers, srv)
+		}
+
+		var cap capture.AccountCapture
+		if capPath := cctx.String("capture"); capPath != "" {
+			f, err := os.Open(capPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if err := json.NewDecoder(bufio.NewReader(f)).Decode(&cap); err != nil {
+				return fmt.Errorf("parsing capture JSON: %w", err)
+			}
+		} else {
+			atid, err := syntax.ParseAtIdentifier(cctx.String("account"))
+			if err != nil {
+				return fmt.Errorf("not a valid handle or DID: %v", err)
+			}
+			ident, err := resolveAccount(cctx, servers[0].Engine.Directory, *atid)
+			if err != nil {
+				return err
+			}
+			// the account is fetched once, so both rulesets see exactly the same records and metadata
+			c, err := capture.CaptureRecent(ctx, servers[0].Engine, ident.DID.AtIdentifier(), cctx.Int("limit"))
+			if err != nil {
+				return err
+			}
+			cap = *c
+		}
+
+		results, err := capture.DiffCapture(ctx, servers[0].Engine, servers[1].Engine, cap)
+		if err != nil {
+			return err
+		}
+		changed := 0
+		for _, rd := range results {
+			if !rd.Changed() {
+				continue
+			}
+			changed++
+			if rd.ErrA != nil || rd.ErrB != nil {
+				fmt.Printf("ERROR\t%s\tA: %v\tB: %v\n", rd.URI, rd.ErrA, rd.ErrB)
+				continue
+			}
+			fields := []string{"DIFF", rd.URI}
+			for _, act := range rd.Diff.Removed {
+				fields = append(fields, "-"+act)
+			}
+			for _, act := range rd.Diff.Added {
+				fields = append(fields, "+"+act)
+			}
+			fmt.Println(strings.Join(fields, "\t"))
+		}
+		fmt.Printf("compared %d records: %d differ\n", len(results), changed)
+		if changed > 0 {
+			return cli.Exit("", 1)
+		}
+		return nil
+	},
+}
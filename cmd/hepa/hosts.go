@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// flags which hold service base URLs, and the URL schemes allowed for each
+var hostFlags = []struct {
+	name    string
+	schemes []string
+	list    bool
+}{
+	{name: "atp-relay-host", schemes: []string{"ws", "wss"}},
+	{name: "jetstream-host", schemes: []string{"ws", "wss"}},
+	{name: "atp-plc-host", schemes: []string{"http", "https"}, list: true},
+	{name: "atp-bsky-host", schemes: []string{"http", "https"}},
+	{name: "atp-ozone-host", schemes: []string{"http", "https"}},
+	{name: "atp-pds-host", schemes: []string{"http", "https"}},
+	{name: "abyss-host", schemes: []string{"http", "https"}},
+}
+
+// Validates all the host flags, and sets each to its normalized form, so that mistakes (a missing scheme, a path, a bad port, etc) fail at startup instead of as confusing request errors later. Empty values are left alone; they disable the corresponding service, where that is supported.
+func normalizeHostFlags(cctx *cli.Context) error {
+	for _, hf := range hostFlags {
+		raw := cctx.String(hf.name)
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		vals := []string{raw}
+		if hf.list {
+			vals = strings.Split(raw, ",")
+		}
+		var out []string
+		for _, val := range vals {
+			val = strings.TrimSpace(val)
+			if val == "" && hf.list {
+				continue
+			}
+			norm, err := normalizeHostURL(val, hf.schemes)
+			if err != nil {
+				return fmt.Errorf("invalid --%s %q: %w", hf.name, val, err)
+			}
+			out = append(out, norm)
+		}
+		if err := cctx.Set(hf.name, strings.Join(out, ",")); err != nil {
+			return fmt.Errorf("setting --%s: %w", hf.name, err)
+		}
+	}
+	return nil
+}
+
+// Parses a service base URL (scheme, host, and optional port), and returns it in a normalized form: lower-case scheme and hostname, no trailing slash. IPv6 addresses must be in brackets (eg, "http://[::1]:2583").
+func normalizeHostURL(raw string, schemes []string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("must include scheme and hostname (eg, '%s://example.com')", schemes[len(schemes)-1])
+	}
+	scheme := strings.ToLower(u.Scheme)
+	allowed := false
+	for _, s := range schemes {
+		allowed = allowed || scheme == s
+	}
+	if !allowed {
+		return "", fmt.Errorf("scheme must be one of: %s", strings.Join(schemes, ", "))
+	}
+	if u.User != nil {
+		return "", fmt.Errorf("credentials are not allowed in host URL")
+	}
+	if u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.ForceQuery {
+		return "", fmt.Errorf("must not include a path, query, or trailing slash")
+	}
+	hostname := u.Hostname()
+	if hostname == "" {
+		return "", fmt.Errorf("missing hostname")
+	}
+	if strings.Contains(hostname, ":") && !strings.HasPrefix(u.Host, "[") {
+		return "", fmt.Errorf("IPv6 addresses must be in brackets")
+	}
+	host := strings.ToLower(hostname)
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("invalid port: %q", port)
+		}
+		host = host + ":" + port
+	} else if strings.HasSuffix(u.Host, ":") {
+		return "", fmt.Errorf("empty port")
+	}
+	return scheme + "://" + host, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/util"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// Configuration of the HTTP clients used for backend calls (identity resolution, ozone, PDS, bsky AppView, and blob downloads). All clients share a single connection pool.
+//
+// Zero values keep the defaults: a pooled transport with 100 max idle connections, GOMAXPROCS+1 idle connections per host, and no limit on connections per host; and per-client timeouts (15s for identity resolution, 2m for ozone, and 30s otherwise).
+type HTTPClientConfig struct {
+	// overall request timeout (including retries) for all clients
+	Timeout time.Duration
+	// max idle (keep-alive) connections, across all hosts
+	MaxIdleConns int
+	// max idle (keep-alive) connections to any single host
+	MaxIdleConnsPerHost int
+	// max total (active and idle) connections to any single host
+	MaxConnsPerHost int
+
+	once      sync.Once
+	transport *http.Transport
+}
+
+// Returns the shared transport (connection pool), creating it on first use
+func (hc *HTTPClientConfig) Transport() *http.Transport {
+	hc.once.Do(func() {
+		t := cleanhttp.DefaultPooledTransport()
+		if hc.MaxIdleConns > 0 {
+			t.MaxIdleConns = hc.MaxIdleConns
+		}
+		if hc.MaxIdleConnsPerHost > 0 {
+			t.MaxIdleConnsPerHost = hc.MaxIdleConnsPerHost
+		}
+		if hc.MaxConnsPerHost > 0 {
+			t.MaxConnsPerHost = hc.MaxConnsPerHost
+		}
+		hc.transport = t
+	})
+	return hc.transport
+}
+
+// Returns the configured timeout, or the given client-specific default
+func (hc *HTTPClientConfig) timeout(def time.Duration) time.Duration {
+	if hc.Timeout > 0 {
+		return hc.Timeout
+	}
+	return def
+}
+
+// Plain client (no retries), for identity resolution
+func (hc *HTTPClientConfig) directoryClient() http.Client {
+	return http.Client{
+		Timeout:   hc.timeout(15 * time.Second),
+		Transport: hc.Transport(),
+	}
+}
+
+// Client with retries (see util.RobustHTTPClient), for PDS, AppView, and blob requests
+func (hc *HTTPClientConfig) robustClient() *http.Client {
+	c := util.RobustHTTPClientWithTransport(hc.Transport())
+	c.Timeout = hc.timeout(c.Timeout)
+	return c
+}
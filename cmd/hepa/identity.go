@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Resolves a set of identifiers concurrently, populating the directory's cache so that later (serial) processing doesn't block on identity resolution. Duplicate identifiers are only resolved once.
+//
+// Requests to PLC still go through the directory's rate limiter, so concurrency mostly helps with did:web and handle resolution, and with request latency. Returns the resolution error (if any) for each identifier.
+func ResolveBatch(ctx context.Context, dir identity.Directory, ids []syntax.AtIdentifier, concurrency int) map[syntax.AtIdentifier]error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	uniq := []syntax.AtIdentifier{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id.String()] {
+			continue
+		}
+		seen[id.String()] = true
+		uniq = append(uniq, id)
+	}
+
+	var lk sync.Mutex
+	results := make(map[syntax.AtIdentifier]error, len(uniq))
+	work := make(chan syntax.AtIdentifier)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range work {
+				_, err := dir.Lookup(ctx, id)
+				if err != nil {
+					slog.Debug("identity prefetch failed", "id", id.String(), "err", err)
+				}
+				lk.Lock()
+				results[id] = err
+				lk.Unlock()
+			}
+		}()
+	}
+	for _, id := range uniq {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- id
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
@@ -1,16 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
-	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"runtime"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
@@ -47,9 +50,21 @@ func run(args []string) error {
 			Value:   "wss://bsky.network",
 			EnvVars: []string{"ATP_RELAY_HOST", "ATP_BGS_HOST"},
 		},
+		&cli.StringFlag{
+			Name:    "firehose-source",
+			Usage:   "where to consume repo events from: 'relay' (full CBOR firehose) or 'jetstream' (lighter-weight JSON; no repo blocks)",
+			Value:   "relay",
+			EnvVars: []string{"HEPA_FIREHOSE_SOURCE"},
+		},
+		&cli.StringFlag{
+			Name:    "jetstream-host",
+			Usage:   "scheme, hostname, and port of Jetstream instance to subscribe to, when firehose-source is 'jetstream'",
+			Value:   "wss://jetstream2.us-east.bsky.network",
+			EnvVars: []string{"HEPA_JETSTREAM_HOST"},
+		},
 		&cli.StringFlag{
 			Name:    "atp-plc-host",
-			Usage:   "method, hostname, and port of PLC registry",
+			Usage:   "method, hostname, and port of PLC registry. may be a comma-separated list, in which case later hosts (eg, mirrors) are tried in order if a request to the first fails",
 			Value:   "https://plc.directory",
 			EnvVars: []string{"ATP_PLC_HOST"},
 		},
@@ -75,6 +90,16 @@ func run(args []string) error {
 			Usage:   "admin authentication password for mod service",
 			EnvVars: []string{"HEPA_OZONE_AUTH_ADMIN_TOKEN", "HEPA_MOD_AUTH_ADMIN_TOKEN"},
 		},
+		&cli.StringFlag{
+			Name:    "ozone-admin-token-file",
+			Usage:   "path of file containing the mod service admin password (eg, a mounted secret). takes precedence over --ozone-admin-token",
+			EnvVars: []string{"HEPA_OZONE_AUTH_ADMIN_TOKEN_FILE"},
+		},
+		&cli.IntFlag{
+			Name:    "ozone-rate-limit",
+			Usage:   "max number of requests per second to ozone (mod service) API; 0 for no limit",
+			EnvVars: []string{"HEPA_OZONE_RATE_LIMIT"},
+		},
 		&cli.StringFlag{
 			Name:    "atp-pds-host",
 			Usage:   "method, hostname, and port of PDS (or entryway) for admin account info; uses admin auth",
@@ -86,6 +111,11 @@ func run(args []string) error {
 			Usage:   "admin authentication password for PDS (or entryway)",
 			EnvVars: []string{"HEPA_PDS_AUTH_ADMIN_TOKEN"},
 		},
+		&cli.StringFlag{
+			Name:    "pds-admin-token-file",
+			Usage:   "path of file containing the PDS admin password (eg, a mounted secret). takes precedence over --pds-admin-token",
+			EnvVars: []string{"HEPA_PDS_AUTH_ADMIN_TOKEN_FILE"},
+		},
 		&cli.StringFlag{
 			Name:  "redis-url",
 			Usage: "redis connection URL",
@@ -99,6 +129,48 @@ func run(args []string) error {
 			Value:   100,
 			EnvVars: []string{"HEPA_PLC_RATE_LIMIT"},
 		},
+		&cli.BoolFlag{
+			Name:    "allow-did-web",
+			Usage:   "resolve did:web identities (fetching DID documents over HTTPS from the DID's hostname). if disabled, only did:plc accounts can be resolved",
+			Value:   true,
+			EnvVars: []string{"HEPA_ALLOW_DID_WEB"},
+		},
+		&cli.IntFlag{
+			Name:    "identity-cache-size",
+			Usage:   "max number of identities (and, separately, handles) held in the in-process LRU cache, when Redis is not configured. zero means unlimited",
+			Value:   1_500_000,
+			EnvVars: []string{"HEPA_IDENTITY_CACHE_SIZE"},
+		},
+		&cli.DurationFlag{
+			Name:    "identity-cache-ttl",
+			Usage:   "how long successful identity resolutions are cached",
+			Value:   24 * time.Hour,
+			EnvVars: []string{"HEPA_IDENTITY_CACHE_TTL"},
+		},
+		&cli.DurationFlag{
+			Name:    "identity-negative-ttl",
+			Usage:   "how long failed identity resolutions (eg, DID not found) are cached. shorter values pick up newly-created accounts faster, at the cost of more PLC and DNS lookups",
+			Value:   2 * time.Minute,
+			EnvVars: []string{"HEPA_IDENTITY_NEGATIVE_TTL"},
+		},
+		&cli.BoolFlag{
+			Name:    "identity-dns-authoritative",
+			Usage:   "when DNS handle resolution fails, re-try against the domain's authoritative nameserver",
+			Value:   true,
+			EnvVars: []string{"HEPA_IDENTITY_DNS_AUTHORITATIVE"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "identity-skip-dns-suffix",
+			Usage:   "handle domain suffix for which DNS handle resolution is skipped (HTTP well-known only). can be repeated",
+			Value:   cli.NewStringSlice(".bsky.social", ".staging.bsky.dev"),
+			EnvVars: []string{"HEPA_IDENTITY_SKIP_DNS_SUFFIX"},
+		},
+		&cli.StringFlag{
+			Name:    "identity-handle-resolution-order",
+			Usage:   "comma-separated order of handle resolution methods to attempt: 'dns,http' or 'http,dns'. all methods are attempted before a handle is considered invalid",
+			Value:   "dns,http",
+			EnvVars: []string{"HEPA_IDENTITY_HANDLE_RESOLUTION_ORDER"},
+		},
 		&cli.StringFlag{
 			Name:    "sets-json-path",
 			Usage:   "file path of JSON file containing static sets",
@@ -109,6 +181,11 @@ func run(args []string) error {
 			Usage:   "API token for Hive AI image auto-labeling",
 			EnvVars: []string{"HIVEAI_API_TOKEN"},
 		},
+		&cli.StringFlag{
+			Name:    "hiveai-api-token-file",
+			Usage:   "path of file containing the Hive AI API token (eg, a mounted secret). takes precedence over --hiveai-api-token",
+			EnvVars: []string{"HIVEAI_API_TOKEN_FILE"},
+		},
 		&cli.StringFlag{
 			Name:    "abyss-host",
 			Usage:   "host for abusive image scanning API (scheme, host, port)",
@@ -119,11 +196,27 @@ func run(args []string) error {
 			Usage:   "admin auth password for abyss API",
 			EnvVars: []string{"ABYSS_PASSWORD"},
 		},
+		&cli.StringFlag{
+			Name:    "abyss-password-file",
+			Usage:   "path of file containing the abyss API password (eg, a mounted secret). takes precedence over --abyss-password",
+			EnvVars: []string{"ABYSS_PASSWORD_FILE"},
+		},
+		&cli.DurationFlag{
+			Name:    "abyss-cache-ttl",
+			Usage:   "how long to cache abyss scan results, by blob CID (zero to disable)",
+			Value:   24 * time.Hour,
+			EnvVars: []string{"ABYSS_CACHE_TTL"},
+		},
 		&cli.StringFlag{
 			Name:    "ruleset",
 			Usage:   "which ruleset config to use: default, no-blobs, only-blobs",
 			EnvVars: []string{"HEPA_RULESET"},
 		},
+		&cli.StringFlag{
+			Name:    "ruleset-file",
+			Usage:   "file path of JSON file containing declarative (keyword, regex, domain) rules, added to the selected ruleset",
+			EnvVars: []string{"HEPA_RULESET_FILE"},
+		},
 		&cli.StringFlag{
 			Name:    "log-level",
 			Usage:   "log verbosity level (eg: warn, info, debug)",
@@ -139,6 +232,12 @@ func run(args []string) error {
 			Usage:   "force a fixed number of parallel firehose workers. default (or 0) for auto-scaling; 200 works for a large instance",
 			EnvVars: []string{"HEPA_FIREHOSE_PARALLELISM"},
 		},
+		&cli.IntFlag{
+			Name:    "firehose-queue-size",
+			Usage:   "size of the buffered event queue between the firehose reader and workers",
+			Value:   1000,
+			EnvVars: []string{"HEPA_FIREHOSE_QUEUE_SIZE"},
+		},
 		&cli.StringFlag{
 			Name:    "prescreen-host",
 			Usage:   "hostname of prescreen server",
@@ -149,12 +248,23 @@ func run(args []string) error {
 			Usage:   "secret token for prescreen server",
 			EnvVars: []string{"HEPA_PRESCREEN_TOKEN"},
 		},
+		&cli.StringFlag{
+			Name:    "prescreen-token-file",
+			Usage:   "path of file containing the prescreen server token (eg, a mounted secret). takes precedence over --prescreen-token",
+			EnvVars: []string{"HEPA_PRESCREEN_TOKEN_FILE"},
+		},
 		&cli.DurationFlag{
 			Name:    "report-dupe-period",
 			Usage:   "time period within which automod will not re-report an account for the same reasonType",
 			EnvVars: []string{"HEPA_REPORT_DUPE_PERIOD"},
 			Value:   1 * 24 * time.Hour,
 		},
+		&cli.DurationFlag{
+			Name:    "action-dedupe-window",
+			Usage:   "time period within which identical moderation actions (same subject, action type, and value) are suppressed. zero to disable",
+			EnvVars: []string{"HEPA_ACTION_DEDUPE_WINDOW"},
+			Value:   1 * time.Hour,
+		},
 		&cli.IntFlag{
 			Name:    "quota-mod-report-day",
 			Usage:   "number of reports automod can file per day, for all subjects and types combined (circuit breaker)",
@@ -173,6 +283,32 @@ func run(args []string) error {
 			EnvVars: []string{"HEPA_QUOTA_MOD_ACTION_DAY"},
 			Value:   2000,
 		},
+		&cli.DurationFlag{
+			Name:    "http-timeout",
+			Usage:   "overall timeout (including retries) for backend HTTP requests (identity, ozone, PDS, bsky, blobs). zero for per-client defaults (15s identity, 2m ozone, 30s otherwise)",
+			EnvVars: []string{"HEPA_HTTP_TIMEOUT"},
+		},
+		&cli.IntFlag{
+			Name:    "http-max-idle-conns",
+			Usage:   "max idle (keep-alive) connections in the shared backend HTTP connection pool, across all hosts",
+			Value:   100,
+			EnvVars: []string{"HEPA_HTTP_MAX_IDLE_CONNS"},
+		},
+		&cli.IntFlag{
+			Name:    "http-max-idle-conns-per-host",
+			Usage:   "max idle (keep-alive) backend HTTP connections per host. zero for default (GOMAXPROCS+1)",
+			EnvVars: []string{"HEPA_HTTP_MAX_IDLE_CONNS_PER_HOST"},
+		},
+		&cli.IntFlag{
+			Name:    "http-max-conns-per-host",
+			Usage:   "max total backend HTTP connections per host; requests wait when the limit is reached. zero for no limit",
+			EnvVars: []string{"HEPA_HTTP_MAX_CONNS_PER_HOST"},
+		},
+		&cli.BoolFlag{
+			Name:    "dry-run",
+			Usage:   "run rules and log moderation actions, but don't send any actions to the mod service (ozone)",
+			EnvVars: []string{"HEPA_DRY_RUN"},
+		},
 	}
 
 	app.Commands = []*cli.Command{
@@ -180,35 +316,147 @@ func run(args []string) error {
 		processRecordCmd,
 		processRecentCmd,
 		captureRecentCmd,
+		backfillCmd,
+		replayCaptureCmd,
+		validateRulesetCmd,
+		cursorStatusCmd,
+		diffRulesetsCmd,
 	}
 
 	return app.Run(args)
 }
 
-func configDirectory(cctx *cli.Context) (identity.Directory, error) {
-	baseDir := identity.BaseDirectory{
-		PLCURL: cctx.String("atp-plc-host"),
-		HTTPClient: http.Client{
-			Timeout: time.Second * 15,
-		},
-		PLCLimiter:            rate.NewLimiter(rate.Limit(cctx.Int("plc-rate-limit")), 1),
-		TryAuthoritativeDNS:   true,
-		SkipDNSDomainSuffixes: []string{".bsky.social", ".staging.bsky.dev"},
+// HTTP client config from flags. a single config (and connection pool) should be shared by all clients
+func configHTTPClient(cctx *cli.Context) *HTTPClientConfig {
+	return &HTTPClientConfig{
+		Timeout:             cctx.Duration("http-timeout"),
+		MaxIdleConns:        cctx.Int("http-max-idle-conns"),
+		MaxIdleConnsPerHost: cctx.Int("http-max-idle-conns-per-host"),
+		MaxConnsPerHost:     cctx.Int("http-max-conns-per-host"),
+	}
+}
+
+func configDirectory(cctx *cli.Context, httpConf *HTTPClientConfig) (identity.Directory, error) {
+	baseDir, err := configBaseDirectory(cctx, httpConf)
+	if err != nil {
+		return nil, err
+	}
+	if cctx.Duration("identity-negative-ttl") > cctx.Duration("identity-cache-ttl") {
+		return nil, fmt.Errorf("identity negative cache TTL should not be longer than the hit TTL")
+	}
+	if cctx.Int("identity-cache-size") < 0 {
+		return nil, fmt.Errorf("identity cache size can not be negative")
 	}
 	var dir identity.Directory
 	if cctx.String("redis-url") != "" {
-		rdir, err := redisdir.NewRedisDirectory(&baseDir, cctx.String("redis-url"), time.Hour*24, time.Minute*2, time.Minute*5, 10_000)
+		rdir, err := redisdir.NewRedisDirectory(baseDir, cctx.String("redis-url"), cctx.Duration("identity-cache-ttl"), cctx.Duration("identity-negative-ttl"), time.Minute*5, 10_000)
 		if err != nil {
 			return nil, err
 		}
 		dir = rdir
 	} else {
-		cdir := identity.NewCacheDirectory(&baseDir, 1_500_000, time.Hour*24, time.Minute*2, time.Minute*5)
+		cdir := identity.NewCacheDirectory(baseDir, cctx.Int("identity-cache-size"), cctx.Duration("identity-cache-ttl"), cctx.Duration("identity-negative-ttl"), time.Minute*5)
 		dir = &cdir
 	}
 	return dir, nil
 }
 
+// un-cached identity directory, configured from flags. this is wrapped by configDirectory, and also used directly to diagnose resolution failures
+func configBaseDirectory(cctx *cli.Context, httpConf *HTTPClientConfig) (*identity.BaseDirectory, error) {
+	var handleOrder []string
+	for _, m := range strings.Split(cctx.String("identity-handle-resolution-order"), ",") {
+		m = strings.TrimSpace(strings.ToLower(m))
+		switch m {
+		case "":
+			continue
+		case identity.HandleResolutionDNS, identity.HandleResolutionHTTP:
+			handleOrder = append(handleOrder, m)
+		default:
+			return nil, fmt.Errorf("unknown handle resolution method: %q", m)
+		}
+	}
+	plcHosts := parsePLCHosts(cctx.String("atp-plc-host"))
+	if len(plcHosts) == 0 {
+		return nil, fmt.Errorf("at least one PLC host is required")
+	}
+	baseDir := identity.BaseDirectory{
+		PLCURL:                plcHosts[0],
+		PLCFallbackURLs:       plcHosts[1:],
+		HTTPClient:            httpConf.directoryClient(),
+		PLCLimiter:            rate.NewLimiter(rate.Limit(cctx.Int("plc-rate-limit")), 1),
+		TryAuthoritativeDNS:   cctx.Bool("identity-dns-authoritative"),
+		SkipDNSDomainSuffixes: cctx.StringSlice("identity-skip-dns-suffix"),
+		HandleResolutionOrder: handleOrder,
+	}
+	if !cctx.Bool("allow-did-web") {
+		baseDir.DIDWebLimitFunc = denyDIDWeb
+	}
+	return &baseDir, nil
+}
+
+// splits a comma-separated list of PLC hosts
+func parsePLCHosts(raw string) []string {
+	var out []string
+	for _, h := range strings.Split(raw, ",") {
+		h = strings.TrimSuffix(strings.TrimSpace(h), "/")
+		if h != "" {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// returns the first PLC host in a comma-separated list. this is used for requests which aren't DID resolution (eg, the PLC audit log), which mirrors may not support
+func primaryPLCHost(raw string) string {
+	hosts := parsePLCHosts(raw)
+	if len(hosts) == 0 {
+		return ""
+	}
+	return hosts[0]
+}
+
+var errDIDWebDisabled = fmt.Errorf("%w: did:web resolution is disabled", identity.ErrDIDResolutionFailed)
+
+// did:web limit function which rejects all did:web resolution. Like other resolution failures, these errors are cached by the caching directory (for the error TTL), so repeated events from a did:web account don't re-run resolution.
+func denyDIDWeb(ctx context.Context, hostname string) error {
+	return errDIDWebDisabled
+}
+
+// flags with secret values, each of which can alternatively be read from a file with a "-file" suffixed flag
+var secretFlags = []string{
+	"ozone-admin-token",
+	"pds-admin-token",
+	"hiveai-api-token",
+	"abyss-password",
+	"prescreen-token",
+	"admin-token",
+}
+
+// Reads any secrets configured as files (eg, Kubernetes secret mounts), and sets the corresponding inline flags. Surrounding whitespace (eg, a trailing newline) is trimmed. If both forms are set, the file wins.
+func loadSecretFiles(cctx *cli.Context, logger *slog.Logger) error {
+	for _, name := range secretFlags {
+		path := cctx.String(name + "-file")
+		if path == "" {
+			continue
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading --%s-file: %w", name, err)
+		}
+		secret := strings.TrimSpace(string(raw))
+		if secret == "" {
+			return fmt.Errorf("--%s-file is empty: %s", name, path)
+		}
+		if cctx.String(name) != "" {
+			logger.Warn("secret configured both inline and as a file; using the file", "flag", name, "path", path)
+		}
+		if err := cctx.Set(name, secret); err != nil {
+			return fmt.Errorf("setting --%s from file: %w", name, err)
+		}
+	}
+	return nil
+}
+
 func configLogger(cctx *cli.Context, writer io.Writer) *slog.Logger {
 	var level slog.Level
 	switch strings.ToLower(cctx.String("log-level")) {
@@ -240,19 +488,125 @@ var runCmd = &cli.Command{
 			Value:   ":3989",
 			EnvVars: []string{"HEPA_METRICS_LISTEN"},
 		},
+		&cli.StringFlag{
+			Name:    "admin-token",
+			Usage:   "admin auth token for HTTP admin endpoints (eg, /admin/reprocess) on the metrics port. endpoints are disabled if not set",
+			EnvVars: []string{"HEPA_ADMIN_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    "admin-token-file",
+			Usage:   "path of file containing the admin endpoint token (eg, a mounted secret). takes precedence over --admin-token",
+			EnvVars: []string{"HEPA_ADMIN_TOKEN_FILE"},
+		},
 		&cli.StringFlag{
 			Name: "slack-webhook-url",
 			// eg: https://hooks.slack.com/services/X1234
-			Usage:   "full URL of slack webhook",
+			Usage:   "full URL of slack webhook (DEPRECATED: use notify-webhook-url)",
 			EnvVars: []string{"SLACK_WEBHOOK_URL"},
 		},
+		&cli.StringFlag{
+			Name:    "notify-webhook-url",
+			Usage:   "full URL of webhook for moderation action notifications",
+			EnvVars: []string{"HEPA_NOTIFY_WEBHOOK_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "notify-webhook-kind",
+			Usage:   "type of notification webhook: slack, discord, or webhook (generic JSON POST)",
+			Value:   "slack",
+			EnvVars: []string{"HEPA_NOTIFY_WEBHOOK_KIND"},
+		},
+		&cli.StringFlag{
+			Name:    "notify-service",
+			Usage:   "service name which discord and webhook notifiers deliver notifications for (rules request notifications by service name; the built-in rules use \"slack\"). defaults to the webhook kind",
+			EnvVars: []string{"HEPA_NOTIFY_SERVICE"},
+		},
+		&cli.StringFlag{
+			Name:    "audit-log-path",
+			Usage:   "file to append a JSON line to for every rule firing (rule, subject, actions, inputs hash); '-' for stdout",
+			EnvVars: []string{"HEPA_AUDIT_LOG_PATH"},
+		},
+		&cli.IntFlag{
+			Name:    "audit-log-buffer",
+			Usage:   "max audit log entries buffered in memory; entries are dropped (and counted) if the buffer is full",
+			Value:   1000,
+			EnvVars: []string{"HEPA_AUDIT_LOG_BUFFER"},
+		},
+		&cli.StringFlag{
+			Name:    "action-sink",
+			Usage:   "where to send moderation actions: 'ozone' (directly to the mod service) or 'nats' (publish JSON events to NATS JetStream, for downstream services)",
+			Value:   "ozone",
+			EnvVars: []string{"HEPA_ACTION_SINK"},
+		},
+		&cli.StringFlag{
+			Name:    "nats-url",
+			Usage:   "NATS server URL(s) for the 'nats' action sink (comma-separated for a cluster)",
+			Value:   "nats://127.0.0.1:4222",
+			EnvVars: []string{"HEPA_NATS_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "nats-subject",
+			Usage:   "NATS subject prefix for the 'nats' action sink; the event kind ('account' or 'record') is appended",
+			Value:   "automod.actions",
+			EnvVars: []string{"HEPA_NATS_SUBJECT"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "collections",
+			Usage:   "only process records in these collections (NSIDs; comma-separated or repeated). default is all collections",
+			EnvVars: []string{"HEPA_COLLECTIONS"},
+		},
+		&cli.StringFlag{
+			Name:    "firehose-cursor",
+			Usage:   "start from this cursor, instead of the persisted one: a sequence number (or timestamp in microseconds, for jetstream), 'live', or 'oldest'. the cursor is not persisted during the run unless --persist-cursor is also set",
+			EnvVars: []string{"HEPA_FIREHOSE_CURSOR"},
+		},
+		&cli.BoolFlag{
+			Name:    "persist-cursor",
+			Usage:   "with --firehose-cursor, persist the cursor as normal (overwriting the stored cursor)",
+			EnvVars: []string{"HEPA_PERSIST_CURSOR"},
+		},
 	},
 	Action: func(cctx *cli.Context) error {
-		ctx := context.Background()
+		// on shutdown, event processing stops, and state (cursors, audit log, action sink) is flushed before exiting
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
 		logger := configLogger(cctx, os.Stdout)
 		configOTEL("hepa")
 
-		dir, err := configDirectory(cctx)
+		logger.Info("hepa starting",
+			"version", versioninfo.Short(),
+			"relayHost", cctx.String("atp-relay-host"),
+			"firehoseSource", cctx.String("firehose-source"),
+			"ozoneHost", cctx.String("atp-ozone-host"),
+			"ruleset", cctx.String("ruleset"),
+			"dryRun", cctx.Bool("dry-run"),
+		)
+
+		if err := loadSecretFiles(cctx, logger); err != nil {
+			return err
+		}
+		if err := normalizeHostFlags(cctx); err != nil {
+			return err
+		}
+
+		// optional cursor override, for targeted replays. to avoid clobbering the stored cursor, it is only persisted if explicitly requested
+		var startCursor *int64
+		readOnlyCursor := false
+		if raw := cctx.String("firehose-cursor"); raw != "" {
+			cur, err := consumer.ParseCursor(raw)
+			if err != nil {
+				return err
+			}
+			startCursor = &cur
+			readOnlyCursor = !cctx.Bool("persist-cursor")
+			if readOnlyCursor {
+				logger.Warn("starting from --firehose-cursor; cursor will not be persisted during this run", "cursor", raw)
+			}
+		} else if cctx.Bool("persist-cursor") {
+			return fmt.Errorf("--persist-cursor only makes sense with --firehose-cursor")
+		}
+
+		httpConf := configHTTPClient(cctx)
+		dir, err := configDirectory(cctx, httpConf)
 		if err != nil {
 			return fmt.Errorf("failed to configure identity directory: %v", err)
 		}
@@ -262,54 +616,63 @@ var runCmd = &cli.Command{
 			Config{
 				Logger:              logger,
 				RelayHost:           cctx.String("atp-relay-host"), // DEPRECATED
+				FirehoseSource:      cctx.String("firehose-source"),
+				JetstreamHost:       cctx.String("jetstream-host"),
+				Collections:         cctx.StringSlice("collections"),
+				PLCHost:             primaryPLCHost(cctx.String("atp-plc-host")),
 				BskyHost:            cctx.String("atp-bsky-host"),
 				OzoneHost:           cctx.String("atp-ozone-host"),
 				OzoneDID:            cctx.String("ozone-did"),
 				OzoneAdminToken:     cctx.String("ozone-admin-token"),
+				OzoneRateLimit:      cctx.Int("ozone-rate-limit"),
 				PDSHost:             cctx.String("atp-pds-host"),
 				PDSAdminToken:       cctx.String("pds-admin-token"),
 				SetsFileJSON:        cctx.String("sets-json-path"),
 				RedisURL:            cctx.String("redis-url"),
 				SlackWebhookURL:     cctx.String("slack-webhook-url"),
+				NotifyWebhookURL:    cctx.String("notify-webhook-url"),
+				NotifyWebhookKind:   cctx.String("notify-webhook-kind"),
+				NotifyService:       cctx.String("notify-service"),
 				HiveAPIToken:        cctx.String("hiveai-api-token"),
 				AbyssHost:           cctx.String("abyss-host"),
 				AbyssPassword:       cctx.String("abyss-password"),
+				AbyssCacheTTL:       cctx.Duration("abyss-cache-ttl"),
 				RatelimitBypass:     cctx.String("ratelimit-bypass"),
 				RulesetName:         cctx.String("ruleset"),
+				RulesetFile:         cctx.String("ruleset-file"),
 				FirehoseParallelism: cctx.Int("firehose-parallelism"), // DEPRECATED
 				PreScreenHost:       cctx.String("prescreen-host"),
 				PreScreenToken:      cctx.String("prescreen-token"),
 				ReportDupePeriod:    cctx.Duration("report-dupe-period"),
+				ActionDedupeWindow:  cctx.Duration("action-dedupe-window"),
 				QuotaModReportDay:   cctx.Int("quota-mod-report-day"),
 				QuotaModTakedownDay: cctx.Int("quota-mod-takedown-day"),
 				QuotaModActionDay:   cctx.Int("quota-mod-action-day"),
+				DryRun:              cctx.Bool("dry-run"),
+				AdminToken:          cctx.String("admin-token"),
+				AuditLogPath:        cctx.String("audit-log-path"),
+				AuditLogBuffer:      cctx.Int("audit-log-buffer"),
+				ActionSink:          cctx.String("action-sink"),
+				NATSURL:             cctx.String("nats-url"),
+				NATSSubject:         cctx.String("nats-subject"),
+				HTTPClient:          httpConf,
 			},
 		)
 		if err != nil {
 			return fmt.Errorf("failed to construct server: %v", err)
 		}
 
-		// ozone event consumer (if configured)
-		if srv.Engine.OzoneClient != nil {
-			oc := consumer.OzoneConsumer{
-				Logger:      logger.With("subsystem", "ozone-consumer"),
-				RedisClient: srv.RedisClient,
-				OzoneClient: srv.Engine.OzoneClient,
-				Engine:      srv.Engine,
-			}
-
-			go func() {
-				if err := oc.Run(ctx); err != nil {
-					slog.Error("ozone consumer failed", "err", err)
-				}
-			}()
-
-			go func() {
-				if err := oc.RunPersistCursor(ctx); err != nil {
-					slog.Error("ozone cursor routine failed", "err", err)
+		// reload static sets on SIGHUP, without interrupting event processing
+		go func() {
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			for range hup {
+				logger.Info("received SIGHUP, reloading sets")
+				if err := srv.ReloadSets(); err != nil {
+					logger.Error("failed to reload sets", "err", err)
 				}
-			}()
-		}
+			}
+		}()
 
 		// prometheus HTTP endpoint: /metrics
 		go func() {
@@ -321,81 +684,103 @@ var runCmd = &cli.Command{
 			}
 		}()
 
-		// firehose event consumer (note this is actually mandatory)
-		relayHost := cctx.String("atp-relay-host")
-		if relayHost != "" {
-			fc := consumer.FirehoseConsumer{
-				Engine:      srv.Engine,
-				Logger:      logger.With("subsystem", "firehose-consumer"),
-				Host:        cctx.String("atp-relay-host"),
-				Parallelism: cctx.Int("firehose-parallelism"),
-				RedisClient: srv.RedisClient,
-			}
-
-			go func() {
-				if err := fc.RunPersistCursor(ctx); err != nil {
-					slog.Error("cursor routine failed", "err", err)
-				}
-			}()
-
-			if err := fc.Run(ctx); err != nil {
-				return fmt.Errorf("failure consuming and processing firehose: %w", err)
-			}
-		}
-
-		return nil
+		return srv.Run(ctx, RunConfig{
+			FirehoseQueueSize: cctx.Int("firehose-queue-size"),
+			StartCursor:       startCursor,
+			ReadOnlyCursor:    readOnlyCursor,
+		})
 	},
 }
 
 // for simple commands, not long-running daemons
 func configEphemeralServer(cctx *cli.Context) (*Server, error) {
+	return configEphemeralServerWith(cctx, nil)
+}
+
+// same as configEphemeralServer, with an optional hook to override parts of the config from flags
+func configEphemeralServerWith(cctx *cli.Context, override func(*Config)) (*Server, error) {
 	// NOTE: using stderr not stdout because some commands print to stdout
 	logger := configLogger(cctx, os.Stderr)
 
-	dir, err := configDirectory(cctx)
+	if err := loadSecretFiles(cctx, logger); err != nil {
+		return nil, err
+	}
+	if err := normalizeHostFlags(cctx); err != nil {
+		return nil, err
+	}
+
+	httpConf := configHTTPClient(cctx)
+	dir, err := configDirectory(cctx, httpConf)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewServer(
-		dir,
-		Config{
-			Logger:              logger,
-			RelayHost:           cctx.String("atp-relay-host"),
-			BskyHost:            cctx.String("atp-bsky-host"),
-			OzoneHost:           cctx.String("atp-ozone-host"),
-			OzoneDID:            cctx.String("ozone-did"),
-			OzoneAdminToken:     cctx.String("ozone-admin-token"),
-			PDSHost:             cctx.String("atp-pds-host"),
-			PDSAdminToken:       cctx.String("pds-admin-token"),
-			SetsFileJSON:        cctx.String("sets-json-path"),
-			RedisURL:            cctx.String("redis-url"),
-			HiveAPIToken:        cctx.String("hiveai-api-token"),
-			AbyssHost:           cctx.String("abyss-host"),
-			AbyssPassword:       cctx.String("abyss-password"),
-			RatelimitBypass:     cctx.String("ratelimit-bypass"),
-			RulesetName:         cctx.String("ruleset"),
-			FirehoseParallelism: cctx.Int("firehose-parallelism"),
-			PreScreenHost:       cctx.String("prescreen-host"),
-			PreScreenToken:      cctx.String("prescreen-token"),
-		},
-	)
+	config := Config{
+		Logger:              logger,
+		RelayHost:           cctx.String("atp-relay-host"),
+		PLCHost:             primaryPLCHost(cctx.String("atp-plc-host")),
+		BskyHost:            cctx.String("atp-bsky-host"),
+		OzoneHost:           cctx.String("atp-ozone-host"),
+		OzoneDID:            cctx.String("ozone-did"),
+		OzoneAdminToken:     cctx.String("ozone-admin-token"),
+		OzoneRateLimit:      cctx.Int("ozone-rate-limit"),
+		PDSHost:             cctx.String("atp-pds-host"),
+		PDSAdminToken:       cctx.String("pds-admin-token"),
+		SetsFileJSON:        cctx.String("sets-json-path"),
+		RedisURL:            cctx.String("redis-url"),
+		HiveAPIToken:        cctx.String("hiveai-api-token"),
+		AbyssHost:           cctx.String("abyss-host"),
+		AbyssPassword:       cctx.String("abyss-password"),
+		AbyssCacheTTL:       cctx.Duration("abyss-cache-ttl"),
+		RatelimitBypass:     cctx.String("ratelimit-bypass"),
+		RulesetName:         cctx.String("ruleset"),
+		RulesetFile:         cctx.String("ruleset-file"),
+		ActionDedupeWindow:  cctx.Duration("action-dedupe-window"),
+		FirehoseParallelism: cctx.Int("firehose-parallelism"),
+		PreScreenHost:       cctx.String("prescreen-host"),
+		PreScreenToken:      cctx.String("prescreen-token"),
+		DryRun:              cctx.Bool("dry-run"),
+		HTTPClient:          httpConf,
+	}
+	if override != nil {
+		override(&config)
+	}
+	return NewServer(dir, config)
+}
+
+// Config override for offline runs (replays and ruleset diffs): all state (counters, caches, flags) is local and in-process, and nothing gets actioned
+func configOffline(config *Config) {
+	config.RedisURL = ""
+	config.DryRun = true
 }
 
 var processRecordCmd = &cli.Command{
 	Name:      "process-record",
-	Usage:     "process a single record in isolation",
-	ArgsUsage: `<at-uri>`,
-	Flags:     []cli.Flag{},
+	Usage:     "process one or more records in isolation",
+	ArgsUsage: `<at-uri> [<at-uri>...]`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "from-file",
+			Usage: "path to file with newline-delimited AT-URIs to process (in addition to any arguments). use '-' for stdin",
+		},
+		&cli.IntFlag{
+			Name:  "prefetch-concurrency",
+			Usage: "number of parallel identity lookups when warming the identity cache before processing. 0 to skip prefetching",
+			Value: 8,
+		},
+	},
 	Action: func(cctx *cli.Context) error {
 		ctx := context.Background()
-		uriArg := cctx.Args().First()
-		if uriArg == "" {
-			return fmt.Errorf("expected a single AT-URI argument")
+		uriArgs := cctx.Args().Slice()
+		if cctx.String("from-file") != "" {
+			fileArgs, err := readLines(cctx.String("from-file"))
+			if err != nil {
+				return err
+			}
+			uriArgs = append(uriArgs, fileArgs...)
 		}
-		aturi, err := syntax.ParseATURI(uriArg)
-		if err != nil {
-			return fmt.Errorf("not a valid AT-URI: %v", err)
+		if len(uriArgs) == 0 {
+			return fmt.Errorf("expected at least one AT-URI argument")
 		}
 
 		srv, err := configEphemeralServer(cctx)
@@ -403,20 +788,85 @@ var processRecordCmd = &cli.Command{
 			return err
 		}
 
-		return capture.FetchAndProcessRecord(ctx, srv.Engine, aturi)
+		// warm the identity cache up front; resolution failures are reported per-record below
+		if c := cctx.Int("prefetch-concurrency"); c > 0 && len(uriArgs) > 1 {
+			var ids []syntax.AtIdentifier
+			for _, uriArg := range uriArgs {
+				if aturi, err := syntax.ParseATURI(uriArg); err == nil {
+					ids = append(ids, aturi.Authority())
+				}
+			}
+			res := ResolveBatch(ctx, srv.Engine.Directory, ids, c)
+			srv.logger.Info("prefetched identities", "count", len(res))
+		}
+
+		// a single server (and identity cache) is re-used for all records. failures are reported, but don't halt the batch
+		failures := 0
+		for _, uriArg := range uriArgs {
+			aturi, err := syntax.ParseATURI(uriArg)
+			if err != nil {
+				err = fmt.Errorf("not a valid AT-URI: %v", err)
+			} else {
+				err = capture.FetchAndProcessRecord(ctx, srv.Engine, aturi)
+			}
+			if err != nil {
+				failures++
+				fmt.Printf("ERROR\t%s\t%s\n", uriArg, err)
+			} else {
+				fmt.Printf("OK\t%s\n", uriArg)
+			}
+		}
+		fmt.Printf("processed %d records: %d succeeded, %d failed\n", len(uriArgs), len(uriArgs)-failures, failures)
+		if failures > 0 {
+			return fmt.Errorf("failed to process %d of %d records", failures, len(uriArgs))
+		}
+		return nil
 	},
 }
 
+// reads non-empty, non-comment lines from a file path ('-' for stdin)
+func readLines(path string) ([]string, error) {
+	var r io.Reader
+	if path == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
 var processRecentCmd = &cli.Command{
-	Name:      "process-recent",
-	Usage:     "fetch and process recent posts for an account",
-	ArgsUsage: `<at-identifier>`,
+	Name:        "process-recent",
+	Usage:       "fetch and process recent posts for an account",
+	ArgsUsage:   `<at-identifier>`,
+	Description: `The record key of the newest post processed (or the --since marker, if there were no new posts) is printed to stdout. Only TID record keys are printed, since others can't be used as a marker. Pass that as --since on the next run to only process posts newer than it, eg to incrementally process an account's new posts when polling. At most --limit posts are processed per run; if more than that were created since the marker, the older ones are skipped, with a warning.`,
 	Flags: []cli.Flag{
 		&cli.IntFlag{
 			Name:  "limit",
 			Usage: "how many post records to parse",
 			Value: 20,
 		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "only process posts newer than this record key (TID), as printed by a previous run, or timestamp (RFC 3339)",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		ctx := context.Background()
@@ -433,14 +883,33 @@ var processRecentCmd = &cli.Command{
 		if err != nil {
 			return err
 		}
+		ident, err := resolveAccount(cctx, srv.Engine.Directory, *atid)
+		if err != nil {
+			return err
+		}
 
-		return capture.FetchAndProcessRecent(ctx, srv.Engine, *atid, cctx.Int("limit"))
+		var since *syntax.TID
+		if cctx.String("since") != "" {
+			tid, err := capture.ParseSinceMarker(cctx.String("since"))
+			if err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+			since = &tid
+		}
+		newest, err := capture.FetchAndProcessRecentSince(ctx, srv.Engine, ident.DID.AtIdentifier(), cctx.Int("limit"), since)
+		if err != nil {
+			return err
+		}
+		if newest != "" {
+			fmt.Println(newest)
+		}
+		return nil
 	},
 }
 
 var captureRecentCmd = &cli.Command{
 	Name:      "capture-recent",
-	Usage:     "fetch account metadata and recent posts for an account, dump JSON to stdout",
+	Usage:     "fetch account metadata and recent posts for an account, dump JSON to stdout (or a file)",
 	ArgsUsage: `<at-identifier>`,
 	Flags: []cli.Flag{
 		&cli.IntFlag{
@@ -448,6 +917,23 @@ var captureRecentCmd = &cli.Command{
 			Usage: "how many post records to parse",
 			Value: 20,
 		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "file path to write JSON to. default is stdout",
+		},
+		&cli.BoolFlag{
+			Name:  "compact",
+			Usage: "output compact (not indented) JSON",
+		},
+		&cli.BoolFlag{
+			Name:  "include-blobs",
+			Usage: "also download blobs (eg, images) referenced by the posts, and include them (base64-encoded) in the capture, so replay-capture can run blob rules without fetching from the PDS. blob rules which send blobs to external services (Hive, abyss) still do so on replay, if those are configured",
+		},
+		&cli.Int64Flag{
+			Name:  "max-blob-bytes",
+			Usage: "maximum total size of blobs to download with --include-blobs; any further blobs are skipped",
+			Value: 50 * 1024 * 1024,
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		ctx := context.Background()
@@ -464,18 +950,164 @@ var captureRecentCmd = &cli.Command{
 		if err != nil {
 			return err
 		}
-
-		cap, err := capture.CaptureRecent(ctx, srv.Engine, *atid, cctx.Int("limit"))
+		ident, err := resolveAccount(cctx, srv.Engine.Directory, *atid)
 		if err != nil {
 			return err
 		}
 
-		outJSON, err := json.MarshalIndent(cap, "", "  ")
+		cap, err := capture.CaptureRecent(ctx, srv.Engine, ident.DID.AtIdentifier(), cctx.Int("limit"))
 		if err != nil {
 			return err
 		}
+		if cctx.Bool("include-blobs") {
+			skipped, err := capture.CaptureBlobs(ctx, srv.Engine, cap, cctx.Int64("max-blob-bytes"))
+			if err != nil {
+				return err
+			}
+			if skipped > 0 {
+				fmt.Fprintf(os.Stderr, "skipped %d blobs (download failed, or over --max-blob-bytes)\n", skipped)
+			}
+		}
+
+		var out io.Writer = os.Stdout
+		var outFile *os.File
+		outPath := cctx.String("output")
+		if outPath != "" && outPath != "-" {
+			outFile, err = os.Create(outPath)
+			if err != nil {
+				return err
+			}
+			defer outFile.Close()
+			out = outFile
+		}
+		bw := bufio.NewWriter(out)
+		enc := json.NewEncoder(bw)
+		if !cctx.Bool("compact") {
+			enc.SetIndent("", "  ")
+		}
+		if err := enc.Encode(cap); err != nil {
+			return err
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
 
-		fmt.Println(string(outJSON))
+		if outFile != nil {
+			if err := outFile.Close(); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "wrote %d records and %d blobs to %s\n", len(cap.PostRecords), len(cap.Blobs), outPath)
+		}
 		return nil
 	},
 }
+
+var backfillCmd = &cli.Command{
+	Name:      "backfill",
+	Usage:     "fetch the complete repo for an account and process every record",
+	ArgsUsage: `<at-identifier>`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "collections",
+			Usage: "comma-separated list of record collections (NSIDs) to process. default is all collections",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := context.Background()
+		idArg := cctx.Args().First()
+		if idArg == "" {
+			return fmt.Errorf("expected a single AT identifier (handle or DID) argument")
+		}
+		atid, err := syntax.ParseAtIdentifier(idArg)
+		if err != nil {
+			return fmt.Errorf("not a valid handle or DID: %v", err)
+		}
+		collections, err := parseCollections(cctx.String("collections"))
+		if err != nil {
+			return err
+		}
+
+		srv, err := configEphemeralServer(cctx)
+		if err != nil {
+			return err
+		}
+		ident, err := resolveAccount(cctx, srv.Engine.Directory, *atid)
+		if err != nil {
+			return err
+		}
+
+		stats, err := capture.FetchAndProcessRepo(ctx, srv.Engine, ident.DID.AtIdentifier(), collections)
+		if err != nil && stats == nil {
+			return err
+		}
+
+		fmt.Printf("backfill %s: processed=%d failed=%d skipped=%d\n", stats.DID, stats.TotalProcessed(), stats.TotalFailed(), stats.Skipped)
+		for nsid, count := range stats.Processed {
+			fmt.Printf("  %s: processed=%d failed=%d\n", nsid, count, stats.Failed[nsid])
+		}
+		for nsid, count := range stats.Failed {
+			if _, ok := stats.Processed[nsid]; !ok {
+				fmt.Printf("  %s: processed=0 failed=%d\n", nsid, count)
+			}
+		}
+		rules := make([]string, 0, len(stats.RuleFirings))
+		for name := range stats.RuleFirings {
+			rules = append(rules, name)
+		}
+		sort.Strings(rules)
+		for _, name := range rules {
+			fmt.Printf("  rule %s: fired on %d records\n", name, stats.RuleFirings[name])
+		}
+		return err
+	},
+}
+
+// parses a comma-separated list of NSIDs. an empty string results in an empty list
+func parseCollections(raw string) ([]syntax.NSID, error) {
+	var out []syntax.NSID
+	for _, s := range strings.Split(raw, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		nsid, err := syntax.ParseNSID(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid collection NSID %q: %w", s, err)
+		}
+		out = append(out, nsid)
+	}
+	return out, nil
+}
+
+var replayCaptureCmd = &cli.Command{
+	Name:        "replay-capture",
+	Usage:       "process records from a capture JSON file (from capture-recent), using the captured identity and account metadata",
+	ArgsUsage:   `<capture-json-path>`,
+	Description: `Replays run in dry-run mode with in-process state, and blobs are served from the capture (if it was made with --include-blobs), but replays are not fully offline: blob rules which call external services (Hive, abyss) still send the captured blobs to them, if they are configured (--hiveai-api-token, or --abyss-host and --abyss-password, including from environment variables). Unset those for a replay without network calls.`,
+	Flags:       []cli.Flag{},
+	Action: func(cctx *cli.Context) error {
+		ctx := context.Background()
+		capPath := cctx.Args().First()
+		if capPath == "" {
+			return fmt.Errorf("expected a single capture JSON file path argument")
+		}
+
+		f, err := os.Open(capPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		var cap capture.AccountCapture
+		if err := json.NewDecoder(bufio.NewReader(f)).Decode(&cap); err != nil {
+			return fmt.Errorf("parsing capture JSON: %w", err)
+		}
+
+		// the captured account metadata is seeded in to the cache, so this needs local in-process state, instead of any shared (redis) state
+		srv, err := configEphemeralServerWith(cctx, configOffline)
+		if err != nil {
+			return err
+		}
+
+		return capture.ReplayCapture(ctx, srv.Engine, cap)
+	},
+}
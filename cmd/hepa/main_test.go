@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+)
+
+// runs loadSecretFiles with the given command-line args, returning the resulting inline value of each secret flag
+func testLoadSecretFiles(args ...string) (map[string]string, error) {
+	var flags []cli.Flag
+	for _, name := range secretFlags {
+		flags = append(flags, &cli.StringFlag{Name: name}, &cli.StringFlag{Name: name + "-file"})
+	}
+	secrets := map[string]string{}
+	app := cli.App{
+		Flags: flags,
+		Action: func(cctx *cli.Context) error {
+			if err := loadSecretFiles(cctx, slog.Default()); err != nil {
+				return err
+			}
+			for _, name := range secretFlags {
+				secrets[name] = cctx.String(name)
+			}
+			return nil
+		},
+	}
+	err := app.Run(append([]string{"hepa"}, args...))
+	return secrets, err
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	assert.NoError(os.WriteFile(tokenFile, []byte("file-secret\n"), 0600))
+	emptyFile := filepath.Join(dir, "empty")
+	assert.NoError(os.WriteFile(emptyFile, []byte(" \n"), 0600))
+
+	// inline values are passed through when there is no file
+	secrets, err := testLoadSecretFiles("--ozone-admin-token", "inline-secret")
+	assert.NoError(err)
+	assert.Equal("inline-secret", secrets["ozone-admin-token"])
+	assert.Equal("", secrets["pds-admin-token"])
+
+	// the file is read (with surrounding whitespace trimmed), and takes precedence over an inline value
+	secrets, err = testLoadSecretFiles("--ozone-admin-token", "inline-secret", "--ozone-admin-token-file", tokenFile, "--admin-token-file", tokenFile)
+	assert.NoError(err)
+	assert.Equal("file-secret", secrets["ozone-admin-token"])
+	assert.Equal("file-secret", secrets["admin-token"])
+
+	// a missing or empty file is an error, not silently ignored
+	_, err = testLoadSecretFiles("--pds-admin-token-file", filepath.Join(dir, "missing"))
+	assert.ErrorIs(err, os.ErrNotExist)
+	assert.ErrorContains(err, "--pds-admin-token-file")
+	_, err = testLoadSecretFiles("--pds-admin-token-file", emptyFile)
+	assert.ErrorContains(err, "--pds-admin-token-file is empty")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/time/rate"
+)
+
+var ozoneThrottledCount = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "hepa_ozone_requests_throttled",
+	Help: "Number of ozone API requests delayed by the client-side rate limiter",
+})
+
+var ozoneRetryCount = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "hepa_ozone_requests_retried",
+	Help: "Number of ozone API request retries (after 429 responses, connection failures, or 5xx responses to read requests)",
+})
+
+// http.RoundTripper which waits on a rate limiter before every request
+type rateLimitedTransport struct {
+	limiter *rate.Limiter
+	inner   http.RoundTripper
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.limiter.Allow() {
+		ozoneThrottledCount.Inc()
+		if err := t.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	return t.inner.RoundTrip(req)
+}
+
+// Returns an HTTP client for the ozone API, using the shared connection pool, with a client-side rate limit (requests per second; zero or negative for no limit), and retries with backoff (see ozoneRetryPolicy).
+//
+// Unlike util.RobustHTTPClient, 429 responses are retried. Retry delays honor the Retry-After response header when present.
+func ozoneHTTPClient(ratePerSec int, hc *HTTPClientConfig) *http.Client {
+	var transport http.RoundTripper = hc.Transport()
+	if ratePerSec > 0 {
+		transport = &rateLimitedTransport{
+			limiter: rate.NewLimiter(rate.Limit(ratePerSec), 1),
+			inner:   transport,
+		}
+	}
+
+	retryClient := retryablehttp.NewClient()
+	retryClient.HTTPClient.Transport = otelhttp.NewTransport(transport)
+	retryClient.RetryMax = 5
+	retryClient.RetryWaitMin = 1 * time.Second
+	retryClient.RetryWaitMax = 30 * time.Second
+	// retries are logged (and counted) by the hook below, instead of by the retry client
+	retryClient.Logger = nil
+	retryClient.CheckRetry = ozoneRetryPolicy
+	retryClient.Backoff = retryablehttp.DefaultBackoff
+	retryClient.RequestLogHook = func(_ retryablehttp.Logger, req *http.Request, attempt int) {
+		if attempt > 0 {
+			ozoneRetryCount.Inc()
+			slog.Warn("retrying ozone request", "method", req.Method, "path", req.URL.Path, "attempt", attempt)
+		}
+	}
+	client := retryClient.StandardClient()
+	client.Timeout = hc.timeout(2 * time.Minute)
+	return client
+}
+
+// Retry policy for ozone API requests. Moderation events are emitted with POST requests which aren't idempotent: if the request reached ozone but the response was lost (or was a 5xx after the event was stored), a retry would create a duplicate report or takedown. So requests are only retried when they certainly weren't processed: on 429 responses, and when the connection could not be established. 5xx responses are only retried for GET requests.
+func ozoneRetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if err != nil {
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial", nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true, nil
+	}
+	if resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented && resp.Request != nil && resp.Request.Method == http.MethodGet {
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOzoneRetryPolicy(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	response := func(method string, status int) *http.Response {
+		return &http.Response{StatusCode: status, Request: &http.Request{Method: method}}
+	}
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+
+	testCases := []struct {
+		name  string
+		resp  *http.Response
+		err   error
+		retry bool
+	}{
+		{name: "POST ok", resp: response(http.MethodPost, http.StatusOK), retry: false},
+		{name: "POST rate-limited", resp: response(http.MethodPost, http.StatusTooManyRequests), retry: true},
+		{name: "POST server error", resp: response(http.MethodPost, http.StatusBadGateway), retry: false},
+		{name: "GET server error", resp: response(http.MethodGet, http.StatusBadGateway), retry: true},
+		{name: "GET not implemented", resp: response(http.MethodGet, http.StatusNotImplemented), retry: false},
+		{name: "GET bad request", resp: response(http.MethodGet, http.StatusBadRequest), retry: false},
+		{name: "dial error", err: dialErr, retry: true},
+		{name: "read error", err: readErr, retry: false},
+		{name: "other error", err: errors.New("unexpected EOF"), retry: false},
+	}
+	for _, tc := range testCases {
+		retry, err := ozoneRetryPolicy(ctx, tc.resp, tc.err)
+		assert.NoError(err, tc.name)
+		assert.Equal(tc.retry, retry, tc.name)
+	}
+
+	// cancelled requests are never retried
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	retry, err := ozoneRetryPolicy(cancelled, nil, dialErr)
+	assert.False(retry)
+	assert.ErrorIs(err, context.Canceled)
+}
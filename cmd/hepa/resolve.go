@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/urfave/cli/v2"
+)
+
+// resolveAccount resolves an AT identifier passed on the command line. If a handle fails to resolve, each handle resolution method is re-tried directly (bypassing any identity cache), and the returned error describes what was tried and what failed, instead of just the generic directory error.
+func resolveAccount(cctx *cli.Context, dir identity.Directory, atid syntax.AtIdentifier) (*identity.Identity, error) {
+	ctx := cctx.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return lookupAccount(ctx, dir, atid, func() (*identity.BaseDirectory, error) {
+		return configBaseDirectory(cctx, configHTTPClient(cctx))
+	})
+}
+
+// lookupAccount is resolveAccount, with the (uncached) base directory used to explain handle failures configured by baseDirectory
+func lookupAccount(ctx context.Context, dir identity.Directory, atid syntax.AtIdentifier, baseDirectory func() (*identity.BaseDirectory, error)) (*identity.Identity, error) {
+	ident, err := dir.Lookup(ctx, atid)
+	if err == nil {
+		return ident, nil
+	}
+	handle, herr := atid.AsHandle()
+	if herr != nil {
+		return nil, fmt.Errorf("could not resolve DID %s: %w", atid, err)
+	}
+	baseDir, derr := baseDirectory()
+	if derr != nil {
+		return nil, fmt.Errorf("could not resolve handle %s: %w", handle, err)
+	}
+	return nil, explainHandleFailure(ctx, baseDir, handle.Normalize(), err)
+}
+
+// explainHandleFailure returns an error for a failed handle lookup, with details of each resolution method attempted, and a hint about what to check
+func explainHandleFailure(ctx context.Context, dir *identity.BaseDirectory, handle syntax.Handle, lookupErr error) error {
+	details := []string{}
+	if errors.Is(lookupErr, identity.ErrHandleReservedTLD) || !handle.AllowedTLD() {
+		details = append(details, fmt.Sprintf("handles under the %q top-level domain are reserved, and never resolve", handle.TLD()))
+		return handleError(handle, lookupErr, details)
+	}
+
+	order := dir.HandleResolutionOrder
+	if len(order) == 0 {
+		order = identity.DefaultHandleResolutionOrder
+	}
+	var resolved syntax.DID
+	for _, method := range order {
+		var did syntax.DID
+		var err error
+		var desc string
+		switch method {
+		case identity.HandleResolutionDNS:
+			desc = fmt.Sprintf("DNS TXT record _atproto.%s", handle)
+			if dir.SkipDNS(handle) {
+				details = append(details, desc+": skipped (domain suffix configured with --identity-skip-dns-suffix)")
+				continue
+			}
+			did, err = dir.ResolveHandleDNS(ctx, handle)
+			if errors.Is(err, identity.ErrHandleNotFound) && dir.TryAuthoritativeDNS {
+				desc += " (including authoritative nameserver)"
+				did, err = dir.ResolveHandleDNSAuthoritative(ctx, handle)
+			}
+		case identity.HandleResolutionHTTP:
+			desc = fmt.Sprintf("HTTPS https://%s/.well-known/atproto-did", handle)
+			did, err = dir.ResolveHandleWellKnown(ctx, handle)
+		default:
+			continue
+		}
+		switch {
+		case err == nil:
+			details = append(details, fmt.Sprintf("%s: found %s", desc, did))
+			if resolved == "" {
+				resolved = did
+			}
+		case errors.Is(err, identity.ErrHandleNotFound):
+			details = append(details, desc+": not found")
+		default:
+			details = append(details, fmt.Sprintf("%s: %v", desc, err))
+		}
+	}
+
+	if resolved == "" {
+		details = append(details, fmt.Sprintf("hint: the handle needs either a DNS TXT record at _atproto.%s with the value \"did=<DID>\", or an HTTPS response at https://%s/.well-known/atproto-did containing only the DID", handle, handle))
+		return handleError(handle, lookupErr, details)
+	}
+
+	// the handle resolved to a DID; the failure was in the DID document, or bi-directional verification
+	ident, err := dir.LookupDID(ctx, resolved)
+	if err != nil {
+		details = append(details, fmt.Sprintf("resolving DID %s failed: %v", resolved, err))
+		return handleError(handle, lookupErr, details)
+	}
+	declared, err := ident.DeclaredHandle()
+	if err != nil {
+		details = append(details, fmt.Sprintf("DID document for %s does not declare a handle (the handle and DID must point to each other)", resolved))
+	} else if declared != handle {
+		details = append(details, fmt.Sprintf("DID document for %s declares the handle %s, not %s (the handle and DID must point to each other)", resolved, declared, handle))
+	} else {
+		details = append(details, "handle resolves correctly when re-tried; the failure may have been transient, or a cached negative result (see --identity-negative-ttl)")
+	}
+	return handleError(handle, lookupErr, details)
+}
+
+// errors are logged on a single line, so the details are joined with semicolons
+func handleError(handle syntax.Handle, err error, details []string) error {
+	return fmt.Errorf("could not resolve handle %s: %w; %s", handle, err, strings.Join(details, "; "))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// http.RoundTripper which serves fixed response bodies by URL, and 404 for anything else
+type testHTTPTransport map[string]string
+
+func (t testHTTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, ok := t[req.URL.String()]
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusNotFound
+	}
+	return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+}
+
+// starts a DNS server which answers TXT queries from txt (by name), and NXDOMAIN for any other name. returns its address
+func testDNSServer(t *testing.T, txt map[string][]string) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var p dnsmessage.Parser
+			hdr, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: hdr.ID, Response: true, Authoritative: true, RecursionAvailable: true},
+				Questions: []dnsmessage.Question{q},
+			}
+			vals, ok := txt[strings.TrimSuffix(q.Name.String(), ".")]
+			if !ok {
+				resp.Header.RCode = dnsmessage.RCodeNameError
+			} else if q.Type == dnsmessage.TypeTXT {
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.TXTResource{TXT: vals},
+				})
+			}
+			out, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			pc.WriteTo(out, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func testDIDDoc(did, handle string) string {
+	return `{"id":"` + did + `","alsoKnownAs":["at://` + handle + `"]}`
+}
+
+func TestLookupAccount(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dnsAddr := testDNSServer(t, map[string][]string{
+		"_atproto.alice.example.com": {"did=did:plc:abc111"},
+	})
+	baseDir := &identity.BaseDirectory{
+		PLCURL: "https://plc.test",
+		HTTPClient: http.Client{Transport: testHTTPTransport{
+			"https://bob.example.com/.well-known/atproto-did": "did:plc:bbb222",
+			"https://plc.test/did:plc:abc111":                 testDIDDoc("did:plc:abc111", "alice.example.com"),
+			"https://plc.test/did:plc:bbb222":                 testDIDDoc("did:plc:bbb222", "someone.example.com"),
+		}},
+		SkipDNSDomainSuffixes: []string{".skip.example.com"},
+	}
+	baseDir.Resolver.PreferGo = true
+	baseDir.Resolver.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "udp", dnsAddr)
+	}
+
+	// the "cached" directory, which knows about one account, and fails all other lookups
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:ccc333"), Handle: syntax.Handle("carol.example.com")})
+	explained := 0
+	lookup := func(raw string) (*identity.Identity, error) {
+		return lookupAccount(ctx, &dir, syntax.AtIdentifier{Inner: syntax.Handle(raw)}, func() (*identity.BaseDirectory, error) {
+			explained++
+			return baseDir, nil
+		})
+	}
+
+	// successful lookups don't go to the base directory
+	ident, err := lookup("carol.example.com")
+	assert.NoError(err)
+	assert.Equal(syntax.DID("did:plc:ccc333"), ident.DID)
+	did, err := syntax.ParseAtIdentifier("did:plc:zzz999")
+	assert.NoError(err)
+	_, err = lookupAccount(ctx, &dir, *did, func() (*identity.BaseDirectory, error) {
+		explained++
+		return baseDir, nil
+	})
+	assert.ErrorIs(err, identity.ErrDIDNotFound)
+	assert.ErrorContains(err, "could not resolve DID did:plc:zzz999")
+	assert.Equal(0, explained)
+
+	testCases := []struct {
+		handle  string
+		details []string
+	}{
+		{
+			// resolves fine without the cache
+			handle:  "alice.example.com",
+			details: []string{"DNS TXT record _atproto.alice.example.com: found did:plc:abc111", "not found", "handle resolves correctly when re-tried"},
+		},
+		{
+			// resolves, but the DID document doesn't point back
+			handle:  "bob.example.com",
+			details: []string{"DNS TXT record _atproto.bob.example.com: not found", "atproto-did: found did:plc:bbb222", "declares the handle someone.example.com, not bob.example.com"},
+		},
+		{
+			handle:  "dan.example.com",
+			details: []string{"DNS TXT record _atproto.dan.example.com: not found", "https://dan.example.com/.well-known/atproto-did: not found", "hint:"},
+		},
+		{
+			handle:  "erin.skip.example.com",
+			details: []string{"DNS TXT record _atproto.erin.skip.example.com: skipped", "hint:"},
+		},
+		{
+			handle:  "frank.invalid",
+			details: []string{`handles under the "invalid" top-level domain are reserved`},
+		},
+	}
+	for _, tc := range testCases {
+		_, err := lookup(tc.handle)
+		assert.ErrorIs(err, identity.ErrHandleNotFound, tc.handle)
+		if err == nil {
+			continue
+		}
+		assert.True(strings.HasPrefix(err.Error(), "could not resolve handle "+tc.handle), tc.handle)
+		for _, d := range tc.details {
+			assert.Contains(err.Error(), d, tc.handle)
+		}
+	}
+	assert.Equal(len(testCases), explained)
+
+	// if the base directory can't be configured, the lookup error is returned as-is
+	_, err = lookupAccount(ctx, &dir, syntax.AtIdentifier{Inner: syntax.Handle("dan.example.com")}, func() (*identity.BaseDirectory, error) {
+		return nil, errors.New("bad config")
+	})
+	assert.ErrorIs(err, identity.ErrHandleNotFound)
+	assert.Equal("could not resolve handle dan.example.com: handle not found", err.Error())
+}
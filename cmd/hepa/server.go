@@ -3,27 +3,32 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/identity/redisdir"
 	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/actionsink"
 	"github.com/bluesky-social/indigo/automod/cachestore"
+	"github.com/bluesky-social/indigo/automod/consumer"
 	"github.com/bluesky-social/indigo/automod/countstore"
 	"github.com/bluesky-social/indigo/automod/engine"
 	"github.com/bluesky-social/indigo/automod/flagstore"
 	"github.com/bluesky-social/indigo/automod/rules"
 	"github.com/bluesky-social/indigo/automod/setstore"
 	"github.com/bluesky-social/indigo/automod/visual"
-	"github.com/bluesky-social/indigo/util"
 	"github.com/bluesky-social/indigo/xrpc"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
 )
 
 type Server struct {
@@ -32,36 +37,80 @@ type Server struct {
 
 	relayHost           string // DEPRECATED
 	firehoseParallelism int    // DEPRECATED
+	firehoseSource      string
+	jetstreamHost       string
+	collections         []syntax.NSID
+	sets                *setstore.ReloadableSetStore
+	setsFileJSON        string
+	adminToken          string
 	logger              *slog.Logger
 }
 
 type Config struct {
 	Logger              *slog.Logger
 	RelayHost           string // DEPRECATED
+	FirehoseSource      string // "relay" (default) or "jetstream"
+	JetstreamHost       string
+	Collections         []string // if non-empty, only process records in these collections (NSIDs)
+	PLCHost             string
 	BskyHost            string
 	OzoneHost           string
 	OzoneDID            string
 	OzoneAdminToken     string
+	OzoneRateLimit      int // max requests per second to ozone; zero for no limit
 	PDSHost             string
 	PDSAdminToken       string
 	SetsFileJSON        string
 	RedisURL            string
-	SlackWebhookURL     string
+	SlackWebhookURL     string // DEPRECATED: equivalent to NotifyWebhookURL with NotifyWebhookKind "slack"
+	NotifyWebhookURL    string
+	NotifyWebhookKind   string // "slack" (default), "discord", or "webhook"
+	NotifyService       string // service name (as requested by rules) delivered by discord and webhook notifiers. Defaults to the webhook kind
 	HiveAPIToken        string
 	AbyssHost           string
 	AbyssPassword       string
+	AbyssCacheTTL       time.Duration // how long to cache abyss scan results by blob CID; zero disables caching
 	RulesetName         string
+	RulesetFile         string // optional declarative ruleset JSON file, added to the named ruleset
 	RatelimitBypass     string
 	FirehoseParallelism int // DEPRECATED
 	PreScreenHost       string
 	PreScreenToken      string
 	ReportDupePeriod    time.Duration
+	ActionDedupeWindow  time.Duration // identical moderation actions within this period are suppressed; zero disables
 	QuotaModReportDay   int
 	QuotaModTakedownDay int
 	QuotaModActionDay   int
+	DryRun              bool
+	AdminToken          string            // enables admin HTTP endpoints (eg, /admin/reprocess) when set
+	AuditLogPath        string            // if set, every rule firing is appended to this file as a JSON line ("-" for stdout)
+	AuditLogBuffer      int               // max audit entries buffered in memory before dropping; defaults to 1000
+	ActionSink          string            // where moderation actions are sent: "ozone" (default; directly to the mod service) or "nats"
+	NATSURL             string            // NATS server URL(s), for the "nats" action sink
+	NATSSubject         string            // NATS subject prefix for the "nats" action sink; the event kind ("account" or "record") is appended
+	HTTPClient          *HTTPClientConfig // shared HTTP client config for backend calls; defaults used if nil. should be the same config passed to configDirectory, so the connection pool is shared
+}
+
+// Backend API clients used by the engine, which can be injected with NewServerWithClients.
+//
+// These are the concrete client types the engine itself holds, not interfaces. To fake a backend (eg, in tests), either point a client's Host at a mock server (eg, httptest), or set its underlying *http.Client's Transport to a stub http.RoundTripper: the transport is the injection seam for individual requests. Injected clients are used as-is, without the rate limiting, retries, or ratelimit-bypass header that are added to clients configured from Config.
+type ServerClients struct {
+	// mod service (ozone) client, with admin auth; used to persist moderation actions
+	Ozone *xrpc.Client
+	// PDS (or entryway) client, with admin auth; used to fetch private account metadata
+	Admin *xrpc.Client
+	// public bsky API (appview) client; no auth
+	Bsky *xrpc.Client
+	// used to fetch blobs
+	Blob *http.Client
 }
 
 func NewServer(dir identity.Directory, config Config) (*Server, error) {
+	return NewServerWithClients(dir, config, ServerClients{})
+}
+
+// Same as NewServer, but with the given backend API clients instead of configuring them from the host, token, etc, config. Any nil clients are configured from config, same as NewServer.
+func NewServerWithClients(dir identity.Directory, config Config, clients ServerClients) (*Server, error) {
 	logger := config.Logger
 	if logger == nil {
 		logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
@@ -74,10 +123,43 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 		return nil, fmt.Errorf("specified relay host must include 'ws://' or 'wss://'")
 	}
 
-	var ozoneClient *xrpc.Client
-	if config.OzoneAdminToken != "" && config.OzoneDID != "" {
+	firehoseSource := config.FirehoseSource
+	switch firehoseSource {
+	case "":
+		firehoseSource = "relay"
+	case "relay":
+	case "jetstream":
+		if !strings.HasPrefix(config.JetstreamHost, "ws") {
+			return nil, fmt.Errorf("specified jetstream host must include 'ws://' or 'wss://'")
+		}
+	default:
+		return nil, fmt.Errorf("unknown firehose source: %s", config.FirehoseSource)
+	}
+
+	var collections []syntax.NSID
+	for _, raw := range config.Collections {
+		nsid, err := syntax.ParseNSID(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid collection NSID %q: %w", raw, err)
+		}
+		collections = append(collections, nsid)
+	}
+
+	if config.DryRun {
+		logger.Warn("DRY RUN: moderation actions will be logged, not sent to the mod service")
+	}
+
+	httpConf := config.HTTPClient
+	if httpConf == nil {
+		httpConf = &HTTPClientConfig{}
+	}
+
+	ozoneClient := clients.Ozone
+	if ozoneClient != nil {
+		logger.Info("using injected ozone client", "ozoneHost", ozoneClient.Host)
+	} else if config.OzoneAdminToken != "" && config.OzoneDID != "" {
 		ozoneClient = &xrpc.Client{
-			Client:     util.RobustHTTPClient(),
+			Client:     ozoneHTTPClient(config.OzoneRateLimit, httpConf),
 			Host:       config.OzoneHost,
 			AdminToken: &config.OzoneAdminToken,
 			Auth:       &xrpc.AuthInfo{},
@@ -91,15 +173,17 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 			return nil, fmt.Errorf("ozone account DID supplied was not valid: %v", err)
 		}
 		ozoneClient.Auth.Did = od.String()
-		logger.Info("configured ozone admin client", "did", od.String(), "ozoneHost", config.OzoneHost)
+		logger.Info("configured ozone admin client", "did", od.String(), "ozoneHost", config.OzoneHost, "rateLimit", config.OzoneRateLimit)
 	} else {
 		logger.Info("did not configure ozone client")
 	}
 
-	var adminClient *xrpc.Client
-	if config.PDSAdminToken != "" {
+	adminClient := clients.Admin
+	if adminClient != nil {
+		logger.Info("using injected PDS admin client", "pdsHost", adminClient.Host)
+	} else if config.PDSAdminToken != "" {
 		adminClient = &xrpc.Client{
-			Client:     util.RobustHTTPClient(),
+			Client:     httpConf.robustClient(),
 			Host:       config.PDSHost,
 			AdminToken: &config.PDSAdminToken,
 			Auth:       &xrpc.AuthInfo{},
@@ -113,14 +197,15 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 		logger.Info("did not configure PDS admin client")
 	}
 
-	sets := setstore.NewMemSetStore()
+	memSets := setstore.NewMemSetStore()
 	if config.SetsFileJSON != "" {
-		if err := sets.LoadFromFileJSON(config.SetsFileJSON); err != nil {
+		if err := memSets.LoadFromFileJSON(config.SetsFileJSON); err != nil {
 			return nil, fmt.Errorf("initializing in-process setstore: %v", err)
 		} else {
 			logger.Info("loaded set config from JSON", "path", config.SetsFileJSON)
 		}
 	}
+	sets := setstore.NewReloadableSetStore(memSets)
 
 	var counters countstore.CountStore
 	var cache cachestore.CacheStore
@@ -162,9 +247,24 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 		flags = flagstore.NewMemFlagStore()
 	}
 
+	var actionDedupe cachestore.ClaimStore
+	if config.ActionDedupeWindow > 0 {
+		if config.RedisURL != "" {
+			csh, err := cachestore.NewRedisClaimStore(config.RedisURL)
+			if err != nil {
+				return nil, fmt.Errorf("initializing redis action de-dupe claimstore: %v", err)
+			}
+			actionDedupe = csh
+		} else {
+			actionDedupe = cachestore.NewMemClaimStore(50_000, config.ActionDedupeWindow)
+		}
+	}
+
 	// IMPORTANT: reminder that these are the indigo-edition rules, not production rules
+	// blob scanning clients are only configured if the ruleset will actually use them
 	extraBlobRules := []automod.BlobRuleFunc{}
-	if config.HiveAPIToken != "" && config.RulesetName != "no-hive" {
+	blobsDisabled := config.RulesetName == "no-blobs"
+	if config.HiveAPIToken != "" && config.RulesetName != "no-hive" && !blobsDisabled {
 		logger.Info("configuring Hive AI image labeler")
 		hc := visual.NewHiveAIClient(config.HiveAPIToken)
 		extraBlobRules = append(extraBlobRules, hc.HiveLabelBlobRule)
@@ -175,66 +275,115 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 		}
 	}
 
-	if config.AbyssHost != "" && config.AbyssPassword != "" {
+	if config.AbyssHost != "" && config.AbyssPassword != "" && !blobsDisabled {
 		logger.Info("configuring abyss abusive image scanning")
 		ac := visual.NewAbyssClient(config.AbyssHost, config.AbyssPassword, config.RatelimitBypass)
+		if config.AbyssCacheTTL > 0 {
+			if config.RedisURL != "" {
+				csh, err := cachestore.NewRedisCacheStore(config.RedisURL, config.AbyssCacheTTL)
+				if err != nil {
+					return nil, fmt.Errorf("initializing redis abyss cachestore: %v", err)
+				}
+				ac.Cache = csh
+			} else {
+				ac.Cache = cachestore.NewMemCacheStore(50_000, config.AbyssCacheTTL)
+			}
+		}
 		extraBlobRules = append(extraBlobRules, ac.AbyssScanBlobRule)
 	}
 
-	var ruleset automod.RuleSet
-	switch config.RulesetName {
-	case "", "default", "no-hive":
-		ruleset = rules.DefaultRules()
-		ruleset.BlobRules = append(ruleset.BlobRules, extraBlobRules...)
-	case "no-blobs":
-		ruleset = rules.DefaultRules()
-		ruleset.BlobRules = []automod.BlobRuleFunc{}
-	case "only-blobs":
-		ruleset.BlobRules = extraBlobRules
-	default:
-		return nil, fmt.Errorf("unknown ruleset config: %s", config.RulesetName)
+	ruleset, err := configRuleset(config.RulesetName, extraBlobRules)
+	if err != nil {
+		return nil, err
+	}
+	if !ruleset.NeedsBlobs() {
+		logger.Info("ruleset has no blob rules; blobs will not be fetched")
+	}
+	if config.RulesetFile != "" {
+		drs, err := rules.LoadDeclarativeRuleset(config.RulesetFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading ruleset file (%s): %w", config.RulesetFile, err)
+		}
+		ruleset.PostRules = append(ruleset.PostRules, drs.PostRule)
+		ruleset.ProfileRules = append(ruleset.ProfileRules, drs.ProfileRule)
+		logger.Info("loaded declarative ruleset file", "path", config.RulesetFile, "rules", len(drs.Rules))
 	}
 
-	var notifier automod.Notifier
-	if config.SlackWebhookURL != "" {
-		notifier = &automod.SlackNotifier{
-			SlackWebhookURL: config.SlackWebhookURL,
+	notifier, err := configNotifier(config)
+	if err != nil {
+		return nil, err
+	}
+
+	actionSink, err := configActionSink(config)
+	if err != nil {
+		return nil, err
+	}
+	if actionSink != nil {
+		logger.Info("publishing moderation actions to sink", "sink", config.ActionSink)
+	}
+
+	var auditLog *automod.AuditLogger
+	if config.AuditLogPath != "" {
+		sink, err := engine.NewFileAuditSink(config.AuditLogPath)
+		if err != nil {
+			return nil, err
 		}
+		auditLog = engine.NewAuditLogger(sink, config.AuditLogBuffer, logger.With("subsystem", "audit"))
+		logger.Info("writing rule audit log", "path", config.AuditLogPath)
 	}
 
-	bskyClient := xrpc.Client{
-		Client: util.RobustHTTPClient(),
-		Host:   config.BskyHost,
+	bskyClient := clients.Bsky
+	if bskyClient == nil {
+		bskyClient = &xrpc.Client{
+			Client: httpConf.robustClient(),
+			Host:   config.BskyHost,
+		}
+		if config.RatelimitBypass != "" {
+			bskyClient.Headers = make(map[string]string)
+			bskyClient.Headers["x-ratelimit-bypass"] = config.RatelimitBypass
+		}
 	}
-	if config.RatelimitBypass != "" {
-		bskyClient.Headers = make(map[string]string)
-		bskyClient.Headers["x-ratelimit-bypass"] = config.RatelimitBypass
+	blobClient := clients.Blob
+	if blobClient == nil {
+		blobClient = httpConf.robustClient()
 	}
-	blobClient := util.RobustHTTPClient()
 	engine := automod.Engine{
-		Logger:      logger,
-		Directory:   dir,
-		Counters:    counters,
-		Sets:        sets,
-		Flags:       flags,
-		Cache:       cache,
-		Rules:       ruleset,
-		Notifier:    notifier,
-		BskyClient:  &bskyClient,
-		OzoneClient: ozoneClient,
-		AdminClient: adminClient,
-		BlobClient:  blobClient,
+		Logger:       logger,
+		Directory:    dir,
+		Counters:     counters,
+		Sets:         sets,
+		Flags:        flags,
+		Cache:        cache,
+		Rules:        ruleset,
+		Notifier:     notifier,
+		AuditLog:     auditLog,
+		ActionSink:   actionSink,
+		ActionDedupe: actionDedupe,
+		BskyClient:   bskyClient,
+		OzoneClient:  ozoneClient,
+		AdminClient:  adminClient,
+		BlobClient:   blobClient,
+		PLCLimiter:   directoryPLCLimiter(dir),
 		Config: engine.EngineConfig{
 			ReportDupePeriod:    config.ReportDupePeriod,
+			ActionDedupeWindow:  config.ActionDedupeWindow,
 			QuotaModReportDay:   config.QuotaModReportDay,
 			QuotaModTakedownDay: config.QuotaModTakedownDay,
 			QuotaModActionDay:   config.QuotaModActionDay,
+			DryRun:              config.DryRun,
+			PLCHost:             config.PLCHost,
 		},
 	}
 
 	s := &Server{
 		relayHost:           config.RelayHost,
 		firehoseParallelism: config.FirehoseParallelism,
+		firehoseSource:      firehoseSource,
+		jetstreamHost:       config.JetstreamHost,
+		collections:         collections,
+		sets:                sets,
+		setsFileJSON:        config.SetsFileJSON,
+		adminToken:          config.AdminToken,
 		logger:              logger,
 		Engine:              &engine,
 		RedisClient:         rdb,
@@ -243,7 +392,184 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 	return s, nil
 }
 
+// Re-reads the static sets JSON file (if configured), and atomically replaces the engine's sets. If the file fails to load, the existing sets are kept.
+func (s *Server) ReloadSets() error {
+	if s.setsFileJSON == "" {
+		return fmt.Errorf("no sets JSON file configured")
+	}
+	next := setstore.NewMemSetStore()
+	if err := next.LoadFromFileJSON(s.setsFileJSON); err != nil {
+		return fmt.Errorf("reloading sets JSON file (keeping existing sets): %w", err)
+	}
+	s.sets.Swap(next)
+	s.logger.Info("reloaded set config from JSON", "path", s.setsFileJSON, "sizes", next.Sizes())
+	return nil
+}
+
+func configNotifier(config Config) (automod.Notifier, error) {
+	webhookURL := config.NotifyWebhookURL
+	kind := config.NotifyWebhookKind
+	if webhookURL == "" && config.SlackWebhookURL != "" {
+		webhookURL = config.SlackWebhookURL
+		kind = "slack"
+	}
+	if webhookURL == "" {
+		return nil, nil
+	}
+	switch kind {
+	case "", "slack":
+		return &automod.SlackNotifier{SlackWebhookURL: webhookURL}, nil
+	case "discord":
+		return &automod.DiscordNotifier{DiscordWebhookURL: webhookURL, Service: config.NotifyService}, nil
+	case "webhook":
+		return &automod.WebhookNotifier{WebhookURL: webhookURL, Service: config.NotifyService}, nil
+	default:
+		return nil, fmt.Errorf("unknown notification webhook kind: %s", kind)
+	}
+}
+
+// returns nil for the default "ozone" sink, in which case actions are sent directly to the mod service
+func configActionSink(config Config) (automod.ActionSink, error) {
+	switch config.ActionSink {
+	case "", "ozone":
+		return nil, nil
+	case "nats":
+		return actionsink.NewNATSActionSink(config.NATSURL, config.NATSSubject)
+	default:
+		return nil, fmt.Errorf("unknown action sink: %s", config.ActionSink)
+	}
+}
+
+// Options for Server.Run, which only apply to the long-running daemon
+type RunConfig struct {
+	// size of the queue between the firehose connection and the event processing workers
+	FirehoseQueueSize int
+	// if not nil, start from this cursor instead of the persisted one
+	StartCursor *int64
+	// if true, the cursor is not persisted during the run
+	ReadOnlyCursor bool
+}
+
+// Run consumes events from the configured firehose source, and from the ozone event stream (if an ozone client is configured), until ctx is cancelled or the firehose consumer fails.
+//
+// Before returning, the final cursors are persisted, and the audit log and action sink (if any) are flushed and closed.
+func (s *Server) Run(ctx context.Context, rc RunConfig) error {
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		if s.Engine.AuditLog != nil {
+			if err := s.Engine.AuditLog.Close(); err != nil {
+				s.logger.Error("failed to close audit log", "err", err)
+			}
+		}
+		if closer, ok := s.Engine.ActionSink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				s.logger.Error("failed to close action sink", "err", err)
+			}
+		}
+	}()
+	// if the firehose consumer fails, the other routines are stopped too
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	goRun := func(desc string, f func(context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f(ctx); err != nil {
+				s.logger.Error(desc+" failed", "err", err)
+			}
+		}()
+	}
+
+	// ozone event consumer (if configured)
+	if s.Engine.OzoneClient != nil {
+		oc := consumer.OzoneConsumer{
+			Logger:      s.logger.With("subsystem", "ozone-consumer"),
+			RedisClient: s.RedisClient,
+			OzoneClient: s.Engine.OzoneClient,
+			Engine:      s.Engine,
+		}
+		goRun("ozone consumer", oc.Run)
+		goRun("ozone cursor routine", oc.RunPersistCursor)
+	}
+
+	// firehose event consumer (note this is actually mandatory)
+	switch s.firehoseSource {
+	case "jetstream":
+		jc := consumer.JetstreamConsumer{
+			Engine:         s.Engine,
+			Logger:         s.logger.With("subsystem", "jetstream-consumer"),
+			Host:           s.jetstreamHost,
+			Collections:    s.collections,
+			Parallelism:    s.firehoseParallelism,
+			RedisClient:    s.RedisClient,
+			StartCursor:    rc.StartCursor,
+			ReadOnlyCursor: rc.ReadOnlyCursor,
+		}
+		goRun("cursor routine", jc.RunPersistCursor)
+		if err := jc.Run(ctx); err != nil {
+			return fmt.Errorf("failure consuming and processing jetstream: %w", err)
+		}
+	default:
+		if s.relayHost != "" {
+			fc := consumer.FirehoseConsumer{
+				Engine:         s.Engine,
+				Logger:         s.logger.With("subsystem", "firehose-consumer"),
+				Host:           s.relayHost,
+				Collections:    s.collections,
+				Parallelism:    s.firehoseParallelism,
+				QueueSize:      rc.FirehoseQueueSize,
+				RedisClient:    s.RedisClient,
+				StartCursor:    rc.StartCursor,
+				ReadOnlyCursor: rc.ReadOnlyCursor,
+			}
+			goRun("cursor routine", fc.RunPersistCursor)
+			if err := fc.Run(ctx); err != nil {
+				return fmt.Errorf("failure consuming and processing firehose: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
 func (s *Server) RunMetrics(listen string) error {
 	http.Handle("/metrics", promhttp.Handler())
+	if s.adminToken != "" {
+		http.HandleFunc("/admin/reprocess", s.adminAuth(s.handleReprocess))
+	}
 	return http.ListenAndServe(listen, nil)
 }
+
+// Returns the named built-in ruleset, with any extra (configured) blob rules added
+func configRuleset(name string, extraBlobRules []automod.BlobRuleFunc) (automod.RuleSet, error) {
+	var ruleset automod.RuleSet
+	switch name {
+	case "", "default", "no-hive":
+		ruleset = rules.DefaultRules()
+		ruleset.BlobRules = append(ruleset.BlobRules, extraBlobRules...)
+	case "no-blobs":
+		ruleset = rules.DefaultRules()
+		ruleset.BlobRules = []automod.BlobRuleFunc{}
+	case "only-blobs":
+		ruleset.BlobRules = extraBlobRules
+	default:
+		return ruleset, fmt.Errorf("unknown ruleset config: %s", name)
+	}
+	return ruleset, nil
+}
+
+// returns the PLC rate limiter of the identity directory (unwrapping any caching layers), so that other PLC directory requests count against the same limit. returns nil if there is no limiter.
+func directoryPLCLimiter(dir identity.Directory) *rate.Limiter {
+	for {
+		switch d := dir.(type) {
+		case *identity.BaseDirectory:
+			return d.PLCLimiter
+		case *identity.CacheDirectory:
+			dir = d.Inner
+		case *redisdir.RedisDirectory:
+			dir = d.Inner
+		default:
+			return nil
+		}
+	}
+}
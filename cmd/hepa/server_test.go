@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/capture"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestServerWithClients(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// mock ozone, which records procedure calls
+	var lk sync.Mutex
+	var calls []string
+	ozone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			lk.Lock()
+			calls = append(calls, r.URL.Path)
+			lk.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ozone.Close()
+
+	dir := identity.NewMockDirectory()
+	ident := identity.Identity{
+		DID:    syntax.DID("did:plc:abc111"),
+		Handle: syntax.Handle("handle.example.com"),
+	}
+	dir.Insert(ident)
+
+	srv, err := NewServerWithClients(&dir, Config{
+		RelayHost:   "wss://relay.example.com",
+		RulesetName: "default",
+	}, ServerClients{
+		Ozone: &xrpc.Client{
+			Host: ozone.URL,
+			Auth: &xrpc.AuthInfo{Did: "did:plc:automod"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Engine.Config.SkipAccountMeta = true
+	srv.Engine.Rules = automod.RuleSet{
+		PostRules: []automod.PostRuleFunc{
+			func(c *automod.RecordContext, post *appbsky.FeedPost) error {
+				c.AddRecordLabel("spam")
+				return nil
+			},
+		},
+	}
+
+	cid1 := syntax.CID("cid123")
+	p1 := appbsky.FeedPost{Text: "some post blah"}
+	p1buf := new(bytes.Buffer)
+	assert.NoError(p1.MarshalCBOR(p1buf))
+	assert.NoError(srv.Engine.ProcessRecordOp(ctx, automod.RecordOp{
+		Action:     automod.CreateOp,
+		DID:        ident.DID,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		RecordCBOR: p1buf.Bytes(),
+	}))
+
+	assert.Equal([]string{"/xrpc/tools.ozone.moderation.emitEvent"}, calls)
+}
+
+func TestDirectoryPLCLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	limiter := rate.NewLimiter(10, 1)
+	base := identity.BaseDirectory{PLCLimiter: limiter}
+	cached := identity.NewCacheDirectory(&base, 100, time.Hour, time.Minute, time.Minute)
+	assert.Same(limiter, directoryPLCLimiter(&base))
+	assert.Same(limiter, directoryPLCLimiter(&cached))
+
+	mock := identity.NewMockDirectory()
+	assert.Nil(directoryPLCLimiter(&mock))
+}
+
+func TestReplayCaptureOffline(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var lk sync.Mutex
+	var calls []string
+	ozone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			lk.Lock()
+			calls = append(calls, r.URL.Path)
+			lk.Unlock()
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ozone.Close()
+
+	// the redis URL is never connected to
+	config := Config{
+		RelayHost:   "wss://relay.example.com",
+		RulesetName: "default",
+		RedisURL:    "redis://localhost:1/0",
+	}
+	configOffline(&config)
+	dir := identity.NewMockDirectory()
+	srv, err := NewServerWithClients(&dir, config, ServerClients{
+		Ozone: &xrpc.Client{
+			Host: ozone.URL,
+			Auth: &xrpc.AuthInfo{Did: "did:plc:automod"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(srv.RedisClient)
+	assert.True(srv.Engine.Config.DryRun)
+	srv.Engine.Rules = automod.RuleSet{
+		PostRules: []automod.PostRuleFunc{
+			func(c *automod.RecordContext, post *appbsky.FeedPost) error {
+				c.AddRecordLabel("spam")
+				c.TakedownRecord()
+				c.ReportAccount(automod.ReportReasonSpam, "replay")
+				return nil
+			},
+		},
+	}
+
+	assert.NoError(capture.ReplayCapture(ctx, srv.Engine, capture.MustLoadCapture("../../automod/capture/testdata/capture_atprotocom.json")))
+	assert.Empty(calls)
+}
+
+func TestServerRunShutdown(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// upstreams which always fail, so the consumers are stuck retrying
+	ozone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ozone.Close()
+
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	dir := identity.NewMockDirectory()
+	srv, err := NewServerWithClients(&dir, Config{
+		RelayHost:      "ws://127.0.0.1:1",
+		RulesetName:    "default",
+		AuditLogPath:   auditPath,
+		AuditLogBuffer: 10,
+	}, ServerClients{
+		Ozone: &xrpc.Client{
+			Host: ozone.URL,
+			Auth: &xrpc.AuthInfo{Did: "did:plc:automod"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- srv.Run(ctx, RunConfig{})
+	}()
+	srv.Engine.AuditLog.Log(&automod.AuditEntry{Rule: "test-rule", Subject: "did:plc:abc111"})
+
+	// cancelling (eg, on SIGTERM) stops the consumers, and flushes the audit log before returning
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	raw, err := os.ReadFile(auditPath)
+	assert.NoError(err)
+	assert.Contains(string(raw), `"rule":"test-rule"`)
+}
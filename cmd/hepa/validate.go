@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bluesky-social/indigo/automod/rules"
+	"github.com/bluesky-social/indigo/automod/setstore"
+
+	"github.com/urfave/cli/v2"
+)
+
+var validateRulesetCmd = &cli.Command{
+	Name:  "validate-ruleset",
+	Usage: "check the configured ruleset (and sets) for errors, without connecting to any services",
+	Description: `Loads the ruleset selected with --ruleset, and the declarative rules file (--ruleset-file) if configured, compiling all regexes. If a sets file is configured (--sets-json-path), also checks that every set referenced by the rules exists in it.
+
+All problems are reported (to stderr), and the command exits non-zero if there were any.`,
+	Action: func(cctx *cli.Context) error {
+		problems := validateRuleset(cctx.String("ruleset"), cctx.String("ruleset-file"), cctx.String("sets-json-path"))
+		for _, err := range problems {
+			fmt.Fprintf(os.Stderr, "ERROR\t%s\n", err)
+		}
+		if len(problems) > 0 {
+			return cli.Exit(fmt.Sprintf("ruleset validation failed: %d problem(s)", len(problems)), 1)
+		}
+		fmt.Println("ruleset OK")
+		return nil
+	},
+}
+
+// Checks a ruleset configuration, returning all problems found (not just the first)
+func validateRuleset(rulesetName, rulesetFile, setsFile string) []error {
+	var problems []error
+
+	// the ruleset config only needs to be valid here; which blob rules get added doesn't matter
+	ruleset, err := configRuleset(rulesetName, nil)
+	if err != nil {
+		problems = append(problems, fmt.Errorf("--ruleset: %w", err))
+	}
+
+	var setRefs []setReference
+	if len(ruleset.PostRules)+len(ruleset.ProfileRules)+len(ruleset.RecordRules)+len(ruleset.IdentityRules) > 0 {
+		for _, name := range rules.DefaultRulesSets {
+			setRefs = append(setRefs, setReference{name: name, source: fmt.Sprintf("built-in ruleset %q", rulesetName), builtin: true})
+		}
+	}
+
+	if rulesetFile != "" {
+		raw, err := os.ReadFile(rulesetFile)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("--ruleset-file: %w", err))
+		} else if _, err := rules.ParseDeclarativeRuleset(raw); err != nil {
+			// rule errors are joined; report each one separately
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				for _, e := range joined.Unwrap() {
+					problems = append(problems, fmt.Errorf("--ruleset-file (%s): %w", rulesetFile, e))
+				}
+			} else {
+				problems = append(problems, fmt.Errorf("--ruleset-file (%s): %w", rulesetFile, err))
+			}
+		}
+		// set references are checked even if other parts of some rules are invalid
+		var drs rules.DeclarativeRuleset
+		if err := json.Unmarshal(raw, &drs); err == nil {
+			for i, r := range drs.Rules {
+				for _, name := range r.Sets {
+					setRefs = append(setRefs, setReference{name: name, source: fmt.Sprintf("--ruleset-file (%s): rule %d (%q)", rulesetFile, i, r.Name)})
+				}
+			}
+		}
+	}
+
+	if setsFile == "" {
+		// without a sets file, all sets are empty. that is allowed for built-in rules, but a declarative rule referencing a set would never match
+		for _, ref := range setRefs {
+			if !ref.builtin {
+				problems = append(problems, fmt.Errorf("%s: references set %q, but no --sets-json-path configured", ref.source, ref.name))
+			}
+		}
+		return problems
+	}
+	sets := setstore.NewMemSetStore()
+	if err := sets.LoadFromFileJSON(setsFile); err != nil {
+		return append(problems, fmt.Errorf("--sets-json-path (%s): %w", setsFile, err))
+	}
+	for _, ref := range setRefs {
+		if _, ok := sets.Sets[ref.name]; !ok {
+			problems = append(problems, fmt.Errorf("%s: references set %q, which is not defined in %s", ref.source, ref.name, setsFile))
+		}
+	}
+	return problems
+}
+
+type setReference struct {
+	name string
+	// description of where the set was referenced, for error messages
+	source  string
+	builtin bool
+}
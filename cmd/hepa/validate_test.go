@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluesky-social/indigo/automod/rules"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRuleset(t *testing.T) {
+	assert := assert.New(t)
+	exampleSets := "../../automod/rules/example_sets.json"
+
+	// the example sets file defines every set referenced by the built-in rules
+	assert.Empty(validateRuleset("default", "", exampleSets))
+	assert.Empty(validateRuleset("no-blobs", "", ""))
+
+	// the same sets file, missing one of the built-in sets
+	raw, err := os.ReadFile(exampleSets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sets map[string][]string
+	assert.NoError(json.Unmarshal(raw, &sets))
+	for _, name := range rules.DefaultRulesSets {
+		assert.Contains(sets, name)
+	}
+	delete(sets, rules.DefaultRulesSets[0])
+	partialSets := writeTestJSON(t, "partial_sets.json", sets)
+	problems := validateRuleset("default", "", partialSets)
+	if assert.Len(problems, 1) {
+		assert.Contains(problems[0].Error(), rules.DefaultRulesSets[0])
+	}
+
+	// a bad ruleset, with an unknown built-in ruleset name, an invalid regex, a rule with no actions, and a reference to a missing set; all problems are reported
+	badRules := writeTestJSON(t, "bad_rules.json", rules.DeclarativeRuleset{Rules: []rules.DeclarativeRule{
+		{Name: "bad-regex", Type: "regex", Values: []string{"(unclosed"}, Actions: rules.DeclarativeActions{RecordFlags: []string{"flag"}}},
+		{Name: "no-actions", Type: "keyword", Values: []string{"word"}},
+		{Name: "missing-set", Type: "keyword", Sets: []string{"no-such-set"}, Actions: rules.DeclarativeActions{RecordFlags: []string{"flag"}}},
+	}})
+	problems = validateRuleset("not-a-ruleset", badRules, exampleSets)
+	assert.Len(problems, 4)
+	for i, substr := range []string{"--ruleset", "bad-regex", "no-actions", "no-such-set"} {
+		if i < len(problems) {
+			assert.Contains(problems[i].Error(), substr)
+		}
+	}
+
+	// without a sets file, set references from declarative rules are problems
+	problems = validateRuleset("default", badRules, "")
+	assert.Len(problems, 3)
+
+	problems = validateRuleset("default", filepath.Join(t.TempDir(), "missing.json"), "")
+	assert.Len(problems, 1)
+}
+
+func writeTestJSON(t *testing.T, name string, v any) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -9,7 +9,9 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
@@ -74,9 +76,15 @@ func run(args []string) error {
 			Value:   "http://localhost:9200",
 			EnvVars: []string{"ES_HOSTS", "ELASTIC_HOSTS", "OPENSEARCH_URL", "ELASTICSEARCH_URL"},
 		},
+		&cli.StringFlag{
+			Name:    "search-backend",
+			Usage:   "search cluster software: 'opensearch' or 'elasticsearch'",
+			Value:   search.SearchBackendOpenSearch,
+			EnvVars: []string{"PALOMAR_SEARCH_BACKEND"},
+		},
 		&cli.StringFlag{
 			Name:    "es-post-index",
-			Usage:   "ES index for 'post' documents",
+			Usage:   "ES index for 'post' documents. for search-only (readonly) instances, can also be a comma-separated list, or a time-sharded pattern like 'palomar_post_{month}'",
 			Value:   "palomar_post",
 			EnvVars: []string{"ES_POST_INDEX"},
 		},
@@ -86,6 +94,11 @@ func run(args []string) error {
 			Value:   "palomar_profile",
 			EnvVars: []string{"ES_PROFILE_INDEX"},
 		},
+		&cli.StringFlag{
+			Name:    "tenant",
+			Usage:   "tenant ID, for serving several tenants from one search cluster. if set, index names must include '{tenant}' (eg, 'palomar_{tenant}_post'), and are scoped to this tenant",
+			EnvVars: []string{"PALOMAR_TENANT"},
+		},
 		&cli.StringFlag{
 			Name:    "atp-relay-host",
 			Usage:   "hostname and port of Relay to subscribe to",
@@ -116,6 +129,7 @@ func run(args []string) error {
 		elasticCheckCmd,
 		searchPostCmd,
 		searchProfileCmd,
+		reindexCmd,
 	}
 
 	return app.Run(args)
@@ -164,6 +178,16 @@ var runCmd = &cli.Command{
 			Value:   50_000,
 			EnvVars: []string{"PALOMAR_INDEXING_RATE_LIMIT"},
 		},
+		&cli.BoolFlag{
+			Name:    "index-quoted-text",
+			Usage:   "copy the text of quoted posts (if already indexed) in to quoting post docs, for 'include_quoted' searches",
+			EnvVars: []string{"PALOMAR_INDEX_QUOTED_TEXT"},
+		},
+		&cli.StringFlag{
+			Name:    "index-refresh",
+			Usage:   "refresh policy for indexing requests: 'wait_for' (wait until indexed docs are searchable) or 'true' (force a refresh; expensive, for tests and tooling). default is to not wait",
+			EnvVars: []string{"PALOMAR_INDEX_REFRESH"},
+		},
 		&cli.IntFlag{
 			Name:    "plc-rate-limit",
 			Usage:   "max number of requests per second to PLC registry",
@@ -176,10 +200,111 @@ var runCmd = &cli.Command{
 			EnvVars: []string{"PALOMAR_DISCOVER_REPOS"},
 			Value:   false,
 		},
+		&cli.BoolFlag{
+			Name:    "create-indices",
+			Usage:   "create the post and profile indices (with mappings) at startup, if they don't already exist",
+			EnvVars: []string{"PALOMAR_CREATE_INDICES"},
+		},
+		&cli.DurationFlag{
+			Name:    "query-timeout",
+			Usage:   "deadline for each search query to elasticsearch",
+			Value:   10 * time.Second,
+			EnvVars: []string{"PALOMAR_QUERY_TIMEOUT"},
+		},
+		&cli.IntFlag{
+			Name:    "query-attempts",
+			Usage:   "maximum attempts for each search query, including retries after transient elasticsearch errors (1 disables retries)",
+			Value:   3,
+			EnvVars: []string{"PALOMAR_QUERY_ATTEMPTS"},
+		},
+		&cli.DurationFlag{
+			Name:    "slow-query-threshold",
+			Usage:   "log search queries (with full query body) which take at least this long; negative disables",
+			Value:   time.Second,
+			EnvVars: []string{"PALOMAR_SLOW_QUERY_THRESHOLD"},
+		},
+		&cli.DurationFlag{
+			Name:    "shutdown-timeout",
+			Usage:   "on shutdown, how long to wait for in-flight search requests to complete",
+			Value:   20 * time.Second,
+			EnvVars: []string{"PALOMAR_SHUTDOWN_TIMEOUT"},
+		},
+		&cli.IntFlag{
+			Name:    "max-limit",
+			Usage:   "maximum page size for search requests",
+			Value:   100,
+			EnvVars: []string{"PALOMAR_MAX_LIMIT"},
+		},
+		&cli.IntFlag{
+			Name:    "max-offset",
+			Usage:   "maximum pagination offset for search requests (raising above 10000 also requires raising index.max_result_window)",
+			Value:   10000,
+			EnvVars: []string{"PALOMAR_MAX_OFFSET"},
+		},
+		&cli.IntFlag{
+			Name:    "max-results",
+			Usage:   "maximum number of results for any single search, over all pages; caps hit counting (track_total_hits) and pagination, to reduce search cluster work. 0 for no cap. must not be more than max-offset",
+			EnvVars: []string{"PALOMAR_MAX_RESULTS"},
+		},
+		&cli.StringFlag{
+			Name:    "admin-token",
+			Usage:   "bearer token for internal endpoints (eg, raw query DSL search); those endpoints are disabled if not set",
+			EnvVars: []string{"PALOMAR_ADMIN_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    "cursor-signing-key",
+			Usage:   "secret key for signing pagination cursors, so that clients can't forge arbitrary offsets; plain cursors are used if not set",
+			EnvVars: []string{"PALOMAR_CURSOR_SIGNING_KEY"},
+		},
+		&cli.BoolFlag{
+			Name:    "profile-spam-penalty",
+			Usage:   "down-weight profiles with keyword-stuffed display names in profile search, by default (can be toggled per-request with 'spam_penalty')",
+			EnvVars: []string{"PALOMAR_PROFILE_SPAM_PENALTY"},
+		},
+		&cli.Float64Flag{
+			Name:    "rate-limit",
+			Usage:   "sustained search requests per second allowed per client (by IP, or rate-limit-key-header); 0 disables rate limiting",
+			EnvVars: []string{"PALOMAR_RATE_LIMIT"},
+		},
+		&cli.IntFlag{
+			Name:    "rate-limit-burst",
+			Usage:   "number of search requests a client can make in a burst; defaults to the rate",
+			EnvVars: []string{"PALOMAR_RATE_LIMIT_BURST"},
+		},
+		&cli.StringFlag{
+			Name:    "rate-limit-key-header",
+			Usage:   "HTTP request header (eg, an API key set by a gateway) which identifies clients for rate limiting, instead of IP; only values in rate-limit-keys are used",
+			EnvVars: []string{"PALOMAR_RATE_LIMIT_KEY_HEADER"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "rate-limit-keys",
+			Usage:   "valid values of rate-limit-key-header (comma-separated); other values are ignored, and the client is identified by IP",
+			EnvVars: []string{"PALOMAR_RATE_LIMIT_KEYS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "trusted-proxies",
+			Usage:   "network ranges (CIDRs, comma-separated) of proxies trusted to set X-Forwarded-For; if not set, the client IP is the address of the direct connection",
+			EnvVars: []string{"PALOMAR_TRUSTED_PROXIES"},
+		},
+		&cli.StringFlag{
+			Name:    "ratelimit-bypass",
+			Usage:   "secret value of the 'x-ratelimit-bypass' HTTP header which exempts requests from rate limits",
+			EnvVars: []string{"PALOMAR_RATELIMIT_BYPASS", "RATELIMIT_BYPASS"},
+		},
 		&cli.StringFlag{
 			Name:    "pagerank-file",
 			EnvVars: []string{"PAGERANK_FILE"},
 		},
+		&cli.StringFlag{
+			Name:    "profile-counts-file",
+			Usage:   "CSV file of 'did,followers_count,posts_count' lines to load in to the profile index",
+			EnvVars: []string{"PROFILE_COUNTS_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    "profile-labels-file",
+			Usage:   "CSV file of 'did,label1;label2' lines (account labels) to load in to the profile index",
+			EnvVars: []string{"PROFILE_LABELS_FILE"},
+		},
 		&cli.StringFlag{
 			Name:    "bulk-posts-file",
 			EnvVars: []string{"BULK_POSTS_FILE"},
@@ -245,7 +370,8 @@ var runCmd = &cli.Command{
 			otel.SetTracerProvider(tp)
 		}
 
-		escli, err := createEsClient(cctx)
+		// search queries are retried by the server (see search.WithRetry), so the client's own retries are disabled, instead of multiplying the attempts
+		escli, err := createEsClient(cctx, true)
 		if err != nil {
 			return fmt.Errorf("failed to get elasticsearch: %w", err)
 		}
@@ -262,9 +388,26 @@ var runCmd = &cli.Command{
 		dir := identity.NewCacheDirectory(&base, 1_500_000, time.Hour*24, time.Minute*2, time.Minute*5)
 
 		apiConfig := search.ServerConfig{
-			Logger:       logger,
-			ProfileIndex: cctx.String("es-profile-index"),
-			PostIndex:    cctx.String("es-post-index"),
+			Logger:             logger,
+			ProfileIndex:       cctx.String("es-profile-index"),
+			PostIndex:          cctx.String("es-post-index"),
+			Tenant:             cctx.String("tenant"),
+			QueryTimeout:       cctx.Duration("query-timeout"),
+			QueryAttempts:      cctx.Int("query-attempts"),
+			SlowQueryThreshold: cctx.Duration("slow-query-threshold"),
+			MaxLimit:           cctx.Int("max-limit"),
+			MaxOffset:          cctx.Int("max-offset"),
+			MaxResults:         cctx.Int("max-results"),
+			SearchBackend:      cctx.String("search-backend"),
+			AdminToken:         cctx.String("admin-token"),
+			CursorSigningKey:   cctx.String("cursor-signing-key"),
+			ProfileSpamPenalty: cctx.Bool("profile-spam-penalty"),
+			RateLimit:          cctx.Float64("rate-limit"),
+			RateLimitBurst:     cctx.Int("rate-limit-burst"),
+			RateLimitKeyHeader: cctx.String("rate-limit-key-header"),
+			RateLimitKeys:      cctx.StringSlice("rate-limit-keys"),
+			TrustedProxies:     cctx.StringSlice("trusted-proxies"),
+			RatelimitBypass:    cctx.String("ratelimit-bypass"),
 		}
 
 		srv, err := search.NewServer(escli, &dir, apiConfig)
@@ -272,6 +415,12 @@ var runCmd = &cli.Command{
 			return err
 		}
 
+		if cctx.Bool("create-indices") {
+			if err := srv.EnsureIndices(cctx.Context); err != nil {
+				return fmt.Errorf("failed to create opensearch indices: %w", err)
+			}
+		}
+
 		// Configure the indexer if we're not in readonly mode
 		if !readonly {
 			db, err := cliutil.SetupDatabase(cctx.String("database-url"), cctx.Int("max-metadb-connections"))
@@ -283,14 +432,22 @@ var runCmd = &cli.Command{
 				RelayHost:           cctx.String("atp-relay-host"),
 				ProfileIndex:        cctx.String("es-profile-index"),
 				PostIndex:           cctx.String("es-post-index"),
+				Tenant:              cctx.String("tenant"),
 				Logger:              logger,
 				RelaySyncRateLimit:  cctx.Int("relay-sync-rate-limit"),
 				IndexMaxConcurrency: cctx.Int("index-max-concurrency"),
 				DiscoverRepos:       cctx.Bool("discover-repos"),
 				IndexingRateLimit:   cctx.Int("indexing-rate-limit"),
+				IndexQuotedText:     cctx.Bool("index-quoted-text"),
+				Refresh:             cctx.String("index-refresh"),
 			}
 
-			idx, err := search.NewIndexer(db, escli, &dir, indexerConfig)
+			// the indexer relies on the client's retries for bulk requests
+			idxcli, err := createEsClient(cctx, false)
+			if err != nil {
+				return fmt.Errorf("failed to get elasticsearch: %w", err)
+			}
+			idx, err := search.NewIndexer(db, idxcli, &dir, indexerConfig)
 			if err != nil {
 				return fmt.Errorf("failed to set up indexer: %w", err)
 			}
@@ -305,72 +462,106 @@ var runCmd = &cli.Command{
 			}
 		}()
 
+		apiErr := make(chan error, 1)
 		go func() {
-			srv.RunAPI(cctx.String("bind"))
+			apiErr <- srv.RunAPI(cctx.String("bind"))
 		}()
 
-		// If we're in readonly mode, just block forever
-		if readonly {
-			select {}
-		} else if cctx.String("pagerank-file") != "" && srv.Indexer != nil {
-			// If we're not in readonly mode, and we have a pagerank file, update pageranks
-			ctx := context.Background()
-			if err := srv.Indexer.BulkIndexPageranks(ctx, cctx.String("pagerank-file")); err != nil {
-				return fmt.Errorf("failed to update pageranks: %w", err)
-			}
-		} else if cctx.String("bulk-posts-file") != "" && srv.Indexer != nil {
-			// If we're not in readonly mode, and we have a bulk posts file, index posts
-			ctx := context.Background()
-			if err := srv.Indexer.BulkIndexPosts(ctx, cctx.String("bulk-posts-file")); err != nil {
-				return fmt.Errorf("failed to bulk index posts: %w", err)
-			}
-		} else if cctx.String("bulk-profiles-file") != "" && srv.Indexer != nil {
-			// If we're not in readonly mode, and we have a bulk profiles file, index profiles
-			ctx := context.Background()
-			if err := srv.Indexer.BulkIndexProfiles(ctx, cctx.String("bulk-profiles-file")); err != nil {
-				return fmt.Errorf("failed to bulk index profiles: %w", err)
-			}
-		} else if srv.Indexer != nil {
-			// Otherwise, just run the indexer
-			ctx := context.Background()
-			if err := srv.Indexer.EnsureIndices(ctx); err != nil {
-				return fmt.Errorf("failed to create opensearch indices: %w", err)
-			}
-			if err := srv.Indexer.RunIndexer(ctx); err != nil {
-				return fmt.Errorf("failed to run indexer: %w", err)
+		// If we're not in readonly mode, run the indexer (or a one-off bulk job) in the background
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		indexerDone := make(chan error, 1)
+		if !readonly && srv.Indexer != nil {
+			go func() {
+				indexerDone <- runIndexer(ctx, cctx, srv.Indexer)
+			}()
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+		var runErr error
+		select {
+		case sig := <-signals:
+			logger.Info("received shutdown signal", "signal", sig)
+		case runErr = <-apiErr:
+			if runErr != nil {
+				runErr = fmt.Errorf("search API failed: %w", runErr)
 			}
+		case runErr = <-indexerDone:
 		}
 
-		return nil
+		// stop accepting new connections, and give in-flight searches a chance to complete
+		logger.Info("shutting down search API", "timeout", cctx.Duration("shutdown-timeout"))
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cctx.Duration("shutdown-timeout"))
+		defer shutdownCancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("failed to shut down search API gracefully", "err", err)
+		}
+		cancel()
+
+		return runErr
 	},
 }
 
+// runIndexer runs the indexer, or one of the one-off bulk jobs if configured. Bulk jobs return when complete; the indexer runs until the context is cancelled.
+func runIndexer(ctx context.Context, cctx *cli.Context, idx *search.Indexer) error {
+	if cctx.String("pagerank-file") != "" {
+		// If we have a pagerank file, update pageranks
+		if err := idx.BulkIndexPageranks(ctx, cctx.String("pagerank-file")); err != nil {
+			return fmt.Errorf("failed to update pageranks: %w", err)
+		}
+	} else if cctx.String("profile-counts-file") != "" {
+		// If we have a profile counts file, update follower and post counts
+		if err := idx.BulkIndexProfileCounts(ctx, cctx.String("profile-counts-file")); err != nil {
+			return fmt.Errorf("failed to update profile counts: %w", err)
+		}
+	} else if cctx.String("profile-labels-file") != "" {
+		// If we have a profile labels file, update account labels
+		if err := idx.BulkIndexProfileLabels(ctx, cctx.String("profile-labels-file")); err != nil {
+			return fmt.Errorf("failed to update profile labels: %w", err)
+		}
+	} else if cctx.String("bulk-posts-file") != "" {
+		// If we have a bulk posts file, index posts
+		if err := idx.BulkIndexPosts(ctx, cctx.String("bulk-posts-file")); err != nil {
+			return fmt.Errorf("failed to bulk index posts: %w", err)
+		}
+	} else if cctx.String("bulk-profiles-file") != "" {
+		// If we have a bulk profiles file, index profiles
+		if err := idx.BulkIndexProfiles(ctx, cctx.String("bulk-profiles-file")); err != nil {
+			return fmt.Errorf("failed to bulk index profiles: %w", err)
+		}
+	} else {
+		// Otherwise, just run the indexer
+		if err := idx.EnsureIndices(ctx); err != nil {
+			return fmt.Errorf("failed to create opensearch indices: %w", err)
+		}
+		if err := idx.RunIndexer(ctx); err != nil {
+			return fmt.Errorf("failed to run indexer: %w", err)
+		}
+	}
+	return nil
+}
+
 var elasticCheckCmd = &cli.Command{
 	Name:  "elastic-check",
 	Flags: []cli.Flag{},
 	Action: func(cctx *cli.Context) error {
-		escli, err := createEsClient(cctx)
+		escli, err := createEsClient(cctx, false)
 		if err != nil {
 			return err
 		}
 
-		// NOTE: this extra info check is redundant; createEsClient() already made this call and logged results
-		inf, err := escli.Info()
+		postIndex, profileIndex, err := configIndexNames(cctx)
 		if err != nil {
-			return fmt.Errorf("failed to get info: %w", err)
-		}
-		defer inf.Body.Close()
-		if inf.IsError() {
-			return fmt.Errorf("failed to get info")
+			return err
 		}
-		slog.Info("opensearch client connected", "client_info", inf)
-
-		resp, err := escli.Indices.Exists([]string{cctx.String("es-profile-index"), cctx.String("es-post-index")})
+		resp, err := escli.Indices.Exists([]string{profileIndex, postIndex})
 		if err != nil {
 			return fmt.Errorf("failed to check index existence: %w", err)
 		}
 		defer resp.Body.Close()
-		if inf.IsError() {
+		if resp.IsError() {
 			return fmt.Errorf("failed to check index existence")
 		}
 		slog.Info("index existence", "resp", resp)
@@ -380,6 +571,50 @@ var elasticCheckCmd = &cli.Command{
 	},
 }
 
+var reindexCmd = &cli.Command{
+	Name:      "reindex",
+	Usage:     "copy all documents from one index to a freshly created one (eg, after a mapping change), then optionally swap an alias to it",
+	ArgsUsage: "<source-index> <target-index>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "doc-type",
+			Usage: "type of documents being reindexed, which determines the target mapping ('post' or 'profile')",
+			Value: "post",
+		},
+		&cli.StringFlag{
+			Name:  "alias",
+			Usage: "if set, atomically point this alias at the target index when the copy completes",
+		},
+		&cli.IntFlag{
+			Name:  "batch-size",
+			Usage: "number of documents per read and bulk write",
+			Value: 1000,
+		},
+		&cli.StringFlag{
+			Name:  "cursor-file",
+			Usage: "file to persist progress to; re-running with the same file resumes an interrupted reindex",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 2 {
+			return fmt.Errorf("expected source and target index names as arguments")
+		}
+		escli, err := createEsClient(cctx, false)
+		if err != nil {
+			return err
+		}
+		return search.Reindex(cctx.Context, escli, search.ReindexConfig{
+			SourceIndex:   cctx.Args().Get(0),
+			TargetIndex:   cctx.Args().Get(1),
+			DocType:       cctx.String("doc-type"),
+			Alias:         cctx.String("alias"),
+			BatchSize:     cctx.Int("batch-size"),
+			CursorFile:    cctx.String("cursor-file"),
+			SearchBackend: cctx.String("search-backend"),
+		})
+	},
+}
+
 func printHits(resp *search.EsSearchResponse) {
 	fmt.Printf("%d hits in %d\n", len(resp.Hits.Hits), resp.Took)
 	for _, hit := range resp.Hits.Hits {
@@ -393,15 +628,19 @@ var searchPostCmd = &cli.Command{
 	Name:  "search-post",
 	Usage: "run a simple query against posts index",
 	Action: func(cctx *cli.Context) error {
-		escli, err := createEsClient(cctx)
+		searchcli, err := createSearchClient(cctx)
+		if err != nil {
+			return err
+		}
+		postIndex, _, err := configIndexNames(cctx)
 		if err != nil {
 			return err
 		}
 		res, err := search.DoSearchPosts(
 			context.Background(),
 			identity.DefaultDirectory(), // TODO: parse PLC arg
-			escli,
-			cctx.String("es-post-index"),
+			searchcli,
+			postIndex,
 			&search.PostSearchParams{
 				Query:  strings.Join(cctx.Args().Slice(), " "),
 				Offset: 0,
@@ -425,15 +664,19 @@ var searchProfileCmd = &cli.Command{
 		},
 	},
 	Action: func(cctx *cli.Context) error {
-		escli, err := createEsClient(cctx)
+		searchcli, err := createSearchClient(cctx)
+		if err != nil {
+			return err
+		}
+		_, profileIndex, err := configIndexNames(cctx)
 		if err != nil {
 			return err
 		}
 		if cctx.Bool("typeahead") {
 			res, err := search.DoSearchProfilesTypeahead(
 				context.Background(),
-				escli,
-				cctx.String("es-profile-index"),
+				searchcli,
+				profileIndex,
 				&search.ActorSearchParams{
 					Query: strings.Join(cctx.Args().Slice(), " "),
 					Size:  10,
@@ -447,8 +690,8 @@ var searchProfileCmd = &cli.Command{
 			res, err := search.DoSearchProfiles(
 				context.Background(),
 				identity.DefaultDirectory(), // TODO: parse PLC arg
-				escli,
-				cctx.String("es-profile-index"),
+				searchcli,
+				profileIndex,
 				&search.ActorSearchParams{
 					Query:  strings.Join(cctx.Args().Slice(), " "),
 					Offset: 0,
@@ -464,7 +707,21 @@ var searchProfileCmd = &cli.Command{
 	},
 }
 
-func createEsClient(cctx *cli.Context) (*es.Client, error) {
+func createSearchClient(cctx *cli.Context) (search.SearchClient, error) {
+	escli, err := createEsClient(cctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return search.NewSearchClient(escli, cctx.String("search-backend"))
+}
+
+// post and profile index names, with the tenant (if any) substituted. see search.TenantIndexNames
+func configIndexNames(cctx *cli.Context) (string, string, error) {
+	return search.TenantIndexNames(cctx.String("tenant"), cctx.String("es-post-index"), cctx.String("es-profile-index"))
+}
+
+// createEsClient configures a search cluster client from CLI flags, and checks that the cluster is reachable. If disableRetry is set, the client doesn't retry failed requests itself.
+func createEsClient(cctx *cli.Context, disableRetry bool) (*es.Client, error) {
 
 	addrs := []string{}
 	if hosts := cctx.String("elastic-hosts"); hosts != "" {
@@ -485,10 +742,11 @@ func createEsClient(cctx *cli.Context) (*es.Client, error) {
 	insecure := cctx.Bool("elastic-insecure-ssl")
 
 	cfg := es.Config{
-		Addresses: addrs,
-		Username:  cctx.String("elastic-username"),
-		Password:  cctx.String("elastic-password"),
-		CACert:    cert,
+		Addresses:    addrs,
+		Username:     cctx.String("elastic-username"),
+		Password:     cctx.String("elastic-password"),
+		CACert:       cert,
+		DisableRetry: disableRetry,
 		Transport: &http.Transport{
 			MaxIdleConnsPerHost: 20,
 			TLSClientConfig: &tls.Config{
@@ -502,12 +760,14 @@ func createEsClient(cctx *cli.Context) (*es.Client, error) {
 		return nil, fmt.Errorf("failed to set up client: %w", err)
 	}
 
-	info, err := escli.Info()
+	// fail fast on bad credentials (or an unreachable cluster), instead of every query erroring later
+	ctx, cancel := context.WithTimeout(cctx.Context, 30*time.Second)
+	defer cancel()
+	info, err := search.CheckCluster(ctx, escli)
 	if err != nil {
-		return nil, fmt.Errorf("cannot get escli info: %w", err)
+		return nil, err
 	}
-	defer info.Body.Close()
-	slog.Debug("opensearch client initialized", "info", info)
+	slog.Info("connected to search cluster", "cluster_name", info.ClusterName, "node", info.Name, "version", info.Version.Number, "distribution", info.Version.Distribution)
 
 	return escli, nil
 }
@@ -26,6 +26,9 @@ type RepoStreamCallbacks struct {
 	LabelLabels   func(evt *comatproto.LabelSubscribeLabels_Labels) error
 	LabelInfo     func(evt *comatproto.LabelSubscribeLabels_Info) error
 	Error         func(evt *ErrorFrame) error
+
+	// If true, HandleRepoStreamWithCallbacks skips (and counts) events which fail to decode, instead of returning an error. Each event is a separate websocket message, so this doesn't lose sync with the stream, but skipped events are never delivered.
+	SkipDecodeErrors bool
 }
 
 func (rsc *RepoStreamCallbacks) EventHandler(ctx context.Context, xev *XRPCStreamEvent) error {
@@ -114,6 +117,15 @@ func (sr *instrumentedReader) Read(p []byte) (int, error) {
 // sched gets AddWork for each event
 // log may be nil for default logger
 func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler, log *slog.Logger) error {
+	return handleRepoStream(ctx, con, sched, log, false)
+}
+
+// HandleRepoStreamWithCallbacks is like HandleRepoStream, but with the stream options from rsc (eg, SkipDecodeErrors). sched is usually configured with rsc.EventHandler.
+func HandleRepoStreamWithCallbacks(ctx context.Context, con *websocket.Conn, sched Scheduler, rsc *RepoStreamCallbacks, log *slog.Logger) error {
+	return handleRepoStream(ctx, con, sched, log, rsc.SkipDecodeErrors)
+}
+
+func handleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler, log *slog.Logger, skipDecodeErrors bool) error {
 	if log == nil {
 		log = slog.Default().With("system", "events")
 	}
@@ -160,6 +172,17 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 	})
 
 	lastSeq := int64(-1)
+
+	// returns err, unless events which fail to decode (eg, with a corrupt CBOR block) are being skipped. seq is -1 for events without one, and may be zero if decoding failed before it was read; prev is the last good seq.
+	decodeFailed := func(msgType string, seq int64, err error) error {
+		if !skipDecodeErrors {
+			return err
+		}
+		decodeErrorsCounter.WithLabelValues(remoteAddr).Inc()
+		log.Warn("skipping event which failed to decode", "type", msgType, "seq", seq, "prev", lastSeq, "err", err)
+		return nil
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -187,7 +210,10 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 
 		var header EventHeader
 		if err := header.UnmarshalCBOR(r); err != nil {
-			return fmt.Errorf("reading header: %w", err)
+			if err := decodeFailed("", -1, fmt.Errorf("reading header: %w", err)); err != nil {
+				return err
+			}
+			continue
 		}
 
 		eventsFromStreamCounter.WithLabelValues(remoteAddr).Inc()
@@ -198,7 +224,10 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 			case "#commit":
 				var evt comatproto.SyncSubscribeRepos_Commit
 				if err := evt.UnmarshalCBOR(r); err != nil {
-					return fmt.Errorf("reading repoCommit event: %w", err)
+					if err := decodeFailed(header.MsgType, evt.Seq, fmt.Errorf("reading repoCommit event: %w", err)); err != nil {
+						return err
+					}
+					continue
 				}
 
 				if evt.Seq < lastSeq {
@@ -215,7 +244,10 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 			case "#handle":
 				var evt comatproto.SyncSubscribeRepos_Handle
 				if err := evt.UnmarshalCBOR(r); err != nil {
-					return err
+					if err := decodeFailed(header.MsgType, evt.Seq, err); err != nil {
+						return err
+					}
+					continue
 				}
 
 				if evt.Seq < lastSeq {
@@ -231,7 +263,10 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 			case "#identity":
 				var evt comatproto.SyncSubscribeRepos_Identity
 				if err := evt.UnmarshalCBOR(r); err != nil {
-					return err
+					if err := decodeFailed(header.MsgType, evt.Seq, err); err != nil {
+						return err
+					}
+					continue
 				}
 
 				if evt.Seq < lastSeq {
@@ -247,7 +282,10 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 			case "#account":
 				var evt comatproto.SyncSubscribeRepos_Account
 				if err := evt.UnmarshalCBOR(r); err != nil {
-					return err
+					if err := decodeFailed(header.MsgType, evt.Seq, err); err != nil {
+						return err
+					}
+					continue
 				}
 
 				if evt.Seq < lastSeq {
@@ -264,7 +302,10 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 				// TODO: this might also be a LabelInfo (as opposed to RepoInfo)
 				var evt comatproto.SyncSubscribeRepos_Info
 				if err := evt.UnmarshalCBOR(r); err != nil {
-					return err
+					if err := decodeFailed(header.MsgType, -1, err); err != nil {
+						return err
+					}
+					continue
 				}
 
 				if err := sched.AddWork(ctx, "", &XRPCStreamEvent{
@@ -275,7 +316,10 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 			case "#migrate":
 				var evt comatproto.SyncSubscribeRepos_Migrate
 				if err := evt.UnmarshalCBOR(r); err != nil {
-					return err
+					if err := decodeFailed(header.MsgType, evt.Seq, err); err != nil {
+						return err
+					}
+					continue
 				}
 
 				if evt.Seq < lastSeq {
@@ -291,7 +335,10 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 			case "#tombstone":
 				var evt comatproto.SyncSubscribeRepos_Tombstone
 				if err := evt.UnmarshalCBOR(r); err != nil {
-					return err
+					if err := decodeFailed(header.MsgType, evt.Seq, err); err != nil {
+						return err
+					}
+					continue
 				}
 
 				if evt.Seq < lastSeq {
@@ -307,7 +354,10 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 			case "#labels":
 				var evt comatproto.LabelSubscribeLabels_Labels
 				if err := evt.UnmarshalCBOR(r); err != nil {
-					return fmt.Errorf("reading Labels event: %w", err)
+					if err := decodeFailed(header.MsgType, evt.Seq, fmt.Errorf("reading Labels event: %w", err)); err != nil {
+						return err
+					}
+					continue
 				}
 
 				if evt.Seq < lastSeq {
@@ -326,7 +376,10 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler,
 		case EvtKindErrorFrame:
 			var errframe ErrorFrame
 			if err := errframe.UnmarshalCBOR(r); err != nil {
-				return err
+				if err := decodeFailed(header.MsgType, -1, err); err != nil {
+					return err
+				}
+				continue
 			}
 
 			if err := sched.AddWork(ctx, "", &XRPCStreamEvent{
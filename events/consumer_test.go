@@ -0,0 +1,116 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	atproto "github.com/bluesky-social/indigo/api/atproto"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/gorilla/websocket"
+	"github.com/ipfs/go-cid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// scheduler which just records events
+type testScheduler struct {
+	lk     sync.Mutex
+	events []*XRPCStreamEvent
+}
+
+func (s *testScheduler) AddWork(ctx context.Context, repo string, val *XRPCStreamEvent) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.events = append(s.events, val)
+	return nil
+}
+
+func (s *testScheduler) Shutdown() {}
+
+func TestHandleRepoStreamDecodeError(t *testing.T) {
+	ctx := context.Background()
+
+	commitCID, err := cid.Decode("bafyreidfayvfuwqa7qlnopdjiqrxzs6blmoeu4rujcjtnci5beludirz2a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commit bytes.Buffer
+	err = (&XRPCStreamEvent{RepoCommit: &atproto.SyncSubscribeRepos_Commit{
+		Seq:    1,
+		Repo:   "did:plc:abc123",
+		Commit: lexutil.LexLink(commitCID),
+		Blocks: bytes.Repeat([]byte{0x42}, 64),
+		Ops:    []*atproto.SyncSubscribeRepos_RepoOp{},
+		Blobs:  []lexutil.LexLink{},
+	}}).Serialize(&commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// truncate the event, so it fails to decode
+	corrupt := commit.Bytes()[:commit.Len()-32]
+
+	var identity bytes.Buffer
+	if err := (&XRPCStreamEvent{RepoIdentity: &atproto.SyncSubscribeRepos_Identity{
+		Seq: 2,
+		Did: "did:plc:abc123",
+	}}).Serialize(&identity); err != nil {
+		t.Fatal(err)
+	}
+
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		con, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer con.Close()
+		for _, msg := range [][]byte{corrupt, identity.Bytes()} {
+			if err := con.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+				return
+			}
+		}
+		con.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}))
+	defer srv.Close()
+
+	dial := func() *websocket.Conn {
+		con, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return con
+	}
+
+	// by default, a corrupt event is an error
+	sched := &testScheduler{}
+	if err := HandleRepoStream(ctx, dial(), sched, nil); err == nil || !strings.Contains(err.Error(), "reading repoCommit event") {
+		t.Fatalf("expected decode error, got: %v", err)
+	}
+	if len(sched.events) != 0 {
+		t.Fatalf("expected no events, got: %v", sched.events)
+	}
+
+	con := dial()
+	remoteAddr := con.RemoteAddr().String()
+	before := testutil.ToFloat64(decodeErrorsCounter.WithLabelValues(remoteAddr))
+
+	sched = &testScheduler{}
+	rsc := &RepoStreamCallbacks{SkipDecodeErrors: true}
+	// the stream ends with the connection closing
+	if err := HandleRepoStreamWithCallbacks(ctx, con, sched, rsc, nil); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("expected normal close, got: %v", err)
+	}
+
+	// when skipping is enabled, the corrupt event is skipped, and later events are still handled
+	if len(sched.events) != 1 || sched.events[0].RepoIdentity == nil || sched.events[0].RepoIdentity.Seq != 2 {
+		t.Fatalf("expected only the identity event, got: %v", sched.events)
+	}
+	if after := testutil.ToFloat64(decodeErrorsCounter.WithLabelValues(remoteAddr)); after-before != 1 {
+		t.Fatalf("expected one decode error, got %v", after-before)
+	}
+}
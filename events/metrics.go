@@ -15,6 +15,11 @@ var bytesFromStreamCounter = promauto.NewCounterVec(prometheus.CounterOpts{
 	Help: "Total bytes received from the stream",
 }, []string{"remote_addr"})
 
+var decodeErrorsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_repo_stream_decode_errors_total",
+	Help: "Total number of events from the stream which failed to decode, and were skipped",
+}, []string{"remote_addr"})
+
 var eventsEnqueued = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name: "indigo_events_enqueued_for_broadcast_total",
 	Help: "Total number of events enqueued to broadcast to subscribers",
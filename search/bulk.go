@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -239,6 +240,173 @@ func (idx *Indexer) processPagerankCSVLine(line string) error {
 	return nil
 }
 
+// BulkIndexProfileCounts updates the follower and post counts for the DIDs in the Search Index from a CSV file.
+//
+// Each line is formatted as: did,followers_count,posts_count
+func (idx *Indexer) BulkIndexProfileCounts(ctx context.Context, countsFile string) error {
+	f, err := os.Open(countsFile)
+	if err != nil {
+		return fmt.Errorf("failed to open csv file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	flush := func(batch []*ProfileCountsIndexJob) error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := idx.indexLimiter.WaitN(ctx, len(batch)); err != nil {
+			return err
+		}
+		return idx.indexProfileCounts(ctx, batch)
+	}
+
+	linesRead := 0
+	var batch []*ProfileCountsIndexJob
+	for scanner.Scan() {
+		job, err := parseProfileCountsCSVLine(scanner.Text())
+		if err != nil {
+			idx.logger.Error("failed to process line", "err", err)
+			continue
+		}
+		batch = append(batch, job)
+		if len(batch) >= 1000 {
+			if err := flush(batch); err != nil {
+				return fmt.Errorf("failed to index profile counts: %w", err)
+			}
+			batch = batch[:0]
+		}
+
+		linesRead++
+		if linesRead%100_000 == 0 {
+			idx.logger.Info("processed csv lines", "lines", linesRead)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading csv file: %w", err)
+	}
+	if err := flush(batch); err != nil {
+		return fmt.Errorf("failed to index profile counts: %w", err)
+	}
+
+	idx.logger.Info("finished processing csv file", "lines", linesRead)
+
+	return nil
+}
+
+func parseProfileCountsCSVLine(line string) (*ProfileCountsIndexJob, error) {
+	parts := strings.Split(line, ",")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid profile counts line: %s", line)
+	}
+
+	did, err := syntax.ParseDID(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid DID: %s", parts[0])
+	}
+
+	followers, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid followers count: %s", parts[1])
+	}
+
+	posts, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid posts count: %s", parts[2])
+	}
+
+	return &ProfileCountsIndexJob{
+		did:       did,
+		followers: followers,
+		posts:     posts,
+	}, nil
+}
+
+// BulkIndexProfileLabels updates the account labels for the DIDs in the Search Index from a CSV file. The labels for each listed account are replaced (not merged), so the file should be a complete snapshot of current labels; accounts which are not listed keep their existing labels.
+//
+// Each line is formatted as: did,label1;label2;... (an empty label list clears labels). Labels not in IndexedAccountLabels are ignored.
+func (idx *Indexer) BulkIndexProfileLabels(ctx context.Context, labelsFile string) error {
+	f, err := os.Open(labelsFile)
+	if err != nil {
+		return fmt.Errorf("failed to open csv file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	flush := func(batch []*ProfileLabelsIndexJob) error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := idx.indexLimiter.WaitN(ctx, len(batch)); err != nil {
+			return err
+		}
+		return idx.indexProfileLabels(ctx, batch)
+	}
+
+	linesRead := 0
+	var batch []*ProfileLabelsIndexJob
+	for scanner.Scan() {
+		job, err := parseProfileLabelsCSVLine(scanner.Text())
+		if err != nil {
+			idx.logger.Error("failed to process line", "err", err)
+			continue
+		}
+		batch = append(batch, job)
+		if len(batch) >= 1000 {
+			if err := flush(batch); err != nil {
+				return fmt.Errorf("failed to index profile labels: %w", err)
+			}
+			batch = batch[:0]
+		}
+
+		linesRead++
+		if linesRead%100_000 == 0 {
+			idx.logger.Info("processed csv lines", "lines", linesRead)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading csv file: %w", err)
+	}
+	if err := flush(batch); err != nil {
+		return fmt.Errorf("failed to index profile labels: %w", err)
+	}
+
+	idx.logger.Info("finished processing csv file", "lines", linesRead)
+
+	return nil
+}
+
+func parseProfileLabelsCSVLine(line string) (*ProfileLabelsIndexJob, error) {
+	parts := strings.Split(line, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid profile labels line: %s", line)
+	}
+
+	did, err := syntax.ParseDID(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid DID: %s", parts[0])
+	}
+
+	labels := []string{}
+	for _, val := range strings.Split(parts[1], ";") {
+		val = strings.TrimSpace(val)
+		if isIndexedAccountLabel(val) && !slices.Contains(labels, val) {
+			labels = append(labels, val)
+		}
+	}
+
+	return &ProfileLabelsIndexJob{
+		did:    did,
+		labels: labels,
+	}, nil
+}
+
 func (idx *Indexer) processPostCSVLine(line string) error {
 	// CSV is formatted as
 	// actor_did,rkey,taken_down(time or null),violates_threadgate(False or null),cid,raw(post JSON as hex)
@@ -0,0 +1,356 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+)
+
+const (
+	SearchBackendOpenSearch    = "opensearch"
+	SearchBackendElasticsearch = "elasticsearch"
+)
+
+// SearchClient is the small subset of the search cluster API used to run queries (DoSearchPosts, DoSearchProfiles, etc). Implementations smooth over differences between Elasticsearch and OpenSearch, so that responses are always returned in the same shape.
+//
+// Index management and bulk indexing still use the underlying client directly; those APIs are the same for both backends.
+type SearchClient interface {
+	// Runs a search (`_search`) request with a JSON request body
+	Search(ctx context.Context, index string, body []byte) (*EsSearchResponse, error)
+	// Runs a count (`_count`) request with a JSON request body
+	Count(ctx context.Context, index string, body []byte) (*EsCountResponse, error)
+}
+
+// Point-in-time (PIT) support, for paging through every document in an index against a consistent snapshot (eg, for Reindex). The PIT APIs differ between Elasticsearch and OpenSearch; both SearchClient implementations in this package support them.
+//
+// Searches against a PIT are run with SearchClient.Search, with an empty index and a "pit" clause in the request body (see pointInTimeClause). The PIT ID may change between requests; the latest ID is returned in EsSearchResponse.PitID.
+type PointInTimeClient interface {
+	// Opens a PIT on the index, kept alive for keepAlive (which is extended by each search using it). Returns the PIT ID.
+	OpenPointInTime(ctx context.Context, index string, keepAlive time.Duration) (string, error)
+	ClosePointInTime(ctx context.Context, pitID string) error
+}
+
+// the "pit" clause of a search request body
+func pointInTimeClause(pitID string, keepAlive time.Duration) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         pitID,
+		"keep_alive": keepAliveParam(keepAlive),
+	}
+}
+
+// formats a duration as a (seconds) time unit understood by the cluster
+func keepAliveParam(d time.Duration) string {
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
+
+// NewSearchClient returns a SearchClient for the given backend ("opensearch" or "elasticsearch"). An empty backend defaults to OpenSearch.
+//
+// Both implementations use the same (OpenSearch) HTTP client; the search and count APIs used here are compatible between OpenSearch and Elasticsearch 7.10+. The point-in-time APIs (see PointInTimeClient) are not, and are implemented separately.
+func NewSearchClient(escli *es.Client, backend string) (SearchClient, error) {
+	switch backend {
+	case "", SearchBackendOpenSearch:
+		return &OpenSearchClient{Client: escli}, nil
+	case SearchBackendElasticsearch:
+		return &ElasticsearchClient{Client: escli}, nil
+	default:
+		return nil, fmt.Errorf("unsupported search backend: %q (expected %q or %q)", backend, SearchBackendOpenSearch, SearchBackendElasticsearch)
+	}
+}
+
+// SearchClient implementation for OpenSearch clusters
+type OpenSearchClient struct {
+	Client *es.Client
+}
+
+func (c *OpenSearchClient) Search(ctx context.Context, index string, body []byte) (*EsSearchResponse, error) {
+	return searchRequest(ctx, c.Client, index, body, nil)
+}
+
+func (c *OpenSearchClient) Count(ctx context.Context, index string, body []byte) (*EsCountResponse, error) {
+	return countRequest(ctx, c.Client, index, body)
+}
+
+// Uses the OpenSearch (2.4+) `_search/point_in_time` API
+func (c *OpenSearchClient) OpenPointInTime(ctx context.Context, index string, keepAlive time.Duration) (string, error) {
+	res, out, err := c.Client.PointInTime.Create(
+		c.Client.PointInTime.Create.WithContext(ctx),
+		c.Client.PointInTime.Create.WithIndex(index),
+		c.Client.PointInTime.Create.WithKeepAlive(keepAlive),
+	)
+	// the response body is decoded even for error responses, so the status is checked first
+	if res != nil {
+		defer res.Body.Close()
+		if res.IsError() {
+			return "", &BackendError{Kind: "point-in-time", StatusCode: res.StatusCode}
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("opening point-in-time: %w", err)
+	}
+	if out == nil || out.PitID == "" {
+		return "", fmt.Errorf("opening point-in-time: no ID in response")
+	}
+	return out.PitID, nil
+}
+
+func (c *OpenSearchClient) ClosePointInTime(ctx context.Context, pitID string) error {
+	res, _, err := c.Client.PointInTime.Delete(
+		c.Client.PointInTime.Delete.WithContext(ctx),
+		c.Client.PointInTime.Delete.WithPitID(pitID),
+	)
+	if res != nil {
+		defer res.Body.Close()
+		if res.IsError() {
+			return &BackendError{Kind: "point-in-time", StatusCode: res.StatusCode}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("closing point-in-time: %w", err)
+	}
+	return nil
+}
+
+// SearchClient implementation for Elasticsearch clusters.
+//
+// Elasticsearch (and proxies in front of it) can be configured to return `hits.total` as a bare integer, in which case there is no `relation`. This client always explicitly requests the object form; responses in the integer form are still handled (see EsTotalHits).
+//
+// Point-in-time searches use the Elasticsearch `_pit` API, which is not available in OpenSearch.
+type ElasticsearchClient struct {
+	Client *es.Client
+}
+
+func (c *ElasticsearchClient) Search(ctx context.Context, index string, body []byte) (*EsSearchResponse, error) {
+	return searchRequest(ctx, c.Client, index, body, []func(*opensearchapi.SearchRequest){
+		c.Client.Search.WithRestTotalHitsAsInt(false),
+	})
+}
+
+func (c *ElasticsearchClient) Count(ctx context.Context, index string, body []byte) (*EsCountResponse, error) {
+	return countRequest(ctx, c.Client, index, body)
+}
+
+func (c *ElasticsearchClient) OpenPointInTime(ctx context.Context, index string, keepAlive time.Duration) (string, error) {
+	u := "/" + url.PathEscape(index) + "/_pit?keep_alive=" + keepAliveParam(keepAlive)
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := c.perform(ctx, http.MethodPost, u, nil, &out); err != nil {
+		return "", err
+	}
+	if out.ID == "" {
+		return "", fmt.Errorf("opening point-in-time: no ID in response")
+	}
+	return out.ID, nil
+}
+
+func (c *ElasticsearchClient) ClosePointInTime(ctx context.Context, pitID string) error {
+	body, err := json.Marshal(map[string]string{"id": pitID})
+	if err != nil {
+		return err
+	}
+	return c.perform(ctx, http.MethodDelete, "/_pit", body, nil)
+}
+
+// sends a request for an API which the OpenSearch client doesn't have, decoding the JSON response in to out (if not nil)
+func (c *ElasticsearchClient) perform(ctx context.Context, method, path string, body []byte, out any) error {
+	var rdr io.Reader
+	if body != nil {
+		rdr = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, path, rdr)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.Client.Perform(req)
+	if err != nil {
+		return fmt.Errorf("point-in-time request error: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		raw, err := io.ReadAll(res.Body)
+		if nil == err {
+			slog.Warn("point-in-time request error", "resp", string(raw), "status_code", res.StatusCode)
+		}
+		return &BackendError{Kind: "point-in-time", StatusCode: res.StatusCode}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding point-in-time response: %w", err)
+	}
+	return nil
+}
+
+// Error response (non-2xx status) from the search cluster
+type BackendError struct {
+	// "search", "count", or "point-in-time"
+	Kind       string
+	StatusCode int
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("%s query error, code=%d", e.Kind, e.StatusCode)
+}
+
+// Total hit count for a search. Relation is "eq" if Value is exact, or "gte" if it is a lower bound.
+//
+// OpenSearch and Elasticsearch 7+ return this as an object by default, but older Elasticsearch versions (and either backend with `rest_total_hits_as_int`) return a bare integer, which is always an exact count. Both forms are accepted when decoding.
+type EsTotalHits struct {
+	Value    int    `json:"value"`
+	Relation string `json:"relation"`
+}
+
+func (t *EsTotalHits) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] != '{' {
+		if string(b) == "null" {
+			return nil
+		}
+		v, err := strconv.Atoi(string(b))
+		if err != nil {
+			return fmt.Errorf("invalid hits total: %w", err)
+		}
+		t.Value = v
+		t.Relation = "eq"
+		return nil
+	}
+	type rawTotal EsTotalHits
+	var raw rawTotal
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*t = EsTotalHits(raw)
+	if t.Relation == "" {
+		t.Relation = "eq"
+	}
+	return nil
+}
+
+func searchRequest(ctx context.Context, escli *es.Client, index string, body []byte, opts []func(*opensearchapi.SearchRequest)) (*EsSearchResponse, error) {
+	opts = append([]func(*opensearchapi.SearchRequest){
+		escli.Search.WithContext(ctx),
+		escli.Search.WithBody(bytes.NewReader(body)),
+	}, opts...)
+	// point-in-time searches don't have an index (see PointInTimeClient)
+	if index != "" {
+		opts = append(opts, escli.Search.WithIndex(index))
+	}
+	if isIndexList(index) {
+		// listed (eg, monthly) indices may not all exist
+		opts = append(opts, escli.Search.WithIgnoreUnavailable(true))
+	}
+
+	start := time.Now()
+	res, err := escli.Search(opts...)
+	searchBackendDuration.WithLabelValues(indexMetricLabel(index), "search").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("search query error: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		raw, err := io.ReadAll(res.Body)
+		if nil == err {
+			slog.Warn("search query error", "resp", string(raw), "status_code", res.StatusCode)
+		}
+		return nil, &BackendError{Kind: "search", StatusCode: res.StatusCode}
+	}
+
+	var out EsSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding search response: %w", err)
+	}
+	return &out, nil
+}
+
+// Returns true if the index expression is a comma-separated list of indices
+func isIndexList(index string) bool {
+	return strings.Contains(index, ",")
+}
+
+// Index lists vary with the searched date range (see resolvePostIndices), so they are collapsed in to a single metric label to keep cardinality bounded
+func indexMetricLabel(index string) string {
+	if isIndexList(index) {
+		return "multiple"
+	}
+	if index == "" {
+		return "point-in-time"
+	}
+	return index
+}
+
+func countRequest(ctx context.Context, escli *es.Client, index string, body []byte) (*EsCountResponse, error) {
+	start := time.Now()
+	opts := []func(*opensearchapi.CountRequest){
+		escli.Count.WithContext(ctx),
+		escli.Count.WithIndex(index),
+		escli.Count.WithBody(bytes.NewReader(body)),
+	}
+	if isIndexList(index) {
+		opts = append(opts, escli.Count.WithIgnoreUnavailable(true))
+	}
+	res, err := escli.Count(opts...)
+	searchBackendDuration.WithLabelValues(indexMetricLabel(index), "count").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("count query error: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		raw, err := io.ReadAll(res.Body)
+		if nil == err {
+			slog.Warn("count query error", "resp", string(raw), "status_code", res.StatusCode)
+		}
+		return nil, &BackendError{Kind: "count", StatusCode: res.StatusCode}
+	}
+
+	var out EsCountResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding count response: %w", err)
+	}
+	return &out, nil
+}
+
+// Basic info about the search cluster, from the root ("/") endpoint
+type ClusterInfo struct {
+	Name        string `json:"name"`
+	ClusterName string `json:"cluster_name"`
+	Version     struct {
+		Number       string `json:"number"`
+		Distribution string `json:"distribution"`
+	} `json:"version"`
+}
+
+// CheckCluster makes a trivial authenticated request to the search cluster, returning an error if it fails for any reason (including bad credentials). Intended as a startup check, so that a misconfigured service fails fast instead of erroring on every query.
+func CheckCluster(ctx context.Context, escli *es.Client) (*ClusterInfo, error) {
+	res, err := escli.Info(escli.Info.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("search cluster unreachable: %w", err)
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("search cluster rejected credentials (status %d); check the configured username and password", res.StatusCode)
+	case res.IsError():
+		return nil, fmt.Errorf("search cluster info request failed: %s", res.Status())
+	}
+
+	var info ClusterInfo
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("decoding search cluster info: %w", err)
+	}
+	return &info, nil
+}
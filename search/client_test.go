@@ -0,0 +1,158 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTotalHitsShapes(t *testing.T) {
+	assert := assert.New(t)
+
+	var hits EsSearchHits
+	assert.NoError(json.Unmarshal([]byte(`{"total": {"value": 10000, "relation": "gte"}, "hits": []}`), &hits))
+	assert.Equal(EsTotalHits{Value: 10000, Relation: "gte"}, hits.Total)
+
+	hits = EsSearchHits{}
+	assert.NoError(json.Unmarshal([]byte(`{"total": 42, "hits": []}`), &hits))
+	assert.Equal(EsTotalHits{Value: 42, Relation: "eq"}, hits.Total)
+
+	hits = EsSearchHits{}
+	assert.NoError(json.Unmarshal([]byte(`{"total": {"value": 3}, "hits": []}`), &hits))
+	assert.Equal(EsTotalHits{Value: 3, Relation: "eq"}, hits.Total)
+
+	hits = EsSearchHits{}
+	assert.NoError(json.Unmarshal([]byte(`{"hits": []}`), &hits))
+	assert.Equal(EsTotalHits{}, hits.Total)
+
+	assert.Error(json.Unmarshal([]byte(`{"total": "many"}`), &hits))
+}
+
+// returns a client pointed at a fake cluster which responds to every search with the given hits total JSON. The query string parameters of the last request are recorded in params.
+func testFakeClusterClient(t *testing.T, totalJSON string, params *map[string]string) *es.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*params = map[string]string{}
+		for k := range r.URL.Query() {
+			(*params)[k] = r.URL.Query().Get(k)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"took": 1, "timed_out": false, "hits": {"total": ` + totalJSON + `, "max_score": null, "hits": [
+			{"_index": "palomar_post", "_id": "abc", "_score": null, "_source": {"did": "did:plc:abc111", "record_rkey": "3kabc"}, "sort": [1700000000000, "abc"]}
+		]}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	escli, err := es.NewClient(es.Config{
+		Addresses:    []string{srv.URL},
+		DisableRetry: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return escli
+}
+
+func TestSearchPostsBackends(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := identity.NewMockDirectory()
+
+	for _, backend := range []string{SearchBackendOpenSearch, SearchBackendElasticsearch} {
+		for _, totalJSON := range []string{`{"value": 1, "relation": "eq"}`, `1`} {
+			var params map[string]string
+			s, err := NewServer(testFakeClusterClient(t, totalJSON, &params), &dir, ServerConfig{
+				PostIndex:     "palomar_post",
+				ProfileIndex:  "palomar_profile",
+				SearchBackend: backend,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := s.SearchPosts(ctx, &PostSearchParams{Query: "hello", Size: 10})
+			if !assert.NoError(err, backend) {
+				continue
+			}
+			if assert.Len(out.Posts, 1) {
+				assert.Equal("at://did:plc:abc111/app.bsky.feed.post/3kabc", out.Posts[0].Uri)
+			}
+			if assert.NotNil(out.HitsTotal, backend) {
+				assert.Equal(int64(1), *out.HitsTotal)
+			}
+			if backend == SearchBackendElasticsearch {
+				assert.Equal("false", params["rest_total_hits_as_int"])
+			} else {
+				assert.NotContains(params, "rest_total_hits_as_int")
+			}
+		}
+	}
+
+	_, err := NewServer(testFakeClusterClient(t, "1", new(map[string]string)), &dir, ServerConfig{SearchBackend: "solr"})
+	assert.Error(err)
+}
+
+// SearchClient which records the last request body, and responds with no hits
+type testRecordingClient struct {
+	index string
+	body  map[string]any
+}
+
+func (c *testRecordingClient) Search(ctx context.Context, index string, body []byte) (*EsSearchResponse, error) {
+	c.index = index
+	c.body = map[string]any{}
+	if err := json.Unmarshal(body, &c.body); err != nil {
+		return nil, err
+	}
+	return &EsSearchResponse{}, nil
+}
+
+func (c *testRecordingClient) Count(ctx context.Context, index string, body []byte) (*EsCountResponse, error) {
+	c.index = index
+	c.body = map[string]any{}
+	if err := json.Unmarshal(body, &c.body); err != nil {
+		return nil, err
+	}
+	return &EsCountResponse{}, nil
+}
+
+func TestCheckCluster(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "node-1", "cluster_name": "palomar", "version": {"number": "2.11.0", "distribution": "opensearch"}}`))
+	}))
+	defer srv.Close()
+
+	escli, err := es.NewClient(es.Config{Addresses: []string{srv.URL}, Username: "admin", Password: "secret", DisableRetry: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := CheckCluster(ctx, escli)
+	if assert.NoError(err) {
+		assert.Equal("palomar", info.ClusterName)
+		assert.Equal("2.11.0", info.Version.Number)
+	}
+
+	escli, err = es.NewClient(es.Config{Addresses: []string{srv.URL}, Username: "admin", Password: "wrong", DisableRetry: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = CheckCluster(ctx, escli)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "credentials")
+	}
+}
@@ -0,0 +1,78 @@
+package search
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Post search supports two cursor formats:
+//
+//   - a plain decimal integer, which is an offset into the result set (ES "from"). These are cheap to produce but can't go beyond 10,000 results.
+//   - an opaque string, which is the unpadded base64url encoding of a JSON array of the sort values of the last hit on the previous page (as returned by ES). This is passed back as "search_after", and works at any depth.
+//
+// Clients should treat both formats as opaque.
+//
+// If the server is configured with a cursor signing key, cursors of either format are suffixed with "." and a truncated HMAC-SHA256 of the cursor (unpadded base64url). Unsigned or tampered cursors are then rejected, so clients can't jump to arbitrary offsets. Neither format otherwise contains ".".
+
+// Returns true if the cursor string is an integer offset, as opposed to an opaque "search_after" cursor.
+func isOffsetCursor(cursor string) bool {
+	_, err := strconv.Atoi(cursor)
+	return err == nil
+}
+
+func encodeSearchAfterCursor(sortValues []json.RawMessage) (string, error) {
+	if len(sortValues) == 0 {
+		return "", fmt.Errorf("empty sort values for cursor")
+	}
+	b, err := json.Marshal(sortValues)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeSearchAfterCursor(cursor string) ([]json.RawMessage, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor encoding: %w", err)
+	}
+	var sortValues []json.RawMessage
+	if err := json.Unmarshal(b, &sortValues); err != nil {
+		return nil, fmt.Errorf("invalid cursor contents: %w", err)
+	}
+	if len(sortValues) == 0 {
+		return nil, fmt.Errorf("empty cursor")
+	}
+	return sortValues, nil
+}
+
+// Number of bytes of HMAC-SHA256 output included in signed cursors
+const cursorSignatureSize = 16
+
+func cursorSignature(key []byte, cursor string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(cursor))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:cursorSignatureSize])
+}
+
+// signCursor appends an HMAC signature to a cursor string
+func signCursor(key []byte, cursor string) string {
+	return cursor + "." + cursorSignature(key, cursor)
+}
+
+// verifyCursor checks the HMAC signature of a signed cursor, and returns the original (unsigned) cursor string
+func verifyCursor(key []byte, signed string) (string, error) {
+	cursor, sig, ok := strings.Cut(signed, ".")
+	if !ok {
+		return "", fmt.Errorf("unsigned cursor")
+	}
+	if !hmac.Equal([]byte(sig), []byte(cursorSignature(key, cursor))) {
+		return "", fmt.Errorf("invalid cursor signature")
+	}
+	return cursor, nil
+}
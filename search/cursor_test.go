@@ -0,0 +1,142 @@
+package search
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchAfterCursor(t *testing.T) {
+	assert := assert.New(t)
+
+	sortValues := []json.RawMessage{
+		json.RawMessage(`1704067200000`),
+		json.RawMessage(`"did:plc:abc222_3kabc2222222"`),
+	}
+	c, err := encodeSearchAfterCursor(sortValues)
+	assert.NoError(err)
+	assert.False(isOffsetCursor(c))
+
+	out, err := decodeSearchAfterCursor(c)
+	assert.NoError(err)
+	assert.Equal(sortValues, out)
+
+	assert.True(isOffsetCursor("25"))
+	assert.True(isOffsetCursor("-1"))
+	assert.False(isOffsetCursor(""))
+
+	_, err = encodeSearchAfterCursor(nil)
+	assert.Error(err)
+
+	for _, bad := range []string{"!!!", "e30", "W10", "bm90IGpzb24"} {
+		_, err = decodeSearchAfterCursor(bad)
+		assert.Error(err, bad)
+	}
+}
+
+func TestPostSearchCursorTruncated(t *testing.T) {
+	assert := assert.New(t)
+
+	resp := &EsSearchResponse{}
+	resp.Hits.Hits = []EsSearchHit{{ID: "a"}, {ID: "b"}}
+
+	// shallow offset pagination
+	c, truncated, err := postSearchCursor(&PostSearchParams{Offset: 0, Size: 2}, resp, 10000, 0)
+	assert.NoError(err)
+	assert.False(truncated)
+	if assert.NotNil(c) {
+		assert.Equal("2", *c)
+	}
+
+	// end of results is not truncation
+	c, truncated, err = postSearchCursor(&PostSearchParams{Offset: 9998, Size: 3}, resp, 10000, 0)
+	assert.NoError(err)
+	assert.False(truncated)
+	assert.Nil(c)
+
+	// collapsed results can't go past the offset limit
+	c, truncated, err = postSearchCursor(&PostSearchParams{Offset: 9998, Size: 2, Collapse: true}, resp, 10000, 0)
+	assert.NoError(err)
+	assert.True(truncated)
+	assert.Nil(c)
+
+	// otherwise, switch to a search_after cursor
+	resp.Hits.Hits[1].Sort = []json.RawMessage{json.RawMessage(`1704067200000`), json.RawMessage(`"b"`)}
+	c, truncated, err = postSearchCursor(&PostSearchParams{Offset: 9998, Size: 2}, resp, 10000, 0)
+	assert.NoError(err)
+	assert.False(truncated)
+	if assert.NotNil(c) {
+		assert.False(isOffsetCursor(*c))
+	}
+
+	// no cursors at or past the result cap, even with more results
+	resp.Hits.Total = EsTotalHits{Value: 1000, Relation: "gte"}
+	c, truncated, err = postSearchCursor(&PostSearchParams{Offset: 998, Size: 2}, resp, 10000, 1000)
+	assert.NoError(err)
+	assert.True(truncated)
+	assert.Nil(c)
+
+	// a full (shortened) last page, with no results past the cap, is not truncated
+	resp.Hits.Total = EsTotalHits{Value: 1000, Relation: "eq"}
+	c, truncated, err = postSearchCursor(&PostSearchParams{Offset: 998, Size: 2}, resp, 10000, 1000)
+	assert.NoError(err)
+	assert.False(truncated)
+	assert.Nil(c)
+
+	// nor is a short page at the cap
+	c, truncated, err = postSearchCursor(&PostSearchParams{Offset: 998, Size: 3}, resp, 10000, 1000)
+	assert.NoError(err)
+	assert.False(truncated)
+	assert.Nil(c)
+	c, truncated, err = postSearchCursor(&PostSearchParams{Offset: 996, Size: 2}, resp, 10000, 1000)
+	assert.NoError(err)
+	assert.False(truncated)
+	if assert.NotNil(c) {
+		assert.Equal("998", *c)
+	}
+}
+
+func TestSignedCursor(t *testing.T) {
+	assert := assert.New(t)
+	key := []byte("secret")
+
+	for _, c := range []string{"25", "WzE3MDQwNjcyMDAwMDAsImFiYyJd"} {
+		signed := signCursor(key, c)
+		assert.NotEqual(c, signed)
+		out, err := verifyCursor(key, signed)
+		assert.NoError(err)
+		assert.Equal(c, out)
+
+		// unsigned
+		_, err = verifyCursor(key, c)
+		assert.Error(err)
+		// different key
+		_, err = verifyCursor([]byte("other"), signed)
+		assert.Error(err)
+	}
+
+	// signature for a different cursor
+	sig := signCursor(key, "25")[len("25"):]
+	_, err := verifyCursor(key, "9975"+sig)
+	assert.Error(err)
+	_, err = verifyCursor(key, "25.")
+	assert.Error(err)
+}
+
+func TestPostSortTiebreak(t *testing.T) {
+	assert := assert.New(t)
+
+	// every sort order ends with the fields which make up the document ID, and never sorts on _id
+	for _, sort := range []string{"latest", "top"} {
+		clause := (&PostSearchParams{Sort: sort}).SortClause()
+		n := len(clause)
+		if assert.GreaterOrEqual(n, 3, sort) {
+			assert.Contains(clause[n-2], "did", sort)
+			assert.Contains(clause[n-1], "record_rkey", sort)
+		}
+		for _, c := range clause {
+			assert.NotContains(c, "_id", sort)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Error names returned in the "error" field of API error responses. Like atproto XRPC errors, these are stable and machine-readable, while the "message" is for humans and may change.
+const (
+	// malformed or invalid request parameter (other than those with a more specific error name below)
+	ErrorInvalidRequest = "InvalidRequest"
+	// malformed, tampered, or too-deep pagination cursor
+	ErrorInvalidCursor = "InvalidCursor"
+	// non-integer 'limit'
+	ErrorInvalidLimit = "InvalidLimit"
+	// missing or empty 'q' query
+	ErrorEmptyQuery = "EmptyQuery"
+	ErrorNotFound   = "NotFound"
+	// admin token is required, and missing or invalid
+	ErrorAuthRequired = "AuthRequired"
+	ErrorForbidden    = "Forbidden"
+	// too many requests from this client; see the "Retry-After" response header
+	ErrorRateLimitExceeded = "RateLimitExceeded"
+	// the search cluster did not respond within the query timeout
+	ErrorSearchTimeout = "SearchTimeout"
+	// the search cluster returned an error, or an unexpected response
+	ErrorBackendFailure = "BackendFailure"
+	ErrorInternal       = "InternalServerError"
+)
+
+// Body of all API error responses
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// apiError returns an error which is rendered as an ErrorResponse with the given HTTP status, error name, and message.
+func apiError(status int, name, msg string) *echo.HTTPError {
+	return &echo.HTTPError{
+		Code:    status,
+		Message: ErrorResponse{Error: name, Message: msg},
+	}
+}
+
+// searchError converts an error from a search request in to an HTTP error. In particular, timeouts talking to the search cluster become a 504.
+func searchError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		he := apiError(http.StatusGatewayTimeout, ErrorSearchTimeout, "search request timed out")
+		he.Internal = err
+		return he
+	}
+	// details of the cluster error are logged, not returned to clients
+	he := apiError(http.StatusInternalServerError, ErrorBackendFailure, "search request failed")
+	he.Internal = err
+	return he
+}
+
+// errorResponse returns the HTTP status and response body for any error returned by a handler, including errors from echo itself (such as unknown routes) which don't use apiError
+func errorResponse(err error) (int, ErrorResponse) {
+	var he *echo.HTTPError
+	if !errors.As(err, &he) {
+		return http.StatusInternalServerError, ErrorResponse{Error: ErrorInternal, Message: "internal server error"}
+	}
+	if resp, ok := he.Message.(ErrorResponse); ok {
+		return he.Code, resp
+	}
+	var name string
+	switch he.Code {
+	case http.StatusUnauthorized:
+		name = ErrorAuthRequired
+	case http.StatusForbidden:
+		name = ErrorForbidden
+	case http.StatusNotFound:
+		name = ErrorNotFound
+	case http.StatusTooManyRequests:
+		name = ErrorRateLimitExceeded
+	case http.StatusGatewayTimeout:
+		name = ErrorSearchTimeout
+	default:
+		if he.Code >= 500 {
+			name = ErrorInternal
+		} else {
+			name = ErrorInvalidRequest
+		}
+	}
+	return he.Code, ErrorResponse{Error: name, Message: fmt.Sprint(he.Message)}
+}
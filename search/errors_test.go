@@ -0,0 +1,84 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorResponses(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{
+		PostIndex:    "palomar_post",
+		ProfileIndex: "palomar_profile",
+		QueryTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.HTTPErrorHandler = s.errorHandler
+
+	// runs a request through the handler, and the error handler for any returned error
+	request := func(h echo.HandlerFunc, path string) (int, ErrorResponse) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if err := h(c); err != nil {
+			e.HTTPErrorHandler(err, c)
+		}
+		var resp ErrorResponse
+		assert.NoError(json.Unmarshal(rec.Body.Bytes(), &resp), path)
+		return rec.Code, resp
+	}
+
+	for _, tc := range []struct {
+		handler echo.HandlerFunc
+		path    string
+		status  int
+		name    string
+	}{
+		{s.handleSearchPostsSkeleton, "/xrpc/app.bsky.unspecced.searchPostsSkeleton", 400, ErrorEmptyQuery},
+		{s.handleSearchPostsSkeleton, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&cursor=-", 400, ErrorInvalidCursor},
+		{s.handleSearchPostsSkeleton, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&limit=many", 400, ErrorInvalidLimit},
+		{s.handleSearchPostsSkeleton, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&sort=oldest", 400, ErrorInvalidRequest},
+		{s.handleSearchPostsSkeleton, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello", 504, ErrorSearchTimeout},
+		{s.handleSearchActorsSkeleton, "/xrpc/app.bsky.unspecced.searchActorsSkeleton?q=", 400, ErrorEmptyQuery},
+		{s.handleSearchActorsStructured, "/search/actors?q=hello&cursor=1000000", 400, ErrorInvalidCursor},
+		{s.handleSearchPostsDetailed, "/search/posts/detailed?q=hello&explain=true", 403, ErrorForbidden},
+		{s.handleLookupPost, "/search/posts/lookup", 400, ErrorInvalidRequest},
+	} {
+		status, resp := request(tc.handler, tc.path)
+		assert.Equal(tc.status, status, tc.path)
+		assert.Equal(tc.name, resp.Error, tc.path)
+		assert.NotEmpty(resp.Message, tc.path)
+	}
+
+	// backend failures don't expose the cluster error
+	status, resp := errorResponse(searchError(fmt.Errorf("connection refused")))
+	assert.Equal(500, status)
+	assert.Equal(ErrorBackendFailure, resp.Error)
+	assert.NotContains(resp.Message, "refused")
+	status, resp = errorResponse(searchError(fmt.Errorf("wrapped: %w", context.DeadlineExceeded)))
+	assert.Equal(504, status)
+	assert.Equal(ErrorSearchTimeout, resp.Error)
+
+	// errors from echo itself
+	status, resp = errorResponse(echo.ErrNotFound)
+	assert.Equal(404, status)
+	assert.Equal(ErrorNotFound, resp.Error)
+	status, resp = errorResponse(fmt.Errorf("oops"))
+	assert.Equal(500, status)
+	assert.Equal(ErrorInternal, resp.Error)
+}
@@ -115,6 +115,25 @@ func (idx *Indexer) RunIndexer(ctx context.Context) error {
 			return nil
 
 		},
+		RepoAccount: func(evt *comatproto.SyncSubscribeRepos_Account) error {
+			ctx := context.Background()
+			ctx, span := tracer.Start(ctx, "RepoAccount")
+			defer span.End()
+
+			// only account deletion is handled. other inactive statuses (eg, takedowns or deactivation) may be reversed, so content stays in the index
+			if evt.Active || evt.Status == nil || *evt.Status != "deleted" {
+				return nil
+			}
+			did, err := syntax.ParseDID(evt.Did)
+			if err != nil {
+				idx.logger.Error("bad DID in RepoAccount event", "did", evt.Did, "seq", evt.Seq, "err", err)
+				return nil
+			}
+			if err := idx.DeleteAccount(ctx, did); err != nil {
+				idx.logger.Error("failed to delete account from index", "did", evt.Did, "seq", evt.Seq, "err", err)
+			}
+			return nil
+		},
 		RepoHandle: func(evt *comatproto.SyncSubscribeRepos_Handle) error {
 			ctx := context.Background()
 			ctx, span := tracer.Start(ctx, "RepoHandle")
@@ -271,10 +290,14 @@ func (idx *Indexer) handleDelete(ctx context.Context, rawDID, rev, path string)
 	switch {
 	// TODO: handle profile deletes, its an edge case, but worth doing still
 	case strings.Contains(path, "app.bsky.feed.post"):
-		if err := idx.deletePost(ctx, did, path); err != nil {
+		uri, err := syntax.ParseATURI(fmt.Sprintf("at://%s/%s", did, path))
+		if err != nil {
+			idx.logger.Warn("skipping post delete with malformed path", "did", did, "path", path)
+			return nil
+		}
+		if err := idx.DeletePost(ctx, uri); err != nil {
 			return err
 		}
-		postsDeleted.Inc()
 	case strings.Contains(path, "app.bsky.actor.profile"):
 		// profilesDeleted.Inc()
 	}
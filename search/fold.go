@@ -0,0 +1,42 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Latin letters which don't decompose to an ASCII base letter plus combining marks, folded the same way as the "asciifolding" token filter
+var foldSpecialLetters = strings.NewReplacer(
+	"ß", "ss",
+	"ø", "o",
+	"æ", "ae",
+	"œ", "oe",
+	"đ", "d",
+	"ł", "l",
+	"þ", "th",
+	"ð", "d",
+	"ı", "i",
+)
+
+// foldText lower-cases text and strips diacritics from Latin letters (eg, "José" becomes "jose"), to match the "asciifolding" analysis of profile handle and display name fields.
+//
+// Combining marks on other scripts (eg, Japanese dakuten) are significant and left as-is, as are query syntax characters (quotes, operators).
+func foldText(text string) string {
+	decomposed := norm.NFD.String(foldSpecialLetters.Replace(strings.ToLower(text)))
+	var b strings.Builder
+	b.Grow(len(decomposed))
+	latinBase := false
+	for _, r := range decomposed {
+		if unicode.Is(unicode.Mn, r) {
+			if latinBase {
+				continue
+			}
+		} else {
+			latinBase = unicode.Is(unicode.Latin, r)
+		}
+		b.WriteRune(r)
+	}
+	return norm.NFC.String(b.String())
+}
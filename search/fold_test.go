@@ -0,0 +1,77 @@
+package search
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFoldText(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		text   string
+		folded string
+	}{
+		{"jose", "jose"},
+		{"José", "jose"},
+		{"JOSÉ", "jose"},
+		{"JoSe", "jose"},
+		// decomposed (NFD) input folds the same as composed
+		{"Jose\u0301", "jose"},
+		{"Zoë Çelik-Ångström", "zoe celik-angstrom"},
+		{"Straße Ørsted Æsir", "strasse orsted aesir"},
+		{"\"josé maría\" -Peña", "\"jose maria\" -pena"},
+		{"handle.bsky.social", "handle.bsky.social"},
+		// combining marks on non-Latin scripts are significant
+		{"がんばる", "がんばる"},
+		{"Привет Йошка", "привет йошка"},
+		{"", ""},
+	}
+	for _, f := range fixtures {
+		assert.Equal(f.folded, foldText(f.text), f.text)
+	}
+
+	// folding is idempotent, and equivalent inputs fold to the same thing in either direction
+	for _, pair := range [][2]string{{"José", "jose"}, {"jOsÉ", "JOSE"}, {"Renée", "renee"}} {
+		assert.Equal(foldText(pair[0]), foldText(pair[1]))
+		assert.Equal(foldText(pair[0]), foldText(foldText(pair[0])))
+	}
+}
+
+func TestSearchProfilesFoldsQuery(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := identity.NewMockDirectory()
+
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"took": 1, "hits": {"total": {"value": 0, "relation": "eq"}, "hits": []}}`))
+	}))
+	defer srv.Close()
+	escli, err := es.NewClient(es.Config{Addresses: []string{srv.URL}, DisableRetry: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := &OpenSearchClient{Client: escli}
+
+	_, err = DoSearchProfiles(ctx, &dir, cli, "palomar_profile", &ActorSearchParams{Query: "José", Fuzzy: true, Size: 10})
+	assert.NoError(err)
+	assert.Contains(body, `"query":"jose"`)
+	assert.NotContains(body, "José")
+	assert.Contains(body, "display_name.folded")
+
+	_, err = DoSearchProfilesTypeahead(ctx, cli, "palomar_profile", &ActorSearchParams{Query: "JOSÉ", Size: 10})
+	assert.NoError(err)
+	assert.Contains(body, `"query":"jose"`)
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
 	"github.com/bluesky-social/indigo/atproto/syntax"
@@ -20,15 +22,54 @@ import (
 
 var tracer = otel.Tracer("search")
 
-func parseCursorLimit(e echo.Context) (int, int, error) {
+// parseDatetimeParam parses a timestamp query parameter, which may be either an integer number of milliseconds since the unix epoch, or an RFC 3339 datetime
+func parseDatetimeParam(val string) (syntax.Datetime, error) {
+	if ms, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return syntax.Datetime(time.UnixMilli(ms).UTC().Format(syntax.AtprotoDatetimeLayout)), nil
+	}
+	if dt, err := syntax.ParseDatetime(val); err == nil {
+		return dt, nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return "", err
+	}
+	return syntax.Datetime(t.UTC().Format(syntax.AtprotoDatetimeLayout)), nil
+}
+
+// parseCursor returns the "cursor" HTTP query parameter, if any. If cursor signing is enabled, the signature is verified and removed.
+func (s *Server) parseCursor(e echo.Context) (string, error) {
+	c := strings.TrimSpace(e.QueryParam("cursor"))
+	if c == "" || s.cursorKey == nil {
+		return c, nil
+	}
+	cursor, err := verifyCursor(s.cursorKey, c)
+	if err != nil {
+		return "", apiError(400, ErrorInvalidCursor, fmt.Sprintf("invalid value for 'cursor': %s", err))
+	}
+	return cursor, nil
+}
+
+// signCursor signs an output cursor, if cursor signing is enabled
+func (s *Server) signCursor(cursor *string) *string {
+	if cursor == nil || s.cursorKey == nil {
+		return cursor
+	}
+	signed := signCursor(s.cursorKey, *cursor)
+	return &signed
+}
+
+// parseCursorLimit parses integer offset cursor and limit HTTP query parameters, bounded by the server's configured maximums
+func (s *Server) parseCursorLimit(e echo.Context) (int, int, error) {
 	offset := 0
-	if c := strings.TrimSpace(e.QueryParam("cursor")); c != "" {
+	c, err := s.parseCursor(e)
+	if err != nil {
+		return 0, 0, err
+	}
+	if c != "" {
 		v, err := strconv.Atoi(c)
 		if err != nil {
-			return 0, 0, &echo.HTTPError{
-				Code:    400,
-				Message: fmt.Sprintf("invalid value for 'cursor': %s", err),
-			}
+			return 0, 0, apiError(400, ErrorInvalidCursor, fmt.Sprintf("invalid value for 'cursor': %s", err))
 		}
 		offset = v
 	}
@@ -36,180 +77,493 @@ func parseCursorLimit(e echo.Context) (int, int, error) {
 	if offset < 0 {
 		offset = 0
 	}
-	if offset > 10000 {
-		return 0, 0, &echo.HTTPError{
-			Code:    400,
-			Message: "invalid value for 'cursor' (can't paginate so deep)",
+	if offset > s.maxOffset {
+		return 0, 0, apiError(400, ErrorInvalidCursor, "invalid value for 'cursor' (can't paginate so deep)")
+	}
+
+	limit, err := s.parseLimit(e)
+	if err != nil {
+		return 0, 0, err
+	}
+	if s.maxResults > 0 {
+		if offset >= s.maxResults {
+			return 0, 0, apiError(400, ErrorInvalidCursor, "invalid value for 'cursor' (beyond the maximum number of results)")
+		}
+		// the last page is shortened, so that no results past the cap are returned
+		if offset+limit > s.maxResults {
+			limit = s.maxResults - offset
 		}
 	}
+	return offset, limit, nil
+}
 
+func (s *Server) parseLimit(e echo.Context) (int, error) {
 	limit := 25
 	if l := strings.TrimSpace(e.QueryParam("limit")); l != "" {
 		v, err := strconv.Atoi(l)
 		if err != nil {
-			return 0, 0, &echo.HTTPError{
-				Code:    400,
-				Message: fmt.Sprintf("invalid value for 'count': %s", err),
-			}
+			return 0, apiError(400, ErrorInvalidLimit, fmt.Sprintf("invalid value for 'limit': %s", err))
 		}
 
 		limit = v
 	}
 
-	if limit > 100 {
-		limit = 100
+	if limit > s.maxLimit {
+		limit = s.maxLimit
 	}
 	if limit < 0 {
 		limit = 0
 	}
-	return offset, limit, nil
+	return limit, nil
 }
 
-func (s *Server) handleSearchPostsSkeleton(e echo.Context) error {
-	ctx, span := tracer.Start(e.Request().Context(), "handleSearchPostsSkeleton")
-	defer span.End()
-
-	span.SetAttributes(attribute.String("query", e.QueryParam("q")))
-
+// parsePostSearchParams parses post search HTTP query parameters, shared by the skeleton and detailed endpoints.
+//
+// If there is an error, the returned params are nil. Invalid request parameters are reported as API error responses (see apiError).
+func (s *Server) parsePostSearchParams(e echo.Context) (*PostSearchParams, error) {
 	q := strings.TrimSpace(e.QueryParam("q"))
 	if q == "" {
-		return e.JSON(400, map[string]any{
-			"error": "must pass non-empty search query",
-		})
+		return nil, apiError(400, ErrorEmptyQuery, "must pass non-empty search query")
+	}
+
+	sort := strings.TrimSpace(e.QueryParam("sort"))
+	switch sort {
+	case "":
+		sort = "latest"
+	case "latest", "top":
+	default:
+		return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid value for 'sort' (expected 'top' or 'latest'): %s", sort))
 	}
 
 	params := PostSearchParams{
 		Query: q,
-		// TODO: parse/validate the sort options here?
-		Sort:   e.QueryParam("sort"),
-		Domain: e.QueryParam("domain"),
-		URL:    e.QueryParam("url"),
+		Sort:  sort,
+		URL:   e.QueryParam("url"),
+	}
+
+	for _, domain := range e.Request().URL.Query()["domain"] {
+		domain = strings.TrimSpace(domain)
+		if domain != "" {
+			params.Domains = append(params.Domains, domain)
+		}
 	}
 
 	viewerStr := e.QueryParam("viewer")
 	if viewerStr != "" {
 		d, err := syntax.ParseDID(viewerStr)
 		if err != nil {
-			return e.JSON(400, map[string]any{
-				"error":   "BadRequest",
-				"message": fmt.Sprintf("invalid DID for 'viewer': %s", err),
-			})
+			return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid DID for 'viewer': %s", err))
 		}
 		params.Viewer = &d
 	}
-	authorStr := e.QueryParam("author")
-	if authorStr != "" {
+	// the first author is the primary Author filter; any more (repeated params) are combined with it according to 'actors_mode'
+	for _, authorStr := range e.Request().URL.Query()["author"] {
+		if authorStr == "" {
+			continue
+		}
 		atid, err := syntax.ParseAtIdentifier(authorStr)
 		if err != nil {
-			return &echo.HTTPError{
-				Code:    400,
-				Message: fmt.Sprintf("invalid DID for 'author': %s", err),
-			}
+			return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid DID for 'author': %s", err))
 		}
+		var did syntax.DID
 		if atid.IsHandle() {
 			ident, err := s.dir.Lookup(e.Request().Context(), *atid)
 			if err != nil {
-				return e.JSON(400, map[string]any{
-					"error":   "BadRequest",
-					"message": fmt.Sprintf("invalid Handle for 'author': %s", err),
-				})
+				return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid Handle for 'author': %s", err))
 			}
-			params.Author = &ident.DID
+			did = ident.DID
 		} else {
-			d, err := atid.AsDID()
+			did, err = atid.AsDID()
 			if err != nil {
-				return err
+				return nil, err
 			}
-			params.Author = &d
+		}
+		if params.Author == nil {
+			params.Author = &did
+		} else {
+			params.Authors = append(params.Authors, did)
 		}
 	}
 
-	mentionsStr := e.QueryParam("mentions")
-	if mentionsStr != "" {
+	for _, mentionsStr := range e.Request().URL.Query()["mentions"] {
+		mentionsStr = strings.TrimPrefix(strings.TrimSpace(mentionsStr), "@")
+		if mentionsStr == "" {
+			continue
+		}
 		atid, err := syntax.ParseAtIdentifier(mentionsStr)
 		if err != nil {
-			return &echo.HTTPError{
-				Code:    400,
-				Message: fmt.Sprintf("invalid DID for 'mentions': %s", err),
-			}
+			return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid DID for 'mentions': %s", err))
 		}
 		if atid.IsHandle() {
 			ident, err := s.dir.Lookup(e.Request().Context(), *atid)
 			if err != nil {
-				return e.JSON(400, map[string]any{
-					"error":   "BadRequest",
-					"message": fmt.Sprintf("invalid Handle for 'mentions': %s", err),
-				})
+				return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid Handle for 'mentions': %s", err))
 			}
-			params.Mentions = &ident.DID
+			params.Mentions = append(params.Mentions, ident.DID)
 		} else {
 			d, err := atid.AsDID()
 			if err != nil {
-				return err
+				return nil, err
 			}
-			params.Mentions = &d
+			params.Mentions = append(params.Mentions, d)
 		}
 	}
 
-	sinceStr := e.QueryParam("since")
-	if sinceStr != "" {
-		dt, err := syntax.ParseDatetime(sinceStr)
+	// excluded actors can be repeated, or comma-separated
+	var excluded []string
+	for _, val := range e.Request().URL.Query()["exclude_actors"] {
+		for _, actor := range strings.Split(val, ",") {
+			actor = strings.TrimPrefix(strings.TrimSpace(actor), "@")
+			if actor != "" {
+				excluded = append(excluded, actor)
+			}
+		}
+	}
+	if len(excluded) > maxExcludeActors {
+		return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("too many values for 'exclude_actors' (%d, max %d)", len(excluded), maxExcludeActors))
+	}
+	var excludedHandles []syntax.Handle
+	for _, actor := range excluded {
+		atid, err := syntax.ParseAtIdentifier(actor)
 		if err != nil {
-			return e.JSON(400, map[string]any{
-				"error":   "BadRequest",
-				"message": fmt.Sprintf("invalid Datetime for 'since': %s", err),
-			})
+			return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid DID or Handle for 'exclude_actors': %s", err))
+		}
+		if atid.IsHandle() {
+			h, err := atid.AsHandle()
+			if err != nil {
+				return nil, err
+			}
+			excludedHandles = append(excludedHandles, h)
+		} else {
+			d, err := atid.AsDID()
+			if err != nil {
+				return nil, err
+			}
+			params.ExcludeActors = append(params.ExcludeActors, d)
 		}
-		params.Since = &dt
 	}
-
-	untilStr := e.QueryParam("until")
-	if untilStr != "" {
-		dt, err := syntax.ParseDatetime(untilStr)
+	if len(excludedHandles) > maxExcludeActorHandles {
+		return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("too many handles for 'exclude_actors' (%d, max %d); pass DIDs instead", len(excludedHandles), maxExcludeActorHandles))
+	}
+	params.ExcludeActors = append(params.ExcludeActors, s.resolveExcludedHandles(e.Request().Context(), excludedHandles)...)
+
+	// "from" and "to" are accepted as aliases for "since" and "until"
+	for _, bound := range []struct {
+		name  string
+		alias string
+		dest  **syntax.Datetime
+	}{
+		{name: "since", alias: "from", dest: &params.Since},
+		{name: "until", alias: "to", dest: &params.Until},
+	} {
+		name := bound.name
+		val := strings.TrimSpace(e.QueryParam(name))
+		if val == "" {
+			name = bound.alias
+			val = strings.TrimSpace(e.QueryParam(name))
+		}
+		if val == "" {
+			continue
+		}
+		dt, err := parseDatetimeParam(val)
 		if err != nil {
-			return e.JSON(400, map[string]any{
-				"error":   "BadRequest",
-				"message": fmt.Sprintf("invalid Datetime for 'until': %s", err),
-			})
+			return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid value for '%s' (expected RFC 3339 datetime or unix milliseconds): %s", name, val))
 		}
-		params.Until = &dt
+		*bound.dest = &dt
+	}
+	// an inverted range would silently match nothing
+	// 'until' is exclusive, so an equal pair can never match either
+	if params.Since != nil && params.Until != nil && !params.Since.Time().Before(params.Until.Time()) {
+		return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("'since' (%s) must be before 'until' (%s)", params.Since, params.Until))
 	}
 
-	langStr := e.QueryParam("lang")
-	if langStr != "" {
+	for _, langStr := range e.Request().URL.Query()["lang"] {
+		if langStr == "" {
+			continue
+		}
 		l, err := syntax.ParseLanguage(langStr)
 		if err != nil {
-			return e.JSON(400, map[string]any{
-				"error":   "BadRequest",
-				"message": fmt.Sprintf("invalid Language for 'lang': %s", err),
-			})
+			return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid Language for 'lang': %s", err))
 		}
-		params.Lang = &l
+		if params.Lang == nil {
+			params.Lang = &l
+		} else {
+			params.Langs = append(params.Langs, l)
+		}
+	}
+	if rootStr := strings.TrimSpace(e.QueryParam("thread_root")); rootStr != "" {
+		root, err := syntax.ParseATURI(rootStr)
+		if err == nil && (root.Collection() != syntax.NSID("app.bsky.feed.post") || root.RecordKey() == "") {
+			err = fmt.Errorf("not a post record URI")
+		}
+		if err != nil {
+			return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid AT-URI for 'thread_root': %s", err))
+		}
+		params.ThreadRoot = &root
 	}
 	// TODO: could be multiple tag params; guess we should "bind"?
 	tags := e.Request().URL.Query()["tags"]
 	if len(tags) > 0 {
 		params.Tags = tags
 	}
+	if t := strings.TrimSpace(e.QueryParam("track_total_hits")); t == "true" || t == "1" || t == "y" {
+		params.TrackTotalHits = true
+	}
+	if et := strings.TrimSpace(e.QueryParam("embed_type")); et != "" {
+		if !slices.Contains(PostEmbedTypes, et) {
+			return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid value for 'embed_type' (expected one of %s): %s", strings.Join(PostEmbedTypes, ", "), et))
+		}
+		params.EmbedType = et
+	}
+	for _, f := range []struct {
+		name string
+		dest *bool
+	}{
+		{"has_image", &params.HasImage},
+		{"has_video", &params.HasVideo},
+		{"has_link", &params.HasLink},
+		{"is_quote", &params.IsQuote},
+	} {
+		if t := strings.TrimSpace(e.QueryParam(f.name)); t == "true" || t == "1" || t == "y" {
+			*f.dest = true
+		}
+	}
+	if t := strings.TrimSpace(e.QueryParam("include_quoted")); t == "true" || t == "1" || t == "y" {
+		params.IncludeQuoted = true
+	}
+	if t := strings.TrimSpace(e.QueryParam("langs_include_detected")); t == "true" || t == "1" || t == "y" {
+		params.LangIncludeDetected = true
+	}
 
-	offset, limit, err := parseCursorLimit(e)
+	if rb := strings.TrimSpace(e.QueryParam("recency_boost")); rb != "" && rb != "false" && rb != "0" {
+		scale, err := parseRecencyBoost(rb)
+		if err != nil {
+			return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid value for 'recency_boost': %s", err))
+		}
+		params.RecencyBoost = scale
+	}
+	if mm := strings.TrimSpace(e.QueryParam("min_match")); mm != "" {
+		val, err := parseMinMatch(mm)
+		if err != nil {
+			return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid value for 'min_match': %s", err))
+		}
+		params.MinMatch = val
+	}
+
+	// retried searches multiply backend load, so waiting is only for operators (eg, integration tests and tooling)
+	if wf := strings.TrimSpace(e.QueryParam("wait_for")); wf != "" {
+		if !s.isAdmin(e) {
+			return nil, apiError(http.StatusForbidden, ErrorForbidden, "'wait_for' requires admin auth")
+		}
+		uri, err := syntax.ParseATURI(wf)
+		if err == nil && (uri.Collection() != syntax.NSID("app.bsky.feed.post") || uri.RecordKey() == "" || !uri.Authority().IsDID()) {
+			err = fmt.Errorf("not a post record URI with a DID")
+		}
+		if err != nil {
+			return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid AT-URI for 'wait_for': %s", err))
+		}
+		params.WaitFor = uri.Authority().String() + "_" + uri.RecordKey().String()
+	}
+
+	for _, m := range []struct {
+		name string
+		dest *string
+	}{
+		{"tags_mode", &params.TagsMode},
+		{"actors_mode", &params.ActorsMode},
+		{"langs_mode", &params.LangsMode},
+	} {
+		switch mode := strings.TrimSpace(e.QueryParam(m.name)); mode {
+		case "", "all":
+			*m.dest = "all"
+		case "any":
+			*m.dest = "any"
+		default:
+			return nil, apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid value for '%s' (expected 'any' or 'all'): %s", m.name, mode))
+		}
+	}
+
+	// integer cursors are offsets; anything else is an opaque "search_after" cursor
+	c, err := s.parseCursor(e)
 	if err != nil {
-		span.SetAttributes(attribute.String("error", fmt.Sprintf("invalid cursor/limit: %s", err)))
-		span.SetStatus(codes.Error, err.Error())
-		return err
+		return nil, err
+	}
+	if c != "" && !isOffsetCursor(c) {
+		// deep pagination cursors are only issued past the offset limit, which is beyond the result cap
+		if s.maxResults > 0 {
+			return nil, apiError(400, ErrorInvalidCursor, "invalid value for 'cursor' (beyond the maximum number of results)")
+		}
+		after, err := decodeSearchAfterCursor(c)
+		if err != nil {
+			return nil, apiError(400, ErrorInvalidCursor, fmt.Sprintf("invalid value for 'cursor': %s", err))
+		}
+		// eg, a cursor issued for a different sort order
+		if len(after) != len(params.SortClause()) {
+			return nil, apiError(400, ErrorInvalidCursor, "invalid value for 'cursor' (does not match sort order)")
+		}
+		params.After = after
+	}
+
+	if c := strings.TrimSpace(e.QueryParam("collapse")); c == "true" || c == "1" || c == "y" {
+		if params.After != nil {
+			return nil, apiError(400, ErrorInvalidRequest, "'collapse' can't be combined with deep pagination cursors")
+		}
+		params.Collapse = true
+	}
+
+	var offset, limit int
+	if params.After != nil {
+		limit, err = s.parseLimit(e)
+	} else {
+		offset, limit, err = s.parseCursorLimit(e)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	params.Offset = offset
 	params.Size = limit
-	span.SetAttributes(attribute.Int("offset", offset), attribute.Int("limit", limit))
+	params.MaxResults = s.maxResults
+	return &params, nil
+}
+
+// resolveExcludedHandles resolves handles concurrently, returning the DIDs in the same order. Handles which fail to resolve are skipped: an account which can't be resolved is no reason to fail the whole search.
+func (s *Server) resolveExcludedHandles(ctx context.Context, handles []syntax.Handle) []syntax.DID {
+	resolved := make([]syntax.DID, len(handles))
+	var wg sync.WaitGroup
+	for i, h := range handles {
+		wg.Add(1)
+		go func(i int, h syntax.Handle) {
+			defer wg.Done()
+			ident, err := s.dir.LookupHandle(ctx, h.Normalize())
+			if err != nil {
+				s.logger.Info("skipping unresolvable handle in 'exclude_actors'", "handle", h, "err", err)
+				return
+			}
+			resolved[i] = ident.DID
+		}(i, h)
+	}
+	wg.Wait()
+
+	dids := make([]syntax.DID, 0, len(handles))
+	for _, d := range resolved {
+		if d != "" {
+			dids = append(dids, d)
+		}
+	}
+	return dids
+}
+
+func (s *Server) handleSearchPostsSkeleton(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleSearchPostsSkeleton")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("query", e.QueryParam("q")))
 
-	out, err := s.SearchPosts(ctx, &params)
+	params, err := s.parsePostSearchParams(e)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("invalid params: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	span.SetAttributes(
+		attribute.String("sort", params.Sort),
+		attribute.Int("offset", params.Offset),
+		attribute.Int("limit", params.Size),
+		attribute.Bool("search_after", params.After != nil),
+	)
+
+	out, authors, err := s.searchPostsSkeleton(ctx, params)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", fmt.Sprintf("failed to SearchPosts: %s", err)))
 		span.SetStatus(codes.Error, err.Error())
+		return searchError(err)
+	}
+
+	span.SetAttributes(attribute.Int("posts.length", len(out.Posts)))
+
+	if a := strings.TrimSpace(e.QueryParam("include_author")); a == "true" || a == "1" || a == "y" {
+		withAuthors := SearchPostsSkeletonWithAuthorsOutput{
+			UnspeccedSearchPostsSkeleton_Output: *out,
+			Authors:                             make([]SkeletonPostAuthor, len(out.Posts)),
+		}
+		for i, p := range out.Posts {
+			withAuthors.Authors[i] = SkeletonPostAuthor{URI: p.Uri, DID: authors[i].String()}
+		}
+		return e.JSON(200, withAuthors)
+	}
+
+	return e.JSON(200, out)
+}
+
+// Author of a post search hit, as indexed
+type SkeletonPostAuthor struct {
+	URI string `json:"uri"`
+	DID string `json:"did"`
+}
+
+// Post search skeleton output (as specified in the lexicon), with an additional list of post authors, in the same order as the posts. Returned by the skeleton endpoint with "include_author=true".
+type SearchPostsSkeletonWithAuthorsOutput struct {
+	appbsky.UnspeccedSearchPostsSkeleton_Output
+	Authors []SkeletonPostAuthor `json:"authors"`
+}
+
+func (s *Server) handleSearchPostsDetailed(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleSearchPostsDetailed")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("query", e.QueryParam("q")))
+
+	params, err := s.parsePostSearchParams(e)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("invalid params: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
+	if h := strings.TrimSpace(e.QueryParam("highlight")); h == "true" || h == "1" || h == "y" {
+		params.Highlight = true
+	}
+	// scoring explanations expose ranking internals, so are only available to operators
+	if x := strings.TrimSpace(e.QueryParam("explain")); x == "true" || x == "1" || x == "y" {
+		if !s.isAdmin(e) {
+			return apiError(http.StatusForbidden, ErrorForbidden, "'explain' requires admin auth")
+		}
+		params.Explain = true
+	}
+
+	// facets can be repeated, or comma-separated. 'facet' is accepted as an alias
+	qp := e.Request().URL.Query()
+	for _, val := range append(qp["facets"], qp["facet"]...) {
+		for _, name := range strings.Split(val, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || slices.Contains(params.Facets, name) {
+				continue
+			}
+			if _, ok := PostFacetFields[name]; !ok {
+				return apiError(400, ErrorInvalidRequest, fmt.Sprintf("unsupported value for 'facets': %s", name))
+			}
+			params.Facets = append(params.Facets, name)
+		}
+	}
+
+	span.SetAttributes(
+		attribute.String("sort", params.Sort),
+		attribute.Int("offset", params.Offset),
+		attribute.Int("limit", params.Size),
+		attribute.Bool("search_after", params.After != nil),
+		attribute.Bool("highlight", params.Highlight),
+		attribute.Bool("explain", params.Explain),
+		attribute.StringSlice("facets", params.Facets),
+	)
+
+	out, err := s.SearchPostsDetailed(ctx, params)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("failed to SearchPostsDetailed: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return searchError(err)
+	}
+
 	span.SetAttributes(attribute.Int("posts.length", len(out.Posts)))
 
 	return e.JSON(200, out)
@@ -223,13 +577,10 @@ func (s *Server) handleSearchActorsSkeleton(e echo.Context) error {
 
 	q := strings.TrimSpace(e.QueryParam("q"))
 	if q == "" {
-		return e.JSON(400, map[string]any{
-			"error":   "BadRequest",
-			"message": "must pass non-empty search query",
-		})
+		return apiError(400, ErrorEmptyQuery, "must pass non-empty search query")
 	}
 
-	offset, limit, err := parseCursorLimit(e)
+	offset, limit, err := s.parseCursorLimit(e)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", fmt.Sprintf("invalid cursor/limit: %s", err)))
 		span.SetStatus(codes.Error, err.Error())
@@ -241,87 +592,521 @@ func (s *Server) handleSearchActorsSkeleton(e echo.Context) error {
 		typeahead = true
 	}
 
+	fuzzy := false
+	if q := strings.TrimSpace(e.QueryParam("fuzzy")); q == "true" || q == "1" || q == "y" {
+		fuzzy = true
+	}
+
 	params := ActorSearchParams{
-		Query:     q,
-		Typeahead: typeahead,
-		Offset:    offset,
-		Size:      limit,
+		Query:      q,
+		Typeahead:  typeahead,
+		Fuzzy:      fuzzy,
+		Offset:     offset,
+		Size:       limit,
+		MaxResults: s.maxResults,
 	}
 
 	viewerStr := e.QueryParam("viewer")
 	if viewerStr != "" {
 		d, err := syntax.ParseDID(viewerStr)
 		if err != nil {
-			return e.JSON(400, map[string]any{
-				"error":   "BadRequest",
-				"message": fmt.Sprintf("invalid DID for 'viewer': %s", err),
-			})
+			return apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid DID for 'viewer': %s", err))
 		}
 		params.Viewer = &d
 	}
 
+	for _, name := range []string{"require_labels", "exclude_labels"} {
+		labels, err := parseAccountLabelsParam(e.Request().URL.Query()[name])
+		if err != nil {
+			return apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid value for '%s': %s", name, err))
+		}
+		if name == "require_labels" {
+			params.RequireLabels = labels
+		} else {
+			params.ExcludeLabels = labels
+		}
+	}
+
+	// defaults to the server config; can be toggled per-request, eg to compare against the raw relevance ranking
+	params.SpamPenalty = s.profileSpamPenalty
+	if v := strings.TrimSpace(e.QueryParam("spam_penalty")); v != "" {
+		params.SpamPenalty = v == "true" || v == "1" || v == "y"
+	}
+
 	span.SetAttributes(
 		attribute.Int("offset", offset),
 		attribute.Int("limit", limit),
 		attribute.Bool("typeahead", typeahead),
+		attribute.Bool("fuzzy", fuzzy),
 	)
 
 	out, err := s.SearchProfiles(ctx, &params)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", fmt.Sprintf("failed to SearchProfiles: %s", err)))
 		span.SetStatus(codes.Error, err.Error())
+		return searchError(err)
+	}
+
+	span.SetAttributes(attribute.Int("actors.length", len(out.Actors)))
+
+	return e.JSON(200, out)
+}
+
+// parseAccountLabelsParam parses the values of an account label filter param (repeated, or comma-separated). Only labels in IndexedAccountLabels are allowed.
+func parseAccountLabelsParam(vals []string) ([]string, error) {
+	var labels []string
+	for _, val := range vals {
+		for _, label := range strings.Split(val, ",") {
+			label = strings.TrimSpace(label)
+			if label == "" || slices.Contains(labels, label) {
+				continue
+			}
+			if !isIndexedAccountLabel(label) {
+				return nil, fmt.Errorf("label not indexed: %s", label)
+			}
+			labels = append(labels, label)
+		}
+	}
+	return labels, nil
+}
+
+func (s *Server) handleSearchActorsStructured(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleSearchActorsStructured")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("query", e.QueryParam("q")))
+
+	q := strings.TrimSpace(e.QueryParam("q"))
+	if q == "" {
+		return apiError(400, ErrorEmptyQuery, "must pass non-empty search query")
+	}
+
+	offset, limit, err := s.parseCursorLimit(e)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("invalid cursor/limit: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
+	params := ActorSearchParams{
+		Query:      q,
+		Offset:     offset,
+		Size:       limit,
+		MaxResults: s.maxResults,
+	}
+
+	switch sort := strings.TrimSpace(e.QueryParam("sort")); sort {
+	case "", "relevance":
+		params.Sort = "relevance"
+	case "followers", "posts":
+		params.Sort = sort
+	default:
+		return apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid value for 'sort' (expected 'relevance', 'followers', or 'posts'): %s", sort))
+	}
+
+	if mf := strings.TrimSpace(e.QueryParam("min_followers")); mf != "" {
+		v, err := strconv.ParseInt(mf, 10, 64)
+		if err != nil || v < 0 {
+			return apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid value for 'min_followers' (expected non-negative integer): %s", mf))
+		}
+		params.MinFollowers = &v
+	}
+
+	for _, name := range []string{"require_labels", "exclude_labels"} {
+		labels, err := parseAccountLabelsParam(e.Request().URL.Query()[name])
+		if err != nil {
+			return apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid value for '%s': %s", name, err))
+		}
+		if name == "require_labels" {
+			params.RequireLabels = labels
+		} else {
+			params.ExcludeLabels = labels
+		}
+	}
+
+	// defaults to the server config; can be toggled per-request, eg to compare against the raw relevance ranking
+	params.SpamPenalty = s.profileSpamPenalty
+	if v := strings.TrimSpace(e.QueryParam("spam_penalty")); v != "" {
+		params.SpamPenalty = v == "true" || v == "1" || v == "y"
+	}
+
+	span.SetAttributes(
+		attribute.Int("offset", offset),
+		attribute.Int("limit", limit),
+		attribute.String("sort", params.Sort),
+	)
+
+	out, err := s.StructuredSearchProfiles(ctx, &params)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("failed to StructuredSearchProfiles: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return searchError(err)
+	}
+
 	span.SetAttributes(attribute.Int("actors.length", len(out.Actors)))
 
 	return e.JSON(200, out)
 }
 
+// How long a post search with PostSearchParams.WaitFor is retried, waiting for the post to become searchable. This is a bit more than the default index refresh interval (1s). Retries are also limited by the query timeout.
+const waitForTimeout = 3 * time.Second
+
+// Delay between retries of a post search with PostSearchParams.WaitFor
+const waitForInterval = 200 * time.Millisecond
+
+// doSearchPosts runs a post search. If params.WaitFor is set, and that post isn't in the results, the search is retried until it is, for up to waitForTimeout. This is for write-then-search flows (eg, integration tests), where a just-indexed post may not be searchable yet. The last results are returned if the post never shows up; it may simply not match the query.
+func (s *Server) doSearchPosts(ctx context.Context, params *PostSearchParams) (*EsSearchResponse, error) {
+	resp, err := doSearchPostsLimited(ctx, s.dir, s.searchcli, s.postIndex, params, s.searchLimits())
+	if err != nil || params.WaitFor == "" {
+		return resp, err
+	}
+	deadline := time.Now().Add(waitForTimeout)
+	for time.Now().Add(waitForInterval).Before(deadline) {
+		if slices.ContainsFunc(resp.Hits.Hits, func(h EsSearchHit) bool { return h.ID == params.WaitFor }) {
+			return resp, nil
+		}
+		select {
+		case <-ctx.Done():
+			return resp, nil
+		case <-time.After(waitForInterval):
+		}
+		next, err := doSearchPostsLimited(ctx, s.dir, s.searchcli, s.postIndex, params, s.searchLimits())
+		if err != nil {
+			if ctx.Err() != nil {
+				// ran out of time waiting; return the results we have
+				return resp, nil
+			}
+			return nil, err
+		}
+		resp = next
+	}
+	return resp, nil
+}
+
 func (s *Server) SearchPosts(ctx context.Context, params *PostSearchParams) (*appbsky.UnspeccedSearchPostsSkeleton_Output, error) {
+	out, _, err := s.searchPostsSkeleton(ctx, params)
+	return out, err
+}
+
+// searchPostsSkeleton is SearchPosts, additionally returning the indexed author DID of each post (in the same order as the output posts)
+func (s *Server) searchPostsSkeleton(ctx context.Context, params *PostSearchParams) (_ *appbsky.UnspeccedSearchPostsSkeleton_Output, _ []syntax.DID, err error) {
 	ctx, span := tracer.Start(ctx, "SearchPosts")
 	defer span.End()
 
-	resp, err := DoSearchPosts(ctx, s.dir, s.escli, s.postIndex, params)
+	start := time.Now()
+	defer func() { observeSearch("posts", start, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	resp, err := s.doSearchPosts(ctx, params)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	posts := []*appbsky.UnspeccedDefs_SkeletonSearchPost{}
+	authors := []syntax.DID{}
 	for _, r := range resp.Hits.Hits {
 		var doc PostDoc
 		if err := json.Unmarshal(r.Source, &doc); err != nil {
-			return nil, fmt.Errorf("decoding post doc from search response: %w", err)
+			return nil, nil, fmt.Errorf("decoding post doc from search response: %w", err)
 		}
 
 		did, err := syntax.ParseDID(doc.DID)
 		if err != nil {
-			return nil, fmt.Errorf("invalid DID in indexed document: %w", err)
+			return nil, nil, fmt.Errorf("invalid DID in indexed document: %w", err)
 		}
 
 		posts = append(posts, &appbsky.UnspeccedDefs_SkeletonSearchPost{
 			Uri: fmt.Sprintf("at://%s/app.bsky.feed.post/%s", did, doc.RecordRkey),
 		})
+		authors = append(authors, did)
 	}
 
 	out := appbsky.UnspeccedSearchPostsSkeleton_Output{Posts: posts}
-	if len(posts) == params.Size && (params.Offset+params.Size) < 10000 {
-		s := fmt.Sprintf("%d", params.Offset+params.Size)
-		out.Cursor = &s
+	var truncated bool
+	out.Cursor, truncated, err = postSearchCursor(params, resp, s.maxOffset, s.maxResults)
+	if err != nil {
+		return nil, nil, err
 	}
-	if resp.Hits.Total.Relation == "eq" {
-		i := int64(resp.Hits.Total.Value)
-		out.HitsTotal = &i
+	out.Cursor = s.signCursor(out.Cursor)
+	span.SetAttributes(attribute.Bool("truncated", truncated))
+	// the lexicon allows this to be approximate, so include lower-bound ("gte") counts as well as exact ones
+	out.HitsTotal, _ = hitsTotal(resp)
+	return &out, authors, nil
+}
+
+func (s *Server) handleSearchPostsCount(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleSearchPostsCount")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("query", e.QueryParam("q")))
+
+	params, err := s.parsePostSearchParams(e)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("invalid params: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	out, err := s.CountPosts(ctx, params)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("failed to CountPosts: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return searchError(err)
+	}
+
+	span.SetAttributes(attribute.Int64("total", out.Total))
+
+	return e.JSON(200, out)
+}
+
+// handles lookup of a single post in the index, by AT-URI (or DID and rkey), for debugging. returns the indexed document as-is
+func (s *Server) handleLookupPost(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleLookupPost")
+	defer span.End()
+
+	var atid syntax.AtIdentifier
+	var rkey syntax.RecordKey
+	if raw := e.QueryParam("uri"); raw != "" {
+		aturi, err := syntax.ParseATURI(raw)
+		if err != nil || aturi.Collection() != "app.bsky.feed.post" || aturi.RecordKey() == "" {
+			return apiError(400, ErrorInvalidRequest, fmt.Sprintf("invalid post AT-URI: %s", raw))
+		}
+		atid = aturi.Authority()
+		rkey = aturi.RecordKey()
+	} else {
+		id, err := syntax.ParseAtIdentifier(e.QueryParam("did"))
+		if err == nil {
+			atid = *id
+			rkey, err = syntax.ParseRecordKey(e.QueryParam("rkey"))
+		}
+		if err != nil {
+			return apiError(400, ErrorInvalidRequest, "either 'uri', or 'did' and 'rkey', are required")
+		}
+	}
+
+	// documents are keyed by DID, so handles need to be resolved
+	did, err := atid.AsDID()
+	if err != nil {
+		ident, err := s.dir.Lookup(ctx, atid)
+		if err != nil {
+			return apiError(400, ErrorInvalidRequest, fmt.Sprintf("resolving handle: %s", err))
+		}
+		did = ident.DID
+	}
+	span.SetAttributes(attribute.String("did", did.String()), attribute.String("rkey", rkey.String()))
+
+	doc, err := s.LookupPost(ctx, did, rkey)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return searchError(err)
+	}
+	if doc == nil {
+		return apiError(404, ErrorNotFound, fmt.Sprintf("post not in index: at://%s/app.bsky.feed.post/%s", did, rkey))
+	}
+	// optionally confirm that the indexed version is the expected one
+	if cid := e.QueryParam("cid"); cid != "" && cid != doc.RecordCID {
+		return apiError(404, ErrorNotFound, fmt.Sprintf("post is indexed with a different CID: %s", doc.RecordCID))
+	}
+	return e.JSON(200, doc)
+}
+
+// LookupPost returns the indexed document for a single post, or nil if it isn't in the index
+func (s *Server) LookupPost(ctx context.Context, did syntax.DID, rkey syntax.RecordKey) (_ *PostDoc, err error) {
+	ctx, span := tracer.Start(ctx, "LookupPost")
+	defer span.End()
+
+	start := time.Now()
+	defer func() { observeSearch("posts_lookup", start, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	doc := PostDoc{DID: did.String(), RecordRkey: rkey.String()}
+	return DoLookupPost(ctx, s.searchcli, s.postIndex, doc.DocId())
+}
+
+type SearchPostsCountOutput struct {
+	Total int64 `json:"total"`
+	// Either "eq" (exact) or "gte" (lower bound)
+	Relation string `json:"relation"`
+}
+
+// CountPosts returns the total number of posts matching a search, using the same query as SearchPosts
+func (s *Server) CountPosts(ctx context.Context, params *PostSearchParams) (_ *SearchPostsCountOutput, err error) {
+	ctx, span := tracer.Start(ctx, "CountPosts")
+	defer span.End()
+
+	start := time.Now()
+	defer func() { observeSearch("posts_count", start, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	resp, err := DoCountPosts(ctx, s.dir, s.searchcli, s.postIndex, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// the _count API is always exact
+	return &SearchPostsCountOutput{Total: resp.Count, Relation: "eq"}, nil
+}
+
+// Maximum number of highlighted text fragments returned per post
+const maxSnippets = 3
+
+var snippetTagStripper = strings.NewReplacer("<em>", "", "</em>", "")
+
+type FacetBucket struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type SearchPostsDetailedHit struct {
+	URI        string   `json:"uri"`
+	Snippets   []string `json:"snippets,omitempty"`
+	Duplicates int64    `json:"duplicates,omitempty"` // number of other posts with the same text collapsed in to this one
+	// relevance score and scoring explanation (as returned by the search cluster); only included in explain mode
+	Score       *float64        `json:"score,omitempty"`
+	Explanation json.RawMessage `json:"explanation,omitempty"`
+}
+
+// Extended version of the post search skeleton output, which can include highlighted text snippets for each hit.
+type SearchPostsDetailedOutput struct {
+	Cursor            *string                  `json:"cursor,omitempty"`
+	HitsTotal         *int64                   `json:"hitsTotal,omitempty"`
+	HitsTotalRelation *string                  `json:"hitsTotalRelation,omitempty"` // "eq" (exact) or "gte" (lower bound)
+	Posts             []SearchPostsDetailedHit `json:"posts"`
+	Facets            map[string][]FacetBucket `json:"facets,omitempty"`    // only included if facets were requested
+	Truncated         bool                     `json:"truncated,omitempty"` // true if there are more results, but no cursor because of the offset pagination limit
+}
+
+func (s *Server) SearchPostsDetailed(ctx context.Context, params *PostSearchParams) (_ *SearchPostsDetailedOutput, err error) {
+	ctx, span := tracer.Start(ctx, "SearchPostsDetailed")
+	defer span.End()
+
+	start := time.Now()
+	defer func() { observeSearch("posts_detailed", start, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	resp, err := s.doSearchPosts(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	posts := []SearchPostsDetailedHit{}
+	for _, r := range resp.Hits.Hits {
+		var doc PostDoc
+		if err := json.Unmarshal(r.Source, &doc); err != nil {
+			return nil, fmt.Errorf("decoding post doc from search response: %w", err)
+		}
+
+		did, err := syntax.ParseDID(doc.DID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DID in indexed document: %w", err)
+		}
+
+		hit := SearchPostsDetailedHit{
+			URI: fmt.Sprintf("at://%s/app.bsky.feed.post/%s", did, doc.RecordRkey),
+		}
+		// japanese text is indexed in both fields, so only fall back to text_ja if there were no other matches
+		frags := r.Highlight["text"]
+		if len(frags) == 0 {
+			frags = r.Highlight["text_ja"]
+		}
+		for _, frag := range frags {
+			if len(hit.Snippets) >= maxSnippets {
+				break
+			}
+			hit.Snippets = append(hit.Snippets, snippetTagStripper.Replace(frag))
+		}
+		if dupes, ok := r.InnerHits["dupes"]; ok && dupes.Hits.Total.Value > 1 {
+			hit.Duplicates = int64(dupes.Hits.Total.Value - 1)
+		}
+		if params.Explain {
+			score := r.Score
+			hit.Score = &score
+			hit.Explanation = r.Explanation
+		}
+		posts = append(posts, hit)
+	}
+
+	out := SearchPostsDetailedOutput{Posts: posts}
+	out.Cursor, out.Truncated, err = postSearchCursor(params, resp, s.maxOffset, s.maxResults)
+	if err != nil {
+		return nil, err
 	}
+	out.Cursor = s.signCursor(out.Cursor)
+	if len(params.Facets) > 0 {
+		out.Facets = map[string][]FacetBucket{}
+		for _, name := range params.Facets {
+			buckets := []FacetBucket{}
+			for _, b := range resp.Aggregations[name].Buckets {
+				buckets = append(buckets, FacetBucket{Value: b.Key, Count: b.DocCount})
+			}
+			out.Facets[name] = buckets
+		}
+	}
+	out.HitsTotal, out.HitsTotalRelation = hitsTotal(resp)
 	return &out, nil
 }
 
-func (s *Server) SearchProfiles(ctx context.Context, params *ActorSearchParams) (*appbsky.UnspeccedSearchActorsSkeleton_Output, error) {
+// hitsTotal returns the total hit count from a search response, along with whether it is exact ("eq") or a lower bound ("gte"). Both are nil if the response didn't include a count.
+func hitsTotal(resp *EsSearchResponse) (*int64, *string) {
+	rel := resp.Hits.Total.Relation
+	if rel != "eq" && rel != "gte" {
+		return nil, nil
+	}
+	i := int64(resp.Hits.Total.Value)
+	return &i, &rel
+}
+
+// postSearchCursor returns the cursor for the next page of post search results, if there is one. If there are more results but no cursor can be produced because of the offset pagination limit or the result cap (if maxResults is non-zero), truncated is true.
+func postSearchCursor(params *PostSearchParams, resp *EsSearchResponse, maxOffset, maxResults int) (cursor *string, truncated bool, err error) {
+	if len(resp.Hits.Hits) != params.Size || len(resp.Hits.Hits) == 0 {
+		return nil, false, nil
+	}
+	if maxResults > 0 && params.Offset+params.Size >= maxResults {
+		// the last page is shortened to end at the cap, so a full page doesn't mean there are more results; hits are counted up to the cap, and only a lower-bound count means there are any past it
+		more := resp.Hits.Total.Relation == "gte" || resp.Hits.Total.Value > params.Offset+len(resp.Hits.Hits)
+		return nil, more, nil
+	}
+	if params.After == nil && (params.Offset+params.Size) < maxOffset {
+		s := fmt.Sprintf("%d", params.Offset+params.Size)
+		return &s, false, nil
+	}
+	// collapsed results can't be paginated with "search_after"
+	if params.Collapse {
+		return nil, true, nil
+	}
+	// past the offset pagination limit (or already paginating that way), switch to an opaque "search_after" cursor
+	last := resp.Hits.Hits[len(resp.Hits.Hits)-1]
+	if len(last.Sort) == 0 {
+		return nil, true, nil
+	}
+	s, err := encodeSearchAfterCursor(last.Sort)
+	if err != nil {
+		return nil, false, fmt.Errorf("encoding search cursor: %w", err)
+	}
+	return &s, false, nil
+}
+
+func (s *Server) SearchProfiles(ctx context.Context, params *ActorSearchParams) (_ *appbsky.UnspeccedSearchActorsSkeleton_Output, err error) {
 	ctx, span := tracer.Start(ctx, "SearchProfiles")
 	defer span.End()
+
+	start := time.Now()
+	defer func() { observeSearch("profiles", start, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, s.queryTimeout)
+	defer cancel()
 	span.SetAttributes(
 		attribute.String("query", params.Query),
 		attribute.Bool("typeahead", params.Typeahead),
+		attribute.Bool("fuzzy", params.Fuzzy),
 		attribute.Int("offset", params.Offset),
 		attribute.Int("size", params.Size),
 	)
@@ -341,9 +1126,9 @@ func (s *Server) SearchProfiles(ctx context.Context, params *ActorSearchParams)
 		myQ.Follows = nil
 
 		if myQ.Typeahead {
-			globalResp, globalErr = DoSearchProfilesTypeahead(ctx, s.escli, s.profileIndex, &myQ)
+			globalResp, globalErr = doSearchProfilesTypeaheadLimited(ctx, s.searchcli, s.profileIndex, &myQ, s.searchLimits())
 		} else {
-			globalResp, globalErr = DoSearchProfiles(ctx, s.dir, s.escli, s.profileIndex, &myQ)
+			globalResp, globalErr = doSearchProfilesLimited(ctx, s.dir, s.searchcli, s.profileIndex, &myQ, s.searchLimits())
 		}
 	}(*params)
 
@@ -353,9 +1138,9 @@ func (s *Server) SearchProfiles(ctx context.Context, params *ActorSearchParams)
 		go func(myQ ActorSearchParams) {
 			defer wg.Done()
 			if myQ.Typeahead {
-				personalizedResp, personalizedErr = DoSearchProfilesTypeahead(ctx, s.escli, s.profileIndex, &myQ)
+				personalizedResp, personalizedErr = doSearchProfilesTypeaheadLimited(ctx, s.searchcli, s.profileIndex, &myQ, s.searchLimits())
 			} else {
-				personalizedResp, personalizedErr = DoSearchProfiles(ctx, s.dir, s.escli, s.profileIndex, &myQ)
+				personalizedResp, personalizedErr = doSearchProfilesLimited(ctx, s.dir, s.searchcli, s.profileIndex, &myQ, s.searchLimits())
 			}
 		}(*params)
 	}
@@ -443,8 +1228,31 @@ func (s *Server) SearchProfiles(ctx context.Context, params *ActorSearchParams)
 		globalResp.Hits.Hits = deduped
 	}
 
+	out, err := profileSearchOutput(params, globalResp, s.paginationLimit())
+	if err != nil {
+		return nil, err
+	}
+	out.Cursor = s.signCursor(out.Cursor)
+	return out, nil
+}
+
+// searchLimits returns the pagination bounds for queries, from the server config
+func (s *Server) searchLimits() searchLimits {
+	return searchLimits{maxOffset: s.maxOffset, maxSize: s.maxLimit}
+}
+
+// paginationLimit returns the maximum offset for which an offset cursor is returned: the max offset, or the result cap if that is lower
+func (s *Server) paginationLimit() int {
+	if s.maxResults > 0 && s.maxResults < s.maxOffset {
+		return s.maxResults
+	}
+	return s.maxOffset
+}
+
+// profileSearchOutput converts a profile search response into an actor skeleton output, with an offset cursor
+func profileSearchOutput(params *ActorSearchParams, resp *EsSearchResponse, maxOffset int) (*appbsky.UnspeccedSearchActorsSkeleton_Output, error) {
 	actors := []*appbsky.UnspeccedDefs_SkeletonSearchActor{}
-	for _, r := range globalResp.Hits.Hits {
+	for _, r := range resp.Hits.Hits {
 		var doc ProfileDoc
 		if err := json.Unmarshal(r.Source, &doc); err != nil {
 			return nil, fmt.Errorf("decoding profile doc from search response: %w", err)
@@ -461,13 +1269,42 @@ func (s *Server) SearchProfiles(ctx context.Context, params *ActorSearchParams)
 	}
 
 	out := appbsky.UnspeccedSearchActorsSkeleton_Output{Actors: actors}
-	if len(actors) == params.Size && (params.Offset+params.Size) < 10000 {
+	if len(actors) == params.Size && (params.Offset+params.Size) < maxOffset {
 		s := fmt.Sprintf("%d", params.Offset+params.Size)
 		out.Cursor = &s
 	}
-	if globalResp.Hits.Total.Relation == "eq" {
-		i := int64(globalResp.Hits.Total.Value)
+	if resp.Hits.Total.Relation == "eq" {
+		i := int64(resp.Hits.Total.Value)
 		out.HitsTotal = &i
 	}
 	return &out, nil
 }
+
+// StructuredSearchProfiles is a non-personalized profile search, which can be ordered by follower or post count instead of relevance, and filtered by follower count
+func (s *Server) StructuredSearchProfiles(ctx context.Context, params *ActorSearchParams) (_ *appbsky.UnspeccedSearchActorsSkeleton_Output, err error) {
+	ctx, span := tracer.Start(ctx, "StructuredSearchProfiles")
+	defer span.End()
+
+	start := time.Now()
+	defer func() { observeSearch("profiles_structured", start, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, s.queryTimeout)
+	defer cancel()
+	span.SetAttributes(
+		attribute.String("query", params.Query),
+		attribute.String("sort", params.Sort),
+		attribute.Int("offset", params.Offset),
+		attribute.Int("size", params.Size),
+	)
+
+	resp, err := doSearchProfilesLimited(ctx, s.dir, s.searchcli, s.profileIndex, params, s.searchLimits())
+	if err != nil {
+		return nil, err
+	}
+	out, err := profileSearchOutput(params, resp, s.paginationLimit())
+	if err != nil {
+		return nil, err
+	}
+	out.Cursor = s.signCursor(out.Cursor)
+	return out, nil
+}
@@ -0,0 +1,922 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/labstack/echo/v4"
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// returns a search client pointed at an HTTP server which never responds until the request is cancelled
+func testBlockingClient(t *testing.T) *es.Client {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	// cleanups run in reverse order: unblock any in-flight handlers before closing the server
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(done) })
+
+	escli, err := es.NewClient(es.Config{
+		Addresses:    []string{srv.URL},
+		DisableRetry: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return escli
+}
+
+func TestSearchTimeout(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := identity.NewMockDirectory()
+
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{
+		PostIndex:    "palomar_post",
+		ProfileIndex: "palomar_profile",
+		QueryTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = s.SearchPosts(ctx, &PostSearchParams{Query: "hello", Size: 10})
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	assert.Less(time.Since(start), 5*time.Second)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello", nil)
+	rec := httptest.NewRecorder()
+	err = s.handleSearchPostsSkeleton(e.NewContext(req, rec))
+	var he *echo.HTTPError
+	if assert.True(errors.As(err, &he)) {
+		assert.Equal(504, he.Code)
+	}
+}
+
+func TestParseDatetimeParam(t *testing.T) {
+	assert := assert.New(t)
+
+	dt, err := parseDatetimeParam("1704067200000")
+	assert.NoError(err)
+	assert.Equal("2024-01-01T00:00:00Z", dt.String())
+
+	dt, err = parseDatetimeParam("1704067200123")
+	assert.NoError(err)
+	assert.Equal("2024-01-01T00:00:00.123Z", dt.String())
+
+	dt, err = parseDatetimeParam("2024-01-01T00:00:00Z")
+	assert.NoError(err)
+	assert.Equal("2024-01-01T00:00:00Z", dt.String())
+
+	// RFC 3339 with a numeric offset is accepted
+	dt, err = parseDatetimeParam("2024-01-01T09:00:00+09:00")
+	assert.NoError(err)
+	assert.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), dt.Time().UTC())
+
+	for _, bad := range []string{"", "yesterday", "2024-01-01", "12.5"} {
+		_, err = parseDatetimeParam(bad)
+		assert.Error(err, bad)
+	}
+
+	// both styles can be mixed, and an inverted range still parses
+	from, err := parseDatetimeParam("2024-06-01T00:00:00Z")
+	assert.NoError(err)
+	to, err := parseDatetimeParam("1704067200000")
+	assert.NoError(err)
+	assert.True(from.Time().After(to.Time()))
+}
+
+func TestInvertedDateRange(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{
+		PostIndex:    "palomar_post",
+		ProfileIndex: "palomar_profile",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&from=2024-06-01T00:00:00Z&to=1704067200000", nil)
+	rec := httptest.NewRecorder()
+	params, err := s.parsePostSearchParams(e.NewContext(req, rec))
+	assert.Nil(params)
+	assertAPIError(t, err, 400)
+	assert.Contains(apiErrorMessage(err), "'since' (2024-06-01T00:00:00Z) must be before 'until' (2024-01-01T00:00:00Z)")
+
+	// 'until' is exclusive, so an equal pair is an empty range
+	req = httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&since=1704067200000&until=2024-01-01T00:00:00Z", nil)
+	rec = httptest.NewRecorder()
+	params, err = s.parsePostSearchParams(e.NewContext(req, rec))
+	assert.Nil(params)
+	assertAPIError(t, err, 400)
+
+	// a one millisecond range is valid
+	req = httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&since=1704067200000&until=1704067200001", nil)
+	rec = httptest.NewRecorder()
+	params, err = s.parsePostSearchParams(e.NewContext(req, rec))
+	assert.NoError(err)
+	if assert.NotNil(params) {
+		assert.NotNil(params.Since)
+		assert.NotNil(params.Until)
+	}
+}
+
+func TestThreadRootParam(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{
+		PostIndex:    "palomar_post",
+		ProfileIndex: "palomar_profile",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+
+	for _, bad := range []string{"asdf", "https://example.com/post", "at://did:plc:abc111", "at://did:plc:abc111/app.bsky.feed.like/3k43tv4rft22g"} {
+		req := httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&thread_root="+url.QueryEscape(bad), nil)
+		rec := httptest.NewRecorder()
+		params, err := s.parsePostSearchParams(e.NewContext(req, rec))
+		assert.Nil(params, bad)
+		assertAPIError(t, err, 400, bad)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&thread_root="+url.QueryEscape("at://did:plc:abc111/app.bsky.feed.post/3k43tv4rft22g"), nil)
+	rec := httptest.NewRecorder()
+	params, err := s.parsePostSearchParams(e.NewContext(req, rec))
+	assert.NoError(err)
+	if !assert.NotNil(params) || !assert.NotNil(params.ThreadRoot) {
+		return
+	}
+	filters := params.Filters()
+	assert.Equal(1, len(filters))
+	thread := filters[0]["bool"].(map[string]interface{})["should"].([]map[string]interface{})
+	// matches replies in the thread, or the root post itself
+	assert.Equal(2, len(thread))
+	assert.Equal("at://did:plc:abc111/app.bsky.feed.post/3k43tv4rft22g", thread[0]["term"].(map[string]interface{})["reply_root_aturi"].(map[string]interface{})["value"])
+}
+
+func TestExcludeActorsParam(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{
+		DID:    syntax.DID("did:plc:abc333"),
+		Handle: syntax.Handle("blocked.example.com"),
+	})
+
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{
+		PostIndex:    "palomar_post",
+		ProfileIndex: "palomar_profile",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&exclude_actors=did:plc:abc111,did:plc:abc222&exclude_actors=@blocked.example.com", nil)
+	rec := httptest.NewRecorder()
+	params, err := s.parsePostSearchParams(e.NewContext(req, rec))
+	assert.NoError(err)
+	if assert.NotNil(params) {
+		assert.Equal([]syntax.DID{"did:plc:abc111", "did:plc:abc222", "did:plc:abc333"}, params.ExcludeActors)
+		filters := params.Filters()
+		assert.Equal(1, len(filters))
+		mustNot := filters[0]["bool"].(map[string]interface{})["must_not"].(map[string]interface{})
+		assert.Equal([]string{"did:plc:abc111", "did:plc:abc222", "did:plc:abc333"}, mustNot["terms"].(map[string]interface{})["did"])
+	}
+
+	// unresolvable handles are skipped
+	req = httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&exclude_actors=unknown.example.com,did:plc:abc111,Blocked.example.com", nil)
+	rec = httptest.NewRecorder()
+	params, err = s.parsePostSearchParams(e.NewContext(req, rec))
+	assert.NoError(err)
+	if assert.NotNil(params) {
+		assert.Equal([]syntax.DID{"did:plc:abc111", "did:plc:abc333"}, params.ExcludeActors)
+	}
+
+	// handles are resolved during the request, so are limited to a smaller number
+	handles := make([]string, maxExcludeActorHandles+1)
+	for i := range handles {
+		handles[i] = fmt.Sprintf("handle%d.example.com", i)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&exclude_actors="+strings.Join(handles, ","), nil)
+	rec = httptest.NewRecorder()
+	params, err = s.parsePostSearchParams(e.NewContext(req, rec))
+	assert.Nil(params)
+	assertAPIError(t, err, 400)
+	assert.Contains(apiErrorMessage(err), "too many handles for 'exclude_actors'")
+
+	// too many
+	many := make([]string, maxExcludeActors+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("did:plc:abc%d", i)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&exclude_actors="+strings.Join(many, ","), nil)
+	rec = httptest.NewRecorder()
+	params, err = s.parsePostSearchParams(e.NewContext(req, rec))
+	assert.Nil(params)
+	assertAPIError(t, err, 400)
+	assert.Contains(apiErrorMessage(err), "too many values for 'exclude_actors'")
+}
+
+func TestExplainMode(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+
+	var reqBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		reqBody = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"took": 1, "hits": {"total": {"value": 1, "relation": "eq"}, "hits": [
+			{"_index": "palomar_post", "_id": "abc", "_score": 1.5, "_source": {"did": "did:plc:abc111", "record_rkey": "3kabc"},
+			 "_explanation": {"value": 1.5, "description": "sum of:", "details": []}}
+		]}}`))
+	}))
+	defer srv.Close()
+	escli, err := es.NewClient(es.Config{Addresses: []string{srv.URL}, DisableRetry: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewServer(escli, &dir, ServerConfig{
+		PostIndex:    "palomar_post",
+		ProfileIndex: "palomar_profile",
+		AdminToken:   "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+
+	// requires admin auth
+	req := httptest.NewRequest(http.MethodGet, "/search/posts/detailed?q=hello&explain=true", nil)
+	err = s.handleSearchPostsDetailed(e.NewContext(req, httptest.NewRecorder()))
+	var he *echo.HTTPError
+	if assert.True(errors.As(err, &he)) {
+		assert.Equal(403, he.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/search/posts/detailed?q=hello&explain=true", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	assert.NoError(s.handleSearchPostsDetailed(e.NewContext(req, rec)))
+	assert.Contains(reqBody, `"explain":true`)
+	var out SearchPostsDetailedOutput
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &out))
+	if assert.Len(out.Posts, 1) && assert.NotNil(out.Posts[0].Score) {
+		assert.Equal(1.5, *out.Posts[0].Score)
+		assert.Contains(string(out.Posts[0].Explanation), "sum of:")
+	}
+
+	// not included otherwise, even for admins
+	req = httptest.NewRequest(http.MethodGet, "/search/posts/detailed?q=hello", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	assert.NoError(s.handleSearchPostsDetailed(e.NewContext(req, rec)))
+	assert.NotContains(reqBody, "explain")
+	assert.NotContains(rec.Body.String(), "explanation")
+}
+
+func TestRecencyBoost(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := identity.NewMockDirectory()
+
+	for raw, scale := range map[string]string{
+		"true": "7d",
+		"12h":  "12h",
+		"30d":  "30d",
+		"7x":   "",
+		"-7d":  "",
+		"0d":   "",
+	} {
+		val, err := parseRecencyBoost(raw)
+		assert.Equal(scale, val, raw)
+		assert.Equal(scale == "", err != nil, raw)
+	}
+
+	cli := &testRecordingClient{}
+	_, err := DoSearchPosts(ctx, &dir, cli, "palomar_post", &PostSearchParams{Query: "hello", Sort: "top", RecencyBoost: "12h", Size: 10})
+	assert.NoError(err)
+	fs, ok := cli.body["query"].(map[string]any)["function_score"].(map[string]any)
+	if assert.True(ok) {
+		gauss := fs["functions"].([]any)[0].(map[string]any)["gauss"].(map[string]any)
+		assert.Equal("12h", gauss["created_at"].(map[string]any)["scale"])
+	}
+
+	// ignored when sorting by time
+	_, err = DoSearchPosts(ctx, &dir, cli, "palomar_post", &PostSearchParams{Query: "hello", Sort: "latest", RecencyBoost: "12h", Size: 10})
+	assert.NoError(err)
+	assert.Nil(cli.body["query"].(map[string]any)["function_score"])
+
+	// off by default
+	_, err = DoSearchPosts(ctx, &dir, cli, "palomar_post", &PostSearchParams{Query: "hello", Sort: "top", Size: 10})
+	assert.NoError(err)
+	assert.Nil(cli.body["query"].(map[string]any)["function_score"])
+}
+
+func TestIncludeAuthor(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+
+	var params map[string]string
+	s, err := NewServer(testFakeClusterClient(t, `{"value": 1, "relation": "eq"}`, &params), &dir, ServerConfig{
+		PostIndex:    "palomar_post",
+		ProfileIndex: "palomar_profile",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&include_author=true", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(s.handleSearchPostsSkeleton(e.NewContext(req, rec)))
+	var out SearchPostsSkeletonWithAuthorsOutput
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &out))
+	if assert.Len(out.Posts, 1) && assert.Len(out.Authors, 1) {
+		assert.Equal("at://did:plc:abc111/app.bsky.feed.post/3kabc", out.Posts[0].Uri)
+		assert.Equal(SkeletonPostAuthor{URI: out.Posts[0].Uri, DID: "did:plc:abc111"}, out.Authors[0])
+	}
+
+	// spec output only, by default
+	req = httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello", nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(s.handleSearchPostsSkeleton(e.NewContext(req, rec)))
+	assert.NotContains(rec.Body.String(), "authors")
+	assert.Contains(rec.Body.String(), "3kabc")
+}
+
+func TestActorSearchSort(t *testing.T) {
+	assert := assert.New(t)
+
+	p := ActorSearchParams{Query: "hello", Sort: "relevance"}
+	assert.Nil(p.SortClause())
+	assert.Empty(p.Filters())
+
+	minFollowers := int64(100)
+	p = ActorSearchParams{Query: "hello", Sort: "followers", MinFollowers: &minFollowers}
+	sort := p.SortClause()
+	if assert.Len(sort, 2) {
+		assert.Contains(sort[0], "followers_count")
+	}
+	assert.Equal([]map[string]interface{}{
+		{"range": map[string]interface{}{"followers_count": map[string]interface{}{"gte": int64(100)}}},
+	}, p.Filters())
+
+	p = ActorSearchParams{Query: "hello", Sort: "posts"}
+	if sort := p.SortClause(); assert.Len(sort, 2) {
+		assert.Contains(sort[0], "posts_count")
+	}
+
+	dir := identity.NewMockDirectory()
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{
+		PostIndex:    "palomar_post",
+		ProfileIndex: "palomar_profile",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	for _, qs := range []string{"q=hello&sort=likes", "q=hello&min_followers=-1", "q=hello&min_followers=many", "sort=followers"} {
+		req := httptest.NewRequest(http.MethodGet, "/search/actors?"+qs, nil)
+		rec := httptest.NewRecorder()
+		assertAPIError(t, s.handleSearchActorsStructured(e.NewContext(req, rec)), 400, qs)
+	}
+}
+
+func TestActorLabelFilters(t *testing.T) {
+	assert := assert.New(t)
+
+	p := ActorSearchParams{Query: "hello", RequireLabels: []string{"verified"}, ExcludeLabels: []string{"spam", "!hide"}}
+	assert.Equal([]map[string]interface{}{
+		{"term": map[string]interface{}{"labels": "verified"}},
+		{"bool": map[string]interface{}{"must_not": map[string]interface{}{"terms": map[string]interface{}{"labels": []string{"spam", "!hide"}}}}},
+	}, p.Filters())
+
+	labels, err := parseAccountLabelsParam([]string{"spam, porn", "spam"})
+	assert.NoError(err)
+	assert.Equal([]string{"spam", "porn"}, labels)
+	_, err = parseAccountLabelsParam([]string{"spam,some-other-label"})
+	assert.Error(err)
+
+	job, err := parseProfileLabelsCSVLine("did:plc:abc111,spam;unknown;spam;!warn")
+	assert.NoError(err)
+	assert.Equal([]string{"spam", "!warn"}, job.labels)
+	job, err = parseProfileLabelsCSVLine("did:plc:abc111,")
+	assert.NoError(err)
+	assert.Empty(job.labels)
+
+	dir := identity.NewMockDirectory()
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{
+		PostIndex:    "palomar_post",
+		ProfileIndex: "palomar_profile",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodGet, "/search/actors?q=hello&exclude_labels=nope", nil)
+	rec := httptest.NewRecorder()
+	assertAPIError(t, s.handleSearchActorsStructured(e.NewContext(req, rec)), 400)
+
+	cli := &testRecordingClient{}
+	s.searchcli = cli
+	req = httptest.NewRequest(http.MethodGet, "/search/actors?q=hello&require_labels=verified&exclude_labels=spam", nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(s.handleSearchActorsStructured(e.NewContext(req, rec)))
+	assert.Equal(200, rec.Code)
+	body, _ := json.Marshal(cli.body)
+	assert.Contains(string(body), `{"term":{"labels":"verified"}}`)
+	assert.Contains(string(body), `{"must_not":{"terms":{"labels":["spam"]}}}`)
+}
+
+func TestProfileSpamPenalty(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := identity.NewMockDirectory()
+	cli := &testRecordingClient{}
+
+	_, err := DoSearchProfiles(ctx, &dir, cli, "palomar_profile", &ActorSearchParams{Query: "hello", SpamPenalty: true, Size: 10})
+	assert.NoError(err)
+	fs, ok := cli.body["query"].(map[string]any)["function_score"].(map[string]any)
+	if assert.True(ok) {
+		linear := fs["functions"].([]any)[0].(map[string]any)["linear"].(map[string]any)
+		assert.Contains(linear, "spamminess")
+	}
+
+	// raw relevance
+	_, err = DoSearchProfiles(ctx, &dir, cli, "palomar_profile", &ActorSearchParams{Query: "hello", Size: 10})
+	assert.NoError(err)
+	assert.Nil(cli.body["query"].(map[string]any)["function_score"])
+
+	// scores don't matter when sorting by counts
+	_, err = DoSearchProfiles(ctx, &dir, cli, "palomar_profile", &ActorSearchParams{Query: "hello", Sort: "followers", SpamPenalty: true, Size: 10})
+	assert.NoError(err)
+	assert.Nil(cli.body["query"].(map[string]any)["function_score"])
+
+	// server default, overridden per-request
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{ProfileIndex: "palomar_profile", ProfileSpamPenalty: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.searchcli = cli
+	e := echo.New()
+	for qs, penalty := range map[string]bool{"q=hello": true, "q=hello&spam_penalty=false": false} {
+		req := httptest.NewRequest(http.MethodGet, "/search/actors?"+qs, nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(s.handleSearchActorsStructured(e.NewContext(req, rec)))
+		assert.Equal(200, rec.Code)
+		_, ok := cli.body["query"].(map[string]any)["function_score"]
+		assert.Equal(penalty, ok, qs)
+	}
+}
+
+func TestCursorLimitBounds(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+	e := echo.New()
+
+	parse := func(s *Server, qs string) (int, int, error) {
+		req := httptest.NewRequest(http.MethodGet, "/search/actors?"+qs, nil)
+		return s.parseCursorLimit(e.NewContext(req, httptest.NewRecorder()))
+	}
+
+	// defaults
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, limit, err := parse(s, "cursor=10000&limit=500")
+	assert.NoError(err)
+	assert.Equal(10000, offset)
+	assert.Equal(100, limit)
+	_, _, err = parse(s, "cursor=10001")
+	assert.Error(err)
+	offset, limit, err = parse(s, "cursor=-5&limit=-5")
+	assert.NoError(err)
+	assert.Equal(0, offset)
+	assert.Equal(0, limit)
+
+	// configured
+	s, err = NewServer(testBlockingClient(t), &dir, ServerConfig{MaxLimit: 10, MaxOffset: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, limit, err = parse(s, "cursor=50&limit=25")
+	assert.NoError(err)
+	assert.Equal(50, offset)
+	assert.Equal(10, limit)
+	_, _, err = parse(s, "cursor=51")
+	assert.Error(err)
+
+	// result cap
+	_, err = NewServer(testBlockingClient(t), &dir, ServerConfig{MaxResults: 20000})
+	assert.Error(err)
+	s, err = NewServer(testBlockingClient(t), &dir, ServerConfig{MaxResults: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, limit, err = parse(s, "cursor=990&limit=25")
+	assert.NoError(err)
+	assert.Equal(990, offset)
+	assert.Equal(10, limit)
+	_, _, err = parse(s, "cursor=1000")
+	assert.Error(err)
+	assert.Equal(1000, s.paginationLimit())
+
+	req := httptest.NewRequest(http.MethodGet, "/search/posts/detailed?q=hello&track_total_hits=true", nil)
+	params, err := s.parsePostSearchParams(e.NewContext(req, httptest.NewRecorder()))
+	assert.NoError(err)
+	assert.Equal(1000, params.MaxResults)
+	cli := &testRecordingClient{}
+	_, err = DoSearchPosts(context.Background(), &dir, cli, "palomar_post", params)
+	assert.NoError(err)
+	assert.Equal(float64(1000), cli.body["track_total_hits"])
+
+	// deep pagination cursors are past the cap
+	req = httptest.NewRequest(http.MethodGet, "/search/posts/detailed?q=hello&cursor=WzE3MDQwNjcyMDAwMDAsImFiYyJd", nil)
+	_, err = s.parsePostSearchParams(e.NewContext(req, httptest.NewRecorder()))
+	assert.Error(err)
+
+	// queries are checked against the same bounds before being sent to the search cluster
+	assert.NoError(checkParams(9975, 25, defaultSearchLimits))
+	assert.Error(checkParams(9990, 25, defaultSearchLimits))
+	assert.Error(checkParams(0, 251, defaultSearchLimits))
+	assert.Error(checkParams(-1, 10, defaultSearchLimits))
+	assert.Error(checkParams(0, -1, defaultSearchLimits))
+	s, err = NewServer(testBlockingClient(t), &dir, ServerConfig{MaxLimit: 500, MaxOffset: 50000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(checkParams(20000, 500, s.searchLimits()))
+	assert.Error(checkParams(20000, 501, s.searchLimits()))
+}
+
+func TestSignedCursors(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+	e := echo.New()
+
+	var params map[string]string
+	s, err := NewServer(testFakeClusterClient(t, `{"value": 5, "relation": "eq"}`, &params), &dir, ServerConfig{
+		PostIndex:        "palomar_post",
+		ProfileIndex:     "palomar_profile",
+		CursorSigningKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := func(qs string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&limit=1"+qs, nil)
+		rec := httptest.NewRecorder()
+		return rec, s.handleSearchPostsSkeleton(e.NewContext(req, rec))
+	}
+
+	rec, err := search("")
+	assert.NoError(err)
+	var out SearchPostsSkeletonWithAuthorsOutput
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &out))
+	if !assert.NotNil(out.Cursor) {
+		return
+	}
+	assert.NotEqual("1", *out.Cursor)
+
+	// signed cursors round-trip
+	_, err = search("&cursor=" + url.QueryEscape(*out.Cursor))
+	assert.NoError(err)
+
+	// plain and tampered cursors are rejected
+	for _, c := range []string{"1", "9000", "9000" + (*out.Cursor)[1:]} {
+		_, err = search("&cursor=" + url.QueryEscape(c))
+		var he *echo.HTTPError
+		if assert.ErrorAs(err, &he, c) {
+			assert.Equal(400, he.Code)
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// shutting down before starting is a no-op
+	assert.NoError(s.Shutdown(context.Background()))
+
+	apiErr := make(chan error, 1)
+	go func() {
+		apiErr <- s.RunAPI("127.0.0.1:0")
+	}()
+	for i := 0; i < 100; i++ {
+		s.echoLk.Lock()
+		ready := s.echo != nil && s.echo.ListenerAddr() != nil
+		s.echoLk.Unlock()
+		if ready {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(s.Shutdown(ctx))
+	select {
+	case err := <-apiErr:
+		assert.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunAPI did not return after Shutdown")
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+
+	for _, token := range []string{"", "secret"} {
+		s, err := NewServer(testFakeClusterClient(t, "1", new(map[string]string)), &dir, ServerConfig{AdminToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go s.RunAPI("127.0.0.1:0")
+		var addr string
+		for i := 0; i < 100 && addr == ""; i++ {
+			s.echoLk.Lock()
+			if s.echo != nil && s.echo.ListenerAddr() != nil {
+				addr = s.echo.ListenerAddr().String()
+			}
+			s.echoLk.Unlock()
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		status := func(method, path, auth string) int {
+			req, err := http.NewRequest(method, "http://"+addr+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if auth != "" {
+				req.Header.Set("Authorization", "Bearer "+auth)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		// internal endpoints don't exist without an admin token, and require it otherwise
+		for _, route := range []struct{ method, path string }{
+			{http.MethodGet, "/search/posts/lookup"},
+			{http.MethodPost, "/search/posts/raw"},
+		} {
+			if token == "" {
+				assert.Equal(404, status(route.method, route.path, ""), route.path)
+				continue
+			}
+			assert.Equal(401, status(route.method, route.path, ""), route.path)
+			assert.Equal(401, status(route.method, route.path, "wrong"), route.path)
+			// missing params
+			assert.Equal(400, status(route.method, route.path, token), route.path)
+		}
+		assert.NoError(s.Shutdown(context.Background()))
+	}
+}
+
+func TestLookupPost(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{DID: syntax.DID("did:plc:abc111"), Handle: syntax.Handle("handle.example.com")})
+
+	var params map[string]string
+	s, err := NewServer(testFakeClusterClient(t, `{"value": 1, "relation": "eq"}`, &params), &dir, ServerConfig{
+		PostIndex:    "palomar_post",
+		ProfileIndex: "palomar_profile",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+
+	for _, q := range []string{
+		"uri=at://did:plc:abc111/app.bsky.feed.post/3kabc",
+		"uri=at://handle.example.com/app.bsky.feed.post/3kabc",
+		"did=did:plc:abc111&rkey=3kabc",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/search/posts/lookup?"+q, nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(s.handleLookupPost(e.NewContext(req, rec)))
+		assert.Equal(200, rec.Code, q)
+		var doc PostDoc
+		assert.NoError(json.Unmarshal(rec.Body.Bytes(), &doc))
+		assert.Equal("did:plc:abc111", doc.DID)
+		assert.Equal("3kabc", doc.RecordRkey)
+	}
+
+	for _, q := range []string{
+		"",
+		"uri=at://did:plc:abc111/app.bsky.feed.like/3kabc",
+		"did=did:plc:abc111",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/search/posts/lookup?"+q, nil)
+		rec := httptest.NewRecorder()
+		assertAPIError(t, s.handleLookupPost(e.NewContext(req, rec)), 400, q)
+	}
+
+	// indexed with a different CID
+	req := httptest.NewRequest(http.MethodGet, "/search/posts/lookup?did=did:plc:abc111&rkey=3kabc&cid=bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm", nil)
+	rec := httptest.NewRecorder()
+	assertAPIError(t, s.handleLookupPost(e.NewContext(req, rec)), 404)
+
+	// not in the index
+	cli := &testRecordingClient{}
+	s.searchcli = cli
+	req = httptest.NewRequest(http.MethodGet, "/search/posts/lookup?did=did:plc:abc111&rkey=3kzzz", nil)
+	rec = httptest.NewRecorder()
+	assertAPIError(t, s.handleLookupPost(e.NewContext(req, rec)), 404)
+	ids := cli.body["query"].(map[string]any)["ids"].(map[string]any)["values"].([]any)
+	assert.Equal([]any{"did:plc:abc111_3kzzz"}, ids)
+}
+
+// search client which returns a fixed response, and records the request body
+type testFixedClient struct {
+	testRecordingClient
+	resp EsSearchResponse
+}
+
+func (c *testFixedClient) Search(ctx context.Context, index string, body []byte) (*EsSearchResponse, error) {
+	if _, err := c.testRecordingClient.Search(ctx, index, body); err != nil {
+		return nil, err
+	}
+	resp := c.resp
+	return &resp, nil
+}
+
+func TestPostAuthorFacet(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{
+		PostIndex:    "palomar_post",
+		ProfileIndex: "palomar_profile",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := &testFixedClient{resp: EsSearchResponse{
+		Aggregations: map[string]EsAggregation{
+			"authors": {Buckets: []EsAggregationBucket{
+				{Key: "did:plc:abc111", DocCount: 12},
+				{Key: "did:plc:abc222", DocCount: 3},
+			}},
+		},
+	}}
+	s.searchcli = cli
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodGet, "/search/posts/detailed?q=buy+followers&facet=authors", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(s.handleSearchPostsDetailed(e.NewContext(req, rec)))
+	assert.Equal(200, rec.Code)
+
+	aggs, ok := cli.body["aggs"].(map[string]any)
+	if assert.True(ok) {
+		assert.Equal("did", aggs["authors"].(map[string]any)["terms"].(map[string]any)["field"])
+	}
+	var out SearchPostsDetailedOutput
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &out))
+	assert.Equal([]FacetBucket{
+		{Value: "did:plc:abc111", Count: 12},
+		{Value: "did:plc:abc222", Count: 3},
+	}, out.Facets["authors"])
+
+	// not requested
+	req = httptest.NewRequest(http.MethodGet, "/search/posts/detailed?q=buy+followers", nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(s.handleSearchPostsDetailed(e.NewContext(req, rec)))
+	assert.Nil(cli.body["aggs"])
+}
+
+// search client which returns a sequence of responses, repeating the last one
+type testSequenceClient struct {
+	testRecordingClient
+	calls int
+	resps []EsSearchResponse
+}
+
+func (c *testSequenceClient) Search(ctx context.Context, index string, body []byte) (*EsSearchResponse, error) {
+	resp := c.resps[min(c.calls, len(c.resps)-1)]
+	c.calls++
+	return &resp, nil
+}
+
+func TestSearchWaitFor(t *testing.T) {
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{
+		PostIndex:    "palomar_post",
+		ProfileIndex: "palomar_profile",
+		AdminToken:   "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hit := func(rkey string) EsSearchHit {
+		return EsSearchHit{ID: "did:plc:abc111_" + rkey, Source: json.RawMessage(fmt.Sprintf(`{"did": "did:plc:abc111", "record_rkey": "%s"}`, rkey))}
+	}
+	stale := EsSearchResponse{Hits: EsSearchHits{Hits: []EsSearchHit{hit("3kold")}}}
+	fresh := EsSearchResponse{Hits: EsSearchHits{Hits: []EsSearchHit{hit("3knew"), hit("3kold")}}}
+	e := echo.New()
+
+	// the new post shows up on the third try
+	cli := &testSequenceClient{resps: []EsSearchResponse{stale, stale, fresh}}
+	s.searchcli = cli
+	req := httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&wait_for=at://did:plc:abc111/app.bsky.feed.post/3knew", nil)
+	rec := httptest.NewRecorder()
+
+	// only with admin auth
+	assertAPIError(t, s.handleSearchPostsSkeleton(e.NewContext(req, rec)), 403)
+	assert.Equal(0, cli.calls)
+
+	req.Header.Set("Authorization", "Bearer secret")
+	assert.NoError(s.handleSearchPostsSkeleton(e.NewContext(req, rec)))
+	assert.Equal(200, rec.Code)
+	assert.Equal(3, cli.calls)
+	assert.Contains(rec.Body.String(), "at://did:plc:abc111/app.bsky.feed.post/3knew")
+
+	// no retries without wait_for, or if the post is already in the results
+	for _, path := range []string{
+		"/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello",
+		"/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&wait_for=at://did:plc:abc111/app.bsky.feed.post/3kold",
+	} {
+		cli = &testSequenceClient{resps: []EsSearchResponse{stale}}
+		s.searchcli = cli
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		assert.NoError(s.handleSearchPostsSkeleton(e.NewContext(req, rec)))
+		assert.Equal(200, rec.Code, path)
+		assert.Equal(1, cli.calls, path)
+	}
+
+	for _, bad := range []string{"3knew", "at://handle.example.com/app.bsky.feed.post/3knew", "at://did:plc:abc111/app.bsky.feed.like/3knew"} {
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchPostsSkeleton?q=hello&wait_for="+url.QueryEscape(bad), nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		assertAPIError(t, s.handleSearchPostsSkeleton(e.NewContext(req, rec)), 400, bad)
+	}
+}
+
+// asserts that err is an API error (see apiError) with the given HTTP status
+func assertAPIError(t *testing.T, err error, status int, msgAndArgs ...any) {
+	t.Helper()
+	var he *echo.HTTPError
+	if assert.ErrorAs(t, err, &he, msgAndArgs...) {
+		assert.Equal(t, status, he.Code, msgAndArgs...)
+	}
+}
+
+// returns the message of an API error, or an empty string for other errors
+func apiErrorMessage(err error) string {
+	var he *echo.HTTPError
+	if !errors.As(err, &he) {
+		return ""
+	}
+	resp, ok := he.Message.(ErrorResponse)
+	if !ok {
+		return ""
+	}
+	return resp.Message
+}
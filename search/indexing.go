@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -42,6 +44,8 @@ type Indexer struct {
 	bf  *backfill.Backfiller
 
 	enableRepoDiscovery bool
+	indexQuotedText     bool
+	refresh             string
 
 	indexLimiter  *rate.Limiter
 	profileQueue  chan *ProfileIndexJob
@@ -58,8 +62,20 @@ type IndexerConfig struct {
 	IndexMaxConcurrency int
 	DiscoverRepos       bool
 	IndexingRateLimit   int
+	// Tenant ID, for multi-tenant deployments (see ServerConfig.Tenant)
+	Tenant string
+	// Whether to copy the text of quoted posts in to quoting posts' documents (see PostDoc.QuotedText). The quoted text is looked up in the post index, so this adds a search request per indexing batch with any quote posts.
+	IndexQuotedText bool
+	// Refresh policy for indexing requests (see IndexRefreshPolicies). By default (empty), indexed documents become searchable at the next periodic index refresh, which is every second by default (the index "refresh_interval" setting), so there is a short window where newly indexed documents are not found by searches.
+	Refresh string
 }
 
+// Valid values for IndexerConfig.Refresh, besides empty:
+//
+//   - "wait_for": each indexing request waits until its documents are searchable (up to the refresh interval), without forcing a refresh. Slows down indexing, but is safe for production.
+//   - "true": each indexing request forces a refresh of the index, so documents are immediately searchable. This is expensive (small index segments), and only intended for tests and tooling.
+var IndexRefreshPolicies = []string{"wait_for", "true"}
+
 type ProfileIndexJob struct {
 	ident  *identity.Identity
 	record *appbsky.ActorProfile
@@ -78,6 +94,17 @@ type PagerankIndexJob struct {
 	rank float64
 }
 
+type ProfileCountsIndexJob struct {
+	did       syntax.DID
+	followers int64
+	posts     int64
+}
+
+type ProfileLabelsIndexJob struct {
+	did    syntax.DID
+	labels []string
+}
+
 func NewIndexer(db *gorm.DB, escli *es.Client, dir identity.Directory, config IndexerConfig) (*Indexer, error) {
 	logger := config.Logger
 	if logger == nil {
@@ -87,10 +114,25 @@ func NewIndexer(db *gorm.DB, escli *es.Client, dir identity.Directory, config In
 	}
 	logger = logger.With("component", "indexer")
 
+	postIndex, profileIndex, err := TenantIndexNames(config.Tenant, config.PostIndex, config.ProfileIndex)
+	if err != nil {
+		return nil, err
+	}
+	if IsMultiPostIndex(postIndex) {
+		return nil, fmt.Errorf("indexer requires a single post index, not a list or pattern: %s", postIndex)
+	}
+	if config.Tenant != "" {
+		logger = logger.With("tenant", config.Tenant)
+	}
+
 	logger.Info("running database migrations")
 	db.AutoMigrate(&LastSeq{})
 	db.AutoMigrate(&backfill.GormDBJob{})
 
+	if config.Refresh != "" && !slices.Contains(IndexRefreshPolicies, config.Refresh) {
+		return nil, fmt.Errorf("invalid indexing refresh policy (expected one of %s): %q", strings.Join(IndexRefreshPolicies, ", "), config.Refresh)
+	}
+
 	relayWS := config.RelayHost
 	if !strings.HasPrefix(relayWS, "ws") {
 		return nil, fmt.Errorf("specified bgs host must include 'ws://' or 'wss://'")
@@ -105,14 +147,16 @@ func NewIndexer(db *gorm.DB, escli *es.Client, dir identity.Directory, config In
 
 	idx := &Indexer{
 		escli:               escli,
-		profileIndex:        config.ProfileIndex,
-		postIndex:           config.PostIndex,
+		profileIndex:        profileIndex,
+		postIndex:           postIndex,
 		db:                  db,
 		relayhost:           config.RelayHost,
 		relayXRPC:           relayXRPC,
 		dir:                 dir,
 		logger:              logger,
 		enableRepoDiscovery: config.DiscoverRepos,
+		indexQuotedText:     config.IndexQuotedText,
+		refresh:             config.Refresh,
 
 		indexLimiter:  limiter,
 		profileQueue:  make(chan *ProfileIndexJob, 1000),
@@ -160,42 +204,70 @@ var palomarPostSchemaJSON string
 //go:embed profile_schema.json
 var palomarProfileSchemaJSON string
 
-func (idx *Indexer) EnsureIndices(ctx context.Context) error {
-	indices := []struct {
-		Name       string
-		SchemaJSON string
-	}{
-		{Name: idx.postIndex, SchemaJSON: palomarPostSchemaJSON},
-		{Name: idx.profileIndex, SchemaJSON: palomarProfileSchemaJSON},
-	}
-	for _, index := range indices {
-		resp, err := idx.escli.Indices.Exists([]string{index.Name})
-		if err != nil {
+// EnsureIndices creates the post and profile indices (with the mappings and analyzers expected by this package) if they don't already exist. Indices which already exist are left as-is.
+//
+// Multiple (eg, time-sharded) post indices are not created; they are expected to be managed externally, for example with an index template.
+func EnsureIndices(ctx context.Context, escli *es.Client, postIndex, profileIndex string) error {
+	if !IsMultiPostIndex(postIndex) {
+		if err := ensureIndex(ctx, escli, postIndex, palomarPostSchemaJSON); err != nil {
 			return err
 		}
-		defer resp.Body.Close()
-		io.ReadAll(resp.Body)
-		if resp.IsError() && resp.StatusCode != 404 {
-			return fmt.Errorf("failed to check index existence")
-		}
-		if resp.StatusCode == 404 {
-			idx.logger.Warn("creating opensearch index", "index", index.Name)
-			if len(index.SchemaJSON) < 2 {
-				return fmt.Errorf("empty schema file (go:embed failed)")
-			}
-			buf := strings.NewReader(index.SchemaJSON)
-			resp, err := idx.escli.Indices.Create(
-				index.Name,
-				idx.escli.Indices.Create.WithBody(buf))
-			if err != nil {
-				return err
-			}
-			defer resp.Body.Close()
-			io.ReadAll(resp.Body)
-			if resp.IsError() {
-				return fmt.Errorf("failed to create index")
-			}
-		}
+	}
+	return ensureIndex(ctx, escli, profileIndex, palomarProfileSchemaJSON)
+}
+
+// ensureIndex creates a single index with the given schema (settings and mappings), if it doesn't already exist
+func ensureIndex(ctx context.Context, escli *es.Client, name, schemaJSON string) error {
+	resp, err := escli.Indices.Exists([]string{name}, escli.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.IsError() && resp.StatusCode != 404 {
+		return fmt.Errorf("failed to check index existence")
+	}
+	if resp.StatusCode != 404 {
+		return nil
+	}
+
+	slog.Warn("creating opensearch index", "index", name)
+	if len(schemaJSON) < 2 {
+		return fmt.Errorf("empty schema file (go:embed failed)")
+	}
+	buf := strings.NewReader(schemaJSON)
+	resp, err = escli.Indices.Create(
+		name,
+		escli.Indices.Create.WithContext(ctx),
+		escli.Indices.Create.WithBody(buf))
+	if err != nil {
+		return err
+	}
+	errBytes, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.IsError() {
+		slog.Error("failed to create index", "index", name, "response", string(errBytes))
+		return fmt.Errorf("failed to create index")
+	}
+	return nil
+}
+
+func (idx *Indexer) EnsureIndices(ctx context.Context) error {
+	return EnsureIndices(ctx, idx.escli, idx.postIndex, idx.profileIndex)
+}
+
+// RefreshIndices forces a refresh of the post and profile indices, so that everything indexed so far is searchable. Intended for tests and tooling which index documents and then immediately search for them; see also IndexerConfig.Refresh.
+func (idx *Indexer) RefreshIndices(ctx context.Context) error {
+	res, err := idx.escli.Indices.Refresh(
+		idx.escli.Indices.Refresh.WithContext(ctx),
+		idx.escli.Indices.Refresh.WithIndex(idx.postIndex, idx.profileIndex),
+	)
+	if err != nil {
+		return fmt.Errorf("refreshing indices: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("refreshing indices: status %d", res.StatusCode)
 	}
 	return nil
 }
@@ -332,25 +404,26 @@ func (idx *Indexer) runPagerankIndexer(ctx context.Context) {
 	}
 }
 
-func (idx *Indexer) deletePost(ctx context.Context, did syntax.DID, recordPath string) error {
-	ctx, span := tracer.Start(ctx, "deletePost")
+// DeletePost removes a single post from the post index, by AT-URI. Deleting a post which isn't in the index is not an error (it is counted in the "search_posts_delete_not_found" metric).
+func (idx *Indexer) DeletePost(ctx context.Context, uri syntax.ATURI) error {
+	ctx, span := tracer.Start(ctx, "DeletePost")
 	defer span.End()
-	span.SetAttributes(attribute.String("repo", did.String()), attribute.String("path", recordPath))
+	span.SetAttributes(attribute.String("uri", uri.String()))
 
-	logger := idx.logger.With("repo", did, "path", recordPath, "op", "deletePost")
+	logger := idx.logger.With("uri", uri, "op", "deletePost")
 
-	parts := strings.SplitN(recordPath, "/", 3)
-	if len(parts) < 2 {
-		logger.Warn("skipping post record with malformed path")
+	did, err := uri.Authority().AsDID()
+	if err != nil {
+		logger.Warn("skipping post delete with non-DID authority")
 		return nil
 	}
-	rkey, err := syntax.ParseTID(parts[1])
-	if err != nil {
-		logger.Warn("skipping post record with non-TID rkey")
+	if uri.RecordKey() == "" {
+		logger.Warn("skipping post delete with missing rkey")
 		return nil
 	}
 
-	docID := fmt.Sprintf("%s_%s", did.String(), rkey)
+	doc := PostDoc{DID: did.String(), RecordRkey: uri.RecordKey().String()}
+	docID := doc.DocId()
 	logger.Info("deleting post from index", "docID", docID)
 	req := esapi.DeleteRequest{
 		Index:      idx.postIndex,
@@ -372,10 +445,83 @@ func (idx *Indexer) deletePost(ctx context.Context, did syntax.DID, recordPath s
 	if err != nil {
 		return fmt.Errorf("failed to read indexing response: %w", err)
 	}
+	if res.StatusCode == http.StatusNotFound {
+		logger.Info("deleted post was not in index", "docID", docID)
+		postsDeleteNotFound.Inc()
+		return nil
+	}
 	if res.IsError() {
 		logger.Warn("opensearch indexing error", "status_code", res.StatusCode, "response", res, "body", string(body))
 		return fmt.Errorf("indexing error, code=%d", res.StatusCode)
 	}
+	postsDeleted.Inc()
+	return nil
+}
+
+// DeleteAccount removes all of an account's posts (with a delete-by-query on the author DID), and its profile, from the index. Used when an account is deleted.
+//
+// An account can have a very large number of posts, so the delete-by-query runs as a background task on the cluster, and this returns once the task has started, instead of blocking the firehose consumer until every post is deleted. Posts are removed from search results as the task progresses (at the regular index refresh; the index is never force-refreshed).
+func (idx *Indexer) DeleteAccount(ctx context.Context, did syntax.DID) error {
+	ctx, span := tracer.Start(ctx, "DeleteAccount")
+	defer span.End()
+	span.SetAttributes(attribute.String("did", did.String()))
+
+	logger := idx.logger.With("did", did, "op", "deleteAccount")
+
+	if err := idx.indexLimiter.Wait(ctx); err != nil {
+		logger.Warn("failed to wait for rate limiter", "err", err)
+		return err
+	}
+
+	query, err := json.Marshal(map[string]any{
+		"query": map[string]any{
+			"term": map[string]any{"did": did.String()},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	waitForCompletion := false
+	res, err := esapi.DeleteByQueryRequest{
+		Index:             []string{idx.postIndex},
+		Body:              bytes.NewReader(query),
+		WaitForCompletion: &waitForCompletion,
+		Conflicts:         "proceed",
+	}.Do(ctx, idx.escli)
+	if err != nil {
+		return fmt.Errorf("failed to delete account posts: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		logger.Warn("opensearch delete-by-query error", "status_code", res.StatusCode, "body", string(body))
+		return fmt.Errorf("delete-by-query error, code=%d", res.StatusCode)
+	}
+	// the number of posts deleted isn't known until the task completes, so isn't counted in postsDeleted
+	var out struct {
+		Task string `json:"task"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return fmt.Errorf("decoding delete-by-query response: %w", err)
+	}
+	accountsDeleted.Inc()
+
+	profRes, err := esapi.DeleteRequest{
+		Index:      idx.profileIndex,
+		DocumentID: did.String(),
+		Refresh:    idx.refresh,
+	}.Do(ctx, idx.escli)
+	if err != nil {
+		return fmt.Errorf("failed to delete account profile: %w", err)
+	}
+	defer profRes.Body.Close()
+	if profRes.IsError() && profRes.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("profile delete error, code=%d", profRes.StatusCode)
+	}
+	if !profRes.IsError() {
+		profilesDeleted.Inc()
+	}
+	logger.Info("deleted account from index", "postsDeleteTask", out.Task)
 	return nil
 }
 
@@ -387,10 +533,16 @@ func (idx *Indexer) indexPosts(ctx context.Context, jobs []*PostIndexJob) error
 	log := idx.logger.With("op", "indexPosts")
 	start := time.Now()
 
+	docs := make([]PostDoc, len(jobs))
+	for i, job := range jobs {
+		docs[i] = TransformPost(job.record, job.did, job.rkey, job.rcid.String())
+	}
+	if idx.indexQuotedText {
+		idx.addQuotedText(ctx, docs)
+	}
+
 	var buf bytes.Buffer
-	for i := range jobs {
-		job := jobs[i]
-		doc := TransformPost(job.record, job.did, job.rkey, job.rcid.String())
+	for _, doc := range docs {
 		docBytes, err := json.Marshal(doc)
 		if err != nil {
 			log.Warn("failed to marshal post", "err", err)
@@ -407,7 +559,7 @@ func (idx *Indexer) indexPosts(ctx context.Context, jobs []*PostIndexJob) error
 
 	log.Info("indexing posts", "num_posts", len(jobs))
 
-	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.postIndex))
+	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.postIndex), idx.escli.Bulk.WithRefresh(idx.refresh))
 	if err != nil {
 		log.Warn("failed to send bulk indexing request", "err", err)
 		return fmt.Errorf("failed to send bulk indexing request: %w", err)
@@ -429,6 +581,109 @@ func (idx *Indexer) indexPosts(ctx context.Context, jobs []*PostIndexJob) error
 	return nil
 }
 
+// addQuotedText sets the quoted text on any quote posts, from the quoted posts' documents (either in the same batch, or already indexed). Quoted posts which aren't indexed (eg, deleted, or not yet seen) are skipped, as are lookup failures: the quoting posts are indexed without quoted text.
+func (idx *Indexer) addQuotedText(ctx context.Context, docs []PostDoc) {
+	texts := map[string]string{}
+	for _, doc := range docs {
+		texts[doc.DocId()] = doc.Text
+	}
+
+	var missing []string
+	for _, doc := range docs {
+		if id, ok := quotedPostDocID(doc); ok {
+			if _, ok := texts[id]; !ok && !slices.Contains(missing, id) {
+				missing = append(missing, id)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		found, err := idx.lookupPostTexts(ctx, missing)
+		if err != nil {
+			idx.logger.Warn("failed to look up quoted posts; indexing without quoted text", "err", err, "count", len(missing))
+		}
+		for id, text := range found {
+			texts[id] = text
+		}
+	}
+
+	for i := range docs {
+		id, ok := quotedPostDocID(docs[i])
+		if !ok {
+			continue
+		}
+		text, ok := texts[id]
+		if !ok {
+			postsQuotedTextMissing.Inc()
+			continue
+		}
+		if text != "" {
+			docs[i].QuotedText = &text
+		}
+	}
+}
+
+// quotedPostDocID returns the document ID of the post quoted by a post document, if any
+func quotedPostDocID(doc PostDoc) (string, bool) {
+	if !doc.IsQuote || doc.EmbedATURI == nil {
+		return "", false
+	}
+	aturi, err := syntax.ParseATURI(*doc.EmbedATURI)
+	if err != nil || aturi.Collection() != syntax.NSID("app.bsky.feed.post") || aturi.RecordKey() == "" {
+		return "", false
+	}
+	// documents are keyed by DID; quotes by handle are rare, and not resolved here
+	did, err := aturi.Authority().AsDID()
+	if err != nil {
+		return "", false
+	}
+	quoted := PostDoc{DID: did.String(), RecordRkey: aturi.RecordKey().String()}
+	return quoted.DocId(), true
+}
+
+// lookupPostTexts fetches the text of already-indexed posts, by document ID. Posts which aren't in the index are omitted from the result.
+func (idx *Indexer) lookupPostTexts(ctx context.Context, docIDs []string) (map[string]string, error) {
+	query, err := json.Marshal(map[string]any{
+		"query": map[string]any{
+			"ids": map[string]any{
+				"values": docIDs,
+			},
+		},
+		"_source": []string{"text"},
+		"size":    len(docIDs),
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := idx.escli.Search(
+		idx.escli.Search.WithContext(ctx),
+		idx.escli.Search.WithIndex(idx.postIndex),
+		idx.escli.Search.WithBody(bytes.NewReader(query)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("quoted post lookup: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("quoted post lookup error, code=%d", res.StatusCode)
+	}
+
+	var resp EsSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decoding quoted post lookup response: %w", err)
+	}
+	out := make(map[string]string, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		var doc struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(hit.Source, &doc); err != nil {
+			return nil, fmt.Errorf("decoding quoted post document: %w", err)
+		}
+		out[hit.ID] = doc.Text
+	}
+	return out, nil
+}
+
 func (idx *Indexer) indexProfiles(ctx context.Context, jobs []*ProfileIndexJob) error {
 	ctx, span := tracer.Start(ctx, "indexProfiles")
 	defer span.End()
@@ -442,13 +697,13 @@ func (idx *Indexer) indexProfiles(ctx context.Context, jobs []*ProfileIndexJob)
 		job := jobs[i]
 
 		doc := TransformProfile(job.record, job.ident, job.rcid.String())
-		docBytes, err := json.Marshal(doc)
+		docBytes, err := profileUpsertJSON(doc)
 		if err != nil {
 			log.Warn("failed to marshal profile", "err", err)
 			return err
 		}
 
-		indexScript := []byte(fmt.Sprintf(`{"index":{"_id":"%s"}}%s`, job.ident.DID.String(), "\n"))
+		indexScript := []byte(fmt.Sprintf(`{"update":{"_id":"%s"}}%s`, job.ident.DID.String(), "\n"))
 		docBytes = append(docBytes, "\n"...)
 
 		buf.Grow(len(indexScript) + len(docBytes))
@@ -458,7 +713,7 @@ func (idx *Indexer) indexProfiles(ctx context.Context, jobs []*ProfileIndexJob)
 
 	log.Info("indexing profiles", "num_profiles", len(jobs))
 
-	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.profileIndex))
+	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.profileIndex), idx.escli.Bulk.WithRefresh(idx.refresh))
 	if err != nil {
 		log.Warn("failed to send bulk indexing request", "err", err)
 		return fmt.Errorf("failed to send bulk indexing request: %w", err)
@@ -480,6 +735,30 @@ func (idx *Indexer) indexProfiles(ctx context.Context, jobs []*ProfileIndexJob)
 	return nil
 }
 
+// Profile doc fields derived from the profile record which are omitted when empty. They are explicitly cleared on update, so that removing (eg) a description from the profile also removes it from the index.
+var profileRecordFields = []string{"display_name", "description", "img_alt_text", "self_label", "url", "domain", "tag", "emoji"}
+
+// profileUpsertJSON returns a bulk "update" body for a profile doc, which creates the doc if it doesn't exist. Unlike re-indexing the whole doc, fields which are loaded separately from the profile record (counts, labels, and pagerank) are left as-is.
+func profileUpsertJSON(doc ProfileDoc) ([]byte, error) {
+	docBytes, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(docBytes, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range profileRecordFields {
+		if _, ok := fields[name]; !ok {
+			fields[name] = json.RawMessage("null")
+		}
+	}
+	return json.Marshal(map[string]any{
+		"doc":           fields,
+		"doc_as_upsert": true,
+	})
+}
+
 // updateProfilePagranks uses the OpenSearch bulk API to update the pageranks for the given DIDs
 func (idx *Indexer) indexPageranks(ctx context.Context, pageranks []*PagerankIndexJob) error {
 	ctx, span := tracer.Start(ctx, "indexPageranks")
@@ -515,7 +794,100 @@ func (idx *Indexer) indexPageranks(ctx context.Context, pageranks []*PagerankInd
 		buf.Write(updateScriptJSON)
 	}
 
-	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.profileIndex))
+	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.profileIndex), idx.escli.Bulk.WithRefresh(idx.refresh))
+	if err != nil {
+		log.Warn("failed to send bulk indexing request", "err", err)
+		return fmt.Errorf("failed to send bulk indexing request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			log.Warn("failed to read bulk indexing response", "err", err)
+			return fmt.Errorf("failed to read bulk indexing response: %w", err)
+		}
+		log.Warn("opensearch bulk indexing error", "status_code", res.StatusCode, "response", res, "body", string(body))
+		return fmt.Errorf("bulk indexing error, code=%d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// indexProfileCounts uses the OpenSearch bulk API to update the follower and post counts for the given DIDs
+func (idx *Indexer) indexProfileCounts(ctx context.Context, counts []*ProfileCountsIndexJob) error {
+	ctx, span := tracer.Start(ctx, "indexProfileCounts")
+	defer span.End()
+	span.SetAttributes(attribute.Int("num_profiles", len(counts)))
+
+	log := idx.logger.With("op", "indexProfileCounts")
+
+	dids := make([]syntax.DID, len(counts))
+	scripts := make([]map[string]any, len(counts))
+	for i, c := range counts {
+		dids[i] = c.did
+		scripts[i] = map[string]any{
+			"script": map[string]any{
+				"source": "ctx._source.followers_count = params.followers_count; ctx._source.posts_count = params.posts_count",
+				"lang":   "painless",
+				"params": map[string]any{
+					"followers_count": c.followers,
+					"posts_count":     c.posts,
+				},
+			},
+		}
+	}
+	return idx.bulkUpdateProfiles(ctx, log, dids, scripts)
+}
+
+func (idx *Indexer) indexProfileLabels(ctx context.Context, jobs []*ProfileLabelsIndexJob) error {
+	ctx, span := tracer.Start(ctx, "indexProfileLabels")
+	defer span.End()
+	span.SetAttributes(attribute.Int("num_profiles", len(jobs)))
+
+	log := idx.logger.With("op", "indexProfileLabels")
+
+	dids := make([]syntax.DID, len(jobs))
+	scripts := make([]map[string]any, len(jobs))
+	for i, j := range jobs {
+		dids[i] = j.did
+		// an empty list replaces any previously indexed labels, so that removed labels are cleared
+		labels := j.labels
+		if labels == nil {
+			labels = []string{}
+		}
+		scripts[i] = map[string]any{
+			"script": map[string]any{
+				"source": "ctx._source.labels = params.labels",
+				"lang":   "painless",
+				"params": map[string]any{
+					"labels": labels,
+				},
+			},
+		}
+	}
+	return idx.bulkUpdateProfiles(ctx, log, dids, scripts)
+}
+
+// bulkUpdateProfiles sends one scripted update per profile doc, as a single bulk request. dids and scripts are parallel slices.
+func (idx *Indexer) bulkUpdateProfiles(ctx context.Context, log *slog.Logger, dids []syntax.DID, scripts []map[string]any) error {
+	var buf bytes.Buffer
+	for i, updateScript := range scripts {
+		updateScriptJSON, err := json.Marshal(updateScript)
+		if err != nil {
+			log.Warn("failed to marshal update script", "err", err)
+			return err
+		}
+
+		updateMetaJSON := []byte(fmt.Sprintf(`{"update":{"_id":"%s"}}%s`, dids[i].String(), "\n"))
+		updateScriptJSON = append(updateScriptJSON, "\n"...)
+
+		buf.Grow(len(updateMetaJSON) + len(updateScriptJSON))
+		buf.Write(updateMetaJSON)
+		buf.Write(updateScriptJSON)
+	}
+
+	res, err := idx.escli.Bulk(bytes.NewReader(buf.Bytes()), idx.escli.Bulk.WithIndex(idx.profileIndex), idx.escli.Bulk.WithRefresh(idx.refresh), idx.escli.Bulk.WithContext(ctx))
 	if err != nil {
 		log.Warn("failed to send bulk indexing request", "err", err)
 		return fmt.Errorf("failed to send bulk indexing request: %w", err)
@@ -580,6 +952,7 @@ func (idx *Indexer) updateUserHandle(ctx context.Context, did syntax.DID, handle
 		Index:      idx.profileIndex,
 		DocumentID: did.String(),
 		Body:       bytes.NewReader(b),
+		Refresh:    idx.refresh,
 	}
 
 	err = idx.indexLimiter.Wait(ctx)
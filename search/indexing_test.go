@@ -0,0 +1,241 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/ipfs/go-cid"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestDeletes(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var requests []string
+	var deleteQuery, deleteParams string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodDelete && r.URL.Path == "/palomar_post/_doc/did:plc:abc111_3kabc":
+			w.Write([]byte(`{"result": "deleted"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/palomar_post/_delete_by_query":
+			b, _ := io.ReadAll(r.Body)
+			deleteQuery = string(b)
+			deleteParams = r.URL.RawQuery
+			w.Write([]byte(`{"task": "node1:123"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"result": "not_found"}`))
+		}
+	}))
+	defer srv.Close()
+	escli, err := es.NewClient(es.Config{Addresses: []string{srv.URL}, DisableRetry: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := &Indexer{
+		escli:        escli,
+		postIndex:    "palomar_post",
+		profileIndex: "palomar_profile",
+		logger:       slog.Default(),
+		indexLimiter: rate.NewLimiter(rate.Inf, 1),
+	}
+
+	deletedBefore := testutil.ToFloat64(postsDeleted)
+	notFoundBefore := testutil.ToFloat64(postsDeleteNotFound)
+
+	assert.NoError(idx.DeletePost(ctx, syntax.ATURI("at://did:plc:abc111/app.bsky.feed.post/3kabc")))
+	assert.Equal(deletedBefore+1, testutil.ToFloat64(postsDeleted))
+
+	// not in the index
+	assert.NoError(idx.DeletePost(ctx, syntax.ATURI("at://did:plc:abc111/app.bsky.feed.post/3kzzz")))
+	assert.Equal(deletedBefore+1, testutil.ToFloat64(postsDeleted))
+	assert.Equal(notFoundBefore+1, testutil.ToFloat64(postsDeleteNotFound))
+
+	// firehose delete op path
+	assert.NoError(idx.handleDelete(ctx, "did:plc:abc111", "", "app.bsky.feed.post/3kabc"))
+	assert.Equal(deletedBefore+2, testutil.ToFloat64(postsDeleted))
+
+	// account posts are deleted by a background task, without forcing an index refresh
+	requests = nil
+	accountsBefore := testutil.ToFloat64(accountsDeleted)
+	assert.NoError(idx.DeleteAccount(ctx, syntax.DID("did:plc:abc111")))
+	assert.Equal(accountsBefore+1, testutil.ToFloat64(accountsDeleted))
+	assert.True(strings.Contains(deleteQuery, `"did":"did:plc:abc111"`), deleteQuery)
+	assert.Contains(deleteParams, "wait_for_completion=false")
+	assert.NotContains(deleteParams, "refresh")
+	assert.Equal([]string{
+		"POST /palomar_post/_delete_by_query",
+		"DELETE /palomar_profile/_doc/did:plc:abc111",
+	}, requests)
+}
+
+func TestIndexQuotedText(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var lookupQuery, bulkBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		b, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/palomar_post/_search":
+			lookupQuery = string(b)
+			w.Write([]byte(`{"hits": {"total": {"value": 1, "relation": "eq"}, "hits": [{"_id": "did:plc:abc222_3kold", "_source": {"text": "already indexed"}}]}}`))
+		case "/palomar_post/_bulk":
+			bulkBody = string(b)
+			w.Write([]byte(`{"errors": false, "items": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	escli, err := es.NewClient(es.Config{Addresses: []string{srv.URL}, DisableRetry: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := &Indexer{
+		escli:           escli,
+		postIndex:       "palomar_post",
+		logger:          slog.Default(),
+		indexQuotedText: true,
+	}
+
+	rcid, err := cid.Decode("bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote := func(rkey, text, quotedURI string) *PostIndexJob {
+		post := appbsky.FeedPost{Text: text}
+		if quotedURI != "" {
+			post.Embed = &appbsky.FeedPost_Embed{EmbedRecord: &appbsky.EmbedRecord{Record: &comatproto.RepoStrongRef{Uri: quotedURI}}}
+		}
+		return &PostIndexJob{did: syntax.DID("did:plc:abc111"), record: &post, rcid: rcid, rkey: rkey}
+	}
+
+	missingBefore := testutil.ToFloat64(postsQuotedTextMissing)
+	assert.NoError(idx.indexPosts(ctx, []*PostIndexJob{
+		quote("3kaaa", "original post", ""),
+		// quoting a post in the same batch
+		quote("3kbbb", "quoting", "at://did:plc:abc111/app.bsky.feed.post/3kaaa"),
+		// quoting an already-indexed post
+		quote("3kccc", "quoting", "at://did:plc:abc222/app.bsky.feed.post/3kold"),
+		// quoted post not available
+		quote("3kddd", "quoting", "at://did:plc:abc333/app.bsky.feed.post/3kgone"),
+	}))
+
+	// only posts not in the batch are looked up
+	assert.Contains(lookupQuery, "did:plc:abc222_3kold")
+	assert.Contains(lookupQuery, "did:plc:abc333_3kgone")
+	assert.NotContains(lookupQuery, "3kaaa")
+
+	docs := map[string]PostDoc{}
+	for _, line := range strings.Split(strings.TrimSpace(bulkBody), "\n") {
+		var doc PostDoc
+		assert.NoError(json.Unmarshal([]byte(line), &doc))
+		if doc.RecordRkey != "" {
+			docs[doc.RecordRkey] = doc
+		}
+	}
+	assert.Equal(4, len(docs))
+	assert.Nil(docs["3kaaa"].QuotedText)
+	if assert.NotNil(docs["3kbbb"].QuotedText) {
+		assert.Equal("original post", *docs["3kbbb"].QuotedText)
+	}
+	if assert.NotNil(docs["3kccc"].QuotedText) {
+		assert.Equal("already indexed", *docs["3kccc"].QuotedText)
+	}
+	assert.Nil(docs["3kddd"].QuotedText)
+	assert.Equal(missingBefore+1, testutil.ToFloat64(postsQuotedTextMissing))
+
+	// query side
+	params := PostSearchParams{Query: "hello", IncludeQuoted: true}
+	q, err := json.Marshal(postQuery(ctx, nil, &params))
+	assert.NoError(err)
+	assert.Contains(string(q), "quoted_text")
+	params = PostSearchParams{Query: "hello"}
+	q, err = json.Marshal(postQuery(ctx, nil, &params))
+	assert.NoError(err)
+	assert.NotContains(string(q), "quoted_text")
+}
+
+func TestIndexRefresh(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	refresh := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		refresh[r.URL.Path] = r.URL.Query().Get("refresh")
+		w.Write([]byte(`{"errors": false, "items": []}`))
+	}))
+	defer srv.Close()
+	escli, err := es.NewClient(es.Config{Addresses: []string{srv.URL}, DisableRetry: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := &Indexer{
+		escli:        escli,
+		postIndex:    "palomar_post",
+		profileIndex: "palomar_profile",
+		logger:       slog.Default(),
+		refresh:      "wait_for",
+	}
+
+	rcid, err := cid.Decode("bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(idx.indexPosts(ctx, []*PostIndexJob{
+		{did: syntax.DID("did:plc:abc111"), record: &appbsky.FeedPost{Text: "hello"}, rcid: rcid, rkey: "3kaaa"},
+	}))
+	assert.Equal("wait_for", refresh["/palomar_post/_bulk"])
+
+	assert.NoError(idx.RefreshIndices(ctx))
+	assert.Contains(refresh, "/palomar_post,palomar_profile/_refresh")
+}
+
+func TestProfileUpsertJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	name := "Alice"
+	raw, err := profileUpsertJSON(ProfileDoc{
+		DID:         "did:plc:abc111",
+		Handle:      "alice.example.com",
+		DisplayName: &name,
+		Tag:         []string{"art"},
+	})
+	assert.NoError(err)
+	var body struct {
+		Doc         map[string]any `json:"doc"`
+		DocAsUpsert bool           `json:"doc_as_upsert"`
+	}
+	assert.NoError(json.Unmarshal(raw, &body))
+	assert.True(body.DocAsUpsert)
+	assert.Equal("Alice", body.Doc["display_name"])
+	assert.Equal([]any{"art"}, body.Doc["tag"])
+
+	// record fields which are now empty are cleared
+	assert.Contains(body.Doc, "description")
+	assert.Nil(body.Doc["description"])
+
+	// fields which aren't from the profile record are not touched
+	assert.NotContains(body.Doc, "labels")
+	assert.NotContains(body.Doc, "followers_count")
+	assert.NotContains(body.Doc, "posts_count")
+}
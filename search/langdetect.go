@@ -0,0 +1,118 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Minimum number of letters in a text before attempting language detection
+const langDetectMinLetters = 8
+
+// Scripts which (mostly) correspond to a single language. Japanese kana take priority over Han characters, since Japanese text usually mixes both.
+var langDetectScripts = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Thai, "th"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Cyrillic, "ru"},
+}
+
+// Letters which appear in Ukrainian, but not Russian, Cyrillic text
+const ukrainianLetters = "іїєґІЇЄҐ"
+
+// Common short function words for languages written in Latin script. These are distinctive enough to tell apart languages on short texts, without needing a statistical model.
+var langDetectStopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "was", "you", "that", "this", "with", "for", "have", "not", "but", "what", "it's", "i'm", "of", "to", "just", "my"},
+	"es": {"el", "los", "las", "y", "que", "es", "está", "con", "para", "por", "una", "pero", "muy", "del", "lo", "como", "más", "yo", "mi"},
+	"pt": {"o", "os", "as", "e", "que", "é", "não", "com", "para", "uma", "mas", "muito", "do", "da", "isso", "eu", "meu", "você", "tá"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "mit", "ein", "eine", "auch", "aber", "auf", "für", "sie", "es", "zu", "wie"},
+	"fr": {"le", "la", "les", "et", "est", "un", "une", "des", "pas", "je", "que", "avec", "pour", "mais", "c'est", "du", "sur", "qui", "très"},
+	"it": {"il", "gli", "e", "che", "è", "non", "di", "un", "una", "per", "con", "ma", "sono", "anche", "questo", "della", "molto", "io"},
+	"nl": {"de", "het", "een", "en", "is", "niet", "ik", "dat", "met", "van", "voor", "maar", "ook", "op", "zijn", "je", "wat"},
+}
+
+var langDetectStopwordIndex = func() map[string][]string {
+	idx := map[string][]string{}
+	for lang, words := range langDetectStopwords {
+		for _, w := range words {
+			idx[w] = append(idx[w], lang)
+		}
+	}
+	return idx
+}()
+
+// detectLanguage is a lightweight language detector for post text, used at index time for posts which don't declare any languages. It returns an ISO 639-1 language code, or empty string if the language can't be determined with reasonable confidence.
+//
+// Non-Latin scripts are mapped directly to a language (eg, Hangul to Korean). Latin-script text is classified by counting common function words, and only a small set of European languages is recognized.
+func detectLanguage(text string) string {
+	counts := map[string]int{}
+	latin, total := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		total++
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, s := range langDetectScripts {
+			if unicode.Is(s.table, r) {
+				counts[s.lang]++
+				break
+			}
+		}
+	}
+	if total < langDetectMinLetters {
+		return ""
+	}
+
+	// any kana at all means Japanese, even if most characters are Han
+	if counts["ja"] > 0 && counts["ja"]+counts["zh"] > total/2 {
+		return "ja"
+	}
+	for lang, n := range counts {
+		if n > total/2 {
+			if lang == "ru" && strings.ContainsAny(text, ukrainianLetters) {
+				return "uk"
+			}
+			return lang
+		}
+	}
+	if latin > total/2 {
+		return detectLatinLanguage(text)
+	}
+	return ""
+}
+
+func detectLatinLanguage(text string) string {
+	hits := map[string]int{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		for _, lang := range langDetectStopwordIndex[w] {
+			hits[lang]++
+		}
+	}
+	best, bestCount, tied := "", 0, false
+	for lang, n := range hits {
+		if n > bestCount {
+			best, bestCount, tied = lang, n, false
+		} else if n == bestCount {
+			tied = true
+		}
+	}
+	// require at least two function word matches, and a clear winner
+	if bestCount < 2 || tied {
+		return ""
+	}
+	return best
+}
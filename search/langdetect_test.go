@@ -0,0 +1,65 @@
+package search
+
+import (
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		text string
+		lang string
+	}{
+		{"", ""},
+		{"lol", ""},
+		{"https://example.com/some/path", ""},
+		{"this is the best thing that I have seen all week", "en"},
+		{"el perro está en la casa con los niños", "es"},
+		{"eu não sei o que você está falando, muito estranho", "pt"},
+		{"ich weiß nicht, was das ist, aber es ist nicht gut", "de"},
+		{"je ne sais pas mais c'est très bien pour moi", "fr"},
+		{"学校から帰って熱いお風呂に入ったら力一杯がんばる", "ja"},
+		{"今天天气很好我们去公园散步吧", "zh"},
+		{"오늘 날씨가 정말 좋네요 산책 가요", "ko"},
+		{"Сегодня очень хорошая погода на улице", "ru"},
+		{"Сьогодні дуже гарна погода на вулиці", "uk"},
+		{"Σήμερα ο καιρός είναι πολύ ωραίος", "el"},
+	}
+
+	for _, f := range fixtures {
+		assert.Equal(f.lang, detectLanguage(f.text), f.text)
+	}
+}
+
+func TestLangDetectedFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	lang := syntax.Language("en")
+	p := PostSearchParams{Lang: &lang}
+	// declared languages only, by default
+	assert.Equal(2, len(p.Filters()))
+
+	p.LangIncludeDetected = true
+	filters := p.Filters()
+	assert.Equal(1, len(filters))
+	assert.NotNil(filters[0]["term"])
+
+	// detected languages are only used for posts without declared languages
+	post := appbsky.FeedPost{
+		Text:  "this is the best thing that I have seen all week",
+		Langs: []string{"de-DE"},
+	}
+	doc := TransformPost(&post, syntax.DID("did:plc:abc111"), "3k4duaz5vfs2b", "bafyreibjifzpqj6o6wcq3hejh7y4z4z2vmiklkvykc57tw3pcbx3kxifpm")
+	assert.False(doc.LangDetected)
+	assert.Equal([]string{"de"}, doc.LangCodeIso2)
+
+	post.Langs = nil
+	doc = TransformPost(&post, syntax.DID("did:plc:abc111"), "3k4duaz5vfs2b", "bafyreibjifzpqj6o6wcq3hejh7y4z4z2vmiklkvykc57tw3pcbx3kxifpm")
+	assert.True(doc.LangDetected)
+	assert.Equal([]string{"en"}, doc.LangCodeIso2)
+}
@@ -1,6 +1,7 @@
 package search
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strconv"
@@ -32,6 +33,16 @@ var postsDeleted = promauto.NewCounter(prometheus.CounterOpts{
 	Help: "Number of posts deleted",
 })
 
+var postsDeleteNotFound = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_posts_delete_not_found",
+	Help: "Number of post deletes for posts which were not in the index",
+})
+
+var accountsDeleted = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_accounts_deleted",
+	Help: "Number of deleted accounts removed from the index",
+})
+
 var profilesReceived = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "search_profiles_received",
 	Help: "Number of profiles received",
@@ -57,6 +68,68 @@ var currentSeq = promauto.NewGauge(prometheus.GaugeOpts{
 	Help: "Current sequence number",
 })
 
+var searchRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_requests_total",
+	Help: "Number of search operations, by operation",
+}, []string{"op"})
+
+var searchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_errors_total",
+	Help: "Number of failed search operations, by operation and error type",
+}, []string{"op", "type"})
+
+var searchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "search_duration_seconds",
+	Help:    "Total duration of search operations, including query parsing and result decoding",
+	Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+}, []string{"op"})
+
+var searchBackendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "search_backend_duration_seconds",
+	Help:    "Duration of requests to the search cluster, by index and request type",
+	Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+}, []string{"index", "kind"})
+
+var searchBackendRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_backend_retries_total",
+	Help: "Number of retried requests to the search cluster, after a transient error, by request type",
+}, []string{"kind"})
+
+var slowQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_slow_queries_total",
+	Help: "Number of requests to the search cluster which exceeded the slow query log threshold, by request type",
+}, []string{"kind"})
+
+var postsQuotedTextMissing = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_posts_quoted_text_missing",
+	Help: "Number of quote posts indexed without quoted text, because the quoted post was not found in the index",
+})
+
+var requestsRateLimited = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_requests_rate_limited_total",
+	Help: "Number of search API requests rejected by the rate limiter",
+})
+
+// observeSearch records metrics for a search operation which started at the given time
+func observeSearch(op string, start time.Time, err error) {
+	searchRequests.WithLabelValues(op).Inc()
+	searchDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		searchErrors.WithLabelValues(op, searchErrorType(err)).Inc()
+	}
+}
+
+func searchErrorType(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "backend"
+	}
+}
+
 var reqSz = promauto.NewHistogramVec(prometheus.HistogramOpts{
 	Name:    "http_request_size_bytes",
 	Help:    "A histogram of request sizes for requests.",
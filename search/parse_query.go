@@ -2,7 +2,9 @@ package search
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
 	"time"
 
@@ -50,7 +52,7 @@ func ParsePostQuery(ctx context.Context, dir identity.Directory, raw string, vie
 				}
 				continue
 			}
-			params.Mentions = &id.DID
+			params.Mentions = append(params.Mentions, id.DID)
 			continue
 		}
 
@@ -60,7 +62,8 @@ func ParsePostQuery(ctx context.Context, dir identity.Directory, raw string, vie
 			continue
 		}
 
-		switch tokParts[0] {
+		// operator names are case-insensitive ("Lang:en")
+		switch op := strings.ToLower(tokParts[0]); op {
 		case "did":
 			// Used as a hack for `from:me` when suppplied by the client
 			did, err := syntax.ParseDID(p)
@@ -69,41 +72,68 @@ func ParsePostQuery(ctx context.Context, dir identity.Directory, raw string, vie
 			}
 			params.Author = &did
 			continue
-		case "from", "to", "mentions":
+		case "from", "to", "mention", "mentions":
 			raw := tokParts[1]
 			if raw == "me" {
-				if viewer != nil && tokParts[0] == "from" {
+				if viewer != nil && op == "from" {
 					params.Author = viewer
 				} else if viewer != nil {
-					params.Mentions = viewer
+					params.Mentions = append(params.Mentions, *viewer)
 				}
 				continue
 			}
 			if strings.HasPrefix(raw, "@") && len(raw) > 1 {
 				raw = raw[1:]
 			}
-			handle, err := syntax.ParseHandle(raw)
-			if err != nil {
-				continue
-			}
-			id, err := dir.LookupHandle(ctx, handle)
-			if err != nil {
-				if err != identity.ErrHandleNotFound {
-					slog.Error("failed to resolve handle", "err", err)
+			// DIDs are accepted as well as handles, like the structured 'author' and 'mentions' params
+			var did syntax.DID
+			if strings.HasPrefix(raw, "did:") {
+				d, err := syntax.ParseDID(raw)
+				if err != nil {
+					continue
 				}
-				continue
+				did = d
+			} else {
+				handle, err := syntax.ParseHandle(raw)
+				if err != nil {
+					continue
+				}
+				id, err := dir.LookupHandle(ctx, handle)
+				if err != nil {
+					if err != identity.ErrHandleNotFound {
+						slog.Error("failed to resolve handle", "err", err)
+					}
+					continue
+				}
+				did = id.DID
 			}
-			if tokParts[0] == "from" {
-				params.Author = &id.DID
+			if op == "from" {
+				params.Author = &did
 			} else {
-				params.Mentions = &id.DID
+				params.Mentions = append(params.Mentions, did)
 			}
 			continue
 		case "http", "https":
 			params.URL = p
 			continue
 		case "domain":
-			params.Domain = tokParts[1]
+			if tokParts[1] != "" {
+				params.Domains = append(params.Domains, tokParts[1])
+			}
+			continue
+		case "has", "is":
+			switch op + ":" + tokParts[1] {
+			case "has:image", "has:images":
+				params.HasImage = true
+			case "has:video":
+				params.HasVideo = true
+			case "has:link":
+				params.HasLink = true
+			case "is:quote":
+				params.IsQuote = true
+			default:
+				keep = append(keep, p)
+			}
 			continue
 		case "lang":
 			lang, err := syntax.ParseLanguage(tokParts[1])
@@ -124,7 +154,7 @@ func ParsePostQuery(ctx context.Context, dir identity.Directory, raw string, vie
 					continue
 				}
 			}
-			if tokParts[0] == "since" {
+			if op == "since" {
 				params.Since = &dt
 			} else {
 				params.Until = &dt
@@ -149,3 +179,129 @@ func ParsePostQuery(ctx context.Context, dir identity.Directory, raw string, vie
 	params.Query = out
 	return params
 }
+
+// textQuery is the free-text portion of a post query, after facet syntax has been pulled out
+type textQuery struct {
+	// plain terms, which are passed through to a "simple_query_string" query
+	Terms []string
+	// quoted phrases, which must match exactly
+	Phrases []string
+	// terms or phrases prefixed with "-", which must not match
+	Excluded []string
+	// if set, plain terms are OR'd together, and at least this many (an integer, or percentage like "75%") must match. Otherwise all terms are required. See parseMinMatch.
+	MinMatch string
+}
+
+// parseTextQuery splits a query string in to plain terms, "quoted phrases", and -excluded terms (or -"excluded phrases").
+//
+// If the quotes in the query are unbalanced, they are ignored and the whole query is treated as plain terms.
+func parseTextQuery(raw string) textQuery {
+	var tq textQuery
+	if strings.Count(raw, "\"")%2 != 0 {
+		tq.Terms = strings.Fields(strings.ReplaceAll(raw, "\"", " "))
+		return tq
+	}
+
+	negateNext := false
+	for i, part := range strings.Split(raw, "\"") {
+		// odd segments are inside quotes
+		if i%2 == 1 {
+			phrase := strings.Join(strings.Fields(part), " ")
+			if phrase != "" {
+				if negateNext {
+					tq.Excluded = append(tq.Excluded, phrase)
+				} else {
+					tq.Phrases = append(tq.Phrases, phrase)
+				}
+			}
+			negateNext = false
+			continue
+		}
+		negateNext = false
+		fields := strings.Fields(part)
+		for j, tok := range fields {
+			if tok == "-" {
+				// a bare "-" directly before a quoted phrase negates the phrase
+				if j == len(fields)-1 && strings.HasSuffix(part, "-") {
+					negateNext = true
+				}
+				continue
+			}
+			if strings.HasPrefix(tok, "-") {
+				tq.Excluded = append(tq.Excluded, tok[1:])
+				continue
+			}
+			tq.Terms = append(tq.Terms, tok)
+		}
+	}
+	return tq
+}
+
+// ESQuery turns the text query in to elasticsearch/opensearch bool query DSL, matching against any of the given fields
+func (tq *textQuery) ESQuery(fields ...string) map[string]interface{} {
+	// match_phrase only works against a single field
+	phraseQuery := func(phrase string) map[string]interface{} {
+		if len(fields) == 1 {
+			return map[string]interface{}{
+				"match_phrase": map[string]interface{}{fields[0]: phrase},
+			}
+		}
+		return map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":  phrase,
+				"type":   "phrase",
+				"fields": fields,
+			},
+		}
+	}
+
+	must := []map[string]interface{}{}
+	if len(tq.Terms) > 0 {
+		sqs := map[string]interface{}{
+			"query":            strings.Join(tq.Terms, " "),
+			"fields":           fields,
+			"flags":            "AND|OR|PRECEDENCE|WHITESPACE",
+			"default_operator": "and",
+			"lenient":          true,
+			"analyze_wildcard": false,
+		}
+		if tq.MinMatch != "" {
+			sqs["default_operator"] = "or"
+			sqs["minimum_should_match"] = tq.MinMatch
+		}
+		must = append(must, map[string]interface{}{"simple_query_string": sqs})
+	}
+	for _, phrase := range tq.Phrases {
+		must = append(must, phraseQuery(phrase))
+	}
+	if len(must) == 0 {
+		must = append(must, map[string]interface{}{"match_all": map[string]interface{}{}})
+	}
+
+	mustNot := []map[string]interface{}{}
+	for _, ex := range tq.Excluded {
+		mustNot = append(mustNot, phraseQuery(ex))
+	}
+
+	boolQuery := map[string]interface{}{
+		"must": must,
+	}
+	if len(mustNot) > 0 {
+		boolQuery["must_not"] = mustNot
+	}
+	return map[string]interface{}{"bool": boolQuery}
+}
+
+// parseMinMatch validates a "minimum_should_match" value: either an integer number of terms, or a percentage of terms (eg, "75%"). Negative values are the number (or percentage) of terms which may be missing. Combinations (eg, "3<90%") are not supported.
+func parseMinMatch(raw string) (string, error) {
+	val := strings.TrimSpace(raw)
+	num, isPercent := strings.CutSuffix(val, "%")
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return "", fmt.Errorf("expected an integer or percentage: %s", raw)
+	}
+	if isPercent && (n < -100 || n > 100) {
+		return "", fmt.Errorf("percentage out of range: %s", raw)
+	}
+	return val, nil
+}
@@ -94,5 +94,238 @@ func TestParseQuery(t *testing.T) {
 		assert.Equal("did:plc:abc222", p.Author.String())
 	}
 
-	// TODO: more parsing tests: bare handles, to:, since:, until:, URL, domain:, lang
+	q10 := "news domain:example.com mention:@known.example.com"
+	p = ParsePostQuery(ctx, &dir, q10, nil)
+	assert.Equal("news", p.Query)
+	assert.Equal([]string{"example.com"}, p.Domains)
+	assert.Equal([]syntax.DID{"did:plc:abc222"}, p.Mentions)
+	assert.Equal(2, len(p.Filters()))
+
+	q11 := "domain:one.example.com domain:two.example.com"
+	p = ParsePostQuery(ctx, &dir, q11, nil)
+	assert.Equal("*", p.Query)
+	assert.Equal([]string{"one.example.com", "two.example.com"}, p.Domains)
+	assert.Equal(2, len(p.Filters()))
+
+	q12 := "hello lang:ja since:2024-01-02 until:2024-02-01T12:00:00Z"
+	p = ParsePostQuery(ctx, &dir, q12, nil)
+	assert.Equal("hello", p.Query)
+	if assert.NotNil(p.Lang) {
+		assert.Equal("ja", p.Lang.String())
+	}
+	if assert.NotNil(p.Since) {
+		assert.Equal("2024-01-02T00:00:00Z", p.Since.String())
+	}
+	if assert.NotNil(p.Until) {
+		assert.Equal("2024-02-01T12:00:00Z", p.Until.String())
+	}
+
+	// operator names are case-insensitive, and from:/to: also take DIDs
+	q13 := "hello Lang:en FROM:did:plc:abc333 to:known.example.com"
+	p = ParsePostQuery(ctx, &dir, q13, nil)
+	assert.Equal("hello", p.Query)
+	if assert.NotNil(p.Lang) {
+		assert.Equal("en", p.Lang.String())
+	}
+	if assert.NotNil(p.Author) {
+		assert.Equal("did:plc:abc333", p.Author.String())
+	}
+	assert.Equal([]syntax.DID{"did:plc:abc222"}, p.Mentions)
+
+	// operators inside quotes are left as literal text
+	q14 := `"from:known.example.com" stuff`
+	p = ParsePostQuery(ctx, &dir, q14, nil)
+	assert.Equal(q14, p.Query)
+	assert.Nil(p.Author)
+
+	// inline operators are merged with structured params, which take priority
+	structured := PostSearchParams{Query: "hello lang:ja from:known.example.com"}
+	lang := syntax.Language("en")
+	structured.Lang = &lang
+	qp := ParsePostQuery(ctx, &dir, structured.Query, nil)
+	structured.Update(&qp)
+	assert.Equal("hello", structured.Query)
+	assert.Equal("en", structured.Lang.String())
+	if assert.NotNil(structured.Author) {
+		assert.Equal("did:plc:abc222", structured.Author.String())
+	}
+
+	// TODO: more parsing tests: bare handles, URL
+}
+
+func TestParseTextQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	tq := parseTextQuery(`cool "exact phrase" -bad stuff`)
+	assert.Equal([]string{"cool", "stuff"}, tq.Terms)
+	assert.Equal([]string{"exact phrase"}, tq.Phrases)
+	assert.Equal([]string{"bad"}, tq.Excluded)
+
+	tq = parseTextQuery(`"only  a   phrase"`)
+	assert.Empty(tq.Terms)
+	assert.Equal([]string{"only a phrase"}, tq.Phrases)
+	assert.Empty(tq.Excluded)
+
+	tq = parseTextQuery(`thing -"not this phrase" -nope`)
+	assert.Equal([]string{"thing"}, tq.Terms)
+	assert.Empty(tq.Phrases)
+	assert.Equal([]string{"not this phrase", "nope"}, tq.Excluded)
+
+	// unbalanced quotes degrade to plain terms
+	tq = parseTextQuery(`some "unbalanced phrase`)
+	assert.Equal([]string{"some", "unbalanced", "phrase"}, tq.Terms)
+	assert.Empty(tq.Phrases)
+	assert.Empty(tq.Excluded)
+
+	// wildcard (empty) query passes through as a term
+	tq = parseTextQuery("*")
+	assert.Equal([]string{"*"}, tq.Terms)
+
+	tq = parseTextQuery(`cool "exact phrase" -bad`)
+	q := tq.ESQuery("everything")
+	b := q["bool"].(map[string]interface{})
+	must := b["must"].([]map[string]interface{})
+	assert.Equal(2, len(must))
+	assert.Equal("cool", must[0]["simple_query_string"].(map[string]interface{})["query"])
+	assert.Equal(map[string]interface{}{"everything": "exact phrase"}, must[1]["match_phrase"])
+	mustNot := b["must_not"].([]map[string]interface{})
+	assert.Equal(1, len(mustNot))
+	assert.Equal(map[string]interface{}{"everything": "bad"}, mustNot[0]["match_phrase"])
+
+	// multiple fields use multi_match for phrases
+	q = tq.ESQuery("text.en", "everything")
+	b = q["bool"].(map[string]interface{})
+	must = b["must"].([]map[string]interface{})
+	assert.Equal([]string{"text.en", "everything"}, must[0]["simple_query_string"].(map[string]interface{})["fields"])
+	assert.Equal("phrase", must[1]["multi_match"].(map[string]interface{})["type"])
+
+	assert.Equal("text.en", postTextLangField(syntax.Language("en-US")))
+	assert.Equal("everything_ja", postTextLangField(syntax.Language("ja")))
+	assert.Equal("", postTextLangField(syntax.Language("tlh")))
+
+	// only exclusions matches everything else
+	tq = parseTextQuery(`-bad`)
+	q = tq.ESQuery("everything")
+	b = q["bool"].(map[string]interface{})
+	must = b["must"].([]map[string]interface{})
+	assert.Equal(1, len(must))
+	assert.NotNil(must[0]["match_all"])
+}
+
+func TestMinMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	for raw, ok := range map[string]bool{
+		"2":     true,
+		"-1":    true,
+		"75%":   true,
+		"-25%":  true,
+		" 50% ": true,
+		"":      false,
+		"%":     false,
+		"abc":   false,
+		"1.5":   false,
+		"150%":  false,
+		"3<90%": false,
+	} {
+		_, err := parseMinMatch(raw)
+		assert.Equal(ok, err == nil, raw)
+	}
+
+	// default requires all terms
+	tq := parseTextQuery("one two three")
+	sqs := tq.ESQuery("everything")["bool"].(map[string]interface{})["must"].([]map[string]interface{})[0]["simple_query_string"].(map[string]interface{})
+	assert.Equal("and", sqs["default_operator"])
+	assert.Nil(sqs["minimum_should_match"])
+
+	tq.MinMatch = "75%"
+	sqs = tq.ESQuery("everything")["bool"].(map[string]interface{})["must"].([]map[string]interface{})[0]["simple_query_string"].(map[string]interface{})
+	assert.Equal("or", sqs["default_operator"])
+	assert.Equal("75%", sqs["minimum_should_match"])
+}
+
+func TestEmbedFilters(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+
+	p := ParsePostQuery(ctx, &dir, "cats has:image is:quote has:nothing", nil)
+	assert.Equal("cats has:nothing", p.Query)
+	assert.True(p.HasImage)
+	assert.True(p.IsQuote)
+	assert.False(p.HasVideo)
+	assert.Equal([]map[string]interface{}{
+		{"term": map[string]interface{}{"has_image": true}},
+		{"term": map[string]interface{}{"is_quote": true}},
+	}, p.Filters())
+
+	// query string filters combine with explicit params
+	params := PostSearchParams{HasVideo: true, EmbedType: "record_with_media"}
+	params.Update(&p)
+	assert.Equal([]map[string]interface{}{
+		{"term": map[string]interface{}{"embed_type": "record_with_media"}},
+		{"term": map[string]interface{}{"has_image": true}},
+		{"term": map[string]interface{}{"has_video": true}},
+		{"term": map[string]interface{}{"is_quote": true}},
+	}, params.Filters())
+}
+
+func TestTagsMode(t *testing.T) {
+	assert := assert.New(t)
+
+	p := PostSearchParams{Tags: []string{"one", "two"}}
+	assert.Equal(2, len(p.Filters()))
+
+	p.TagsMode = "all"
+	assert.Equal(2, len(p.Filters()))
+
+	p.TagsMode = "any"
+	filters := p.Filters()
+	assert.Equal(1, len(filters))
+	b := filters[0]["bool"].(map[string]interface{})
+	assert.Equal(1, b["minimum_should_match"])
+	assert.Equal(2, len(b["should"].([]map[string]interface{})))
+
+	// a single tag is just a plain filter either way
+	p.Tags = []string{"one"}
+	filters = p.Filters()
+	assert.Equal(1, len(filters))
+	assert.NotNil(filters[0]["term"])
+
+	// other filters are still ANDed
+	did := syntax.DID("did:plc:abc222")
+	p = PostSearchParams{Tags: []string{"one", "two"}, TagsMode: "any", Author: &did}
+	assert.Equal(2, len(p.Filters()))
+}
+
+func TestActorsAndLangsMode(t *testing.T) {
+	assert := assert.New(t)
+
+	one := syntax.DID("did:plc:abc111")
+	two := syntax.DID("did:plc:abc222")
+	en := syntax.Language("en")
+	p := PostSearchParams{Author: &one, Authors: []syntax.DID{two}, LangIncludeDetected: true}
+	assert.Equal(2, len(p.Filters()))
+
+	p.ActorsMode = "any"
+	filters := p.Filters()
+	if assert.Equal(1, len(filters)) {
+		b := filters[0]["bool"].(map[string]interface{})
+		assert.Equal(2, len(b["should"].([]map[string]interface{})))
+	}
+
+	// langs combine the same way, and separately from authors
+	p.Lang = &en
+	p.Langs = []syntax.Language{"ja"}
+	assert.Equal(3, len(p.Filters()))
+	p.LangsMode = "any"
+	assert.Equal(2, len(p.Filters()))
+
+	// a single value is a plain filter in either mode
+	p = PostSearchParams{Author: &one, ActorsMode: "any", Lang: &en, LangsMode: "any", LangIncludeDetected: true}
+	filters = p.Filters()
+	if assert.Equal(2, len(filters)) {
+		assert.NotNil(filters[0]["term"])
+		assert.NotNil(filters[1]["term"])
+	}
 }
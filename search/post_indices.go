@@ -0,0 +1,100 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Placeholder in the post index config for time-sharded (monthly) post indices. For example, "palomar_post_{month}" refers to indices like "palomar_post_2024-01", "palomar_post_2024-02", etc, where each index holds the posts created in that month (by "created_at").
+//
+// The post index config can also be a comma-separated list of index names (or patterns), which are all searched.
+const PostIndexMonthPlaceholder = "{month}"
+
+// Time layout for the month part of time-sharded post index names
+const postIndexMonthLayout = "2006-01"
+
+// If a date-bounded search would span more than this many monthly indices, the wildcard pattern is used instead of listing them
+const maxPostIndexMonths = 24
+
+// IsMultiPostIndex returns true if the post index config refers to more than a single concrete index: either a list, or a time-sharded pattern. Such configs can only be searched; the indexer requires a single index.
+func IsMultiPostIndex(index string) bool {
+	return strings.Contains(index, ",") || strings.Contains(index, PostIndexMonthPlaceholder)
+}
+
+// ValidatePostIndex checks the syntax of a post index config
+func ValidatePostIndex(index string) error {
+	for _, name := range strings.Split(index, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("empty post index name in %q", index)
+		}
+		if strings.Count(name, PostIndexMonthPlaceholder) > 1 {
+			return fmt.Errorf("post index pattern can only contain %s once: %s", PostIndexMonthPlaceholder, name)
+		}
+	}
+	return nil
+}
+
+// allPostIndices returns an index expression matching every post index in the config, with any time-sharded patterns replaced by a wildcard
+func allPostIndices(index string) string {
+	return resolvePostIndices(index, nil, nil, time.Now())
+}
+
+// resolvePostIndices turns a post index config in to the index expression to search, for posts created in the range [since, until). Time-sharded patterns are expanded to only the monthly indices overlapping that range. If the range is unbounded at the start, or too long, the pattern is replaced with a wildcard instead.
+//
+// Plain index names are passed through unchanged.
+func resolvePostIndices(index string, since, until *syntax.Datetime, now time.Time) string {
+	if !IsMultiPostIndex(index) {
+		return index
+	}
+	var out []string
+	for _, name := range strings.Split(index, ",") {
+		name = strings.TrimSpace(name)
+		if !strings.Contains(name, PostIndexMonthPlaceholder) {
+			out = append(out, name)
+			continue
+		}
+		months := postIndexMonths(since, until, now)
+		if months == nil {
+			out = append(out, strings.Replace(name, PostIndexMonthPlaceholder, "*", 1))
+			continue
+		}
+		for _, m := range months {
+			out = append(out, strings.Replace(name, PostIndexMonthPlaceholder, m, 1))
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+// postIndexMonths returns the months (in index name format) overlapping [since, until), or nil if all indices need to be searched. Future posts are never returned by searches, so an open-ended range stops at the current month.
+func postIndexMonths(since, until *syntax.Datetime, now time.Time) []string {
+	if since == nil {
+		return nil
+	}
+	start := since.Time().UTC()
+	if start.IsZero() {
+		return nil
+	}
+	end := now.UTC()
+	if until != nil {
+		// until is exclusive
+		end = until.Time().UTC().Add(-time.Nanosecond)
+	}
+	if end.Before(start) {
+		// empty range: no posts can match, but an index is still needed for the request
+		end = start
+	}
+	first := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var months []string
+	for m := first; !m.After(last); m = m.AddDate(0, 1, 0) {
+		if len(months) >= maxPostIndexMonths {
+			return nil
+		}
+		months = append(months, m.Format(postIndexMonthLayout))
+	}
+	return months
+}
@@ -0,0 +1,71 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvePostIndices(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	dt := func(s string) *syntax.Datetime {
+		d := syntax.Datetime(s)
+		return &d
+	}
+
+	fixtures := []struct {
+		index string
+		since *syntax.Datetime
+		until *syntax.Datetime
+		out   string
+	}{
+		{index: "palomar_post", since: dt("2024-01-01T00:00:00Z"), out: "palomar_post"},
+		{index: "posts_a,posts_b", out: "posts_a,posts_b"},
+		{index: "palomar_post_{month}", out: "palomar_post_*"},
+		{index: "palomar_post_{month}", until: dt("2024-01-01T00:00:00Z"), out: "palomar_post_*"},
+		{index: "palomar_post_{month}", since: dt("2024-02-10T00:00:00Z"), out: "palomar_post_2024-02,palomar_post_2024-03"},
+		// until is exclusive
+		{index: "palomar_post_{month}", since: dt("2023-12-10T00:00:00Z"), until: dt("2024-01-01T00:00:00Z"), out: "palomar_post_2023-12"},
+		{index: "palomar_post_{month}", since: dt("2023-12-10T00:00:00Z"), until: dt("2024-01-01T00:00:01Z"), out: "palomar_post_2023-12,palomar_post_2024-01"},
+		// empty range
+		{index: "palomar_post_{month}", since: dt("2024-02-10T00:00:00Z"), until: dt("2023-01-01T00:00:00Z"), out: "palomar_post_2024-02"},
+		// too many months
+		{index: "palomar_post_{month}", since: dt("2020-01-01T00:00:00Z"), out: "palomar_post_*"},
+		{index: "palomar_post_old,palomar_post_{month}", since: dt("2024-03-01T00:00:00Z"), out: "palomar_post_old,palomar_post_2024-03"},
+	}
+	for _, fix := range fixtures {
+		assert.Equal(fix.out, resolvePostIndices(fix.index, fix.since, fix.until, now), fix.index)
+	}
+
+	assert.NoError(ValidatePostIndex("palomar_post"))
+	assert.NoError(ValidatePostIndex("a, b_{month}"))
+	assert.Error(ValidatePostIndex("a,,b"))
+	assert.Error(ValidatePostIndex("a_{month}_{month}"))
+}
+
+func TestSearchPostIndexPruning(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := identity.NewMockDirectory()
+	cli := &testRecordingClient{}
+
+	// date range from the query string is used too
+	_, err := DoSearchPosts(ctx, &dir, cli, "palomar_post_{month}", &PostSearchParams{Query: "hello since:2023-11-05 until:2024-01-02", Size: 10})
+	assert.NoError(err)
+	assert.Equal("palomar_post_2023-11,palomar_post_2023-12,palomar_post_2024-01", cli.index)
+
+	_, err = DoCountPosts(ctx, &dir, cli, "palomar_post_{month}", &PostSearchParams{Query: "hello"})
+	assert.NoError(err)
+	assert.Equal("palomar_post_*", cli.index)
+
+	_, err = DoLookupPost(ctx, cli, "palomar_post_{month}", "did:plc:abc111_3kabc")
+	assert.NoError(err)
+	assert.Equal("palomar_post_*", cli.index)
+}
@@ -1,18 +1,17 @@
 package search
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log/slog"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
 
-	es "github.com/opensearch-project/opensearch-go/v2"
 	"go.opentelemetry.io/otel/attribute"
 )
 
@@ -21,21 +20,46 @@ type EsSearchHit struct {
 	ID     string          `json:"_id"`
 	Score  float64         `json:"_score"`
 	Source json.RawMessage `json:"_source"`
+	// sort values for this hit, only included if the query had an explicit sort
+	Sort []json.RawMessage `json:"sort,omitempty"`
+	// highlighted fragments by field name, only included if highlighting was requested
+	Highlight map[string][]string `json:"highlight,omitempty"`
+	// only included if the query used field collapsing
+	InnerHits map[string]EsInnerHits `json:"inner_hits,omitempty"`
+	// scoring explanation, only included if the query requested "explain"
+	Explanation json.RawMessage `json:"_explanation,omitempty"`
+}
+
+type EsInnerHits struct {
+	Hits EsSearchHits `json:"hits"`
 }
 
 type EsSearchHits struct {
-	Total struct { // not used
-		Value    int
-		Relation string
-	} `json:"total"`
+	Total    EsTotalHits   `json:"total"`
 	MaxScore float64       `json:"max_score"`
 	Hits     []EsSearchHit `json:"hits"`
 }
 
+type EsAggregationBucket struct {
+	Key      string `json:"key"`
+	DocCount int64  `json:"doc_count"`
+}
+
+type EsAggregation struct {
+	Buckets []EsAggregationBucket `json:"buckets"`
+}
+
 type EsSearchResponse struct {
-	Took     int          `json:"took"`
-	TimedOut bool         `json:"timed_out"`
-	Hits     EsSearchHits `json:"hits"`
+	Took         int                      `json:"took"`
+	TimedOut     bool                     `json:"timed_out"`
+	Hits         EsSearchHits             `json:"hits"`
+	Aggregations map[string]EsAggregation `json:"aggregations,omitempty"`
+	// latest point-in-time ID, for searches against a point-in-time (see PointInTimeClient)
+	PitID string `json:"pit_id,omitempty"`
+}
+
+type EsCountResponse struct {
+	Count int64 `json:"count"`
 }
 
 type UserResult struct {
@@ -52,27 +76,80 @@ type PostSearchResult struct {
 
 type PostSearchParams struct {
 	Query    string           `json:"q"`
-	Sort     string           `json:"sort"`
+	Sort     string           `json:"sort"` // "latest" (reverse-chronological, default) or "top" (relevance)
 	Author   *syntax.DID      `json:"author"`
 	Since    *syntax.Datetime `json:"since"`
 	Until    *syntax.Datetime `json:"until"`
-	Mentions *syntax.DID      `json:"mentions"`
+	Mentions []syntax.DID     `json:"mentions"`
 	Lang     *syntax.Language `json:"lang"`
-	Domain   string           `json:"domain"`
+	Domains  []string         `json:"domain"`
 	URL      string           `json:"url"`
 	Tags     []string         `json:"tag"`
-	Viewer   *syntax.DID      `json:"viewer"`
-	Offset   int              `json:"offset"`
-	Size     int              `json:"size"`
+	TagsMode string           `json:"tags_mode"` // "all" (default) requires every tag to match; "any" requires at least one
+	// Additional authors and languages, from repeated "author" and "lang" params. These are combined with Author and Lang according to ActorsMode and LangsMode, which work the same as TagsMode. A post only has one author, so "all" with several authors matches nothing.
+	Authors    []syntax.DID      `json:"authors,omitempty"`
+	Langs      []syntax.Language `json:"langs,omitempty"`
+	ActorsMode string            `json:"actors_mode,omitempty"`
+	LangsMode  string            `json:"langs_mode,omitempty"`
+	Viewer     *syntax.DID       `json:"viewer"`
+	Offset     int               `json:"offset"`
+	Size       int               `json:"size"`
+	// Whether the "lang" filter also matches posts whose language was detected at index time, instead of declared in the record
+	LangIncludeDetected bool `json:"langs_include_detected,omitempty"`
+	// Posts by these accounts are excluded from results (eg, a viewer's blocks and mutes). At most maxExcludeActors.
+	ExcludeActors []syntax.DID `json:"exclude_actors,omitempty"`
+	// Restricts results to a single thread: the root post itself, and any replies to it
+	ThreadRoot *syntax.ATURI `json:"thread_root,omitempty"`
+	// Restricts results to posts with this type of top-level embed (see PostEmbedTypes)
+	EmbedType string `json:"embed_type,omitempty"`
+	// Restricts results to posts with images, video, links, or quoted posts. These are independent, and combine with each other (and EmbedType) as an AND.
+	HasImage bool `json:"has_image,omitempty"`
+	HasVideo bool `json:"has_video,omitempty"`
+	HasLink  bool `json:"has_link,omitempty"`
+	IsQuote  bool `json:"is_quote,omitempty"`
+	// Whether the query text also matches the text of quoted posts (see PostDoc.QuotedText), not just the post itself
+	IncludeQuoted bool `json:"include_quoted,omitempty"`
+	// Minimum number of plain query terms which must match, as an integer or percentage (eg, "75%"). If empty, all terms must match.
+	MinMatch string `json:"min_match,omitempty"`
+	// If set, relevance scores are multiplied by a Gaussian decay on post creation time, with this scale (an ES time unit, eg "7d"): a post this old scores half as much as a brand new one. Only applies to "top" sort; "latest" is already ordered by time, so this is ignored.
+	RecencyBoost string `json:"recency_boost,omitempty"`
+	// Whether to count all hits exactly, instead of stopping at a lower bound (ES defaults to 10,000). This is more expensive for broad queries.
+	TrackTotalHits bool `json:"track_total_hits,omitempty"`
+	// If non-zero, the server's result cap (see ServerConfig.MaxResults): hits are counted only up to this number, even with TrackTotalHits
+	MaxResults int `json:"-"`
+	// Whether to request highlighted fragments of post text for each hit
+	Highlight bool `json:"highlight,omitempty"`
+	// Whether to collapse posts with duplicate text (after normalization) in to a single hit. Not compatible with "search_after" pagination.
+	Collapse bool `json:"collapse,omitempty"`
+	// Names of facets (see PostFacetFields) to aggregate over the full result set
+	Facets []string `json:"facets,omitempty"`
+	// Sort values of the last hit from a previous page, for deep pagination with "search_after". When set, Offset is ignored. This is what opaque (non-integer) cursors decode to; see cursor.go for the format.
+	After []json.RawMessage `json:"after,omitempty"`
+	// Whether to request a scoring explanation for each hit. This is expensive, and only for debugging relevance.
+	Explain bool `json:"-"`
+	// Document ID (see PostDoc.DocId) of a post which was just indexed. If set, and the post isn't in the results, the search is retried briefly, to allow for the index refresh delay (see Server.doSearchPosts)
+	WaitFor string `json:"-"`
+	// Additional filter clause in raw query DSL. Must be checked with ValidateRawQuery before use; never parsed from user-facing query params.
+	RawFilter map[string]any `json:"-"`
 }
 
 type ActorSearchParams struct {
-	Query     string       `json:"q"`
-	Typeahead bool         `json:"typeahead"`
-	Follows   []syntax.DID `json:"follows"`
-	Viewer    *syntax.DID  `json:"viewer"`
-	Offset    int          `json:"offset"`
-	Size      int          `json:"size"`
+	Query        string       `json:"q"`
+	Typeahead    bool         `json:"typeahead"`
+	Fuzzy        bool         `json:"fuzzy"`
+	Sort         string       `json:"sort"` // "relevance" (default), "followers", or "posts"
+	MinFollowers *int64       `json:"min_followers"`
+	Follows      []syntax.DID `json:"follows"`
+	Viewer       *syntax.DID  `json:"viewer"`
+	// Down-weight profiles with keyword-stuffed display names (see ProfileDoc.Spamminess). Not applied to typeahead, or when sorting by counts
+	SpamPenalty bool `json:"spam_penalty"`
+	// Account label filters. Values must be in IndexedAccountLabels
+	RequireLabels []string `json:"require_labels"`
+	ExcludeLabels []string `json:"exclude_labels"`
+	Offset        int      `json:"offset"`
+	Size          int      `json:"size"`
+	// If non-zero, the server's result cap (see ServerConfig.MaxResults): hits are counted only up to this number
+	MaxResults int `json:"-"`
 }
 
 // Merges params from another param object in to this one. Intended to meld parsed query with HTTP query params, so not all functionality is supported, and priority is with the "current" object
@@ -87,14 +164,14 @@ func (p *PostSearchParams) Update(other *PostSearchParams) {
 	if p.Until == nil {
 		p.Until = other.Until
 	}
-	if p.Mentions == nil {
+	if len(p.Mentions) == 0 {
 		p.Mentions = other.Mentions
 	}
 	if p.Lang == nil {
 		p.Lang = other.Lang
 	}
-	if p.Domain == "" {
-		p.Domain = other.Domain
+	if len(p.Domains) == 0 {
+		p.Domains = other.Domains
 	}
 	if p.URL == "" {
 		p.URL = other.URL
@@ -102,39 +179,77 @@ func (p *PostSearchParams) Update(other *PostSearchParams) {
 	if len(p.Tags) == 0 {
 		p.Tags = other.Tags
 	}
+	p.HasImage = p.HasImage || other.HasImage
+	p.HasVideo = p.HasVideo || other.HasVideo
+	p.HasLink = p.HasLink || other.HasLink
+	p.IsQuote = p.IsQuote || other.IsQuote
+}
+
+// appendModeFilters adds a group of filters for one multi-valued param: with mode "any", as a single clause which matches if any of them do; otherwise (mode "all"), as separate filters, which must all match
+func appendModeFilters(filters, group []map[string]interface{}, mode string) []map[string]interface{} {
+	if mode == "any" && len(group) > 1 {
+		return append(filters, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should":               group,
+				"minimum_should_match": 1,
+			},
+		})
+	}
+	return append(filters, group...)
 }
 
 // Filters turns search params in to actual elasticsearch/opensearch filter DSL
 func (p *PostSearchParams) Filters() []map[string]interface{} {
 	var filters []map[string]interface{}
 
+	var authorFilters []map[string]interface{}
+	authors := p.Authors
 	if p.Author != nil {
-		filters = append(filters, map[string]interface{}{
+		authors = append([]syntax.DID{*p.Author}, authors...)
+	}
+	for _, did := range authors {
+		authorFilters = append(authorFilters, map[string]interface{}{
 			"term": map[string]interface{}{"did": map[string]interface{}{
-				"value":            p.Author.String(),
+				"value":            did.String(),
 				"case_insensitive": true,
 			}},
 		})
 	}
+	filters = appendModeFilters(filters, authorFilters, p.ActorsMode)
 
-	if p.Mentions != nil {
+	for _, did := range p.Mentions {
 		filters = append(filters, map[string]interface{}{
 			"term": map[string]interface{}{"mention_did": map[string]interface{}{
-				"value":            p.Mentions.String(),
+				"value":            did.String(),
 				"case_insensitive": true,
 			}},
 		})
 	}
 
+	var langFilters []map[string]interface{}
+	langs := p.Langs
 	if p.Lang != nil {
+		langs = append([]syntax.Language{*p.Lang}, langs...)
+	}
+	for _, lang := range langs {
 		// TODO: extracting just the 2-char code would be good
-		filters = append(filters, map[string]interface{}{
+		langFilters = append(langFilters, map[string]interface{}{
 			"term": map[string]interface{}{"lang_code_iso2": map[string]interface{}{
-				"value":            p.Lang.String(),
+				"value":            lang.String(),
 				"case_insensitive": true,
 			}},
 		})
 	}
+	filters = appendModeFilters(filters, langFilters, p.LangsMode)
+	if len(langs) > 0 {
+		if !p.LangIncludeDetected {
+			filters = append(filters, map[string]interface{}{
+				"bool": map[string]interface{}{
+					"must_not": map[string]interface{}{"term": map[string]interface{}{"lang_detected": true}},
+				},
+			})
+		}
+	}
 
 	if p.Since != nil {
 		filters = append(filters, map[string]interface{}{
@@ -165,17 +280,18 @@ func (p *PostSearchParams) Filters() []map[string]interface{} {
 		})
 	}
 
-	if p.Domain != "" {
+	for _, domain := range p.Domains {
 		filters = append(filters, map[string]interface{}{
 			"term": map[string]interface{}{"domain": map[string]interface{}{
-				"value":            p.Domain,
+				"value":            domain,
 				"case_insensitive": true,
 			}},
 		})
 	}
 
+	var tagFilters []map[string]interface{}
 	for _, tag := range p.Tags {
-		filters = append(filters, map[string]interface{}{
+		tagFilters = append(tagFilters, map[string]interface{}{
 			"term": map[string]interface{}{
 				"tag": map[string]interface{}{
 					"value":            tag,
@@ -184,6 +300,70 @@ func (p *PostSearchParams) Filters() []map[string]interface{} {
 			},
 		})
 	}
+	filters = appendModeFilters(filters, tagFilters, p.TagsMode)
+
+	if p.EmbedType != "" {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"embed_type": p.EmbedType},
+		})
+	}
+	for _, f := range []struct {
+		field   string
+		enabled bool
+	}{
+		{"has_image", p.HasImage},
+		{"has_video", p.HasVideo},
+		{"has_link", p.HasLink},
+		{"is_quote", p.IsQuote},
+	} {
+		if f.enabled {
+			filters = append(filters, map[string]interface{}{
+				"term": map[string]interface{}{f.field: true},
+			})
+		}
+	}
+
+	if len(p.ExcludeActors) > 0 {
+		dids := make([]string, len(p.ExcludeActors))
+		for i, did := range p.ExcludeActors {
+			dids[i] = did.String()
+		}
+		filters = append(filters, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": map[string]interface{}{"terms": map[string]interface{}{"did": dids}},
+			},
+		})
+	}
+
+	if p.ThreadRoot != nil {
+		thread := []map[string]interface{}{
+			{"term": map[string]interface{}{"reply_root_aturi": map[string]interface{}{
+				"value":            p.ThreadRoot.String(),
+				"case_insensitive": true,
+			}}},
+		}
+		// the root post itself can only be matched if the URI has a DID (not handle) authority
+		if did, err := p.ThreadRoot.Authority().AsDID(); err == nil {
+			thread = append(thread, map[string]interface{}{
+				"bool": map[string]interface{}{
+					"filter": []map[string]interface{}{
+						{"term": map[string]interface{}{"did": map[string]interface{}{"value": did.String(), "case_insensitive": true}}},
+						{"term": map[string]interface{}{"record_rkey": p.ThreadRoot.RecordKey().String()}},
+					},
+				},
+			})
+		}
+		filters = append(filters, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should":               thread,
+				"minimum_should_match": 1,
+			},
+		})
+	}
+
+	if p.RawFilter != nil {
+		filters = append(filters, p.RawFilter)
+	}
 
 	return filters
 }
@@ -204,39 +384,308 @@ func (p *ActorSearchParams) Filters() []map[string]interface{} {
 		})
 	}
 
+	if p.MinFollowers != nil {
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{
+				"followers_count": map[string]interface{}{
+					"gte": *p.MinFollowers,
+				},
+			},
+		})
+	}
+
+	// each required label must be present (not just any one of them)
+	for _, label := range p.RequireLabels {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"labels": label},
+		})
+	}
+
+	if len(p.ExcludeLabels) > 0 {
+		filters = append(filters, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": map[string]interface{}{
+					"terms": map[string]interface{}{"labels": p.ExcludeLabels},
+				},
+			},
+		})
+	}
+
 	return filters
 }
 
-func checkParams(offset, size int) error {
-	if offset+size > 10000 || size > 250 || offset > 10000 || offset < 0 || size < 0 {
+// SortClause returns the ES "sort" clause for the requested ordering, or nil for the default relevance (score) ordering. Profiles which haven't had counts indexed sort last.
+func (p *ActorSearchParams) SortClause() []map[string]interface{} {
+	var field string
+	switch p.Sort {
+	case "followers":
+		field = "followers_count"
+	case "posts":
+		field = "posts_count"
+	default:
+		return nil
+	}
+	return []map[string]interface{}{
+		{field: map[string]interface{}{"order": "desc", "missing": "_last"}},
+		{"_score": map[string]interface{}{"order": "desc"}},
+	}
+}
+
+// postTextLangFields maps ISO 639-1 language codes to post text fields analyzed for that language (see post_schema.json)
+var postTextLangFields = map[string]string{
+	"en": "text.en",
+	"es": "text.es",
+	"pt": "text.pt",
+	"de": "text.de",
+	"fr": "text.fr",
+	"ko": "text.cjk",
+	"zh": "text.cjk",
+	"ja": "everything_ja",
+}
+
+// postTextLangField returns the language-specific post text field for a language, or empty string if there isn't one
+func postTextLangField(lang syntax.Language) string {
+	prefix := strings.ToLower(strings.SplitN(lang.String(), "-", 2)[0])
+	return postTextLangFields[prefix]
+}
+
+// PostFacetFields maps the facet names which can be requested for post search to the indexed field they aggregate over
+var PostFacetFields = map[string]string{
+	"langs": "lang_code_iso2",
+	"tags":  "tag",
+	// author DIDs, eg to find which accounts are producing the most matches for a query
+	"authors": "did",
+}
+
+// Maximum number of buckets returned for any one facet
+const maxFacetBuckets = 50
+
+// Maximum number of actors which can be excluded from a post search
+const maxExcludeActors = 1000
+
+// Maximum number of excluded actors which can be given as handles (instead of DIDs), since each one is resolved during the request
+const maxExcludeActorHandles = 25
+
+// Default decay scale for "recency_boost", if not specified
+const defaultRecencyBoostScale = "7d"
+
+var recencyBoostScaleRegex = regexp.MustCompile(`^[1-9][0-9]{0,5}[smhd]$`)
+
+// parseRecencyBoost validates a "recency_boost" scale, which is a positive integer with a time unit suffix (s, m, h, or d). Boolean "true" values select the default scale.
+func parseRecencyBoost(raw string) (string, error) {
+	val := strings.TrimSpace(raw)
+	if val == "true" || val == "1" || val == "y" {
+		return defaultRecencyBoostScale, nil
+	}
+	if !recencyBoostScaleRegex.MatchString(val) {
+		return "", fmt.Errorf("expected a duration like '12h' or '7d': %s", raw)
+	}
+	return val, nil
+}
+
+// recencyBoostQuery wraps a query so that scores decay with post age. See PostSearchParams.RecencyBoost.
+func recencyBoostQuery(query map[string]interface{}, scale string) map[string]interface{} {
+	return map[string]interface{}{
+		"function_score": map[string]interface{}{
+			"query": query,
+			"functions": []map[string]interface{}{
+				{
+					"gauss": map[string]interface{}{
+						"created_at": map[string]interface{}{
+							"origin": "now",
+							"scale":  scale,
+							"decay":  0.5,
+						},
+					},
+				},
+			},
+			"boost_mode": "multiply",
+		},
+	}
+}
+
+// spamPenaltyQuery wraps a profile query so that scores are scaled down linearly with spamminess: a score of 1 keeps 10% of the relevance score. Profiles indexed before the field existed are not affected.
+func spamPenaltyQuery(query map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"function_score": map[string]interface{}{
+			"query": query,
+			"functions": []map[string]interface{}{
+				{
+					"linear": map[string]interface{}{
+						"spamminess": map[string]interface{}{
+							"origin": 0,
+							"scale":  1,
+							"decay":  0.1,
+						},
+					},
+				},
+			},
+			"boost_mode": "multiply",
+		},
+	}
+}
+
+// SortClause returns the elasticsearch/opensearch sort DSL for these params. Anything other than "top" falls back to reverse-chronological ordering.
+//
+// The account DID and record key (which together make up the document ID) are always included as final tiebreakers, so that sort values are unique and can be used with "search_after". These are keyword fields with doc_values; sorting on "_id" directly requires fielddata, which Elasticsearch disallows by default, and which is expensive on OpenSearch.
+func (p *PostSearchParams) SortClause() []map[string]interface{} {
+	if p.Sort == "top" {
+		return append([]map[string]interface{}{
+			{"_score": map[string]interface{}{"order": "desc"}},
+			{"created_at": map[string]interface{}{"order": "desc"}},
+		}, postTiebreakSort("desc")...)
+	}
+	return append([]map[string]interface{}{
+		{"created_at": map[string]interface{}{"order": "desc"}},
+	}, postTiebreakSort("desc")...)
+}
+
+// sort clauses which uniquely order post documents
+func postTiebreakSort(order string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{"did": map[string]interface{}{"order": order}},
+		{"record_rkey": map[string]interface{}{"order": order}},
+	}
+}
+
+// sort clauses which uniquely order profile documents
+func profileTiebreakSort(order string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{"did": map[string]interface{}{"order": order}},
+	}
+}
+
+// searchLimits are upper bounds on pagination parameters, checked before any query is sent to the search cluster
+type searchLimits struct {
+	maxOffset int
+	maxSize   int
+}
+
+// Bounds used by the exported DoSearch functions. The HTTP server checks its own configured bounds instead (see ServerConfig).
+var defaultSearchLimits = searchLimits{maxOffset: 10000, maxSize: 250}
+
+// checkParams is a sanity check on pagination parameters
+func checkParams(offset, size int, limits searchLimits) error {
+	if offset+size > limits.maxOffset || size > limits.maxSize || offset > limits.maxOffset || offset < 0 || size < 0 {
 		return fmt.Errorf("disallowed size/offset parameters")
 	}
 	return nil
 }
 
-func DoSearchPosts(ctx context.Context, dir identity.Directory, escli *es.Client, index string, params *PostSearchParams) (*EsSearchResponse, error) {
+func DoSearchPosts(ctx context.Context, dir identity.Directory, cli SearchClient, index string, params *PostSearchParams) (*EsSearchResponse, error) {
+	return doSearchPostsLimited(ctx, dir, cli, index, params, defaultSearchLimits)
+}
+
+func doSearchPostsLimited(ctx context.Context, dir identity.Directory, cli SearchClient, index string, params *PostSearchParams, limits searchLimits) (*EsSearchResponse, error) {
 	ctx, span := tracer.Start(ctx, "DoSearchPosts")
 	defer span.End()
 
-	if err := checkParams(params.Offset, params.Size); err != nil {
+	if err := checkParams(params.Offset, params.Size, limits); err != nil {
 		return nil, err
 	}
+	pq := postQuery(ctx, dir, params)
+	// only search the time-sharded indices which can contain posts in the (parsed) date range
+	index = resolvePostIndices(index, params.Since, params.Until, time.Now())
+	// scores don't affect ordering for "latest" sort, so skip the (relatively expensive) decay function
+	if params.RecencyBoost != "" && params.Sort == "top" {
+		pq = recencyBoostQuery(pq, params.RecencyBoost)
+	}
+	query := map[string]interface{}{
+		"query": pq,
+		"sort":  params.SortClause(),
+		"size":  params.Size,
+	}
+	if len(params.After) > 0 {
+		query["search_after"] = params.After
+	} else {
+		query["from"] = params.Offset
+	}
+	if params.MaxResults > 0 {
+		query["track_total_hits"] = params.MaxResults
+	} else if params.TrackTotalHits {
+		query["track_total_hits"] = true
+	}
+	if params.Explain {
+		// scores aren't computed by default when sorting by something other than score
+		query["explain"] = true
+		query["track_scores"] = true
+	}
+	if params.Collapse {
+		// the inner hits are only used to count the size of each group
+		query["collapse"] = map[string]interface{}{
+			"field": "text_hash",
+			"inner_hits": map[string]interface{}{
+				"name": "dupes",
+				"size": 0,
+			},
+		}
+	}
+	if len(params.Facets) > 0 {
+		aggs := map[string]interface{}{}
+		for _, name := range params.Facets {
+			field, ok := PostFacetFields[name]
+			if !ok {
+				return nil, fmt.Errorf("unsupported search facet: %s", name)
+			}
+			aggs[name] = map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": field,
+					"size":  maxFacetBuckets,
+				},
+			}
+		}
+		query["aggs"] = aggs
+	}
+	if params.Highlight {
+		// the query runs against the "everything" fields, so don't require the highlighted field to match
+		query["highlight"] = map[string]interface{}{
+			"require_field_match": false,
+			"number_of_fragments": maxSnippets,
+			"fragment_size":       150,
+			"fields": map[string]interface{}{
+				"text":    map[string]interface{}{},
+				"text_ja": map[string]interface{}{},
+			},
+		}
+	}
+
+	return doSearch(ctx, cli, index, query)
+}
+
+// DoCountPosts counts the number of posts matching a search, without fetching any hits. Pagination params are ignored.
+func DoCountPosts(ctx context.Context, dir identity.Directory, cli SearchClient, index string, params *PostSearchParams) (*EsCountResponse, error) {
+	ctx, span := tracer.Start(ctx, "DoCountPosts")
+	defer span.End()
+
+	query := map[string]interface{}{
+		"query": postQuery(ctx, dir, params),
+	}
+	index = resolvePostIndices(index, params.Since, params.Until, time.Now())
+
+	return doCount(ctx, cli, index, query)
+}
+
+// postQuery builds the query clause (without sorting or pagination) for a post search. Note that this merges any filters parsed from the query string in to params.
+func postQuery(ctx context.Context, dir identity.Directory, params *PostSearchParams) map[string]interface{} {
 	queryStringParams := ParsePostQuery(ctx, dir, params.Query, params.Viewer)
 	params.Update(&queryStringParams)
-	idx := "everything"
+	fields := []string{"everything"}
 	if containsJapanese(params.Query) {
-		idx = "everything_ja"
+		fields = []string{"everything_ja"}
 	}
-	basic := map[string]interface{}{
-		"simple_query_string": map[string]interface{}{
-			"query":            params.Query,
-			"fields":           []string{idx},
-			"flags":            "AND|NOT|OR|PHRASE|PRECEDENCE|WHITESPACE",
-			"default_operator": "and",
-			"lenient":          true,
-			"analyze_wildcard": false,
-		},
+	// if filtering by a single language, also match against the language-specific analysis of the post text
+	if params.Lang != nil && len(params.Langs) == 0 {
+		if f := postTextLangField(*params.Lang); f != "" && f != fields[0] {
+			fields = append([]string{f}, fields...)
+		}
 	}
+	// quoted text isn't copied to the "everything" fields, so it only matches when requested
+	if params.IncludeQuoted {
+		fields = append(fields, "quoted_text")
+	}
+	tq := parseTextQuery(params.Query)
+	tq.MinMatch = params.MinMatch
+	basic := tq.ESQuery(fields...)
 	filters := params.Filters()
 	// filter out future posts (TODO: temporary hack)
 	now := syntax.DatetimeNow()
@@ -247,39 +696,34 @@ func DoSearchPosts(ctx context.Context, dir identity.Directory, escli *es.Client
 			},
 		},
 	})
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must":   basic,
-				"filter": filters,
-			},
-		},
-		"sort": map[string]any{
-			"created_at": map[string]any{
-				"order": "desc",
-			},
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must":   basic,
+			"filter": filters,
 		},
-		"size": params.Size,
-		"from": params.Offset,
 	}
+}
 
-	return doSearch(ctx, escli, index, query)
+func DoSearchProfiles(ctx context.Context, dir identity.Directory, cli SearchClient, index string, params *ActorSearchParams) (*EsSearchResponse, error) {
+	return doSearchProfilesLimited(ctx, dir, cli, index, params, defaultSearchLimits)
 }
 
-func DoSearchProfiles(ctx context.Context, dir identity.Directory, escli *es.Client, index string, params *ActorSearchParams) (*EsSearchResponse, error) {
+func doSearchProfilesLimited(ctx context.Context, dir identity.Directory, cli SearchClient, index string, params *ActorSearchParams, limits searchLimits) (*EsSearchResponse, error) {
 	ctx, span := tracer.Start(ctx, "DoSearchProfiles")
 	defer span.End()
 
-	if err := checkParams(params.Offset, params.Size); err != nil {
+	if err := checkParams(params.Offset, params.Size, limits); err != nil {
 		return nil, err
 	}
 
 	filters := params.Filters()
+	// fold case and diacritics the same way as the handle and display name fields are analyzed, so "José" matches "jose" (and vice versa)
+	q := foldText(params.Query)
 
 	fulltext := map[string]interface{}{
 		"simple_query_string": map[string]interface{}{
-			"query":            params.Query,
-			"fields":           []string{"everything"},
+			"query":            q,
+			"fields":           []string{"everything", "display_name.folded"},
 			"flags":            "AND|NOT|OR|PHRASE|PRECEDENCE|WHITESPACE",
 			"default_operator": "and",
 			"lenient":          true,
@@ -291,10 +735,10 @@ func DoSearchProfiles(ctx context.Context, dir identity.Directory, escli *es.Cli
 	// if the query string is just a single token (after parsing out filter
 	// syntax), then have the primary query be an "OR" of the basic fulltext
 	// query and the typeahead query
-	if len(strings.Split(params.Query, " ")) == 1 {
+	if len(strings.Split(q, " ")) == 1 {
 		typeahead := map[string]interface{}{
 			"multi_match": map[string]interface{}{
-				"query":    params.Query,
+				"query":    q,
 				"type":     "bool_prefix",
 				"operator": "and",
 				"fields": []string{
@@ -314,6 +758,27 @@ func DoSearchProfiles(ctx context.Context, dir identity.Directory, escli *es.Cli
 		}
 	}
 
+	// for typo tolerance, also match fuzzily against handle and display name, scored below the exact and prefix matches
+	if params.Fuzzy {
+		primary = map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": []interface{}{
+					primary,
+					map[string]interface{}{
+						"multi_match": map[string]interface{}{
+							"query":         q,
+							"fields":        []string{"handle", "display_name.folded"},
+							"fuzziness":     "AUTO",
+							"prefix_length": 1,
+							"boost":         0.3,
+						},
+					},
+				},
+				"minimum_should_match": 1,
+			},
+		}
+	}
+
 	query := map[string]interface{}{
 		"query": map[string]interface{}{
 			"bool": map[string]interface{}{
@@ -329,54 +794,107 @@ func DoSearchProfiles(ctx context.Context, dir identity.Directory, escli *es.Cli
 		"size": params.Size,
 		"from": params.Offset,
 	}
+	if params.MaxResults > 0 {
+		query["track_total_hits"] = params.MaxResults
+	}
 
 	if len(filters) > 0 {
 		query["query"].(map[string]interface{})["bool"].(map[string]interface{})["filter"] = filters
 	}
+	if sort := params.SortClause(); sort != nil {
+		query["sort"] = sort
+	} else if params.SpamPenalty {
+		query["query"] = spamPenaltyQuery(query["query"].(map[string]interface{}))
+	}
 
-	return doSearch(ctx, escli, index, query)
+	return doSearch(ctx, cli, index, query)
 }
 
-func DoSearchProfilesTypeahead(ctx context.Context, escli *es.Client, index string, params *ActorSearchParams) (*EsSearchResponse, error) {
+func DoSearchProfilesTypeahead(ctx context.Context, cli SearchClient, index string, params *ActorSearchParams) (*EsSearchResponse, error) {
+	return doSearchProfilesTypeaheadLimited(ctx, cli, index, params, defaultSearchLimits)
+}
+
+func doSearchProfilesTypeaheadLimited(ctx context.Context, cli SearchClient, index string, params *ActorSearchParams, limits searchLimits) (*EsSearchResponse, error) {
 	ctx, span := tracer.Start(ctx, "DoSearchProfilesTypeahead")
 	defer span.End()
 
-	if err := checkParams(0, params.Size); err != nil {
+	if err := checkParams(0, params.Size, limits); err != nil {
 		return nil, err
 	}
 
 	filters := params.Filters()
+	// case and diacritic folding, as in DoSearchProfiles
+	q := foldText(params.Query)
+
+	var primary interface{} = map[string]interface{}{
+		"multi_match": map[string]interface{}{
+			"query":    q,
+			"type":     "bool_prefix",
+			"operator": "and",
+			"fields": []string{
+				"typeahead",
+				"typeahead._2gram",
+				"typeahead._3gram",
+			},
+		},
+	}
 
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
+	// lighter-weight typo tolerance than full search: only one edit allowed, and exact prefix matches are boosted
+	if params.Fuzzy {
+		primary = map[string]interface{}{
 			"bool": map[string]interface{}{
-				"must": map[string]interface{}{
-					"multi_match": map[string]interface{}{
-						"query":    params.Query,
-						"type":     "bool_prefix",
-						"operator": "and",
-						"fields": []string{
-							"typeahead",
-							"typeahead._2gram",
-							"typeahead._3gram",
+				"should": []interface{}{
+					map[string]interface{}{
+						"multi_match": map[string]interface{}{
+							"query":    q,
+							"type":     "bool_prefix",
+							"operator": "and",
+							"fields": []string{
+								"typeahead",
+								"typeahead._2gram",
+								"typeahead._3gram",
+							},
+							"boost": 2.0,
+						},
+					},
+					map[string]interface{}{
+						"multi_match": map[string]interface{}{
+							"query":         q,
+							"type":          "bool_prefix",
+							"operator":      "and",
+							"fields":        []string{"typeahead"},
+							"fuzziness":     1,
+							"prefix_length": 1,
 						},
 					},
 				},
+				"minimum_should_match": 1,
+			},
+		}
+	}
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": primary,
 			},
 		},
 		"size": params.Size,
 		"from": params.Offset,
 	}
+	if params.MaxResults > 0 {
+		query["track_total_hits"] = params.MaxResults
+	}
 
 	if len(filters) > 0 {
 		query["query"].(map[string]interface{})["bool"].(map[string]interface{})["filter"] = filters
 	}
 
-	return doSearch(ctx, escli, index, query)
+	return doSearch(ctx, cli, index, query)
 }
 
 // helper to do a full-featured Lucene query parser (query_string) search, with all possible facets. Not safe to expose publicly.
-func DoSearchGeneric(ctx context.Context, escli *es.Client, index, q string) (*EsSearchResponse, error) {
+func DoSearchGeneric(ctx context.Context, cli SearchClient, index, q string) (*EsSearchResponse, error) {
 	ctx, span := tracer.Start(ctx, "DoSearchGeneric")
 	defer span.End()
 
@@ -393,10 +911,37 @@ func DoSearchGeneric(ctx context.Context, escli *es.Client, index, q string) (*E
 		},
 	}
 
-	return doSearch(ctx, escli, index, query)
+	return doSearch(ctx, cli, index, query)
 }
 
-func doSearch(ctx context.Context, escli *es.Client, index string, query interface{}) (*EsSearchResponse, error) {
+// DoLookupPost fetches a single indexed post document by ID (see PostDoc.DocId). Returns nil (and no error) if the document is not in the index. With time-sharded post indices, all of them are searched.
+func DoLookupPost(ctx context.Context, cli SearchClient, index string, docID string) (*PostDoc, error) {
+	ctx, span := tracer.Start(ctx, "DoLookupPost")
+	defer span.End()
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{
+				"values": []string{docID},
+			},
+		},
+		"size": 1,
+	}
+	resp, err := doSearch(ctx, cli, allPostIndices(index), query)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Hits.Hits) == 0 {
+		return nil, nil
+	}
+	var doc PostDoc
+	if err := json.Unmarshal(resp.Hits.Hits[0].Source, &doc); err != nil {
+		return nil, fmt.Errorf("decoding post document: %w", err)
+	}
+	return &doc, nil
+}
+
+func doSearch(ctx context.Context, cli SearchClient, index string, query interface{}) (*EsSearchResponse, error) {
 	ctx, span := tracer.Start(ctx, "doSearch")
 	defer span.End()
 
@@ -408,28 +953,20 @@ func doSearch(ctx context.Context, escli *es.Client, index string, query interfa
 	}
 	slog.Info("sending query", "index", index, "query", string(b))
 
-	// Perform the search request.
-	res, err := escli.Search(
-		escli.Search.WithContext(ctx),
-		escli.Search.WithIndex(index),
-		escli.Search.WithBody(bytes.NewBuffer(b)),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("search query error: %w", err)
-	}
-	defer res.Body.Close()
-	if res.IsError() {
-		raw, err := ioutil.ReadAll(res.Body)
-		if nil == err {
-			slog.Warn("search query error", "resp", string(raw), "status_code", res.StatusCode)
-		}
-		return nil, fmt.Errorf("search query error, code=%d", res.StatusCode)
-	}
+	return cli.Search(ctx, index, b)
+}
 
-	var out EsSearchResponse
-	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
-		return nil, fmt.Errorf("decoding search response: %w", err)
+func doCount(ctx context.Context, cli SearchClient, index string, query interface{}) (*EsCountResponse, error) {
+	ctx, span := tracer.Start(ctx, "doCount")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("index", index), attribute.String("query", fmt.Sprintf("%+v", query)))
+
+	b, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize query: %w", err)
 	}
+	slog.Info("sending count query", "index", index, "query", string(b))
 
-	return &out, nil
+	return cli.Count(ctx, index, b)
 }
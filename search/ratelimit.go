@@ -0,0 +1,89 @@
+package search
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+)
+
+// HTTP request header which exempts a request from rate limits, if it matches the configured bypass secret. This is the same header hepa (and other services) send to bypass rate limits.
+const RatelimitBypassHeader = "x-ratelimit-bypass"
+
+// how long idle per-client rate limit state is kept
+const rateLimitExpiry = 5 * time.Minute
+
+// clientIPExtractor returns how the client IP is determined, for rate limiting and logging. "X-Forwarded-For" is only used if the request came from one of the trusted proxy ranges (CIDRs), and only addresses added by trusted proxies are used; otherwise any client could pick its own IP (and rate limit bucket). With no trusted ranges, the address of the direct connection is used.
+func clientIPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	// only the configured ranges are trusted, not the echo defaults (loopback and private networks)
+	opts := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range trustedProxies {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy range: %w", err)
+		}
+		opts = append(opts, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(opts...), nil
+}
+
+// rateLimitMiddleware returns a token-bucket rate limiter middleware for the search endpoints, or nil if rate limiting is disabled.
+//
+// Clients are identified by the value of keyHeader (eg, an API key set by a gateway), if configured and the value is one of the given keys, and otherwise by client IP (see clientIPExtractor). Unknown keys are ignored, so that clients can't get a fresh limit by sending a new random key with each request. Requests which include the bypass secret are not limited, and don't count against any limit.
+func rateLimitMiddleware(perSecond float64, burst int, keyHeader string, keys []string, bypass string) echo.MiddlewareFunc {
+	if perSecond <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(perSecond))
+	}
+	// time for a single token to refill, rounded up to whole seconds
+	retryAfter := strconv.Itoa(int(math.Ceil(1 / perSecond)))
+
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Skipper: func(c echo.Context) bool {
+			val := c.Request().Header.Get(RatelimitBypassHeader)
+			return bypass != "" && subtle.ConstantTimeCompare([]byte(val), []byte(bypass)) == 1
+		},
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:      rate.Limit(perSecond),
+			Burst:     burst,
+			ExpiresIn: rateLimitExpiry,
+		}),
+		IdentifierExtractor: func(c echo.Context) (string, error) {
+			if keyHeader != "" {
+				if key := c.Request().Header.Get(keyHeader); key != "" && knownRateLimitKey(keys, key) {
+					return "key:" + key, nil
+				}
+			}
+			return "ip:" + c.RealIP(), nil
+		},
+		DenyHandler: func(c echo.Context, identifier string, err error) error {
+			requestsRateLimited.Inc()
+			c.Response().Header().Set("Retry-After", retryAfter)
+			return apiError(http.StatusTooManyRequests, ErrorRateLimitExceeded, "rate limit exceeded")
+		},
+	})
+}
+
+func knownRateLimitKey(keys []string, key string) bool {
+	known := false
+	for _, k := range keys {
+		// every key is compared, so that timing doesn't reveal which keys exist
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			known = true
+		}
+	}
+	return known
+}
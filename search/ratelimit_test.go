@@ -0,0 +1,95 @@
+package search
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(rateLimitMiddleware(0, 10, "", nil, ""))
+
+	e := echo.New()
+	e.HTTPErrorHandler = (&Server{logger: slog.Default()}).errorHandler
+	e.GET("/search", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, rateLimitMiddleware(0.5, 2, "x-api-key", []string{"abc", "def"}, "secret"))
+
+	request := func(ip string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/search", nil)
+		req.RemoteAddr = ip + ":1234"
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// burst, then limited
+	assert.Equal(200, request("10.0.0.1", nil).Code)
+	assert.Equal(200, request("10.0.0.1", nil).Code)
+	rec := request("10.0.0.1", nil)
+	assert.Equal(429, rec.Code)
+	assert.Equal("2", rec.Header().Get("Retry-After"))
+	assert.Contains(rec.Body.String(), ErrorRateLimitExceeded)
+
+	// other clients have their own limits
+	assert.Equal(200, request("10.0.0.2", nil).Code)
+	assert.Equal(200, request("10.0.0.1", map[string]string{"x-api-key": "abc"}).Code)
+
+	// unknown keys are ignored, and the client is identified by IP
+	assert.Equal(429, request("10.0.0.1", map[string]string{"x-api-key": "made-up"}).Code)
+
+	// bypass header, only with the right secret
+	assert.Equal(200, request("10.0.0.1", map[string]string{RatelimitBypassHeader: "secret"}).Code)
+	assert.Equal(429, request("10.0.0.1", map[string]string{RatelimitBypassHeader: "wrong"}).Code)
+}
+
+func TestClientIPExtractor(t *testing.T) {
+	assert := assert.New(t)
+
+	realIP := func(extractor echo.IPExtractor, remoteIP, xff string) string {
+		req := httptest.NewRequest(http.MethodGet, "/search", nil)
+		req.RemoteAddr = remoteIP + ":1234"
+		if xff != "" {
+			req.Header.Set(echo.HeaderXForwardedFor, xff)
+		}
+		return extractor(req)
+	}
+
+	// without trusted proxies, forwarded addresses are never used
+	direct, err := clientIPExtractor(nil)
+	assert.NoError(err)
+	assert.Equal("10.0.0.5", realIP(direct, "10.0.0.5", "203.0.113.7"))
+	assert.Equal("127.0.0.1", realIP(direct, "127.0.0.1", "203.0.113.7"))
+
+	proxied, err := clientIPExtractor([]string{"10.0.0.0/8", " 192.168.1.0/24"})
+	assert.NoError(err)
+	assert.Equal("203.0.113.7", realIP(proxied, "10.0.0.5", "203.0.113.7"))
+	// addresses prepended by the client itself are ignored
+	assert.Equal("203.0.113.7", realIP(proxied, "10.0.0.5", "198.51.100.1, 203.0.113.7"))
+	assert.Equal("203.0.113.7", realIP(proxied, "192.168.1.2", "203.0.113.7"))
+	// requests from outside the trusted ranges (including other private ranges) can't set their IP
+	assert.Equal("198.51.100.1", realIP(proxied, "198.51.100.1", "203.0.113.7"))
+	assert.Equal("172.16.0.1", realIP(proxied, "172.16.0.1", "203.0.113.7"))
+
+	_, err = clientIPExtractor([]string{"10.0.0.0"})
+	assert.Error(err)
+
+	// invalid rate limit configs are rejected at startup
+	dir := identity.NewMockDirectory()
+	escli := testFakeClusterClient(t, "1", new(map[string]string))
+	_, err = NewServer(escli, &dir, ServerConfig{TrustedProxies: []string{"not-a-range"}})
+	assert.Error(err)
+	_, err = NewServer(escli, &dir, ServerConfig{RateLimit: 1, RateLimitKeyHeader: "x-api-key"})
+	assert.Error(err)
+}
@@ -0,0 +1,182 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Leaf query clauses which may be used in a raw query filter. Anything which runs scripts (script, script_score, function_score), reads from other indices (terms lookup, percolate, indexed shapes), or is expensive to evaluate on arbitrary input (wildcard, regexp, query_string) is not allowed.
+var rawQueryLeafClauses = map[string]bool{
+	"term":             true,
+	"terms":            true,
+	"range":            true,
+	"exists":           true,
+	"prefix":           true,
+	"match":            true,
+	"match_phrase":     true,
+	"ids":              true,
+	"geo_distance":     true,
+	"geo_bounding_box": true,
+}
+
+// Keys which are rejected anywhere inside a leaf clause. "index" and "indexed_shape" would reference documents in other indices.
+var rawQueryForbiddenKeys = map[string]bool{
+	"script":        true,
+	"index":         true,
+	"indexed_shape": true,
+}
+
+const (
+	maxRawQueryDepth   = 8
+	maxRawQueryClauses = 64
+)
+
+// Request body for the raw post search endpoint. Other search params (q, sort, limit, cursor, etc) are passed as HTTP query params, the same as for other post search endpoints.
+type RawPostSearchRequest struct {
+	// Query clause in elasticsearch/opensearch DSL, added as an additional filter to the standard post query. See ValidateRawQuery for what is allowed.
+	Filter map[string]any `json:"filter"`
+}
+
+// ValidateRawQuery checks that a raw query clause only uses allowlisted clause types ("bool", plus simple leaf clauses like "term", "range", and "geo_distance"), and is not too deeply nested or large.
+func ValidateRawQuery(clause map[string]any) error {
+	count := 0
+	return validateRawClause(clause, 0, &count)
+}
+
+func validateRawClause(val any, depth int, count *int) error {
+	obj, ok := val.(map[string]any)
+	if !ok || len(obj) != 1 {
+		return fmt.Errorf("query clause must be an object with exactly one key")
+	}
+	if depth >= maxRawQueryDepth {
+		return fmt.Errorf("query nested too deeply (max %d)", maxRawQueryDepth)
+	}
+	*count++
+	if *count > maxRawQueryClauses {
+		return fmt.Errorf("too many query clauses (max %d)", maxRawQueryClauses)
+	}
+	for name, body := range obj {
+		if name == "bool" {
+			return validateRawBool(body, depth, count)
+		}
+		if !rawQueryLeafClauses[name] {
+			return fmt.Errorf("query clause not allowed: %q", name)
+		}
+		if err := checkRawLeafBody(body); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validateRawBool(val any, depth int, count *int) error {
+	obj, ok := val.(map[string]any)
+	if !ok {
+		return fmt.Errorf("bool: expected an object")
+	}
+	for k, v := range obj {
+		switch k {
+		case "must", "filter", "should", "must_not":
+			// either a single clause or an array of clauses
+			clauses, ok := v.([]any)
+			if !ok {
+				clauses = []any{v}
+			}
+			for _, c := range clauses {
+				if err := validateRawClause(c, depth+1, count); err != nil {
+					return err
+				}
+			}
+		case "minimum_should_match", "boost":
+			switch v.(type) {
+			case json.Number, string:
+			default:
+				return fmt.Errorf("bool.%s: expected a number or string", k)
+			}
+		default:
+			return fmt.Errorf("bool: unsupported key %q", k)
+		}
+	}
+	return nil
+}
+
+func checkRawLeafBody(val any) error {
+	switch v := val.(type) {
+	case map[string]any:
+		for k, inner := range v {
+			if rawQueryForbiddenKeys[k] {
+				return fmt.Errorf("key not allowed: %q", k)
+			}
+			if err := checkRawLeafBody(inner); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, inner := range v {
+			if err := checkRawLeafBody(inner); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parses a raw post search request body, preserving numbers exactly
+func parseRawPostSearchRequest(body io.Reader) (*RawPostSearchRequest, error) {
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+	var req RawPostSearchRequest
+	if err := dec.Decode(&req); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+	if req.Filter == nil {
+		return nil, fmt.Errorf("'filter' is required")
+	}
+	if err := ValidateRawQuery(req.Filter); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	return &req, nil
+}
+
+// Post search with an additional raw query DSL filter (see RawPostSearchRequest). This is for internal tooling, and is only enabled (and requires auth) if an admin token is configured.
+func (s *Server) handleSearchPostsRaw(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleSearchPostsRaw")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("query", e.QueryParam("q")))
+
+	req, err := parseRawPostSearchRequest(e.Request().Body)
+	if err != nil {
+		return apiError(400, ErrorInvalidRequest, err.Error())
+	}
+
+	params, err := s.parsePostSearchParams(e)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("invalid params: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	params.RawFilter = req.Filter
+
+	out, err := s.SearchPostsDetailed(ctx, params)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("failed to SearchPostsDetailed: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return searchError(err)
+	}
+
+	span.SetAttributes(attribute.Int("posts.length", len(out.Posts)))
+
+	return e.JSON(200, out)
+}
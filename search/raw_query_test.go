@@ -0,0 +1,76 @@
+package search
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRawQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	valid := []string{
+		`{"filter": {"term": {"lang_code_iso2": "en"}}}`,
+		`{"filter": {"geo_distance": {"distance": "10km", "location": {"lat": 40.7, "lon": -74.0}}}}`,
+		`{"filter": {"bool": {"should": [{"term": {"tag": "a"}}, {"term": {"tag": "b"}}], "minimum_should_match": 1}}}`,
+		`{"filter": {"bool": {"must_not": {"exists": {"field": "embed_aturi"}}}}}`,
+		`{"filter": {"range": {"created_at": {"gte": "2024-01-01T00:00:00Z", "lt": 1704067200000}}}}`,
+	}
+	for _, raw := range valid {
+		_, err := parseRawPostSearchRequest(strings.NewReader(raw))
+		assert.NoError(err, raw)
+	}
+
+	invalid := []string{
+		`{}`,
+		`{"filter": {"script": {"script": "doc['x'].value > 1"}}}`,
+		`{"filter": {"function_score": {"query": {"match_all": {}}}}}`,
+		`{"filter": {"query_string": {"query": "*"}}}`,
+		`{"filter": {"bool": {"filter": [{"wildcard": {"text": "a*"}}]}}}`,
+		`{"filter": {"terms": {"did": {"index": "other", "id": "1", "path": "dids"}}}}`,
+		`{"filter": {"range": {"created_at": {"gte": "now", "script": "1"}}}}`,
+		`{"filter": {"bool": {"must": [], "script": {}}}}`,
+		`{"filter": {"term": {"a": "b"}, "range": {"c": {"gte": 1}}}}`,
+		`{"filter": {"term": {"a": "b"}}, "extra": true}`,
+		`{"filter": ` + strings.Repeat(`{"bool": {"filter": `, 10) + `{"term": {"a": "b"}}` + strings.Repeat(`}}`, 10) + `}`,
+	}
+	for _, raw := range invalid {
+		_, err := parseRawPostSearchRequest(strings.NewReader(raw))
+		assert.Error(err, raw)
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	assert := assert.New(t)
+	s := &Server{adminToken: "secret"}
+	handler := s.adminAuth(func(c echo.Context) error {
+		return c.NoContent(200)
+	})
+
+	e := echo.New()
+	for hdr, ok := range map[string]bool{
+		"":              false,
+		"Bearer wrong":  false,
+		"Basic secret":  false,
+		"Bearer secret": true,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/search/posts/raw?q=hello", nil)
+		if hdr != "" {
+			req.Header.Set("Authorization", hdr)
+		}
+		rec := httptest.NewRecorder()
+		err := handler(e.NewContext(req, rec))
+		if ok {
+			assert.NoError(err, hdr)
+		} else {
+			var he *echo.HTTPError
+			if assert.ErrorAs(err, &he, hdr) {
+				assert.Equal(401, he.Code)
+			}
+		}
+	}
+}
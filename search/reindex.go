@@ -0,0 +1,323 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+)
+
+type ReindexConfig struct {
+	// Index to read documents from
+	SourceIndex string
+	// Index to write documents to. Created with the mapping for DocType if it doesn't already exist.
+	TargetIndex string
+	// Either "post" or "profile"; selects the mapping used when creating the target index
+	DocType string
+	// If set, this alias is atomically moved to point at the target index once the copy is complete. Must not be the name of an existing (concrete) index.
+	Alias string
+	// Number of documents per search page and bulk request. Defaults to 1000.
+	BatchSize int
+	// If set, progress is persisted to this file after every batch, and a re-run with the same file resumes from where it left off
+	CursorFile string
+	// Search cluster software: "opensearch" (default) or "elasticsearch"
+	SearchBackend string
+	Logger        *slog.Logger
+}
+
+// reindexCursor is the progress state persisted between batches
+type reindexCursor struct {
+	SourceIndex string            `json:"sourceIndex"`
+	TargetIndex string            `json:"targetIndex"`
+	After       []json.RawMessage `json:"after,omitempty"`
+	Copied      int64             `json:"copied"`
+}
+
+// Reindex copies every document from one index to another (for example, after a mapping change), then optionally swaps an alias over to the new index.
+//
+// Fields derived at index time which can be recomputed from the stored document (currently the post text_hash) are recomputed during the copy, so documents indexed before the field existed get it filled in.
+//
+// Documents are read in document ID order (by the fields which make up the ID; see postTiebreakSort and profileTiebreakSort) using "search_after", so a reindex can be resumed from the last completed batch. The source index must have doc_values on those fields, as with the current schemas; older indices can be copied with the cluster's own _reindex API instead.
+//
+// Pages are read from a point-in-time snapshot of the source index (see PointInTimeClient), so documents written to the source index during the copy don't shift the "search_after" pages. Documents written after the snapshot was opened are not copied; a resumed reindex opens a new snapshot.
+func Reindex(ctx context.Context, escli *es.Client, config ReindexConfig) error {
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = logger.With("source", config.SourceIndex, "target", config.TargetIndex)
+
+	if config.SourceIndex == "" || config.TargetIndex == "" {
+		return fmt.Errorf("source and target index are required")
+	}
+	if config.SourceIndex == config.TargetIndex {
+		return fmt.Errorf("source and target index must be different")
+	}
+	searchcli, err := NewSearchClient(escli, config.SearchBackend)
+	if err != nil {
+		return err
+	}
+	batchSize := config.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	var schemaJSON string
+	var sort []map[string]interface{}
+	switch config.DocType {
+	case "post":
+		schemaJSON = palomarPostSchemaJSON
+		sort = postTiebreakSort("asc")
+	case "profile":
+		schemaJSON = palomarProfileSchemaJSON
+		sort = profileTiebreakSort("asc")
+	default:
+		return fmt.Errorf("unknown document type: %s", config.DocType)
+	}
+
+	cursor := reindexCursor{
+		SourceIndex: config.SourceIndex,
+		TargetIndex: config.TargetIndex,
+	}
+	if config.CursorFile != "" {
+		b, err := os.ReadFile(config.CursorFile)
+		if err == nil {
+			if err := json.Unmarshal(b, &cursor); err != nil {
+				return fmt.Errorf("invalid reindex cursor file: %w", err)
+			}
+			if cursor.SourceIndex != config.SourceIndex || cursor.TargetIndex != config.TargetIndex {
+				return fmt.Errorf("reindex cursor file is for a different source/target (%s -> %s)", cursor.SourceIndex, cursor.TargetIndex)
+			}
+			logger.Info("resuming reindex", "copied", cursor.Copied)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("reading reindex cursor file: %w", err)
+		}
+	}
+
+	if err := ensureIndex(ctx, escli, config.TargetIndex, schemaJSON); err != nil {
+		return err
+	}
+
+	// the snapshot only needs to outlive a single batch (including bulk indexing retries); each search extends it
+	pitKeepAlive := 5 * time.Minute
+	var pitID string
+	pitcli, ok := searchcli.(PointInTimeClient)
+	if ok {
+		pitID, err = pitcli.OpenPointInTime(ctx, config.SourceIndex, pitKeepAlive)
+		if err != nil {
+			return fmt.Errorf("opening point-in-time on source index: %w", err)
+		}
+		defer func() {
+			// closed even if the reindex context was cancelled
+			if err := pitcli.ClosePointInTime(context.Background(), pitID); err != nil {
+				logger.Warn("failed to close point-in-time", "err", err)
+			}
+		}()
+	}
+
+	start := time.Now()
+	startCopied := cursor.Copied
+	lastReport := time.Now()
+	for {
+		query := map[string]interface{}{
+			"query": map[string]interface{}{"match_all": map[string]interface{}{}},
+			"sort":  sort,
+			"size":  batchSize,
+		}
+		if len(cursor.After) > 0 {
+			query["search_after"] = cursor.After
+		}
+		index := config.SourceIndex
+		if pitID != "" {
+			query["pit"] = pointInTimeClause(pitID, pitKeepAlive)
+			index = ""
+		}
+
+		resp, err := doSearch(ctx, searchcli, index, query)
+		if err != nil {
+			return fmt.Errorf("reading from source index: %w", err)
+		}
+		if resp.PitID != "" {
+			pitID = resp.PitID
+		}
+		hits := resp.Hits.Hits
+		if len(hits) == 0 {
+			break
+		}
+
+		if config.DocType == "post" {
+			for i := range hits {
+				src, err := reindexPostSource(hits[i].Source)
+				if err != nil {
+					return fmt.Errorf("updating post document %s: %w", hits[i].ID, err)
+				}
+				hits[i].Source = src
+			}
+		}
+
+		if err := bulkIndexWithRetry(ctx, escli, config.TargetIndex, hits, logger); err != nil {
+			return err
+		}
+
+		cursor.After = hits[len(hits)-1].Sort
+		cursor.Copied += int64(len(hits))
+		if config.CursorFile != "" {
+			b, err := json.Marshal(cursor)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(config.CursorFile, b, 0644); err != nil {
+				return fmt.Errorf("writing reindex cursor file: %w", err)
+			}
+		}
+
+		if time.Since(lastReport) > 30*time.Second {
+			elapsed := time.Since(start)
+			rate := float64(cursor.Copied-startCopied) / elapsed.Seconds()
+			logger.Info("reindex progress", "copied", cursor.Copied, "docs_per_sec", rate)
+			lastReport = time.Now()
+		}
+
+		if len(hits) < batchSize {
+			break
+		}
+	}
+
+	logger.Info("reindex copy complete", "copied", cursor.Copied, "duration", time.Since(start))
+
+	if config.Alias != "" {
+		if err := swapAlias(ctx, escli, config.Alias, config.TargetIndex); err != nil {
+			return err
+		}
+		logger.Info("alias updated", "alias", config.Alias)
+	}
+	return nil
+}
+
+// reindexPostSource recomputes the text_hash of a post document, the same way as TransformPost. Other fields are passed through unchanged.
+func reindexPostSource(src json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(src, &fields); err != nil {
+		return nil, err
+	}
+	var doc PostDoc
+	if err := json.Unmarshal(src, &doc); err != nil {
+		return nil, err
+	}
+	hash := normalizedTextHash(doc.Text)
+	if hash == "" {
+		hash = doc.DocId()
+	}
+	b, err := json.Marshal(hash)
+	if err != nil {
+		return nil, err
+	}
+	fields["text_hash"] = b
+	return json.Marshal(fields)
+}
+
+// bulkIndexWithRetry writes a batch of hits (with their original IDs) to an index. Because documents are written with explicit IDs, a failed batch can safely be retried in full.
+func bulkIndexWithRetry(ctx context.Context, escli *es.Client, index string, hits []EsSearchHit, logger *slog.Logger) error {
+	var buf bytes.Buffer
+	for _, hit := range hits {
+		idJSON, err := json.Marshal(hit.ID)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(fmt.Sprintf(`{"index":{"_id":%s}}%s`, idJSON, "\n"))
+		buf.Write(hit.Source)
+		buf.WriteString("\n")
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < 5; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<attempt) * time.Second
+			logger.Warn("retrying bulk index request", "attempt", attempt, "backoff", backoff, "err", lastErr)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+		lastErr = bulkIndex(ctx, escli, index, buf.Bytes())
+		if lastErr == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("bulk indexing failed after retries: %w", lastErr)
+}
+
+func bulkIndex(ctx context.Context, escli *es.Client, index string, body []byte) error {
+	res, err := escli.Bulk(bytes.NewReader(body), escli.Bulk.WithContext(ctx), escli.Bulk.WithIndex(index))
+	if err != nil {
+		return fmt.Errorf("failed to send bulk indexing request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("bulk indexing error, code=%d", res.StatusCode)
+	}
+	var out struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return fmt.Errorf("decoding bulk indexing response: %w", err)
+	}
+	if out.Errors {
+		return fmt.Errorf("bulk indexing response included item errors")
+	}
+	return nil
+}
+
+// swapAlias atomically points an alias at the given index, removing it from any other indices
+func swapAlias(ctx context.Context, escli *es.Client, alias, index string) error {
+	actions := []map[string]interface{}{}
+
+	res, err := escli.Indices.GetAlias(escli.Indices.GetAlias.WithContext(ctx), escli.Indices.GetAlias.WithName(alias))
+	if err != nil {
+		return fmt.Errorf("fetching current alias: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 200 {
+		var current map[string]json.RawMessage
+		if err := json.NewDecoder(res.Body).Decode(&current); err != nil {
+			return fmt.Errorf("decoding current alias: %w", err)
+		}
+		for idx := range current {
+			if idx == index {
+				continue
+			}
+			actions = append(actions, map[string]interface{}{
+				"remove": map[string]interface{}{"index": idx, "alias": alias},
+			})
+		}
+	} else if res.StatusCode != 404 {
+		return fmt.Errorf("fetching current alias, code=%d", res.StatusCode)
+	}
+	actions = append(actions, map[string]interface{}{
+		"add": map[string]interface{}{"index": index, "alias": alias},
+	})
+
+	b, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return err
+	}
+	upd, err := escli.Indices.UpdateAliases(bytes.NewReader(b), escli.Indices.UpdateAliases.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("updating alias: %w", err)
+	}
+	defer upd.Body.Close()
+	if upd.IsError() {
+		body, _ := io.ReadAll(upd.Body)
+		return fmt.Errorf("updating alias, code=%d: %s", upd.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReindexPostSource(t *testing.T) {
+	assert := assert.New(t)
+
+	// a document indexed before text_hash existed gets one, and other fields are kept as-is
+	src, err := reindexPostSource(json.RawMessage(`{"did": "did:plc:abc111", "record_rkey": "3kabc", "text": "Hello  World", "some_future_field": [1, 2]}`))
+	assert.NoError(err)
+	var fields map[string]json.RawMessage
+	assert.NoError(json.Unmarshal(src, &fields))
+	assert.JSONEq(`"`+normalizedTextHash("hello world")+`"`, string(fields["text_hash"]))
+	assert.JSONEq(`[1, 2]`, string(fields["some_future_field"]))
+	assert.JSONEq(`"Hello  World"`, string(fields["text"]))
+
+	// a stale hash is replaced
+	src, err = reindexPostSource(json.RawMessage(`{"did": "did:plc:abc111", "record_rkey": "3kabc", "text": "hello world", "text_hash": "stale"}`))
+	assert.NoError(err)
+	var doc PostDoc
+	assert.NoError(json.Unmarshal(src, &doc))
+	assert.Equal(normalizedTextHash("hello world"), doc.TextHash)
+
+	// posts with no text are not grouped together
+	src, err = reindexPostSource(json.RawMessage(`{"did": "did:plc:abc111", "record_rkey": "3kabc"}`))
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(src, &doc))
+	assert.Equal("did:plc:abc111_3kabc", doc.TextHash)
+
+	_, err = reindexPostSource(json.RawMessage(`not json`))
+	assert.Error(err)
+}
+
+func TestReindexPointInTime(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	for _, backend := range []string{SearchBackendOpenSearch, SearchBackendElasticsearch} {
+		// fake cluster with an existing target index, and a single document in the source index. Each request is recorded as "METHOD path", and search request bodies are kept.
+		var mu sync.Mutex
+		var requests []string
+		var searchBody, closeBody map[string]any
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			switch {
+			case r.Method == http.MethodHead:
+			case strings.HasSuffix(r.URL.Path, "/_search/point_in_time") || strings.HasSuffix(r.URL.Path, "/_pit"):
+				if r.Method != http.MethodPost {
+					json.Unmarshal(body, &closeBody)
+					w.Write([]byte(`{}`))
+				} else if r.URL.Query().Get("keep_alive") == "" {
+					w.WriteHeader(http.StatusBadRequest)
+				} else {
+					w.Write([]byte(`{"pit_id": "pit-1", "id": "pit-1"}`))
+				}
+			case r.URL.Path == "/_search":
+				json.Unmarshal(body, &searchBody)
+				w.Write([]byte(`{"took": 1, "timed_out": false, "pit_id": "pit-2", "hits": {"total": {"value": 1, "relation": "eq"}, "hits": [
+					{"_index": "src", "_id": "did:plc:abc111_3kabc", "_source": {"did": "did:plc:abc111", "record_rkey": "3kabc", "text": "hello"}, "sort": ["did:plc:abc111", "3kabc"]}
+				]}}`))
+			case r.URL.Path == "/dst/_bulk":
+				w.Write([]byte(`{"errors": false}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer srv.Close()
+
+		escli, err := es.NewClient(es.Config{Addresses: []string{srv.URL}, DisableRetry: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = Reindex(ctx, escli, ReindexConfig{
+			SourceIndex:   "src",
+			TargetIndex:   "dst",
+			DocType:       "post",
+			BatchSize:     10,
+			SearchBackend: backend,
+		})
+		if !assert.NoError(err, backend) {
+			continue
+		}
+
+		// the source index is only named when opening the point-in-time, and the latest point-in-time ID is the one closed
+		if backend == SearchBackendElasticsearch {
+			assert.Equal([]string{"HEAD /dst", "POST /src/_pit", "POST /_search", "POST /dst/_bulk", "DELETE /_pit"}, requests, backend)
+			assert.Equal(map[string]any{"id": "pit-2"}, closeBody)
+		} else {
+			assert.Equal([]string{"HEAD /dst", "POST /src/_search/point_in_time", "POST /_search", "POST /dst/_bulk", "DELETE /_search/point_in_time"}, requests, backend)
+			assert.Equal(map[string]any{"pit_id": []any{"pit-2"}}, closeBody)
+		}
+		assert.Equal(map[string]any{"id": "pit-1", "keep_alive": "300s"}, searchBody["pit"], backend)
+		assert.Equal([]any{map[string]any{"did": map[string]any{"order": "asc"}}, map[string]any{"record_rkey": map[string]any{"order": "asc"}}}, searchBody["sort"], backend)
+	}
+}
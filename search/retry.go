@@ -0,0 +1,111 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Configuration for retrying transient search cluster errors. See WithRetry.
+type RetryConfig struct {
+	// Maximum number of attempts for each request, including the first. Values less than 2 disable retries.
+	Attempts int
+	// Delay before the first retry; doubles for each subsequent retry. Defaults to 50ms.
+	InitialBackoff time.Duration
+	// Upper bound on the delay between retries. Defaults to 1s.
+	MaxBackoff time.Duration
+}
+
+// WithRetry wraps a SearchClient so that requests are retried, with exponential backoff, on transient errors: connection failures and timeouts, and 502/503/504 responses. Client errors (4xx) are never retried.
+//
+// Retries never extend past the request context's deadline: if the next backoff would end after the deadline, the last error is returned immediately.
+//
+// Note that the underlying HTTP transport also does a few immediate retries of its own, unless configured with DisableRetry.
+func WithRetry(cli SearchClient, config RetryConfig) SearchClient {
+	if config.Attempts < 2 {
+		return cli
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = 50 * time.Millisecond
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = time.Second
+	}
+	return &retryClient{inner: cli, config: config}
+}
+
+type retryClient struct {
+	inner  SearchClient
+	config RetryConfig
+}
+
+func (c *retryClient) Search(ctx context.Context, index string, body []byte) (*EsSearchResponse, error) {
+	var out *EsSearchResponse
+	err := c.retry(ctx, "search", func() error {
+		var err error
+		out, err = c.inner.Search(ctx, index, body)
+		return err
+	})
+	return out, err
+}
+
+func (c *retryClient) Count(ctx context.Context, index string, body []byte) (*EsCountResponse, error) {
+	var out *EsCountResponse
+	err := c.retry(ctx, "count", func() error {
+		var err error
+		out, err = c.inner.Count(ctx, index, body)
+		return err
+	})
+	return out, err
+}
+
+func (c *retryClient) retry(ctx context.Context, kind string, f func() error) error {
+	backoff := c.config.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil || attempt >= c.config.Attempts || ctx.Err() != nil || !isRetryableError(err) {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+		slog.Warn("retrying search cluster request", "kind", kind, "attempt", attempt, "backoff", backoff, "err", err)
+		searchBackendRetries.WithLabelValues(kind).Inc()
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, c.config.MaxBackoff)
+	}
+}
+
+// isRetryableError returns true for errors which are likely transient: gateway and unavailable responses, timeouts, and dropped connections
+func isRetryableError(err error) bool {
+	var be *BackendError
+	if errors.As(err, &be) {
+		switch be.StatusCode {
+		case 502, 503, 504:
+			return true
+		default:
+			return false
+		}
+	}
+	// the caller's own deadline or cancellation is not transient
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
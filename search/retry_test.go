@@ -0,0 +1,112 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// returns a client pointed at a fake cluster which fails the first 'failures' requests with the given status code, then succeeds. The number of requests received is counted in 'requests'.
+func testFlakyClient(t *testing.T, failures int64, status int, requests *int64) SearchClient {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(requests, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"took": 1, "hits": {"total": {"value": 0, "relation": "eq"}, "hits": []}, "count": 0}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	escli, err := es.NewClient(es.Config{
+		Addresses:    []string{srv.URL},
+		DisableRetry: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &OpenSearchClient{Client: escli}
+}
+
+func TestSearchRetry(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	config := RetryConfig{Attempts: 3, InitialBackoff: time.Millisecond}
+
+	// transient errors are retried
+	var requests int64
+	cli := WithRetry(testFlakyClient(t, 2, 503, &requests), config)
+	_, err := cli.Search(ctx, "palomar_post", []byte(`{}`))
+	assert.NoError(err)
+	assert.Equal(int64(3), requests)
+
+	requests = 0
+	cli = WithRetry(testFlakyClient(t, 1, 502, &requests), config)
+	_, err = cli.Count(ctx, "palomar_post", []byte(`{}`))
+	assert.NoError(err)
+	assert.Equal(int64(2), requests)
+
+	// ... up to the configured number of attempts
+	requests = 0
+	cli = WithRetry(testFlakyClient(t, 5, 503, &requests), config)
+	_, err = cli.Search(ctx, "palomar_post", []byte(`{}`))
+	var be *BackendError
+	if assert.True(errors.As(err, &be)) {
+		assert.Equal(503, be.StatusCode)
+	}
+	assert.Equal(int64(3), requests)
+
+	// client errors are never retried
+	for _, status := range []int{400, 404, 429} {
+		requests = 0
+		cli = WithRetry(testFlakyClient(t, 5, status, &requests), config)
+		_, err = cli.Search(ctx, "palomar_post", []byte(`{}`))
+		assert.Error(err)
+		assert.Equal(int64(1), requests, status)
+	}
+
+	// retries don't go past the context deadline
+	requests = 0
+	cli = WithRetry(testFlakyClient(t, 5, 503, &requests), RetryConfig{Attempts: 3, InitialBackoff: time.Second})
+	deadlineCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = cli.Search(deadlineCtx, "palomar_post", []byte(`{}`))
+	assert.Error(err)
+	assert.Equal(int64(1), requests)
+	assert.Less(time.Since(start), 200*time.Millisecond)
+
+	// disabled
+	requests = 0
+	cli = WithRetry(testFlakyClient(t, 1, 503, &requests), RetryConfig{Attempts: 1})
+	_, err = cli.Search(ctx, "palomar_post", []byte(`{}`))
+	assert.Error(err)
+	assert.Equal(int64(1), requests)
+}
+
+func TestSearchRetryConnectionError(t *testing.T) {
+	assert := assert.New(t)
+
+	// server which is immediately shut down, so connections are refused
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	escli, err := es.NewClient(es.Config{
+		Addresses:    []string{srv.URL},
+		DisableRetry: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = (&OpenSearchClient{Client: escli}).Search(context.Background(), "palomar_post", []byte(`{}`))
+	assert.True(isRetryableError(err), err)
+	assert.False(isRetryableError(context.DeadlineExceeded))
+	assert.False(isRetryableError(&BackendError{Kind: "search", StatusCode: 400}))
+}
@@ -2,12 +2,17 @@ package search
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
 
@@ -32,15 +37,62 @@ type ServerConfig struct {
 	ProfileIndex      string
 	PostIndex         string
 	AtlantisAddresses []string
+	// Deadline for each search request to the search cluster. Defaults to 10 seconds.
+	QueryTimeout time.Duration
+	// Maximum page size for search requests; larger requested limits are clamped. Defaults to 100.
+	MaxLimit int
+	// Maximum offset (integer cursor) for search requests. Defaults to 10,000, which is the default "index.max_result_window" of the search cluster; going higher requires raising that index setting as well.
+	MaxOffset int
+	// Maximum number of results for any single search, over all pages. Cursors are not returned past this, and hits are only counted up to it, which saves search cluster work. Must not be more than MaxOffset. Defaults to zero (no cap, besides MaxOffset for offset pagination).
+	MaxResults int
+	// Maximum attempts for each request to the search cluster, including retries after transient errors (see WithRetry). Defaults to 3; set to 1 to disable retries.
+	QueryAttempts int
+	// Search cluster requests taking at least this long are logged, with the full query (see WithSlowQueryLog). Defaults to 1 second; negative disables the slow query log.
+	SlowQueryThreshold time.Duration
+	// Which search cluster software queries are sent to: "opensearch" (default) or "elasticsearch"
+	SearchBackend string
+	// Bearer token required for internal endpoints ("/search/posts/lookup" and "/search/posts/raw"). Those endpoints are disabled if this is empty.
+	AdminToken string
+	// Secret key for signing pagination cursors (see cursor.go). If set, unsigned or tampered cursors are rejected. If empty, plain cursors are used.
+	CursorSigningKey string
+	// Whether profile searches down-weight keyword-stuffed display names by default (see ActorSearchParams.SpamPenalty). Can be overridden per-request.
+	ProfileSpamPenalty bool
+	// Tenant ID, for multi-tenant deployments. If set, PostIndex and ProfileIndex must be templated with TenantPlaceholder (see TenantIndexNames), and all queries are scoped to this tenant's indices.
+	Tenant string
+	// Sustained rate of search requests allowed per client, per second. Zero (the default) disables rate limiting. See rateLimitMiddleware.
+	RateLimit float64
+	// Number of requests a client can make in a burst, above the sustained rate. Defaults to the rate.
+	RateLimitBurst int
+	// Request header which identifies clients for rate limiting (eg, an API key), when present with one of RateLimitKeys. Clients are otherwise identified by IP.
+	RateLimitKeyHeader string
+	// Valid values of RateLimitKeyHeader; required if it is set
+	RateLimitKeys []string
+	// Network ranges (CIDRs) of proxies in front of the API, which are trusted to set "X-Forwarded-For". If empty, the client IP is the address of the direct connection.
+	TrustedProxies []string
+	// Secret which exempts requests from rate limits, when passed in the RatelimitBypassHeader
+	RatelimitBypass string
 }
 
 type Server struct {
 	escli        *es.Client
+	searchcli    SearchClient
+	tenant       string
 	postIndex    string
 	profileIndex string
 	dir          identity.Directory
 	echo         *echo.Echo
+	echoLk       sync.Mutex
 	logger       *slog.Logger
+	queryTimeout time.Duration
+	maxLimit     int
+	maxOffset    int
+	maxResults   int
+	adminToken   string
+	cursorKey    []byte
+
+	profileSpamPenalty bool
+	rateLimit          echo.MiddlewareFunc
+	ipExtractor        echo.IPExtractor
 
 	Indexer *Indexer
 }
@@ -53,60 +105,84 @@ func NewServer(escli *es.Client, dir identity.Directory, config ServerConfig) (*
 		}))
 	}
 
+	postIndex, profileIndex, err := TenantIndexNames(config.Tenant, config.PostIndex, config.ProfileIndex)
+	if err != nil {
+		return nil, err
+	}
+	if postIndex != "" {
+		if err := ValidatePostIndex(postIndex); err != nil {
+			return nil, err
+		}
+	}
+	if config.Tenant != "" {
+		logger = logger.With("tenant", config.Tenant)
+	}
+
+	queryTimeout := config.QueryTimeout
+	if queryTimeout == 0 {
+		queryTimeout = 10 * time.Second
+	}
+	maxLimit := config.MaxLimit
+	if maxLimit <= 0 {
+		maxLimit = 100
+	}
+	maxOffset := config.MaxOffset
+	if maxOffset <= 0 {
+		maxOffset = 10000
+	}
+	if config.MaxResults < 0 || config.MaxResults > maxOffset {
+		return nil, fmt.Errorf("max results (%d) must be between zero and the max offset (%d)", config.MaxResults, maxOffset)
+	}
+	queryAttempts := config.QueryAttempts
+	if queryAttempts <= 0 {
+		queryAttempts = 3
+	}
+	searchcli, err := NewSearchClient(escli, config.SearchBackend)
+	if err != nil {
+		return nil, err
+	}
+	searchcli = WithRetry(searchcli, RetryConfig{Attempts: queryAttempts})
+	slowQueryThreshold := config.SlowQueryThreshold
+	if slowQueryThreshold == 0 {
+		slowQueryThreshold = time.Second
+	}
+	// wraps the retrying client, so that time spent on retries counts
+	searchcli = WithSlowQueryLog(searchcli, slowQueryThreshold, logger)
+	ipExtractor, err := clientIPExtractor(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	if config.RateLimitKeyHeader != "" && len(config.RateLimitKeys) == 0 {
+		return nil, fmt.Errorf("rate limit key header configured without any rate limit keys")
+	}
+
 	serv := Server{
 		escli:        escli,
-		postIndex:    config.PostIndex,
-		profileIndex: config.ProfileIndex,
+		searchcli:    searchcli,
+		tenant:       config.Tenant,
+		postIndex:    postIndex,
+		profileIndex: profileIndex,
 		dir:          dir,
 		logger:       logger,
+		queryTimeout: queryTimeout,
+		maxLimit:     maxLimit,
+		maxOffset:    maxOffset,
+		maxResults:   config.MaxResults,
+		adminToken:   config.AdminToken,
+
+		profileSpamPenalty: config.ProfileSpamPenalty,
+		rateLimit:          rateLimitMiddleware(config.RateLimit, config.RateLimitBurst, config.RateLimitKeyHeader, config.RateLimitKeys, config.RatelimitBypass),
+		ipExtractor:        ipExtractor,
+	}
+	if config.CursorSigningKey != "" {
+		serv.cursorKey = []byte(config.CursorSigningKey)
 	}
 
 	return &serv, nil
 }
 
 func (s *Server) EnsureIndices(ctx context.Context) error {
-
-	indices := []struct {
-		Name       string
-		SchemaJSON string
-	}{
-		{Name: s.postIndex, SchemaJSON: palomarPostSchemaJSON},
-		{Name: s.profileIndex, SchemaJSON: palomarProfileSchemaJSON},
-	}
-	for _, idx := range indices {
-		resp, err := s.escli.Indices.Exists([]string{idx.Name})
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-		io.ReadAll(resp.Body)
-		if resp.IsError() && resp.StatusCode != 404 {
-			return fmt.Errorf("failed to check index existence")
-		}
-		if resp.StatusCode == 404 {
-			s.logger.Warn("creating opensearch index", "index", idx.Name)
-			if len(idx.SchemaJSON) < 2 {
-				return fmt.Errorf("empty schema file (go:embed failed)")
-			}
-			buf := strings.NewReader(idx.SchemaJSON)
-			resp, err := s.escli.Indices.Create(
-				idx.Name,
-				s.escli.Indices.Create.WithBody(buf))
-			if err != nil {
-				return err
-			}
-			defer resp.Body.Close()
-			errBytes, err := io.ReadAll(resp.Body)
-			if resp.IsError() {
-				s.logger.Error("failed to create index", "index", idx.Name, "response", string(errBytes))
-				return fmt.Errorf("failed to create index")
-			}
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
+	return EnsureIndices(ctx, s.escli, s.postIndex, s.profileIndex)
 }
 
 type HealthStatus struct {
@@ -126,36 +202,154 @@ func (a *Server) handleHealthCheck(c echo.Context) error {
 	return c.JSON(200, HealthStatus{Status: "ok", Version: versioninfo.Short()})
 }
 
+type ReadyStatus struct {
+	Status        string          `json:"status"`
+	ClusterStatus string          `json:"clusterStatus,omitempty"`
+	Tenant        string          `json:"tenant,omitempty"`
+	Indices       map[string]bool `json:"indices"`
+	Message       string          `json:"msg,omitempty"`
+}
+
+// Readiness probe: the search cluster is reachable and healthy (yellow or green), and both indices exist. For time-sharded post indices, at least one must exist
+func (s *Server) handleReadyz(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 3*time.Second)
+	defer cancel()
+
+	status := ReadyStatus{
+		Status: "ok",
+		Tenant: s.tenant,
+		Indices: map[string]bool{
+			allPostIndices(s.postIndex): false,
+			s.profileIndex:              false,
+		},
+	}
+
+	resp, err := s.escli.Cluster.Health(s.escli.Cluster.Health.WithContext(ctx))
+	if err != nil {
+		s.logger.Warn("readiness check failed to fetch cluster health", "err", err)
+		status.Status = "error"
+		status.Message = "can't reach search cluster"
+		return c.JSON(503, status)
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		status.Status = "error"
+		status.Message = fmt.Sprintf("cluster health request failed: %s", resp.Status())
+		return c.JSON(503, status)
+	}
+	var health struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		status.Status = "error"
+		status.Message = "failed to decode cluster health"
+		return c.JSON(503, status)
+	}
+	status.ClusterStatus = health.Status
+
+	for idx := range status.Indices {
+		resp, err := s.escli.Indices.Exists([]string{idx}, s.escli.Indices.Exists.WithContext(ctx))
+		if err != nil {
+			s.logger.Warn("readiness check failed to check index", "index", idx, "err", err)
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		status.Indices[idx] = resp.StatusCode == 200
+	}
+
+	if health.Status != "green" && health.Status != "yellow" {
+		status.Status = "error"
+		status.Message = "search cluster is not healthy"
+		return c.JSON(503, status)
+	}
+	for idx, ok := range status.Indices {
+		if !ok {
+			status.Status = "error"
+			status.Message = fmt.Sprintf("missing index: %s", idx)
+			return c.JSON(503, status)
+		}
+	}
+	return c.JSON(200, status)
+}
+
 func (s *Server) RunAPI(listen string) error {
 
 	s.logger.Info("Configuring HTTP server")
 	e := echo.New()
 	e.HideBanner = true
+	e.IPExtractor = s.ipExtractor
 	e.Use(slogecho.New(s.logger))
 	e.Use(middleware.Recover())
 	e.Use(MetricsMiddleware)
 	e.Use(middleware.BodyLimit("64M"))
 	e.Use(otelecho.Middleware("palomar"))
 
-	e.HTTPErrorHandler = func(err error, ctx echo.Context) {
-		code := 500
-		if he, ok := err.(*echo.HTTPError); ok {
-			code = he.Code
-		}
-		s.logger.Warn("HTTP request error", "statusCode", code, "path", ctx.Path(), "err", err)
-		ctx.Response().WriteHeader(code)
-	}
+	e.HTTPErrorHandler = s.errorHandler
 
 	e.Use(middleware.CORS())
 	e.GET("/", s.handleHealthCheck)
 	e.GET("/_health", s.handleHealthCheck)
+	e.GET("/healthz", s.handleHealthCheck)
+	e.GET("/readyz", s.handleReadyz)
 	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
-	e.GET("/xrpc/app.bsky.unspecced.searchPostsSkeleton", s.handleSearchPostsSkeleton)
-	e.GET("/xrpc/app.bsky.unspecced.searchActorsSkeleton", s.handleSearchActorsSkeleton)
+	// health and metrics endpoints are not rate limited
+	var limit []echo.MiddlewareFunc
+	if s.rateLimit != nil {
+		limit = append(limit, s.rateLimit)
+	}
+	e.GET("/xrpc/app.bsky.unspecced.searchPostsSkeleton", s.handleSearchPostsSkeleton, limit...)
+	e.GET("/xrpc/app.bsky.unspecced.searchActorsSkeleton", s.handleSearchActorsSkeleton, limit...)
+	e.GET("/search/posts/detailed", s.handleSearchPostsDetailed, limit...)
+	e.GET("/search/posts/count", s.handleSearchPostsCount, limit...)
+	e.GET("/search/actors", s.handleSearchActorsStructured, limit...)
+	if s.adminToken != "" {
+		// returns the full indexed document, including fields which aren't otherwise exposed (eg, for deleted or taken-down posts)
+		e.GET("/search/posts/lookup", s.handleLookupPost, s.adminAuth)
+		e.POST("/search/posts/raw", s.handleSearchPostsRaw, s.adminAuth)
+	}
+	s.echoLk.Lock()
 	s.echo = e
+	s.echoLk.Unlock()
 
 	s.logger.Info("starting search API daemon", "bind", listen)
-	return s.echo.Start(listen)
+	if err := e.Start(listen); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// errorHandler renders all errors returned by handlers (and by echo itself) as an ErrorResponse
+func (s *Server) errorHandler(err error, ctx echo.Context) {
+	code, resp := errorResponse(err)
+	// rate limited requests are counted by a metric instead; logging them would be too noisy during abuse
+	if code != http.StatusTooManyRequests {
+		s.logger.Warn("HTTP request error", "statusCode", code, "path", ctx.Path(), "err", err)
+	}
+	if ctx.Response().Committed {
+		return
+	}
+	if ctx.Request().Method == http.MethodHead {
+		ctx.NoContent(code)
+		return
+	}
+	ctx.JSON(code, resp)
+}
+
+// isAdmin returns true if the request includes the admin token as a bearer token
+func (s *Server) isAdmin(c echo.Context) bool {
+	tok, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+	return ok && s.adminToken != "" && subtle.ConstantTimeCompare([]byte(tok), []byte(s.adminToken)) == 1
+}
+
+// middleware which requires the admin token as a bearer token
+func (s *Server) adminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !s.isAdmin(c) {
+			return apiError(http.StatusUnauthorized, ErrorAuthRequired, "admin auth required")
+		}
+		return next(c)
+	}
 }
 
 func (s *Server) RunMetrics(listen string) error {
@@ -163,6 +357,13 @@ func (s *Server) RunMetrics(listen string) error {
 	return http.ListenAndServe(listen, nil)
 }
 
+// Shutdown gracefully stops the search API: the listener is closed, and in-flight requests are allowed to complete until the context is done.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.echo.Shutdown(ctx)
+	s.echoLk.Lock()
+	e := s.echo
+	s.echoLk.Unlock()
+	if e == nil {
+		return nil
+	}
+	return e.Shutdown(ctx)
 }
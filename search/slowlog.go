@@ -0,0 +1,67 @@
+package search
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithSlowQueryLog wraps a SearchClient so that requests which take at least 'threshold' are logged (at WARN level) with the full query body, hit count, and the trace and span IDs of the request context, for correlation with OTEL traces.
+//
+// A request counts as slow if either the search cluster's own "took" time, or the wall time measured by the client (including network, queueing, and any retries by inner clients), exceeds the threshold. A threshold of zero or less disables logging.
+func WithSlowQueryLog(cli SearchClient, threshold time.Duration, logger *slog.Logger) SearchClient {
+	if threshold <= 0 {
+		return cli
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slowQueryClient{inner: cli, threshold: threshold, logger: logger}
+}
+
+type slowQueryClient struct {
+	inner     SearchClient
+	threshold time.Duration
+	logger    *slog.Logger
+}
+
+func (c *slowQueryClient) Search(ctx context.Context, index string, body []byte) (*EsSearchResponse, error) {
+	start := time.Now()
+	out, err := c.inner.Search(ctx, index, body)
+	elapsed := time.Since(start)
+	if out != nil {
+		took := time.Duration(out.Took) * time.Millisecond
+		if elapsed >= c.threshold || took >= c.threshold {
+			c.log(ctx, "search", index, body, elapsed, "took", took, "hits", out.Hits.Total.Value, "hits_relation", out.Hits.Total.Relation, "timed_out", out.TimedOut)
+		}
+	} else if elapsed >= c.threshold {
+		c.log(ctx, "search", index, body, elapsed, "err", err)
+	}
+	return out, err
+}
+
+func (c *slowQueryClient) Count(ctx context.Context, index string, body []byte) (*EsCountResponse, error) {
+	start := time.Now()
+	out, err := c.inner.Count(ctx, index, body)
+	elapsed := time.Since(start)
+	// count responses don't include a "took" time
+	if elapsed >= c.threshold {
+		if out != nil {
+			c.log(ctx, "count", index, body, elapsed, "hits", out.Count)
+		} else {
+			c.log(ctx, "count", index, body, elapsed, "err", err)
+		}
+	}
+	return out, err
+}
+
+func (c *slowQueryClient) log(ctx context.Context, kind, index string, body []byte, elapsed time.Duration, args ...any) {
+	args = append([]any{"kind", kind, "index", index, "duration", elapsed, "query", string(body)}, args...)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		args = append(args, "trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+	}
+	slowQueries.WithLabelValues(kind).Inc()
+	c.logger.Warn("slow search query", args...)
+}
@@ -0,0 +1,64 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SearchClient which responds instantly, with a fixed "took" time
+type testTookClient struct {
+	took int
+}
+
+func (c *testTookClient) Search(ctx context.Context, index string, body []byte) (*EsSearchResponse, error) {
+	return &EsSearchResponse{Took: c.took, Hits: EsSearchHits{Total: EsTotalHits{Value: 7, Relation: "eq"}}}, nil
+}
+
+func (c *testTookClient) Count(ctx context.Context, index string, body []byte) (*EsCountResponse, error) {
+	return &EsCountResponse{Count: 7}, nil
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x01, 0x02, 0x03},
+		SpanID:  trace.SpanID{0x04, 0x05},
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	// fast queries aren't logged
+	cli := WithSlowQueryLog(&testTookClient{took: 3}, time.Second, logger)
+	_, err := cli.Search(ctx, "palomar_post", []byte(`{"query": "fast"}`))
+	assert.NoError(err)
+	_, err = cli.Count(ctx, "palomar_post", []byte(`{"query": "fast"}`))
+	assert.NoError(err)
+	assert.Empty(buf.String())
+
+	// slow according to the search cluster
+	cli = WithSlowQueryLog(&testTookClient{took: 1500}, time.Second, logger)
+	_, err = cli.Search(ctx, "palomar_post", []byte(`{"query": "slow"}`))
+	assert.NoError(err)
+	line := buf.String()
+	assert.Contains(line, "slow search query")
+	assert.Contains(line, `query="{\"query\": \"slow\"}"`)
+	assert.Contains(line, "took=1.5s")
+	assert.Contains(line, "hits=7")
+	assert.Contains(line, "trace_id="+sc.TraceID().String())
+	assert.Contains(line, "span_id="+sc.SpanID().String())
+
+	// disabled
+	buf.Reset()
+	cli = WithSlowQueryLog(&testTookClient{took: 1500}, -1, logger)
+	_, err = cli.Search(ctx, "palomar_post", []byte(`{}`))
+	assert.NoError(err)
+	assert.Empty(buf.String())
+}
@@ -0,0 +1,60 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Placeholder in index name config which is replaced with the tenant ID, for deployments serving several tenants (eg, labelers or appviews) from one search cluster. For example, "palomar_{tenant}_post".
+const TenantPlaceholder = "{tenant}"
+
+// Tenant IDs are restricted to lowercase letters and digits, so that they are valid in index names, and so that one tenant's index names (or wildcard patterns, for time-sharded indices) can never match another tenant's
+var tenantRegex = regexp.MustCompile(`^[a-z0-9]{1,32}$`)
+
+// TenantIndexNames validates the tenant configuration, and returns the post and profile index names with the tenant substituted.
+//
+// If tenant is empty, the index names must not contain the placeholder, and are returned as-is (a single-tenant deployment). If tenant is set, every index name (including each entry in a post index list) must contain the placeholder exactly once, delimited from the rest of the name, so that all queries are scoped to the tenant's indices. Explicit wildcards are not allowed with a tenant.
+func TenantIndexNames(tenant, postIndex, profileIndex string) (string, string, error) {
+	if tenant == "" {
+		for _, name := range []string{postIndex, profileIndex} {
+			if strings.Contains(name, TenantPlaceholder) {
+				return "", "", fmt.Errorf("index name %q is templated by tenant, but no tenant configured", name)
+			}
+		}
+		return postIndex, profileIndex, nil
+	}
+	if !tenantRegex.MatchString(tenant) {
+		return "", "", fmt.Errorf("invalid tenant (must be 1 to 32 lowercase letters and digits): %q", tenant)
+	}
+	for _, index := range []string{postIndex, profileIndex} {
+		for _, name := range strings.Split(index, ",") {
+			if err := checkTenantIndexTemplate(strings.TrimSpace(name)); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	return strings.ReplaceAll(postIndex, TenantPlaceholder, tenant), strings.ReplaceAll(profileIndex, TenantPlaceholder, tenant), nil
+}
+
+// checks a single index name template, for a multi-tenant deployment
+func checkTenantIndexTemplate(name string) error {
+	if strings.Count(name, TenantPlaceholder) != 1 {
+		return fmt.Errorf("index name %q must contain %s exactly once when a tenant is configured", name, TenantPlaceholder)
+	}
+	if strings.Contains(name, "*") {
+		return fmt.Errorf("index name %q can not contain wildcards when a tenant is configured", name)
+	}
+	// the tenant must be delimited, otherwise a pattern for tenant "a" (eg, "idx_a*", from "idx_{tenant}{month}") could match indices of tenant "ab"
+	i := strings.Index(name, TenantPlaceholder)
+	before, after := name[:i], name[i+len(TenantPlaceholder):]
+	if (before != "" && !isTenantDelimiter(before[len(before)-1])) || (after != "" && !isTenantDelimiter(after[0])) {
+		return fmt.Errorf("%s in index name %q must be delimited (eg, with '_') from the rest of the name", TenantPlaceholder, name)
+	}
+	return nil
+}
+
+// Returns false for characters which could be part of a tenant ID, or the start or end of another placeholder
+func isTenantDelimiter(c byte) bool {
+	return !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '{' || c == '}')
+}
@@ -0,0 +1,79 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantIndexNames(t *testing.T) {
+	assert := assert.New(t)
+
+	// single-tenant
+	post, profile, err := TenantIndexNames("", "palomar_post", "palomar_profile")
+	assert.NoError(err)
+	assert.Equal("palomar_post", post)
+	assert.Equal("palomar_profile", profile)
+
+	post, profile, err = TenantIndexNames("acme", "palomar_{tenant}_post_{month}", "palomar_{tenant}_profile")
+	assert.NoError(err)
+	assert.Equal("palomar_acme_post_{month}", post)
+	assert.Equal("palomar_acme_profile", profile)
+
+	post, _, err = TenantIndexNames("acme", "{tenant}-old,{tenant}-post-{month}", "{tenant}-profile")
+	assert.NoError(err)
+	assert.Equal("acme-old,acme-post-{month}", post)
+
+	bad := []struct {
+		tenant  string
+		post    string
+		profile string
+	}{
+		// templated, but no tenant
+		{tenant: "", post: "palomar_{tenant}_post", profile: "palomar_profile"},
+		// tenant, but not templated (would share indices)
+		{tenant: "acme", post: "palomar_post", profile: "palomar_{tenant}_profile"},
+		{tenant: "acme", post: "palomar_{tenant}_post,palomar_post", profile: "palomar_{tenant}_profile"},
+		// invalid tenants
+		{tenant: "*", post: "palomar_{tenant}_post", profile: "palomar_{tenant}_profile"},
+		{tenant: "ACME", post: "palomar_{tenant}_post", profile: "palomar_{tenant}_profile"},
+		{tenant: "a_b", post: "palomar_{tenant}_post", profile: "palomar_{tenant}_profile"},
+		{tenant: "a,b", post: "palomar_{tenant}_post", profile: "palomar_{tenant}_profile"},
+		// wildcards, or ambiguous tenant boundaries
+		{tenant: "acme", post: "palomar_{tenant}_*", profile: "palomar_{tenant}_profile"},
+		{tenant: "acme", post: "palomar_{tenant}{month}", profile: "palomar_{tenant}_profile"},
+		{tenant: "acme", post: "palomar{tenant}_post", profile: "palomar_{tenant}_profile"},
+		{tenant: "acme", post: "palomar_{tenant}_{tenant}", profile: "palomar_{tenant}_profile"},
+	}
+	for _, b := range bad {
+		_, _, err := TenantIndexNames(b.tenant, b.post, b.profile)
+		assert.Error(err, b)
+	}
+}
+
+func TestTenantServer(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	dir := identity.NewMockDirectory()
+
+	_, err := NewServer(testBlockingClient(t), &dir, ServerConfig{PostIndex: "palomar_{tenant}_post", ProfileIndex: "palomar_{tenant}_profile"})
+	assert.Error(err)
+
+	s, err := NewServer(testBlockingClient(t), &dir, ServerConfig{PostIndex: "palomar_{tenant}_post", ProfileIndex: "palomar_{tenant}_profile", Tenant: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := &testRecordingClient{}
+	s.searchcli = cli
+
+	_, err = s.SearchPosts(ctx, &PostSearchParams{Query: "hello", Size: 10})
+	assert.NoError(err)
+	assert.Equal("palomar_acme_post", cli.index)
+
+	_, err = s.StructuredSearchProfiles(ctx, &ActorSearchParams{Query: "hello", Size: 10})
+	assert.NoError(err)
+	assert.Equal("palomar_acme_profile", cli.index)
+}
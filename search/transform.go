@@ -1,7 +1,10 @@
 package search
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"log/slog"
+	"math"
 	"net/url"
 	"strings"
 	"time"
@@ -13,6 +16,29 @@ import (
 	"github.com/rivo/uniseg"
 )
 
+// Account labels which are indexed in to profile docs, and can be used with the actor search label filters. This set is deliberately small: labels not in it are dropped when loading, and rejected as filter values.
+var IndexedAccountLabels = []string{
+	"!hide",
+	"!warn",
+	"porn",
+	"sexual",
+	"nudity",
+	"graphic-media",
+	"spam",
+	"impersonation",
+	"verified",
+}
+
+// Returns true if the label value is one of IndexedAccountLabels
+func isIndexedAccountLabel(val string) bool {
+	for _, l := range IndexedAccountLabels {
+		if val == l {
+			return true
+		}
+	}
+	return false
+}
+
 type ProfileDoc struct {
 	DocIndexTs  string   `json:"doc_index_ts"`
 	DID         string   `json:"did"`
@@ -28,29 +54,50 @@ type ProfileDoc struct {
 	Emoji       []string `json:"emoji,omitempty"`
 	HasAvatar   bool     `json:"has_avatar"`
 	HasBanner   bool     `json:"has_banner"`
+	// 0 to 1, from the display name (see displayNameSpamminess). Used to down-weight keyword-stuffed profiles in search
+	Spamminess float64 `json:"spamminess"`
+	// Counts are not part of the profile record; they are bulk-loaded separately (see BulkIndexProfileCounts)
+	FollowersCount *int64 `json:"followers_count,omitempty"`
+	PostsCount     *int64 `json:"posts_count,omitempty"`
+	// Account-level moderation labels, also bulk-loaded separately (see BulkIndexProfileLabels). Only labels in IndexedAccountLabels are stored
+	Labels []string `json:"labels,omitempty"`
 }
 
 type PostDoc struct {
-	DocIndexTs        string   `json:"doc_index_ts"`
-	DID               string   `json:"did"`
-	RecordRkey        string   `json:"record_rkey"`
-	RecordCID         string   `json:"record_cid"`
-	CreatedAt         *string  `json:"created_at,omitempty"`
-	Text              string   `json:"text"`
-	TextJA            *string  `json:"text_ja,omitempty"`
-	LangCode          []string `json:"lang_code,omitempty"`
-	LangCodeIso2      []string `json:"lang_code_iso2,omitempty"`
+	DocIndexTs   string   `json:"doc_index_ts"`
+	DID          string   `json:"did"`
+	RecordRkey   string   `json:"record_rkey"`
+	RecordCID    string   `json:"record_cid"`
+	CreatedAt    *string  `json:"created_at,omitempty"`
+	Text         string   `json:"text"`
+	TextJA       *string  `json:"text_ja,omitempty"`
+	TextHash     string   `json:"text_hash"`
+	LangCode     []string `json:"lang_code,omitempty"`
+	LangCodeIso2 []string `json:"lang_code_iso2,omitempty"`
+	// true if the post record didn't declare any languages, and the language codes were detected from the text at index time
+	LangDetected      bool     `json:"lang_detected,omitempty"`
 	MentionDID        []string `json:"mention_did,omitempty"`
 	EmbedATURI        *string  `json:"embed_aturi,omitempty"`
 	ReplyRootATURI    *string  `json:"reply_root_aturi,omitempty"`
+	ReplyParentATURI  *string  `json:"reply_parent_aturi,omitempty"`
 	EmbedImgCount     int      `json:"embed_img_count"`
 	EmbedImgAltText   []string `json:"embed_img_alt_text,omitempty"`
 	EmbedImgAltTextJA []string `json:"embed_img_alt_text_ja,omitempty"`
-	SelfLabel         []string `json:"self_label,omitempty"`
-	URL               []string `json:"url,omitempty"`
-	Domain            []string `json:"domain,omitempty"`
-	Tag               []string `json:"tag,omitempty"`
-	Emoji             []string `json:"emoji,omitempty"`
+	// type of the top-level embed, if any (see PostEmbedTypes)
+	EmbedType string `json:"embed_type,omitempty"`
+	HasImage  bool   `json:"has_image"`
+	HasVideo  bool   `json:"has_video"`
+	// true if the post has a link facet or external (link card) embed
+	HasLink bool `json:"has_link"`
+	// true if the post embeds another post (with or without media)
+	IsQuote bool `json:"is_quote"`
+	// text of the quoted post, if any, and if the indexer is configured to include it (see IndexerConfig.IndexQuotedText). Only available if the quoted post was already indexed
+	QuotedText *string  `json:"quoted_text,omitempty"`
+	SelfLabel  []string `json:"self_label,omitempty"`
+	URL        []string `json:"url,omitempty"`
+	Domain     []string `json:"domain,omitempty"`
+	Tag        []string `json:"tag,omitempty"`
+	Emoji      []string `json:"emoji,omitempty"`
 }
 
 // Returns the search index document ID (`_id`) for this document.
@@ -86,6 +133,10 @@ func TransformProfile(profile *appbsky.ActorProfile, ident *identity.Identity, c
 	if !ident.Handle.IsInvalidHandle() {
 		handle = ident.Handle.String()
 	}
+	var spamminess float64
+	if profile.DisplayName != nil {
+		spamminess = displayNameSpamminess(*profile.DisplayName)
+	}
 	return ProfileDoc{
 		DocIndexTs:  syntax.DatetimeNow().String(),
 		DID:         ident.DID.String(),
@@ -99,6 +150,7 @@ func TransformProfile(profile *appbsky.ActorProfile, ident *identity.Identity, c
 		Emoji:       emojis,
 		HasAvatar:   profile.Avatar != nil,
 		HasBanner:   profile.Banner != nil,
+		Spamminess:  spamminess,
 	}
 }
 
@@ -119,6 +171,16 @@ func TransformPost(post *appbsky.FeedPost, did syntax.DID, rkey, cid string) Pos
 			langCodeIso2 = append(langCodeIso2, strings.ToLower(prefix))
 		}
 	}
+	// declared langs are authoritative; only fall back to detection if there are none
+	langCode := post.Langs
+	var langDetected bool
+	if len(post.Langs) == 0 {
+		if lang := detectLanguage(post.Text); lang != "" {
+			langCode = []string{lang}
+			langCodeIso2 = []string{lang}
+			langDetected = true
+		}
+	}
 	var mentionDIDs []string
 	var urls []string
 	for _, facet := range post.Facets {
@@ -131,9 +193,14 @@ func TransformPost(post *appbsky.FeedPost, did syntax.DID, rkey, cid string) Pos
 			}
 		}
 	}
-	var replyRootATURI *string
+	var replyRootATURI, replyParentATURI *string
 	if post.Reply != nil {
-		replyRootATURI = &(post.Reply.Root.Uri)
+		if post.Reply.Root != nil {
+			replyRootATURI = &(post.Reply.Root.Uri)
+		}
+		if post.Reply.Parent != nil {
+			replyParentATURI = &(post.Reply.Parent.Uri)
+		}
 	}
 	if post.Embed != nil && post.Embed.EmbedExternal != nil {
 		urls = append(urls, post.Embed.EmbedExternal.External.Uri)
@@ -176,6 +243,23 @@ func TransformPost(post *appbsky.FeedPost, did syntax.DID, rkey, cid string) Pos
 		}
 	}
 
+	var hasVideo, hasLink bool
+	if post.Embed != nil {
+		hasVideo = post.Embed.EmbedVideo != nil
+		if rwm := post.Embed.EmbedRecordWithMedia; rwm != nil && rwm.Media != nil {
+			hasVideo = hasVideo || rwm.Media.EmbedVideo != nil
+			hasLink = rwm.Media.EmbedExternal != nil
+		}
+	}
+	hasLink = hasLink || len(urls) > 0
+	// embedded records can also be feed generators, lists, etc
+	isQuote := false
+	if embedATURI != nil {
+		if aturi, err := syntax.ParseATURI(*embedATURI); err == nil {
+			isQuote = aturi.Collection() == syntax.NSID("app.bsky.feed.post")
+		}
+	}
+
 	var selfLabels []string
 	if post.Labels != nil && post.Labels.LabelDefs_SelfLabels != nil {
 		for _, le := range post.Labels.LabelDefs_SelfLabels.Values {
@@ -199,14 +283,21 @@ func TransformPost(post *appbsky.FeedPost, did syntax.DID, rkey, cid string) Pos
 		RecordRkey:        rkey,
 		RecordCID:         cid,
 		Text:              post.Text,
-		LangCode:          post.Langs,
+		LangCode:          langCode,
 		LangCodeIso2:      langCodeIso2,
+		LangDetected:      langDetected,
 		MentionDID:        mentionDIDs,
 		EmbedATURI:        embedATURI,
 		ReplyRootATURI:    replyRootATURI,
+		ReplyParentATURI:  replyParentATURI,
 		EmbedImgCount:     embedImgCount,
 		EmbedImgAltText:   embedImgAltText,
 		EmbedImgAltTextJA: embedImgAltTextJA,
+		EmbedType:         postEmbedType(post.Embed),
+		HasImage:          embedImgCount > 0,
+		HasVideo:          hasVideo,
+		HasLink:           hasLink,
+		IsQuote:           isQuote,
 		SelfLabel:         selfLabels,
 		URL:               urls,
 		Domain:            domains,
@@ -218,6 +309,12 @@ func TransformPost(post *appbsky.FeedPost, did syntax.DID, rkey, cid string) Pos
 		doc.TextJA = &post.Text
 	}
 
+	// posts with no text shouldn't all be treated as duplicates of each other
+	doc.TextHash = normalizedTextHash(post.Text)
+	if doc.TextHash == "" {
+		doc.TextHash = doc.DocId()
+	}
+
 	if post.CreatedAt != "" {
 		// there are some old bad timestamps out there!
 		dt, err := syntax.ParseDatetimeLenient(post.CreatedAt)
@@ -237,6 +334,16 @@ func TransformPost(post *appbsky.FeedPost, did syntax.DID, rkey, cid string) Pos
 	return doc
 }
 
+// normalizedTextHash returns a short hash of post text, ignoring case and whitespace differences, for grouping duplicate posts. Returns an empty string if there is no text.
+func normalizedTextHash(text string) string {
+	norm := strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	if norm == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(norm))
+	return hex.EncodeToString(sum[:8])
+}
+
 func dedupeStrings(in []string) []string {
 	var out []string
 	seen := make(map[string]bool)
@@ -294,3 +401,59 @@ func parseEmojis(s string) []string {
 	}
 	return ret
 }
+
+// Thresholds for displayNameSpamminess. Display names at or under these limits score zero
+const (
+	// in graphemes. the lexicon limit is 64
+	spamNameMaxLength = 32
+	spamNameMaxWords  = 6
+)
+
+// displayNameSpamminess scores how much a display name looks keyword-stuffed, from 0 (normal) to 1 (very spammy). It is the largest of three signals, each scaled linearly above a threshold: overall length, number of words, and the fraction of words which are repeats.
+func displayNameSpamminess(name string) float64 {
+	length := uniseg.GraphemeClusterCount(name)
+	words := strings.Fields(strings.ToLower(name))
+
+	score := clampScore(float64(length-spamNameMaxLength) / float64(64-spamNameMaxLength))
+	score = max(score, clampScore(float64(len(words)-spamNameMaxWords)/float64(spamNameMaxWords)))
+	// two-word names with a repeat ("Jo Jo") are common, and ignored
+	if len(words) >= 3 {
+		seen := make(map[string]bool, len(words))
+		repeats := 0
+		for _, w := range words {
+			if seen[w] {
+				repeats++
+			}
+			seen[w] = true
+		}
+		// repeats are weighted double, so a name which is half repeated words scores the max
+		score = max(score, clampScore(2*float64(repeats)/float64(len(words))))
+	}
+	// round, so that small changes don't cause needless re-scoring differences
+	return math.Round(score*100) / 100
+}
+
+func clampScore(v float64) float64 {
+	return math.Min(1, math.Max(0, v))
+}
+
+// Values of the "embed_type" post field, corresponding to the app.bsky.embed.* record types
+var PostEmbedTypes = []string{"images", "video", "external", "record", "record_with_media"}
+
+func postEmbedType(embed *appbsky.FeedPost_Embed) string {
+	switch {
+	case embed == nil:
+		return ""
+	case embed.EmbedImages != nil:
+		return "images"
+	case embed.EmbedVideo != nil:
+		return "video"
+	case embed.EmbedExternal != nil:
+		return "external"
+	case embed.EmbedRecord != nil:
+		return "record"
+	case embed.EmbedRecordWithMedia != nil:
+		return "record_with_media"
+	}
+	return ""
+}
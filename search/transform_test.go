@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"strings"
 	"testing"
 
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
@@ -32,6 +34,33 @@ type profileFixture struct {
 	ProfileDoc    ProfileDoc
 }
 
+func TestDisplayNameSpamminess(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		name  string
+		score float64
+	}{
+		{name: "", score: 0},
+		{name: "Big Bubba", score: 0},
+		{name: "Jo Jo", score: 0},
+		{name: "Dr. Jane Q. Public, PhD 🔬", score: 0},
+		// long (48 and 64 graphemes)
+		{name: strings.Repeat("a", 48), score: 0.5},
+		{name: strings.Repeat("🦋", 64), score: 1},
+		// long, and many words
+		{name: "A Very Long Display Name Which Goes On And Onnnn", score: 0.67},
+		// repeats
+		{name: "crypto nft crypto airdrop", score: 0.5},
+		{name: "FREE free Free followers", score: 1},
+		// many words
+		{name: "a b c d e f g h i", score: 0.5},
+	}
+	for _, fix := range fixtures {
+		assert.Equal(fix.score, displayNameSpamminess(fix.name), fix.name)
+	}
+}
+
 func TestTransformProfileFixtures(t *testing.T) {
 	f, err := os.Open("testdata/transform-profile-fixtures.json")
 	if err != nil {
@@ -113,3 +142,44 @@ func testPostFixture(t *testing.T, row postFixture) {
 	assert.Equal(row.PostDoc, doc)
 	assert.Equal(row.DocId, doc.DocId())
 }
+
+func TestTransformPostEmbedType(t *testing.T) {
+	assert := assert.New(t)
+	did := syntax.DID("did:plc:abc111")
+	quoted := appbsky.EmbedRecord{Record: &comatproto.RepoStrongRef{Uri: "at://did:plc:abc222/app.bsky.feed.post/3k4duaz5vfs2b"}}
+
+	fixtures := []struct {
+		embed     *appbsky.FeedPost_Embed
+		embedType string
+		image     bool
+		video     bool
+		link      bool
+		quote     bool
+	}{
+		{nil, "", false, false, false, false},
+		{&appbsky.FeedPost_Embed{EmbedImages: &appbsky.EmbedImages{Images: []*appbsky.EmbedImages_Image{{Alt: "a cat"}}}}, "images", true, false, false, false},
+		{&appbsky.FeedPost_Embed{EmbedVideo: &appbsky.EmbedVideo{}}, "video", false, true, false, false},
+		{&appbsky.FeedPost_Embed{EmbedExternal: &appbsky.EmbedExternal{External: &appbsky.EmbedExternal_External{Uri: "https://example.com"}}}, "external", false, false, true, false},
+		{&appbsky.FeedPost_Embed{EmbedRecord: &quoted}, "record", false, false, false, true},
+		// feed generators aren't quote posts
+		{&appbsky.FeedPost_Embed{EmbedRecord: &appbsky.EmbedRecord{Record: &comatproto.RepoStrongRef{Uri: "at://did:plc:abc222/app.bsky.feed.generator/cats"}}}, "record", false, false, false, false},
+		{&appbsky.FeedPost_Embed{EmbedRecordWithMedia: &appbsky.EmbedRecordWithMedia{
+			Record: &quoted,
+			Media:  &appbsky.EmbedRecordWithMedia_Media{EmbedImages: &appbsky.EmbedImages{Images: []*appbsky.EmbedImages_Image{{}}}},
+		}}, "record_with_media", true, false, false, true},
+		{&appbsky.FeedPost_Embed{EmbedRecordWithMedia: &appbsky.EmbedRecordWithMedia{
+			Record: &quoted,
+			Media:  &appbsky.EmbedRecordWithMedia_Media{EmbedVideo: &appbsky.EmbedVideo{}},
+		}}, "record_with_media", false, true, false, true},
+	}
+
+	for i, f := range fixtures {
+		post := appbsky.FeedPost{Text: "hello", Embed: f.embed}
+		doc := TransformPost(&post, did, "3k4duaz5vfs2b", "bafyreibjifzpqj6o6wcq3hejh7y4z4z2vmiklkvykc57tw3pcbx3kxifpm")
+		assert.Equal(f.embedType, doc.EmbedType, i)
+		assert.Equal(f.image, doc.HasImage, i)
+		assert.Equal(f.video, doc.HasVideo, i)
+		assert.Equal(f.link, doc.HasLink, i)
+		assert.Equal(f.quote, doc.IsQuote, i)
+	}
+}
@@ -44,10 +44,15 @@ func (l LeveledSlog) Debug(msg string, keysAndValues ...interface{}) {
 // client needs. CLI tools might want shorter timeouts and fewer retries by
 // default.
 func RobustHTTPClient() *http.Client {
+	return RobustHTTPClientWithTransport(cleanhttp.DefaultPooledTransport())
+}
+
+// Same as RobustHTTPClient, but using the provided transport (eg, to share a connection pool between clients, or tune pool limits).
+func RobustHTTPClientWithTransport(transport http.RoundTripper) *http.Client {
 
 	logger := LeveledSlog{inner: slog.Default().With("subsystem", "RobustHTTPClient")}
 	retryClient := retryablehttp.NewClient()
-	retryClient.HTTPClient.Transport = otelhttp.NewTransport(cleanhttp.DefaultPooledTransport())
+	retryClient.HTTPClient.Transport = otelhttp.NewTransport(transport)
 	retryClient.RetryMax = 3
 	retryClient.RetryWaitMin = 1 * time.Second
 	retryClient.RetryWaitMax = 10 * time.Second